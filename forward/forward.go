@@ -0,0 +1,79 @@
+// Package forward opens port forwarding tunnels through AWS Systems Manager
+// sessions, like a single forward of the aws-go-forward command, for
+// programs that embed it instead of running the binary.
+//
+// The session plugin runs in a child copy of the program. Importing the
+// package makes that copy run the plugin and exit before main starts.
+package forward
+
+import (
+	"context"
+
+	"github.com/esoel/aws-go-forward/internal/cli"
+)
+
+func init() {
+	cli.RunPlugin()
+}
+
+// Config selects the instance and the remote endpoint of a tunnel.
+type Config struct {
+	// Profile names the shared AWS config profile to use. It is required.
+	Profile string
+	// Region overrides the profile's region.
+	Region string
+	// InstanceID or InstanceName, which matches the Name tag, selects the
+	// instance the session goes through.
+	InstanceID   string
+	InstanceName string
+	// RemoteHost and RemotePort are the endpoint reached from the instance.
+	RemoteHost string
+	RemotePort int
+	// LocalPort is the loopback port the tunnel listens on. Zero lets the
+	// operating system pick one.
+	LocalPort int
+}
+
+func (c Config) cliConfig() cli.Config {
+	return cli.Config{
+		Profile:      c.Profile,
+		Region:       c.Region,
+		InstanceID:   c.InstanceID,
+		InstanceName: c.InstanceName,
+		RemoteHost:   c.RemoteHost,
+		RemotePort:   c.RemotePort,
+		LocalPort:    c.LocalPort,
+	}
+}
+
+// Forwarder starts tunnels. The zero value is ready to use.
+type Forwarder struct{}
+
+// Handle is a tunnel started by Forwarder.Start.
+type Handle struct {
+	// LocalPort is the port the tunnel listens on.
+	LocalPort int
+	// InstanceID is the instance the tunnel goes through.
+	InstanceID string
+
+	tunnel *cli.Tunnel
+}
+
+// Start resolves the instance cfg selects, starts a port forwarding
+// session and runs the session plugin. It returns once the local port
+// accepts connections. Cancelling ctx aborts the start, and afterwards
+// closes the tunnel like Close.
+func (f *Forwarder) Start(ctx context.Context, cfg Config) (*Handle, error) {
+	tunnel, err := cli.Start(ctx, cfg.cliConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{LocalPort: tunnel.LocalPort, InstanceID: tunnel.InstanceID, tunnel: tunnel}, nil
+}
+
+// Close terminates the session and waits for the session plugin to exit.
+// It returns the error the tunnel failed with, if any, so closing a
+// healthy tunnel returns nil.
+func (h *Handle) Close() error {
+	return h.tunnel.Close()
+}
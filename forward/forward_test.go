@@ -0,0 +1,36 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/esoel/aws-go-forward/internal/cli"
+)
+
+func TestConfigCLIConfig(t *testing.T) {
+	t.Parallel()
+
+	got := Config{
+		Profile: "prod", Region: "us-east-1", InstanceID: "i-0123", InstanceName: "bastion",
+		RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 15432,
+	}.cliConfig()
+	want := cli.Config{
+		Profile: "prod", Region: "us-east-1", InstanceID: "i-0123", InstanceName: "bastion",
+		RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 15432,
+	}
+	if got.Profile != want.Profile || got.Region != want.Region || got.InstanceID != want.InstanceID || got.InstanceName != want.InstanceName ||
+		got.RemoteHost != want.RemoteHost || got.RemotePort != want.RemotePort || got.LocalPort != want.LocalPort {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestForwarderStartValidates(t *testing.T) {
+	t.Parallel()
+
+	var f Forwarder
+	_, err := f.Start(context.Background(), Config{Profile: "default", InstanceName: "bastion", LocalPort: 5432, RemotePort: 5432})
+	if !errors.Is(err, cli.ErrMissingRemoteHost) {
+		t.Errorf("expected %v, got %v", cli.ErrMissingRemoteHost, err)
+	}
+}
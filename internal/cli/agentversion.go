@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// minimumAgentVersion is the oldest SSM agent that forwards to a remote
+// host, which AWS-StartPortForwardingSessionToRemoteHost needs.
+const minimumAgentVersion = "3.1.1374.0"
+
+var (
+	ErrAgentVersionMismatch = errors.New("session plugin and SSM agent could not agree on a protocol")
+	ErrOutdatedAgent        = errors.New("outdated SSM agent")
+)
+
+// versionMismatchMarkers are what the session plugin prints when the agent
+// asks for a handshake action or session type it does not know, or never
+// completes the handshake.
+var versionMismatchMarkers = []string{
+	"unsupported action",
+	"unknown session type",
+	"unable to determine sessiontype",
+	"does not support session manager",
+	"handshake",
+}
+
+func isVersionMismatch(output string) bool {
+	output = strings.ToLower(output)
+	for _, marker := range versionMismatchMarkers {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares dotted version numbers such as 3.1.1374.0;
+// missing parts count as 0. ok is false when either is not numeric.
+func compareVersions(a, b string) (result int, ok bool) {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(aParts), len(bParts)) {
+		var x, y int
+		var err error
+		if i < len(aParts) {
+			if x, err = strconv.Atoi(aParts[i]); err != nil {
+				return 0, false
+			}
+		}
+		if i < len(bParts) {
+			if y, err = strconv.Atoi(bParts[i]); err != nil {
+				return 0, false
+			}
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// agentVersion returns the SSM agent version the instance reports, or ""
+// when it is not registered.
+func agentVersion(ctx context.Context, client ssmDescribeInstanceInformationAPI, instanceID string) (string, error) {
+	info, err := managedInstanceInformation(ctx, client, instanceID)
+	if err != nil || info == nil {
+		return "", err
+	}
+	return aws.ToString(info.AgentVersion), nil
+}
+
+// checkAgentVersion fails with ErrOutdatedAgent when the instance's agent
+// is older than minimumAgentVersion. An unknown version passes.
+func checkAgentVersion(ctx context.Context, client ssmDescribeInstanceInformationAPI, instanceID string) error {
+	version, err := agentVersion(ctx, client, instanceID)
+	if err != nil {
+		return err
+	}
+	if order, ok := compareVersions(version, minimumAgentVersion); ok && version != "" && order < 0 {
+		return fmt.Errorf("%w: %s runs %s, below %s; update it, for example with the AWS-UpdateSSMAgent document", ErrOutdatedAgent, instanceID, version, minimumAgentVersion)
+	}
+	return nil
+}
+
+// explainVersionMismatch adds the instance's agent version and what to do
+// about it to an ErrAgentVersionMismatch; other errors pass unchanged.
+func explainVersionMismatch(ctx context.Context, client ssmDescribeInstanceInformationAPI, instanceID string, err error) error {
+	if !errors.Is(err, ErrAgentVersionMismatch) {
+		return err
+	}
+	version, lookupErr := agentVersion(ctx, client, instanceID)
+	if lookupErr != nil || version == "" {
+		version = "unknown"
+	}
+	return fmt.Errorf("%w; the SSM agent on %s (version %s) probably needs updating to %s or later, for example with the AWS-UpdateSSMAgent document", err, instanceID, version, minimumAgentVersion)
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func agentInformation(version string) *fakeInstanceInformationClient {
+	return &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{
+		InstanceInformationList: []ssmtypes.InstanceInformation{{
+			InstanceId:   aws.String("i-1"),
+			AgentVersion: aws.String(version),
+		}},
+	}}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOK bool
+	}{
+		{a: "3.1.1374.0", b: "3.1.1374.0", want: 0, wantOK: true},
+		{a: "3.0.1390.0", b: "3.1.1374.0", want: -1, wantOK: true},
+		{a: "3.2.582.0", b: "3.1.1374.0", want: 1, wantOK: true},
+		{a: "3.1.1374", b: "3.1.1374.0", want: 0, wantOK: true},
+		{a: "3.1.x", b: "3.1.1374.0"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.a, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := compareVersions(tt.a, tt.b)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("expected %d, %v, got %d, %v", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestCheckAgentVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		client  *fakeInstanceInformationClient
+		wantErr error
+	}{
+		{name: "current", client: agentInformation("3.3.40.0")},
+		{name: "outdated", client: agentInformation("2.3.1644.0"), wantErr: ErrOutdatedAgent},
+		{name: "unregistered", client: &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{}}},
+		{name: "unparsable", client: agentInformation("latest")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := checkAgentVersion(context.Background(), tt.client, "i-1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExplainVersionMismatch(t *testing.T) {
+	t.Parallel()
+
+	mismatch := pluginFailure("Cannot perform start session: Unknown session type Port", func(string, ...any) {})
+	if !errors.Is(mismatch, ErrAgentVersionMismatch) || !errors.Is(mismatch, ErrSessionPluginFailed) {
+		t.Fatalf("expected %v, got %v", ErrAgentVersionMismatch, mismatch)
+	}
+	err := explainVersionMismatch(context.Background(), agentInformation("2.3.1644.0"), "i-1", mismatch)
+	if !errors.Is(err, ErrAgentVersionMismatch) || !strings.Contains(err.Error(), "version 2.3.1644.0") {
+		t.Errorf("expected the agent version in the error, got %v", err)
+	}
+
+	other := errors.New("plugin exited")
+	if err := explainVersionMismatch(context.Background(), agentInformation("2.3.1644.0"), "i-1", other); err != other {
+		t.Errorf("expected %v, got %v", other, err)
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// remoteAllowlistSection maps an instance ID or Name to the host:port
+// patterns it may forward to. The key "*" applies to every instance.
+const remoteAllowlistSection = "remote_allowlist"
+
+var (
+	ErrInvalidAllowlistPattern = errors.New("invalid remote allowlist pattern")
+	ErrRemoteNotAllowed        = errors.New("remote endpoint is not allowed")
+	ErrInvalidRemoteHostSuffix = errors.New("invalid remote host suffix")
+	ErrRemoteHostNotAllowed    = errors.New("remote host does not match an allowed suffix")
+)
+
+func parseRemoteAllowlist(section *ini.Section) (map[string][]string, error) {
+	allowlist := make(map[string][]string)
+	for _, key := range section.Keys() {
+		for _, pattern := range strings.Split(key.Value(), ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if _, _, err := splitAllowlistPattern(pattern); err != nil {
+				return nil, fmt.Errorf("%s: %w", key.Name(), err)
+			}
+			allowlist[key.Name()] = append(allowlist[key.Name()], pattern)
+		}
+	}
+	return allowlist, nil
+}
+
+func splitAllowlistPattern(pattern string) (string, string, error) {
+	i := strings.LastIndex(pattern, ":")
+	if i <= 0 || i == len(pattern)-1 {
+		return "", "", fmt.Errorf("%w: %q (want <host>:<port>)", ErrInvalidAllowlistPattern, pattern)
+	}
+	host, port := pattern[:i], pattern[i+1:]
+	if _, err := path.Match(host, ""); err != nil {
+		return "", "", fmt.Errorf("%w: %q: %v", ErrInvalidAllowlistPattern, pattern, err)
+	}
+	if port != "*" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("%w: %q: invalid port", ErrInvalidAllowlistPattern, pattern)
+		}
+	}
+	return host, port, nil
+}
+
+// checkRemoteAllowed reports whether host:port may be forwarded through
+// the instance. A nil allowlist allows everything; otherwise an instance
+// without a matching entry may not forward at all.
+func checkRemoteAllowed(allowlist map[string][]string, instanceID, instanceName, host string, port int) error {
+	if allowlist == nil {
+		return nil
+	}
+	var patterns []string
+	for _, key := range []string{instanceID, strings.TrimSpace(instanceName), "*"} {
+		if key != "" {
+			patterns = append(patterns, allowlist[key]...)
+		}
+	}
+	for _, pattern := range patterns {
+		hostPattern, portPattern, err := splitAllowlistPattern(pattern)
+		if err != nil {
+			return err
+		}
+		hostMatch, _ := path.Match(strings.ToLower(hostPattern), strings.ToLower(host))
+		if hostMatch && (portPattern == "*" || portPattern == strconv.Itoa(port)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s:%d through %s", ErrRemoteNotAllowed, host, port, instanceID)
+}
+
+func validateRemoteHostSuffixes(suffixes []string) error {
+	for _, suffix := range suffixes {
+		suffix = strings.TrimSpace(suffix)
+		if strings.Contains(suffix, "/") {
+			if _, err := netip.ParsePrefix(suffix); err != nil {
+				return fmt.Errorf("%w: %q: %v", ErrInvalidRemoteHostSuffix, suffix, err)
+			}
+			continue
+		}
+		if _, err := netip.ParseAddr(suffix); err == nil {
+			continue
+		}
+		if strings.Trim(suffix, ".") == "" || strings.ContainsAny(suffix, " *:") {
+			return fmt.Errorf("%w: %q", ErrInvalidRemoteHostSuffix, suffix)
+		}
+	}
+	return nil
+}
+
+// checkRemoteHostSuffix reports whether host ends with one of the allowed
+// domain suffixes, on a label boundary. An IP address host must instead be
+// listed as an address or fall in a listed CIDR prefix. No suffixes allow
+// every host.
+func checkRemoteHostSuffix(suffixes []string, host string) error {
+	if len(suffixes) == 0 {
+		return nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	addr, addrErr := netip.ParseAddr(strings.Trim(name, "[]"))
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.TrimSpace(suffix))
+		if addrErr == nil {
+			if prefix, err := netip.ParsePrefix(suffix); err == nil && prefix.Contains(addr.Unmap()) {
+				return nil
+			}
+			if allowed, err := netip.ParseAddr(suffix); err == nil && allowed.Unmap() == addr.Unmap() {
+				return nil
+			}
+			continue
+		}
+		suffix = strings.Trim(suffix, ".")
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q (allowed: %s)", ErrRemoteHostNotAllowed, host, strings.Join(suffixes, ", "))
+}
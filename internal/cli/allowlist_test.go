@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRemoteAllowed(t *testing.T) {
+	t.Parallel()
+
+	allowlist := map[string][]string{
+		"i-0123456789abcdef0": {"db.internal:5432"},
+		"shared-bastion":      {"*.cache.internal:6379", "metrics.internal:*"},
+		"*":                   {"status.internal:443"},
+	}
+
+	tests := []struct {
+		name         string
+		allowlist    map[string][]string
+		instanceID   string
+		instanceName string
+		host         string
+		port         int
+		wantErr      error
+	}{
+		{name: "no allowlist", host: "anything", port: 1},
+		{name: "instance id entry", allowlist: allowlist, instanceID: "i-0123456789abcdef0", host: "db.internal", port: 5432},
+		{name: "instance id wrong port", allowlist: allowlist, instanceID: "i-0123456789abcdef0", host: "db.internal", port: 3306, wantErr: ErrRemoteNotAllowed},
+		{name: "name entry with host glob", allowlist: allowlist, instanceID: "i-0fedcba9876543210", instanceName: "shared-bastion", host: "Sessions.Cache.Internal", port: 6379},
+		{name: "name entry with port wildcard", allowlist: allowlist, instanceID: "i-0fedcba9876543210", instanceName: "shared-bastion", host: "metrics.internal", port: 9090},
+		{name: "wildcard entry", allowlist: allowlist, instanceID: "i-0fedcba9876543210", host: "status.internal", port: 443},
+		{name: "unlisted instance", allowlist: allowlist, instanceID: "i-0fedcba9876543210", host: "db.internal", port: 5432, wantErr: ErrRemoteNotAllowed},
+		{name: "empty allowlist", allowlist: map[string][]string{}, instanceID: "i-0123456789abcdef0", host: "db.internal", port: 5432, wantErr: ErrRemoteNotAllowed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkRemoteAllowed(tt.allowlist, tt.instanceID, tt.instanceName, tt.host, tt.port)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("checkRemoteAllowed() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromFileRemoteAllowlist(t *testing.T) {
+	t.Parallel()
+
+	write := func(t *testing.T, allowlist ...string) string {
+		t.Helper()
+		configPath := filepath.Join(t.TempDir(), "settings.ini")
+		content := strings.Join(append([]string{
+			"[settings]",
+			"profile = default",
+			"instance_name = bastion",
+			"",
+			"[remote_allowlist]",
+		}, allowlist...), "\n")
+		if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("write config file: %v", err)
+		}
+		return configPath
+	}
+
+	cfg, err := loadConfigFromFile(write(t, "bastion = db.internal:5432, *.cache.internal:6379"))
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	if got := cfg.RemoteAllowlist["bastion"]; len(got) != 2 || got[1] != "*.cache.internal:6379" {
+		t.Fatalf("RemoteAllowlist[bastion] = %q, want 2 patterns", got)
+	}
+
+	for _, pattern := range []string{"db.internal", "db.internal:http", "[db:5432"} {
+		if _, err := loadConfigFromFile(write(t, "bastion = "+pattern)); !errors.Is(err, ErrInvalidAllowlistPattern) {
+			t.Fatalf("pattern %q: expected %v, got %v", pattern, ErrInvalidAllowlistPattern, err)
+		}
+	}
+}
+
+func TestCheckRemoteHostSuffix(t *testing.T) {
+	t.Parallel()
+
+	suffixes := []string{"internal.example.com", ".corp", "10.0.0.0/8", "192.168.1.5"}
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{host: "db.internal.example.com", allowed: true},
+		{host: "DB.Internal.Example.com.", allowed: true},
+		{host: "internal.example.com", allowed: true},
+		{host: "api.corp", allowed: true},
+		{host: "10.20.30.40", allowed: true},
+		{host: "192.168.1.5", allowed: true},
+		{host: "db.internal.example.com.evil.net"},
+		{host: "badinternal.example.com"},
+		{host: "192.168.1.6"},
+		{host: "localhost"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.host, func(t *testing.T) {
+			t.Parallel()
+			err := checkRemoteHostSuffix(suffixes, tt.host)
+			if tt.allowed && err != nil {
+				t.Fatalf("checkRemoteHostSuffix() unexpected error: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrRemoteHostNotAllowed) {
+				t.Fatalf("expected %v, got %v", ErrRemoteHostNotAllowed, err)
+			}
+		})
+	}
+
+	if err := checkRemoteHostSuffix(nil, "anything.example.net"); err != nil {
+		t.Fatalf("expected no suffixes to allow every host, got %v", err)
+	}
+}
+
+func TestValidateRemoteHostSuffixes(t *testing.T) {
+	t.Parallel()
+
+	if err := validateRemoteHostSuffixes([]string{"internal.example.com", "10.0.0.0/8", "fd00::1"}); err != nil {
+		t.Fatalf("validateRemoteHostSuffixes() unexpected error: %v", err)
+	}
+	for _, suffix := range []string{"", ".", "*.example.com", "10.0.0.0/33"} {
+		if err := validateRemoteHostSuffixes([]string{suffix}); !errors.Is(err, ErrInvalidRemoteHostSuffix) {
+			t.Fatalf("suffix %q: expected %v, got %v", suffix, ErrInvalidRemoteHostSuffix, err)
+		}
+	}
+}
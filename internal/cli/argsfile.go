@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidArgsFile = errors.New("invalid arguments file")
+
+// expandArgsFiles replaces every @file argument with the arguments read
+// from file, so flags from the file parse exactly like direct ones. Files
+// are not expanded recursively, and nothing after "--" is expanded.
+func expandArgsFiles(args []string, readFile func(string) ([]byte, error)) ([]string, error) {
+	var expanded []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...), nil
+		}
+		path, ok := strings.CutPrefix(arg, "@")
+		if !ok || path == "" {
+			expanded = append(expanded, arg)
+			continue
+		}
+		data, err := readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read arguments file: %w", err)
+		}
+		fileArgs, err := splitArgs(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrInvalidArgsFile, path, err)
+		}
+		expanded = append(expanded, fileArgs...)
+	}
+	return expanded, nil
+}
+
+// splitArgs splits s into words the way a POSIX shell would, without
+// expansions: whitespace and newlines separate words, single quotes are
+// literal, double quotes allow \" and \\, a backslash escapes the next
+// character, and # starts a comment at the start of a word.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+		comment bool
+	)
+	for _, r := range s {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				word.WriteRune('\\')
+			}
+			if r != '\n' || quote != 0 {
+				word.WriteRune(r)
+				inWord = true
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '#' && !inWord:
+			comment = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
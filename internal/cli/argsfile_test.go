@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "one per line", input: "--instance-name\nbastion\n--local-port\n5432\n", want: []string{"--instance-name", "bastion", "--local-port", "5432"}},
+		{name: "shell split", input: "--instance-name bastion --local-port=5432", want: []string{"--instance-name", "bastion", "--local-port=5432"}},
+		{name: "crlf", input: "--ssh\r\n--instance-id i-1\r\n", want: []string{"--ssh", "--instance-id", "i-1"}},
+		{name: "single quotes", input: `--session-reason 'db migration $X'`, want: []string{"--session-reason", "db migration $X"}},
+		{name: "double quotes", input: `--session-reason "say \"hi\" \n"`, want: []string{"--session-reason", `say "hi" \n`}},
+		{name: "backslash", input: `a\ b \'c`, want: []string{"a b", "'c"}},
+		{name: "line continuation", input: "--local-port \\\n 5432", want: []string{"--local-port", "5432"}},
+		{name: "empty quotes", input: `--remote-host ""`, want: []string{"--remote-host", ""}},
+		{name: "comments", input: "# CI tunnel\n--ssh # inline\n--name=a#b\n", want: []string{"--ssh", "--name=a#b"}},
+		{name: "empty", input: "\n\n", want: nil},
+		{name: "unterminated quote", input: `--session-reason "oops`, wantErr: true},
+		{name: "trailing backslash", input: `--ssh \`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := splitArgs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExpandArgsFiles(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"ci.args":     "--instance-name bastion\n--local-port 5432\n",
+		"nested.args": "@ci.args\n",
+		"bad.args":    `"unterminated`,
+	}
+	readFile := func(path string) ([]byte, error) {
+		data, ok := files[path]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return []byte(data), nil
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr error
+	}{
+		{name: "no files", args: []string{"--ssh"}, want: []string{"--ssh"}},
+		{name: "merged in place", args: []string{"--profile", "ci", "@ci.args", "--local-port", "6543"}, want: []string{"--profile", "ci", "--instance-name", "bastion", "--local-port", "5432", "--local-port", "6543"}},
+		{name: "not recursive", args: []string{"@nested.args"}, want: []string{"@ci.args"}},
+		{name: "lone at", args: []string{"@"}, want: []string{"@"}},
+		{name: "after double dash", args: []string{"--", "@ci.args"}, want: []string{"--", "@ci.args"}},
+		{name: "missing file", args: []string{"@missing.args"}, wantErr: fs.ErrNotExist},
+		{name: "invalid file", args: []string{"@bad.args"}, wantErr: ErrInvalidArgsFile},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := expandArgsFiles(tt.args, readFile)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	ErrInvalidAvailabilityZone        = errors.New("invalid availability zone")
+	ErrAvailabilityZoneWithInstanceID = errors.New("availability zone cannot be combined with --instance-id")
+)
+
+var (
+	// availabilityZoneName matches zone names such as us-east-1a and
+	// us-west-2-lax-1a.
+	availabilityZoneName = regexp.MustCompile(`^[a-z]{2}(-[a-z0-9]+)+[a-z]$`)
+	// availabilityZoneID matches zone IDs such as use1-az1, which name the
+	// same zone in every account.
+	availabilityZoneID = regexp.MustCompile(`^[a-z]{3,5}[0-9]+(-[a-z0-9]+)*-az[0-9]+$`)
+)
+
+func (c Config) availabilityZone() string {
+	return strings.ToLower(strings.TrimSpace(c.AvailabilityZone))
+}
+
+func (c Config) validateAvailabilityZone() error {
+	az := c.availabilityZone()
+	if az == "" {
+		return nil
+	}
+	if strings.TrimSpace(c.InstanceID) != "" {
+		return ErrAvailabilityZoneWithInstanceID
+	}
+	if availabilityZoneID.MatchString(az) {
+		return nil
+	}
+	if !availabilityZoneName.MatchString(az) {
+		return fmt.Errorf("%w: %q (want a zone name such as us-east-1a or a zone ID such as use1-az1)", ErrInvalidAvailabilityZone, c.AvailabilityZone)
+	}
+	for _, region := range c.regions() {
+		if !strings.HasPrefix(az, region) {
+			return fmt.Errorf("%w: %q is not in region %s", ErrInvalidAvailabilityZone, c.AvailabilityZone, region)
+		}
+	}
+	return nil
+}
+
+// availabilityZoneFilter narrows DescribeInstances to az, by zone ID or
+// zone name.
+func availabilityZoneFilter(az string) types.Filter {
+	name := "availability-zone"
+	if availabilityZoneID.MatchString(az) {
+		name = "availability-zone-id"
+	}
+	return types.Filter{Name: aws.String(name), Values: []string{az}}
+}
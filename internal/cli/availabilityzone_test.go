@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestConfigValidateAvailabilityZone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "unset", cfg: Config{InstanceID: "i-1"}},
+		{name: "zone name", cfg: Config{Region: "us-east-1", InstanceName: "bastion", AvailabilityZone: "us-east-1a"}},
+		{name: "local zone", cfg: Config{Region: "us-west-2", InstanceName: "bastion", AvailabilityZone: "us-west-2-lax-1a"}},
+		{name: "zone id", cfg: Config{Region: "us-east-1", InstanceName: "bastion", AvailabilityZone: "use1-az4"}},
+		{name: "other region", cfg: Config{Region: "eu-west-1", InstanceName: "bastion", AvailabilityZone: "us-east-1a"}, wantErr: ErrInvalidAvailabilityZone},
+		{name: "region only", cfg: Config{Region: "us-east-1", InstanceName: "bastion", AvailabilityZone: "us-east-1"}, wantErr: ErrInvalidAvailabilityZone},
+		{name: "instance id", cfg: Config{Region: "us-east-1", InstanceID: "i-1", AvailabilityZone: "us-east-1a"}, wantErr: ErrAvailabilityZoneWithInstanceID},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateAvailabilityZone(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolveInstanceIDAvailabilityZone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		az         string
+		wantFilter string
+	}{
+		{az: "us-east-1b", wantFilter: "availability-zone"},
+		{az: "use1-az2", wantFilter: "availability-zone-id"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.az, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeEC2Client{output: &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{
+				Instances: []ec2types.Instance{{InstanceId: aws.String("i-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}}},
+			}}}}
+			cfg := Config{InstanceName: "bastion", AvailabilityZone: tt.az, Select: selectLatest}
+			if _, err := resolveInstanceID(context.Background(), client, cfg, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			found := slices.ContainsFunc(client.gotInput.Filters, func(filter ec2types.Filter) bool {
+				return aws.ToString(filter.Name) == tt.wantFilter && slices.Equal(filter.Values, []string{tt.az})
+			})
+			if !found {
+				t.Errorf("expected a %s filter for %s, got %+v", tt.wantFilter, tt.az, client.gotInput.Filters)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+var ErrHeadlessEnvironment = errors.New("no interactive desktop session detected")
+
+func browserCommand(goos, url string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		return "xdg-open", []string{url}
+	}
+}
+
+func isHeadless(goos string, getenv func(string) string) bool {
+	if getenv("CI") != "" {
+		return true
+	}
+	switch goos {
+	case "darwin", "windows":
+		return false
+	default:
+		return getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == ""
+	}
+}
+
+func openBrowserURL(url string) error {
+	if isHeadless(runtime.GOOS, os.Getenv) {
+		return ErrHeadlessEnvironment
+	}
+	name, args := browserCommand(runtime.GOOS, url)
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBrowserCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		goos     string
+		wantName string
+		wantArgs []string
+	}{
+		{goos: "darwin", wantName: "open", wantArgs: []string{"http://localhost:8080"}},
+		{goos: "windows", wantName: "rundll32", wantArgs: []string{"url.dll,FileProtocolHandler", "http://localhost:8080"}},
+		{goos: "linux", wantName: "xdg-open", wantArgs: []string{"http://localhost:8080"}},
+		{goos: "freebsd", wantName: "xdg-open", wantArgs: []string{"http://localhost:8080"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.goos, func(t *testing.T) {
+			t.Parallel()
+			name, args := browserCommand(tt.goos, "http://localhost:8080")
+			if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("browserCommand() = %q %v, want %q %v", name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestIsHeadless(t *testing.T) {
+	t.Parallel()
+
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	tests := []struct {
+		name string
+		goos string
+		env  map[string]string
+		want bool
+	}{
+		{name: "linux without display", goos: "linux", env: map[string]string{}, want: true},
+		{name: "linux with x11", goos: "linux", env: map[string]string{"DISPLAY": ":0"}, want: false},
+		{name: "linux with wayland", goos: "linux", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, want: false},
+		{name: "darwin desktop", goos: "darwin", env: map[string]string{}, want: false},
+		{name: "ci runner", goos: "darwin", env: map[string]string{"CI": "true"}, want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isHeadless(tt.goos, env(tt.env)); got != tt.want {
+				t.Fatalf("isHeadless() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
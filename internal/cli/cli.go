@@ -0,0 +1,1915 @@
+package cli
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	_ "github.com/aws/session-manager-plugin/src/sessionmanagerplugin/session"
+	_ "github.com/aws/session-manager-plugin/src/sessionmanagerplugin/session/portsession"
+	"gopkg.in/ini.v1"
+)
+
+// Config is the settings of a tunnel, read from the [settings] section of
+// the config file and from the command line.
+type Config struct {
+	Profile      string `ini:"profile"`
+	Region       string `ini:"region"`
+	InstanceName string `ini:"instance_name"`
+	InstanceID   string `ini:"instance_id"`
+	LocalPort    int    `ini:"local_port"`
+	RemoteHost   string `ini:"remote_host"`
+	RemotePort   int    `ini:"remote_port"`
+	DocumentName string `ini:"document_name"`
+	SSH          bool   `ini:"ssh"`
+	Pipe         bool   `ini:"pipe"`
+	Direct       bool   `ini:"direct"`
+
+	ProfilePrefix      string   `ini:"profile_prefix"`
+	RemoteService      string   `ini:"remote_service"`
+	AcceptStates       string   `ini:"accept_states"`
+	AvailabilityZone   string   `ini:"availability_zone"`
+	RequireTags        []string `ini:"require_tags" delim:","`
+	DescribePagination string   `ini:"describe_pagination"`
+	Select             string   `ini:"select"`
+	InterfaceIndex     int      `ini:"interface_index"`
+	PreferSubnet       string   `ini:"prefer_subnet"`
+	KeepAliveStrategy  string   `ini:"keepalive_strategy"`
+	KeepAliveRoundTrip bool     `ini:"keepalive_roundtrip"`
+	Protocol           string   `ini:"protocol"`
+	MaxSessions        int      `ini:"max_sessions"`
+	LocalPortRange     string   `ini:"local_port_range"`
+	Count              int      `ini:"count"`
+	SessionReason      string   `ini:"session_reason"`
+	NoAutoReason       bool     `ini:"no_auto_reason"`
+	ForwardTaggedPorts bool     `ini:"forward_tagged_ports"`
+	PluginFallback     bool     `ini:"plugin_fallback"`
+	RemoteHostSuffixes []string `ini:"remote_host_suffixes" delim:","`
+	KillExisting       bool     `ini:"kill_existing"`
+	Replace            bool     `ini:"replace"`
+	SSMEndpoint        string   `ini:"ssm_endpoint"`
+	LocalHost          string   `ini:"local_host"`
+	LocalResolver      string   `ini:"local_resolver"`
+	PostDisconnect     string   `ini:"post_disconnect"`
+	Reconnect          int      `ini:"reconnect"`
+
+	PreferFresh         bool          `ini:"prefer_fresh"`
+	PreferFreshInterval time.Duration `ini:"prefer_fresh_interval"`
+	PreferFreshPolicy   string        `ini:"prefer_fresh_policy"`
+
+	KeepAlive         bool          `ini:"keepalive"`
+	KeepAliveInterval time.Duration `ini:"keepalive_interval"`
+
+	Monitor         bool          `ini:"monitor"`
+	MonitorInterval time.Duration `ini:"monitor_interval"`
+	MonitorFailures int           `ini:"monitor_failures"`
+
+	Forwarder         string   `ini:"forwarder"`
+	AcceptConcurrency int      `ini:"accept_concurrency"`
+	ListenBacklog     int      `ini:"listen_backlog"`
+	AllowCIDRs        []string `ini:"allow_cidrs" delim:","`
+	BindAddress       string   `ini:"bind_address"`
+
+	// Policy is read from the [policy] section; its keys are still
+	// accepted in [settings] too.
+	Policy `ini:"-"`
+
+	ResolverURL     string `ini:"resolver_url"`
+	ResolverEnv     string `ini:"resolver_env"`
+	ResolverService string `ini:"resolver_service"`
+
+	CloudMapNamespace string `ini:"cloudmap_namespace"`
+	CloudMapService   string `ini:"cloudmap_service"`
+	CloudMapSelection string `ini:"cloudmap_selection"`
+
+	EKSCluster string `ini:"eks_cluster"`
+	K8sService string `ini:"k8s_service"`
+
+	// RemoteAllowlist is read from the [remote_allowlist] section.
+	RemoteAllowlist map[string][]string `ini:"-"`
+	// ServicePorts is read from the [service_ports] section.
+	ServicePorts map[string]int `ini:"-"`
+	// Forwards is read from the [forward "name"] sections.
+	Forwards []forwardTarget `ini:"-"`
+	// InstanceTags is read from the [tags] section.
+	InstanceTags map[string]string `ini:"-"`
+}
+
+const (
+	// stdinInstanceID as --instance-id reads the ID from stdin.
+	stdinInstanceID     = "-"
+	defaultDocumentName = "AWS-StartPortForwardingSessionToRemoteHost"
+	sshDocumentName     = "AWS-StartSSHSession"
+	defaultSSHPort      = 22
+)
+
+var (
+	ErrMissingSettingsSection    = errors.New("missing [settings] section")
+	ErrMissingProfile            = errors.New("missing profile")
+	ErrMissingRegion             = errors.New("missing region")
+	ErrMissingInstanceSelector   = errors.New("missing instance selector")
+	ErrAnyRequiresInstanceName   = errors.New("any mode requires instance name or tag selection")
+	ErrInvalidLocalPort          = errors.New("invalid local port")
+	ErrMissingRemoteHost         = errors.New("missing remote host")
+	ErrMissingRemotePort         = errors.New("missing remote port")
+	ErrInvalidRemotePort         = errors.New("invalid remote port")
+	ErrNoRunningInstances        = errors.New("no running instances found")
+	ErrMultipleRunningInstances  = errors.New("multiple running instances found")
+	ErrInvalidInstanceState      = errors.New("instance has nil state")
+	ErrMissingInstanceID         = errors.New("instance has nil id")
+	ErrInstanceNotFound          = errors.New("instance not found")
+	ErrInstanceNotRunning        = errors.New("instance is not running")
+	ErrInvalidInstanceID         = errors.New("invalid instance id")
+	ErrMissingRequiredTag        = errors.New("instance is missing a required tag")
+	ErrStdinInstanceIDWithSSH    = errors.New("instance id from stdin cannot be used with ssh mode")
+	ErrInvalidAcceptState        = errors.New("invalid accepted instance state")
+	ErrInvalidDescribePagination = errors.New("invalid describe pagination")
+	ErrDocumentNotFound          = errors.New("ssm document not found")
+	ErrInvalidDocumentType       = errors.New("ssm document is not a session document")
+	ErrInvalidProtocol           = errors.New("invalid protocol")
+	ErrOpenRequiresHTTP          = errors.New("open requires protocol http or https")
+	ErrLocalPortNotReady         = errors.New("local port did not become ready")
+	ErrInvalidMaxSessions        = errors.New("invalid max sessions")
+	ErrInvalidConnectRetries     = errors.New("invalid connect retries")
+	ErrInvalidCount              = errors.New("invalid count")
+	ErrCountWithSSH              = errors.New("count cannot be used with ssh mode")
+)
+
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.Profile) == "" && strings.TrimSpace(c.ProfilePrefix) == "" {
+		return ErrMissingProfile
+	}
+	c, err := applyRemoteService(c)
+	if err != nil {
+		return err
+	}
+	if err := c.validateDirect(); err != nil {
+		return err
+	}
+	c = applyDirect(c)
+	instanceName := strings.TrimSpace(c.InstanceName)
+	instanceID := strings.TrimSpace(c.InstanceID)
+	resolverURL := strings.TrimSpace(c.ResolverURL)
+	if resolverURL != "" && (instanceName != "" || len(c.InstanceTags) > 0 || instanceID != "") {
+		return ErrResolverWithInstanceSelector
+	}
+	if instanceName == "" && len(c.InstanceTags) == 0 && instanceID == "" && resolverURL == "" {
+		return ErrMissingInstanceSelector
+	}
+	if resolverURL != "" {
+		if err := validateResolverURL(resolverURL); err != nil {
+			return err
+		}
+	}
+	if err := c.validateCloudMap(); err != nil {
+		return err
+	}
+	if err := c.validateEKS(); err != nil {
+		return err
+	}
+	if err := c.validateTaggedPorts(); err != nil {
+		return err
+	}
+	if err := c.validateForwardSections(); err != nil {
+		return err
+	}
+	if err := c.validateManagedInstance(); err != nil {
+		return err
+	}
+	if err := c.validateAvailabilityZone(); err != nil {
+		return err
+	}
+	if err := c.validateInterfaceChoice(); err != nil {
+		return err
+	}
+	if err := c.validatePreferFresh(); err != nil {
+		return err
+	}
+	if err := c.validateReconnect(); err != nil {
+		return err
+	}
+	if err := c.validateMonitor(); err != nil {
+		return err
+	}
+	if err := c.validatePipe(); err != nil {
+		return err
+	}
+	if err := c.validateSSMEndpoint(); err != nil {
+		return err
+	}
+	if err := c.validateRegions(); err != nil {
+		return err
+	}
+	if _, err := parseAcceptStates(c.AcceptStates); err != nil {
+		return err
+	}
+	if _, err := describeMaxPages(c.DescribePagination); err != nil {
+		return err
+	}
+	if _, err := c.keepAliveStrategy(); err != nil {
+		return err
+	}
+	if err := c.validateKeepAliveInterval(); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Protocol)) {
+	case "", "tcp", "http", "https":
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidProtocol, c.Protocol)
+	}
+	if c.MaxSessions < 0 {
+		return ErrInvalidMaxSessions
+	}
+	if err := c.Policy.validate(); err != nil {
+		return err
+	}
+	if err := validateRemoteHostSuffixes(c.RemoteHostSuffixes); err != nil {
+		return err
+	}
+	if err := validateLocalHost(c); err != nil {
+		return err
+	}
+	if c.Count < 0 {
+		return ErrInvalidCount
+	}
+	if err := c.validateForwarder(); err != nil {
+		return err
+	}
+	if c.SSH {
+		if instanceID == stdinInstanceID {
+			return ErrStdinInstanceIDWithSSH
+		}
+		if c.Count > 1 {
+			return ErrCountWithSSH
+		}
+		if c.RemotePort != 0 && (c.RemotePort < 1 || c.RemotePort > 65535) {
+			return ErrInvalidRemotePort
+		}
+		return nil
+	}
+	if strings.TrimSpace(c.LocalPortRange) != "" {
+		if _, _, err := parsePortRange(c.LocalPortRange); err != nil {
+			return err
+		}
+	}
+	if c.LocalPort < 0 || c.LocalPort > 65535 {
+		return ErrInvalidLocalPort
+	}
+	if c.LocalPort != 0 && c.LocalPort+max(c.Count, 1)-1 > 65535 {
+		return fmt.Errorf("%w: %d forwards from local port %d exceed port 65535", ErrInvalidCount, c.Count, c.LocalPort)
+	}
+	// The resolver, Cloud Map, the EKS service, the ports tag or the forward
+	// sections may supply the remote endpoint.
+	if resolverURL != "" || c.cloudMapEnabled() || c.eksEnabled() || c.ForwardTaggedPorts || len(c.Forwards) > 0 {
+		if c.RemotePort < 0 || c.RemotePort > 65535 {
+			return ErrInvalidRemotePort
+		}
+		return nil
+	}
+	if err := c.validateRemote(); err != nil {
+		if errors.Is(err, ErrMissingRemoteHost) {
+			return fmt.Errorf("%w (or use --direct for a port on the instance itself)", err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c Config) validateRemote() error {
+	if strings.TrimSpace(c.RemoteHost) == "" {
+		return ErrMissingRemoteHost
+	}
+	if c.RemotePort == 0 {
+		return ErrMissingRemotePort
+	}
+	if c.RemotePort < 1 || c.RemotePort > 65535 {
+		return ErrInvalidRemotePort
+	}
+	return nil
+}
+
+func (c Config) nativeForwarder() bool {
+	return strings.ToLower(strings.TrimSpace(c.Forwarder)) == forwarderNative
+}
+
+func (c Config) validateForwarder() error {
+	switch strings.ToLower(strings.TrimSpace(c.Forwarder)) {
+	case "", forwarderPlugin, forwarderNative:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidForwarder, c.Forwarder)
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		return ErrInvalidTimeout
+	}
+	if !c.nativeForwarder() && (c.ReadTimeout > 0 || c.WriteTimeout > 0) {
+		return ErrTimeoutRequiresNative
+	}
+	if c.AcceptConcurrency < 0 {
+		return ErrInvalidAcceptConcurrency
+	}
+	if !c.nativeForwarder() && c.AcceptConcurrency > 0 {
+		return ErrAcceptConcurrencyRequiresNative
+	}
+	if c.ListenBacklog < 0 {
+		return ErrInvalidListenBacklog
+	}
+	if c.ListenBacklog > 0 && !c.nativeForwarder() {
+		return ErrListenBacklogRequiresNative
+	}
+	if c.ListenBacklog > 0 && !listenBacklogSupported {
+		return ErrListenBacklogUnsupported
+	}
+	if err := c.validateBindAddress(); err != nil {
+		return err
+	}
+	if err := c.validateAllowCIDRs(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c Config) resolvedDocumentName() string {
+	if name := strings.TrimSpace(c.DocumentName); name != "" {
+		return name
+	}
+	if c.SSH {
+		return sshDocumentName
+	}
+	if c.Direct {
+		return directDocumentName
+	}
+	return defaultDocumentName
+}
+
+func (c Config) sessionParameters() map[string][]string {
+	if c.SSH {
+		port := c.RemotePort
+		if port == 0 {
+			port = defaultSSHPort
+		}
+		return map[string][]string{
+			"portNumber": {fmt.Sprintf("%d", port)},
+		}
+	}
+	if c.Direct {
+		return map[string][]string{
+			"localPortNumber": {fmt.Sprintf("%d", c.LocalPort)},
+			"portNumber":      {fmt.Sprintf("%d", c.RemotePort)},
+		}
+	}
+	return map[string][]string{
+		"localPortNumber": {fmt.Sprintf("%d", c.LocalPort)},
+		"host":            {c.RemoteHost},
+		"portNumber":      {fmt.Sprintf("%d", c.RemotePort)},
+	}
+}
+
+func loadConfigFromFile(configFile string) (*Config, error) {
+	iniCfg, err := ini.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return configFromINI(iniCfg)
+}
+
+// loadConfigLayers reads the config file over a base layer fetched with
+// --remote-config, so the file's settings win. Either may be missing.
+func loadConfigLayers(base *ini.File, configFile string) (*Config, error) {
+	if base == nil {
+		return loadConfigFromFile(configFile)
+	}
+	if configFile != "" {
+		if err := base.Append(configFile); err != nil {
+			return nil, err
+		}
+	}
+	return configFromINI(base)
+}
+
+func configFromINI(iniCfg *ini.File) (*Config, error) {
+	cfg := &Config{}
+	if !iniCfg.HasSection("settings") {
+		return nil, ErrMissingSettingsSection
+	}
+	section := iniCfg.Section("settings")
+	// Backward compatibility: ignore deprecated setting.
+	if section.HasKey("use_builtin") {
+		section.DeleteKey("use_builtin")
+	}
+	err := section.StrictMapTo(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Policy, err = loadPolicy(iniCfg)
+	if err != nil {
+		return nil, err
+	}
+	if iniCfg.HasSection(servicePortsSection) {
+		cfg.ServicePorts, err = parseServicePorts(iniCfg.Section(servicePortsSection))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if iniCfg.HasSection(remoteAllowlistSection) {
+		cfg.RemoteAllowlist, err = parseRemoteAllowlist(iniCfg.Section(remoteAllowlistSection))
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg.Forwards, err = parseForwardSections(iniCfg)
+	if err != nil {
+		return nil, err
+	}
+	if iniCfg.HasSection(instanceTagsSection) {
+		cfg.InstanceTags, err = parseInstanceTagsSection(iniCfg.Section(instanceTagsSection))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// stringListFlag collects the values of a repeatable flag.
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringListFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func collectSetFlags(fs *flag.FlagSet) map[string]bool {
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	return setFlags
+}
+
+func mergeConfigWithCLIOverrides(base, cli Config, setFlags map[string]bool) Config {
+	merged := base
+
+	if setFlags["profile"] {
+		merged.Profile = cli.Profile
+	}
+	if setFlags["profile-prefix"] {
+		merged.ProfilePrefix = cli.ProfilePrefix
+	}
+	if setFlags["region"] {
+		merged.Region = cli.Region
+	}
+	if setFlags["instance-name"] {
+		merged.InstanceName = cli.InstanceName
+		merged.InstanceID = ""
+	}
+	if setFlags["tag"] {
+		merged.InstanceTags = cli.InstanceTags
+		merged.InstanceID = ""
+	}
+	if setFlags["instance-id"] {
+		merged.InstanceID = cli.InstanceID
+		merged.InstanceName = ""
+		merged.InstanceTags = nil
+	}
+	if setFlags["accept-states"] {
+		merged.AcceptStates = cli.AcceptStates
+	}
+	if setFlags["az"] {
+		merged.AvailabilityZone = cli.AvailabilityZone
+	}
+	if setFlags["require-tag"] {
+		merged.RequireTags = cli.RequireTags
+	}
+	if setFlags["describe-pagination"] {
+		merged.DescribePagination = cli.DescribePagination
+	}
+	if setFlags["select"] {
+		merged.Select = cli.Select
+	}
+	if setFlags["interface-index"] {
+		merged.InterfaceIndex = cli.InterfaceIndex
+	}
+	if setFlags["prefer-subnet"] {
+		merged.PreferSubnet = cli.PreferSubnet
+	}
+	if setFlags["local-port"] {
+		merged.LocalPort = cli.LocalPort
+	}
+	if setFlags["remote-host"] {
+		merged.RemoteHost = cli.RemoteHost
+	}
+	if setFlags["remote-port"] {
+		merged.RemotePort = cli.RemotePort
+	}
+	if setFlags["remote-service"] {
+		merged.RemoteService = cli.RemoteService
+	}
+	if setFlags["document-name"] {
+		merged.DocumentName = cli.DocumentName
+	}
+	if setFlags["ssh"] {
+		merged.SSH = cli.SSH
+	}
+	if setFlags["pipe"] {
+		merged.Pipe = cli.Pipe
+	}
+	if setFlags["direct"] {
+		merged.Direct = cli.Direct
+	}
+	if setFlags["keepalive-strategy"] {
+		merged.KeepAliveStrategy = cli.KeepAliveStrategy
+	}
+	if setFlags["keep-alive"] || setFlags["keepalive"] {
+		merged.KeepAlive = cli.KeepAlive
+	}
+	if setFlags["keep-alive-interval"] || setFlags["keepalive-interval"] {
+		merged.KeepAliveInterval = cli.KeepAliveInterval
+	}
+	if setFlags["keepalive-roundtrip"] {
+		merged.KeepAliveRoundTrip = cli.KeepAliveRoundTrip
+	}
+	if setFlags["protocol"] {
+		merged.Protocol = cli.Protocol
+	}
+	if setFlags["remote-host-suffix"] {
+		merged.RemoteHostSuffixes = cli.RemoteHostSuffixes
+	}
+	if setFlags["local-host"] {
+		merged.LocalHost = cli.LocalHost
+	}
+	if setFlags["local-resolver"] {
+		merged.LocalResolver = cli.LocalResolver
+	}
+	if setFlags["post-disconnect"] {
+		merged.PostDisconnect = cli.PostDisconnect
+	}
+	if setFlags["kill-existing"] {
+		merged.KillExisting = cli.KillExisting
+	}
+	if setFlags["replace"] {
+		merged.Replace = cli.Replace
+	}
+	if setFlags["ssm-endpoint"] {
+		merged.SSMEndpoint = cli.SSMEndpoint
+	}
+	if setFlags["reconnect"] {
+		merged.Reconnect = cli.Reconnect
+	}
+	if setFlags["monitor"] {
+		merged.Monitor = cli.Monitor
+	}
+	if setFlags["monitor-interval"] {
+		merged.MonitorInterval = cli.MonitorInterval
+	}
+	if setFlags["monitor-failures"] {
+		merged.MonitorFailures = cli.MonitorFailures
+	}
+	if setFlags["prefer-fresh"] {
+		merged.PreferFresh = cli.PreferFresh
+	}
+	if setFlags["prefer-fresh-interval"] {
+		merged.PreferFreshInterval = cli.PreferFreshInterval
+	}
+	if setFlags["prefer-fresh-policy"] {
+		merged.PreferFreshPolicy = cli.PreferFreshPolicy
+	}
+	if setFlags["plugin-fallback"] {
+		merged.PluginFallback = cli.PluginFallback
+	}
+	if setFlags["max-sessions"] {
+		merged.MaxSessions = cli.MaxSessions
+	}
+	if setFlags["connect-retries"] {
+		merged.ConnectRetries = cli.ConnectRetries
+	}
+	if setFlags["local-port-range"] {
+		merged.LocalPortRange = cli.LocalPortRange
+	}
+	if setFlags["count"] {
+		merged.Count = cli.Count
+	}
+	if setFlags["forward-tagged-ports"] {
+		merged.ForwardTaggedPorts = cli.ForwardTaggedPorts
+	}
+	if setFlags["resolver-url"] {
+		merged.ResolverURL = cli.ResolverURL
+	}
+	if setFlags["resolver-env"] {
+		merged.ResolverEnv = cli.ResolverEnv
+	}
+	if setFlags["resolver-service"] {
+		merged.ResolverService = cli.ResolverService
+	}
+	if setFlags["cloudmap-namespace"] {
+		merged.CloudMapNamespace = cli.CloudMapNamespace
+	}
+	if setFlags["cloudmap-service"] {
+		merged.CloudMapService = cli.CloudMapService
+	}
+	if setFlags["cloudmap-selection"] {
+		merged.CloudMapSelection = cli.CloudMapSelection
+	}
+	if setFlags["eks-cluster"] {
+		merged.EKSCluster = cli.EKSCluster
+	}
+	if setFlags["k8s-service"] {
+		merged.K8sService = cli.K8sService
+	}
+	if setFlags["session-reason"] {
+		merged.SessionReason = cli.SessionReason
+	}
+	if setFlags["no-auto-reason"] {
+		merged.NoAutoReason = cli.NoAutoReason
+	}
+	if setFlags["forwarder"] {
+		merged.Forwarder = cli.Forwarder
+	}
+	if setFlags["read-timeout"] {
+		merged.ReadTimeout = cli.ReadTimeout
+	}
+	if setFlags["write-timeout"] {
+		merged.WriteTimeout = cli.WriteTimeout
+	}
+	if setFlags["accept-concurrency"] {
+		merged.AcceptConcurrency = cli.AcceptConcurrency
+	}
+	if setFlags["listen-backlog"] {
+		merged.ListenBacklog = cli.ListenBacklog
+	}
+	if setFlags["allow-cidr"] {
+		merged.AllowCIDRs = cli.AllowCIDRs
+	}
+	if setFlags["bind-address"] {
+		merged.BindAddress = cli.BindAddress
+	}
+	if setFlags["max-startup-time"] {
+		merged.MaxStartupTime = cli.MaxStartupTime
+	}
+	if setFlags["resolve-timeout"] {
+		merged.ResolveTimeout = cli.ResolveTimeout
+	}
+
+	return merged
+}
+
+func createAWSSession(ctx context.Context, profile, region string) (aws.Config, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithSharedConfigProfile(profile),
+		config.WithRegion(region),
+		config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+			o.TokenProvider = mfaCodePrompt(os.Stdin, os.Stderr)
+		}),
+	)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	// Load the credentials now, so an expired SSO sign-in or a missing MFA
+	// code is reported before any API call.
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		home, _ := os.UserHomeDir()
+		configFile, credentialsFile := sharedConfigFiles(os.Getenv, home)
+		name := sharedProfileName(profile, os.Getenv)
+		return aws.Config{}, explainCredentialsFailure(name, ssoProfile(ctx, name, configFile, credentialsFile), err)
+	}
+	return awsCfg, nil
+}
+
+func resolveRegion(awsCfg aws.Config, profile string) (string, error) {
+	region := strings.TrimSpace(awsCfg.Region)
+	if region == "" {
+		return "", fmt.Errorf("%w: profile %q has no region configured; pass --region, set AWS_REGION, or add region to the profile", ErrMissingRegion, profile)
+	}
+	return region, nil
+}
+
+type ec2DescribeInstancesAPI interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+}
+
+type ssmStartSessionAPI interface {
+	StartSession(ctx context.Context, params *ssm.StartSessionInput, optFns ...func(*ssm.Options)) (*ssm.StartSessionOutput, error)
+}
+
+type ssmDescribeDocumentAPI interface {
+	DescribeDocument(ctx context.Context, params *ssm.DescribeDocumentInput, optFns ...func(*ssm.Options)) (*ssm.DescribeDocumentOutput, error)
+}
+
+type ssmTerminateSessionAPI interface {
+	TerminateSession(ctx context.Context, params *ssm.TerminateSessionInput, optFns ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error)
+}
+
+func randomIndex(n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot choose random index from %d candidates", n)
+	}
+	chooser := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return chooser.Intn(n), nil
+}
+
+func validateSelectionOptions(cfg Config, allowAny bool) error {
+	if allowAny && cfg.instanceFilter().empty() {
+		return ErrAnyRequiresInstanceName
+	}
+	return cfg.validateSelect(allowAny)
+}
+
+func validateOpenOptions(cfg Config, openBrowser bool) error {
+	if !openBrowser {
+		return nil
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Protocol)) {
+	case "http", "https":
+	default:
+		return ErrOpenRequiresHTTP
+	}
+	if cfg.SSH {
+		return ErrOpenRequiresHTTP
+	}
+	return nil
+}
+
+// defaultAcceptStates are the instance states eligible for forwarding
+// unless --accept-states says otherwise.
+var defaultAcceptStates = []types.InstanceStateName{types.InstanceStateNameRunning}
+
+// parseAcceptStates parses a comma-separated list of EC2 instance states.
+func parseAcceptStates(value string) ([]types.InstanceStateName, error) {
+	if strings.TrimSpace(value) == "" {
+		return defaultAcceptStates, nil
+	}
+	known := types.InstanceStateName("").Values()
+	var states []types.InstanceStateName
+	for _, name := range strings.Split(value, ",") {
+		state := types.InstanceStateName(strings.ToLower(strings.TrimSpace(name)))
+		if !slices.Contains(known, state) {
+			return nil, fmt.Errorf("%w: %q (want one of %v)", ErrInvalidAcceptState, name, known)
+		}
+		if !slices.Contains(states, state) {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func formatStates(states []types.InstanceStateName) string {
+	names := make([]string, len(states))
+	for i, state := range states {
+		names[i] = string(state)
+	}
+	return strings.Join(names, ",")
+}
+
+// describePagination values select how many DescribeInstances pages a name
+// lookup reads.
+const (
+	describePaginationAll   = "all"
+	describePaginationFirst = "first"
+)
+
+func describeMaxPages(value string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", describePaginationAll:
+		return 0, nil
+	case describePaginationFirst:
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidDescribePagination, value, describePaginationAll, describePaginationFirst)
+	}
+}
+
+// findInstancesByName reads up to maxPages pages of instances that match
+// filter (0 = all). Unless all is set it stops at the second match, which
+// already makes the selection ambiguous.
+func findInstancesByName(ctx context.Context, client ec2DescribeInstancesAPI, filter instanceFilter, acceptStates []types.InstanceStateName, maxPages int, all bool) ([]instanceMatch, error) {
+	input := &ec2.DescribeInstancesInput{Filters: filter.ec2Filters()}
+	matches := make([]instanceMatch, 0)
+	var misses instanceMisses
+	var firstMalformedErr error
+	paginator := ec2.NewDescribeInstancesPaginator(client, input)
+	for pages := 1; paginator.HasMorePages(); pages++ {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, describeInstancesFailure(err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State == nil {
+					if firstMalformedErr == nil {
+						firstMalformedErr = fmt.Errorf("%w for %s", ErrInvalidInstanceState, filter)
+					}
+					continue
+				}
+				if !slices.Contains(acceptStates, instance.State.Name) {
+					misses.add(instance.State.Name)
+					continue
+				}
+				if instance.InstanceId == nil || strings.TrimSpace(*instance.InstanceId) == "" {
+					if firstMalformedErr == nil {
+						firstMalformedErr = fmt.Errorf("%w for %s", ErrMissingInstanceID, filter)
+					}
+					continue
+				}
+				matches = append(matches, newInstanceMatch(instance))
+			}
+		}
+		if !all && len(matches) > 1 {
+			break
+		}
+		if maxPages > 0 && pages >= maxPages {
+			misses.truncated = paginator.HasMorePages()
+			break
+		}
+	}
+
+	if len(matches) == 0 {
+		if firstMalformedErr != nil {
+			return nil, firstMalformedErr
+		}
+		return nil, noInstancesError(filter, acceptStates, misses)
+	}
+	return matches, nil
+}
+
+// getInstanceIDByName reads up to maxPages pages of matches (0 = all).
+func getInstanceIDByName(ctx context.Context, client ec2DescribeInstancesAPI, filter instanceFilter, allowAny bool, acceptStates []types.InstanceStateName, maxPages int, chooseIndex func(int) (int, error)) (string, error) {
+	// With --any every match is needed for a uniform pick.
+	matches, err := findInstancesByName(ctx, client, filter, acceptStates, maxPages, allowAny)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0].ID, nil
+	default:
+		if !allowAny {
+			return "", ambiguousInstanceName(filter, matches)
+		}
+
+		idx, err := chooseIndex(len(matches))
+		if err != nil {
+			return "", fmt.Errorf("failed to choose instance among %d matches: %w", len(matches), err)
+		}
+		if idx < 0 || idx >= len(matches) {
+			return "", fmt.Errorf("random selector returned out-of-range index %d for %d matches", idx, len(matches))
+		}
+		return matches[idx].ID, nil
+	}
+}
+
+func getInstanceIDByID(ctx context.Context, client ec2DescribeInstancesAPI, instanceID string, acceptStates []types.InstanceStateName) (string, error) {
+	input := &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+	output, err := client.DescribeInstances(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	var foundState types.InstanceStateName
+	found := false
+	for _, reservation := range output.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.InstanceId == nil || strings.TrimSpace(*instance.InstanceId) == "" {
+				return "", fmt.Errorf("%w while resolving instance id %q", ErrMissingInstanceID, instanceID)
+			}
+			if *instance.InstanceId != instanceID {
+				continue
+			}
+			found = true
+			if instance.State == nil {
+				return "", fmt.Errorf("%w for instance id %q", ErrInvalidInstanceState, instanceID)
+			}
+			if slices.Contains(acceptStates, instance.State.Name) {
+				return instanceID, nil
+			}
+			foundState = instance.State.Name
+		}
+	}
+
+	if found {
+		if !slices.Equal(acceptStates, defaultAcceptStates) {
+			return "", fmt.Errorf("%w: %q is %s, want %s", ErrInstanceNotRunning, instanceID, foundState, formatStates(acceptStates))
+		}
+		return "", fmt.Errorf("%w: %q", ErrInstanceNotRunning, instanceID)
+	}
+	return "", fmt.Errorf("%w: %q", ErrInstanceNotFound, instanceID)
+}
+
+// readInstanceID reads the instance ID from the first line of r, for
+// --instance-id -.
+func readInstanceID(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read instance id from stdin: %w", err)
+	}
+	instanceID := strings.TrimSpace(line)
+	if !isTargetID(instanceID) {
+		return "", fmt.Errorf("%w: %q read from stdin", ErrInvalidInstanceID, instanceID)
+	}
+	return instanceID, nil
+}
+
+// checkRequiredTags verifies that the instance carries every required tag
+// with a non-empty value.
+func checkRequiredTags(ctx context.Context, client ec2DescribeInstancesAPI, instanceID string, required []string) error {
+	if len(required) == 0 {
+		return nil
+	}
+	tags, err := instanceTags(ctx, client, instanceID)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, key := range required {
+		if strings.TrimSpace(tags[key]) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s has no %s tag", ErrMissingRequiredTag, instanceID, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func instanceTags(ctx context.Context, client ec2DescribeInstancesAPI, instanceID string) (map[string]string, error) {
+	output, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for _, reservation := range output.Reservations {
+		for _, instance := range reservation.Instances {
+			if aws.ToString(instance.InstanceId) != instanceID {
+				continue
+			}
+			for _, tag := range instance.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+		}
+	}
+	return tags, nil
+}
+
+// resolveInstanceID returns the instance to connect to. An explicit
+// instance ID wins over a name and is used as given, without calling
+// ec2:DescribeInstances, unless --accept-states asks for its state to be
+// checked.
+func resolveInstanceID(ctx context.Context, client ec2DescribeInstancesAPI, cfg Config, allowAny bool) (string, error) {
+	acceptStates, err := parseAcceptStates(cfg.AcceptStates)
+	if err != nil {
+		return "", err
+	}
+	if instanceID := strings.TrimSpace(cfg.InstanceID); instanceID != "" {
+		if strings.TrimSpace(cfg.AcceptStates) == "" {
+			return instanceID, nil
+		}
+		return getInstanceIDByID(ctx, client, instanceID, acceptStates)
+	}
+	maxPages, err := describeMaxPages(cfg.DescribePagination)
+	if err != nil {
+		return "", err
+	}
+	if !allowAny {
+		if choose := instanceChooser(cfg, os.Stdin, os.Stderr); choose != nil {
+			return selectInstanceByName(ctx, client, cfg.instanceFilter(), acceptStates, maxPages, choose)
+		}
+	}
+	return getInstanceIDByName(ctx, client, cfg.instanceFilter(), allowAny, acceptStates, maxPages, randomIndex)
+}
+
+func validateDocument(ctx context.Context, client ssmDescribeDocumentAPI, documentName string) error {
+	output, err := client.DescribeDocument(ctx, &ssm.DescribeDocumentInput{
+		Name: aws.String(documentName),
+	})
+	if err != nil {
+		var invalidDocument *ssmtypes.InvalidDocument
+		if errors.As(err, &invalidDocument) {
+			return fmt.Errorf("%w: %q is not visible to this account in the selected region", ErrDocumentNotFound, documentName)
+		}
+		return err
+	}
+	if output.Document == nil {
+		return fmt.Errorf("%w: %q", ErrDocumentNotFound, documentName)
+	}
+	if output.Document.DocumentType != ssmtypes.DocumentTypeSession {
+		return fmt.Errorf("%w: %q has type %q", ErrInvalidDocumentType, documentName, output.Document.DocumentType)
+	}
+	return nil
+}
+
+const maxSessionReasonLength = 256
+
+func sessionReason(cfg Config, currentUser func() (*user.User, error), hostname func() (string, error)) string {
+	reason := strings.TrimSpace(cfg.SessionReason)
+	if reason == "" && !cfg.NoAutoReason {
+		username := "unknown"
+		if u, err := currentUser(); err == nil && u.Username != "" {
+			username = u.Username
+		}
+		host := "unknown"
+		if h, err := hostname(); err == nil && h != "" {
+			host = h
+		}
+		reason = fmt.Sprintf("aws-go-forward by %s@%s", username, host)
+	}
+	// SSM rejects a reason that is not valid UTF-8, so a name with
+	// invalid bytes loses them and the cut falls on a rune boundary.
+	reason = strings.ToValidUTF8(reason, "")
+	if len(reason) > maxSessionReasonLength {
+		cut := maxSessionReasonLength
+		for cut > 0 && !utf8.RuneStart(reason[cut]) {
+			cut--
+		}
+		reason = reason[:cut]
+	}
+	return reason
+}
+
+func newStartSessionInput(instanceID, documentName string, parameters map[string][]string, reason string) *ssm.StartSessionInput {
+	input := &ssm.StartSessionInput{
+		Target:       aws.String(instanceID),
+		DocumentName: aws.String(documentName),
+		Parameters:   parameters,
+	}
+	if reason != "" {
+		input.Reason = aws.String(reason)
+	}
+	return input
+}
+
+func startPortForwarding(ctx context.Context, client ssmStartSessionAPI, instanceID, documentName string, parameters map[string][]string, reason string) (*ssm.StartSessionOutput, error) {
+	return client.StartSession(ctx, newStartSessionInput(instanceID, documentName, parameters, reason))
+}
+
+// formatStartSessionInput renders input as indented JSON for
+// --dump-parameters.
+func formatStartSessionInput(input *ssm.StartSessionInput) (string, error) {
+	data, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal session input: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+func terminatePortForwardingSession(ctx context.Context, client ssmTerminateSessionAPI, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	_, err := client.TerminateSession(ctx, &ssm.TerminateSessionInput{
+		SessionId: aws.String(sessionID),
+	})
+	return err
+}
+
+// sessionTerminateTimeout bounds the TerminateSession call when a forward
+// shuts down, so an unreachable SSM endpoint cannot hold up the exit.
+const sessionTerminateTimeout = 5 * time.Second
+
+// terminateSessionOnShutdown terminates the session of a forward that is
+// shutting down and logs the outcome. A session SSM no longer knows has
+// already closed, which is not an error.
+func terminateSessionOnShutdown(ctx context.Context, client ssmTerminateSessionAPI, sessionID, prefix string) error {
+	ctx, cancel := context.WithTimeout(ctx, sessionTerminateTimeout)
+	defer cancel()
+	err := terminatePortForwardingSession(ctx, client, sessionID)
+	var closed *ssmtypes.DoesNotExistException
+	switch {
+	case err == nil:
+		log.Printf("%sTerminated session %s", prefix, sessionID)
+	case errors.As(err, &closed):
+		log.Printf("%sSession %s was already closed", prefix, sessionID)
+		return nil
+	default:
+		log.Printf("%sFailed to terminate session %s: %v", prefix, sessionID, err)
+	}
+	return err
+}
+
+func runSessionLifecycle(
+	ctx context.Context,
+	localPort int,
+	sessionID string,
+	startPlugin func() error,
+	terminateSession func(context.Context, string) error,
+	keepAliveFn func(int, <-chan struct{}),
+) error {
+	stopChan := make(chan struct{})
+	pluginErrCh := make(chan error, 1)
+	keepAliveDone := make(chan struct{})
+
+	go func() {
+		defer close(keepAliveDone)
+		keepAliveFn(localPort, stopChan)
+	}()
+	go func() {
+		pluginErrCh <- startPlugin()
+	}()
+
+	var (
+		pluginErr error
+		ctxDone   bool
+	)
+
+	select {
+	case pluginErr = <-pluginErrCh:
+	case <-ctx.Done():
+		ctxDone = true
+	}
+
+	close(stopChan)
+	select {
+	case <-keepAliveDone:
+	case <-time.After(time.Second):
+		return errors.New("timed out waiting for keep-alive to stop")
+	}
+
+	shouldTerminate := sessionID != "" && (ctxDone || pluginErr != nil)
+	if shouldTerminate {
+		if err := terminateSession(context.Background(), sessionID); err != nil {
+			if pluginErr != nil {
+				return errors.Join(pluginErr, err)
+			}
+			return err
+		}
+	}
+
+	if ctxDone {
+		select {
+		case postCancelPluginErr := <-pluginErrCh:
+			if postCancelPluginErr != nil {
+				pluginErr = postCancelPluginErr
+			}
+		case <-time.After(5 * time.Second):
+			return errors.New("timed out waiting for session plugin to stop")
+		}
+	}
+
+	return pluginErr
+}
+
+// waitForLocalPort polls the local port until it accepts a connection.
+// With attempts above zero it gives up after that many connection attempts,
+// and in any case once timeout has passed.
+func waitForLocalPort(ctx context.Context, local localHost, localPort int, timeout, pollInterval time.Duration, attempts int) error {
+	target := net.JoinHostPort(cmp.Or(local.Name, defaultLocalHost), strconv.Itoa(localPort))
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		addr, err := local.addr(ctx, localPort)
+		var conn net.Conn
+		if err == nil {
+			dialer := net.Dialer{Timeout: pollInterval}
+			conn, err = dialer.DialContext(ctx, "tcp", addr)
+		}
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if attempts > 0 && attempt >= attempts {
+			return fmt.Errorf("%w: %s after %d attempts: %v", ErrLocalPortNotReady, target, attempts, err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s after %s: %v", ErrLocalPortNotReady, target, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+func formatAWSEnv(cfg Config, instanceID, sessionID string) string {
+	type envVar struct{ name, value string }
+	vars := []envVar{
+		{"AWS_PROFILE", cfg.Profile},
+		{"AWS_REGION", cfg.Region},
+		{"AWS_GO_FORWARD_INSTANCE_ID", instanceID},
+		{"AWS_GO_FORWARD_SESSION_ID", sessionID},
+	}
+	if !cfg.SSH {
+		vars = append(vars,
+			envVar{"AWS_GO_FORWARD_LOCAL_PORT", fmt.Sprintf("%d", cfg.LocalPort)},
+			envVar{"AWS_GO_FORWARD_REMOTE_HOST", cfg.RemoteHost},
+			envVar{"AWS_GO_FORWARD_REMOTE_PORT", fmt.Sprintf("%d", cfg.RemotePort)},
+		)
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&b, "export %s=%s\n", v.name, shellQuote(v.value))
+	}
+	return b.String()
+}
+
+// Main runs the aws-go-forward command with the process's arguments.
+func Main() {
+	if handled, err := runPluginSubcommand(os.Args, os.Stderr); handled {
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if handled, err := runServiceSubcommand(os.Args, os.Stdout); handled {
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			log.Fatalf("Failed to manage service: %v", err)
+		}
+		return
+	}
+	if handled, err := runSetupSubcommand(os.Args, os.Stdin, os.Stdout); handled {
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			log.Fatalf("Setup failed: %v", err)
+		}
+		return
+	}
+
+	var configFile string
+	var allowAny bool
+	var validateDocumentFirst bool
+	var checkAgent bool
+	var openInBrowser bool
+	var controlFile string
+	var outputAWSEnv bool
+	var eventsSocket string
+	var resolverHeaders stringListFlag
+	var remoteConfigURL string
+	var remoteConfigHeaders stringListFlag
+	var remoteConfigTimeoutFlag time.Duration
+	var remoteConfigCache time.Duration
+	var dumpParameters bool
+	var describeInstance bool
+	var listDocuments bool
+	var probe bool
+	var notify bool
+	var statsDAddr string
+	var statsDPrefix string
+	var summaryFile string
+	var errorFormat string
+	var cliCfg Config
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flag.StringVar(&configFile, "config", "", "Path to configuration file in INI format (optional)")
+	flag.StringVar(&remoteConfigURL, "remote-config", "", "Fetch a JSON configuration document from this http(s) URL and use it as the base that --config and flags override")
+	flag.Var(&remoteConfigHeaders, "remote-config-header", "HTTP header sent to --remote-config as \"Name: value\"; $VARS are expanded (repeatable)")
+	flag.DurationVar(&remoteConfigTimeoutFlag, "remote-config-timeout", remoteConfigTimeout, "Give up fetching --remote-config after this long")
+	flag.DurationVar(&remoteConfigCache, "remote-config-cache", 0, "Reuse the last --remote-config document for this long instead of fetching it again (e.g. 1h; 0 = no cache)")
+	flag.StringVar(&cliCfg.Profile, "profile", "", "AWS profile name")
+	flag.StringVar(&cliCfg.ProfilePrefix, "profile-prefix", "", "Use the AWS profile starting with this prefix when --profile is not set (fails if several match)")
+	flag.Var(&regionListFlag{value: &cliCfg.Region}, "region", "AWS region (repeatable, or comma-separated, to forward to several regions at once)")
+	flag.StringVar(&cliCfg.InstanceName, "instance-name", "", "Name of the instance used for forwarding")
+	flag.Var(instanceTagsFlag{&cliCfg.InstanceTags}, "tag", "Only consider instances with this Key=Value tag, alongside --instance-name (repeatable; * and ? match any characters)")
+	flag.StringVar(&cliCfg.InstanceID, "instance-id", "", "Instance ID used for forwarding (- reads it from the first line of stdin)")
+	flag.StringVar(&cliCfg.ResolverURL, "resolver-url", "", "Ask this HTTP endpoint which instance (and optionally remote host/port) to use instead of --instance-name/--instance-id")
+	flag.StringVar(&cliCfg.ResolverEnv, "resolver-env", "", "Environment sent to --resolver-url")
+	flag.StringVar(&cliCfg.ResolverService, "resolver-service", "", "Service sent to --resolver-url")
+	flag.StringVar(&cliCfg.CloudMapNamespace, "cloudmap-namespace", "", "Cloud Map namespace of the service to forward to (e.g. an ECS Service Connect namespace)")
+	flag.StringVar(&cliCfg.CloudMapService, "cloudmap-service", "", "Cloud Map service whose discovered address and port are used as the remote host and port")
+	flag.StringVar(&cliCfg.CloudMapSelection, "cloudmap-selection", "", "How to pick among several discovered endpoints: single (default, fail), first, or random")
+	flag.StringVar(&cliCfg.EKSCluster, "eks-cluster", "", "EKS cluster whose API is asked for the address of --k8s-service")
+	flag.StringVar(&cliCfg.K8sService, "k8s-service", "", "Kubernetes service to forward to, as namespace/name or namespace/name:port (needs --eks-cluster)")
+	flag.Var(&resolverHeaders, "resolver-header", "HTTP header sent to --resolver-url as \"Name: value\" (repeatable)")
+	flag.StringVar(&cliCfg.AcceptStates, "accept-states", "", "Comma-separated EC2 instance states eligible for forwarding, e.g. running,stopping (default running)")
+	flag.Var((*stringListFlag)(&cliCfg.RequireTags), "require-tag", "Refuse instances without a non-empty value for this tag (repeatable)")
+	flag.IntVar(&cliCfg.InterfaceIndex, "interface-index", 0, "Device index of the network interface whose private IP stands for the instance on multi-ENI instances (default 0, the primary)")
+	flag.StringVar(&cliCfg.PreferSubnet, "prefer-subnet", "", "Use the private IP of the instance's network interface in this subnet when it has one, before --interface-index")
+	flag.StringVar(&cliCfg.AvailabilityZone, "az", "", "Only consider instances matching --instance-name in this availability zone, by name (us-east-1a) or ID (use1-az1)")
+	flag.StringVar(&cliCfg.Select, "select", "", "Pick among several running instances matching --instance-name: latest (most recently launched) or prompt (default: prompt on a terminal, otherwise fail)")
+	flag.StringVar(&cliCfg.DescribePagination, "describe-pagination", "", "DescribeInstances pages read for --instance-name: all (default, stops early once the result is decided) or first")
+	flag.BoolVar(&allowAny, "any", false, "Allow selecting a random running instance when multiple instances match --instance-name")
+	flag.IntVar(&cliCfg.LocalPort, "local-port", 0, "Local port")
+	flag.StringVar(&cliCfg.LocalHost, "local-host", "", "Host name or address the keep-alive and readiness checks dial to reach the local port (default "+defaultLocalHost+")")
+	flag.StringVar(&cliCfg.LocalResolver, "local-resolver", "", "DNS server (host:port) used to resolve --local-host instead of the system resolver")
+	flag.StringVar(&cliCfg.LocalPortRange, "local-port-range", "", "Pick the first free local port from this pool (e.g. 6000-6100) when --local-port is not set")
+	flag.IntVar(&cliCfg.Count, "count", 0, "Start this many identical forwards on consecutive local ports from --local-port (or from --local-port-range)")
+	flag.BoolVar(&cliCfg.ForwardTaggedPorts, "forward-tagged-ports", false, "Forward every port listed in the instance's Ports tag (e.g. Ports=5432,9090) to --remote-host (default localhost)")
+	flag.StringVar(&cliCfg.RemoteHost, "remote-host", "", "Remote host")
+	flag.IntVar(&cliCfg.RemotePort, "remote-port", 0, "Remote port")
+	flag.Var((*stringListFlag)(&cliCfg.RemoteHostSuffixes), "remote-host-suffix", "Refuse remote hosts that do not end with this domain suffix or, for IP addresses, match this address or CIDR (repeatable)")
+	flag.StringVar(&cliCfg.RemoteService, "remote-service", "", "Well-known service on the remote host (e.g. postgres, mysql, redis) whose port is used as --remote-port")
+	flag.BoolVar(&cliCfg.Direct, "direct", false, "Forward to --remote-port on the instance itself with "+directDocumentName+", without a remote host")
+	flag.StringVar(&cliCfg.DocumentName, "document-name", "", "SSM session document used for forwarding (default "+defaultDocumentName+")")
+	flag.BoolVar(&cliCfg.SSH, "ssh", false, "Open an AWS-StartSSHSession on stdin/stdout for use as an SSH ProxyCommand (--remote-port defaults to 22)")
+	flag.BoolVar(&cliCfg.Pipe, "pipe", false, "Relay stdin/stdout to --remote-host:--remote-port through the session, with no local listener")
+	flag.BoolVar(&cliCfg.KeepAlive, "keep-alive", false, "Probe the local port periodically so SSM does not close an idle session (off by default; each probe opens a connection to the remote service)")
+	flag.BoolVar(&cliCfg.KeepAlive, "keepalive", false, "Alias for --keep-alive")
+	flag.DurationVar(&cliCfg.KeepAliveInterval, "keep-alive-interval", 0, "Time between keep-alive probes (default 30s)")
+	flag.DurationVar(&cliCfg.KeepAliveInterval, "keepalive-interval", 0, "Alias for --keep-alive-interval")
+	flag.StringVar(&cliCfg.KeepAliveStrategy, "keepalive-strategy", "", "Keep-alive probe, which also turns on --keep-alive: tcp-connect (default), tcp-probe, protocol:<http|redis|postgres>, or none")
+	flag.BoolVar(&cliCfg.KeepAliveRoundTrip, "keepalive-roundtrip", false, "Require the far end to answer the tcp-probe keep-alive, so broken tunnels are not reported healthy")
+	flag.BoolVar(&cliCfg.Monitor, "monitor", false, "Run as a synthetic probe: keep the session open, check the remote service through it periodically, and exit nonzero after sustained failure (not for real traffic)")
+	flag.DurationVar(&cliCfg.MonitorInterval, "monitor-interval", 0, "Time between --monitor probes (default 15s)")
+	flag.IntVar(&cliCfg.MonitorFailures, "monitor-failures", 0, "Consecutive failed --monitor probes after which the tool exits (default 3)")
+	flag.StringVar(&cliCfg.Protocol, "protocol", "", "Protocol spoken through the tunnel: tcp (default), http, or https")
+	flag.StringVar(&cliCfg.PostDisconnect, "post-disconnect", "", "Shell command run after the session ends, gracefully or with an error; $"+exitReasonEnv+" says why")
+	flag.BoolVar(&cliCfg.PreferFresh, "prefer-fresh", false, "Re-resolve --instance-name periodically and move the tunnel to a newer healthy instance when one appears")
+	flag.DurationVar(&cliCfg.PreferFreshInterval, "prefer-fresh-interval", defaultPreferFreshInterval, "How often --prefer-fresh looks for a newer instance")
+	flag.StringVar(&cliCfg.PreferFreshPolicy, "prefer-fresh-policy", freshPolicyIdle, "When --prefer-fresh migrates: idle (once no connections are open, needs --forwarder native) or immediate")
+	flag.IntVar(&cliCfg.Reconnect, "reconnect", 0, "Start a new session up to this many times in a row, with exponential backoff, when the session drops (0 = off, -1 = until Ctrl-C)")
+	flag.BoolVar(&cliCfg.KillExisting, "kill-existing", false, "Terminate your active sessions to the instance that use the same document before starting")
+	flag.StringVar(&cliCfg.SSMEndpoint, "ssm-endpoint", "", "SSM endpoint URL for the API calls and the session, e.g. a FIPS or VPC endpoint (default https://ssm.<region>.amazonaws.com)")
+	flag.BoolVar(&cliCfg.Replace, "replace", false, "Stop another aws-go-forward that forwards the same local port before starting")
+	flag.BoolVar(&cliCfg.PluginFallback, "plugin-fallback", false, "Run the installed session-manager-plugin on the same session if the embedded plugin fails or panics")
+	flag.StringVar(&cliCfg.Forwarder, "forwarder", "", "Local listener: plugin (default, the session plugin binds the port) or native (the tool relays to the plugin)")
+	flag.DurationVar(&cliCfg.ReadTimeout, "read-timeout", 0, "Close a forwarded connection when no data moves in either direction for this long (native forwarder, 0 = disabled)")
+	flag.DurationVar(&cliCfg.WriteTimeout, "write-timeout", 0, "Close a forwarded connection when a write to a peer blocks for this long (native forwarder, 0 = disabled)")
+	flag.IntVar(&cliCfg.AcceptConcurrency, "accept-concurrency", 0, "Number of goroutines accepting local connections (native forwarder, default 1)")
+	flag.IntVar(&cliCfg.ListenBacklog, "listen-backlog", 0, "Listen backlog of the local port, capped by the system's somaxconn (native forwarder, not on Windows; default the system's)")
+	flag.Var((*stringListFlag)(&cliCfg.AllowCIDRs), "allow-cidr", "Also accept local connections from client addresses in this CIDR, besides loopback (native forwarder, repeatable; needs a non-loopback --bind-address)")
+	flag.StringVar(&cliCfg.BindAddress, "bind-address", "", "Address the native forwarder listens on, e.g. 0.0.0.0 to serve other hosts allowed by --allow-cidr (default 127.0.0.1)")
+	flag.StringVar(&cliCfg.SessionReason, "session-reason", "", "Reason recorded on the SSM session (default: local user and hostname)")
+	flag.BoolVar(&cliCfg.NoAutoReason, "no-auto-reason", false, "Do not record the local user and hostname as the session reason")
+	flag.BoolVar(&openInBrowser, "open", false, "Open http(s)://localhost:<local-port> in the default browser once the tunnel is ready (requires --protocol http or https)")
+	flag.IntVar(&cliCfg.MaxSessions, "max-sessions", 0, "Maximum number of SSM sessions open at once; additional forwards wait for a free slot (0 = unlimited)")
+	flag.IntVar(&cliCfg.ConnectRetries, "connect-retries", 0, "Try connecting to the local port up to this many times, 250ms apart, and print when it accepts connections (0 = off)")
+	flag.DurationVar(&cliCfg.MaxStartupTime, "max-startup-time", 0, "Give up if the tunnel is not up within this long, across every startup lookup and wait (e.g. 45s; 0 = no limit)")
+	flag.DurationVar(&cliCfg.ResolveTimeout, "resolve-timeout", 0, "Give up if resolving the instance and remote endpoint takes longer than this (e.g. 10s; 0 = no limit)")
+	flag.BoolVar(&outputAWSEnv, "output-aws-env", false, "Print AWS_PROFILE/AWS_REGION and the forward coordinates as shell exports once the session starts")
+	flag.BoolVar(&notify, "notify", false, "Show a desktop notification when the tunnel is ready and when it closes or fails")
+	flag.StringVar(&statsDAddr, "statsd-addr", "", "Send session metrics as StatsD over UDP to this host:port")
+	flag.StringVar(&statsDPrefix, "statsd-prefix", defaultStatsDPrefix, "Prefix of the StatsD metric names")
+	flag.StringVar(&summaryFile, "summary-file", "", "Write a JSON summary of the run (duration, sessions, reconnects, keep-alive failures, bytes) to this file on shutdown, also after an error")
+	flag.StringVar(&eventsSocket, "events-socket", "", "Stream JSON lifecycle events to clients connected to this Unix socket path")
+	flag.StringVar(&controlFile, "control-file", "", "Shut down gracefully when this file is removed or contains \"stop\"")
+	flag.BoolVar(&describeInstance, "describe-instance", false, "Print EC2 and SSM details of the resolved instance and exit without starting a session")
+	flag.BoolVar(&listDocuments, "list-documents-for-session", false, "List the Session documents in the region that take localPortNumber or portNumber, for --document-name, and exit (needs only --profile and --region)")
+	flag.BoolVar(&dumpParameters, "dump-parameters", false, "Print the StartSession request as JSON and exit without starting a session")
+	flag.BoolVar(&probe, "probe-session", false, "Start a session to the instance, terminate it right away and report the timing, without binding a local port or starting the plugin")
+	flag.BoolVar(&validateDocumentFirst, "validate-document", false, "Check that the SSM document exists before starting the session")
+	flag.BoolVar(&checkAgent, "check-agent-version", false, "Warn before starting the session when the instance's SSM agent is older than "+minimumAgentVersion)
+	flag.StringVar(&errorFormat, "error-format", errorFormatText, "How fatal errors are written to stderr: text, or json for one object with code, message, phase, exit_code and AWS error details")
+	var logFormat string
+	flag.StringVar(&logFormat, "log-format", logFormatText, "How log messages are written to stderr: text, or json for one object per line with time, level and message")
+	var verbose bool
+	flag.BoolVar(&verbose, "verbose", false, "Also log debug messages, such as every keep-alive probe, and every lifecycle event")
+	var timing bool
+	flag.BoolVar(&timing, "timing", false, "Once the tunnel is ready, log how long each startup phase took: credentials, identity, instance resolution, checks, StartSession and the plugin")
+	args, err := expandArgsFiles(os.Args[1:], os.ReadFile)
+	if err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	flag.CommandLine.Parse(args)
+	if err := validateErrorFormat(errorFormat); err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	if err := validateLogFormat(logFormat); err != nil {
+		log.Fatalf("Invalid options: %v", err)
+	}
+	setupLogging(logFormat, verbose, os.Stderr)
+	fatal := func(phase, format string, err error) {
+		exitFatal(errorFormat, newFatalError(phase, fmt.Sprintf(format, err), err))
+	}
+
+	events := newEventBus()
+	// The summary is also written when a fatal error exits the process.
+	var stopSummary func(reason string, err error, sent, received *atomic.Int64) runSummary
+	if summaryFile != "" {
+		stopSummary = startSummary(events, time.Now)
+		fatalExitHook = fatalSummaryWriter(summaryFile, stopSummary)
+	}
+
+	if controlFile != "" {
+		if err := prepareControlFile(controlFile); err != nil {
+			fatal("options", "Invalid options: %v", err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go watchControlFile(ctx, controlFile, controlFilePollInterval, func(reason string) {
+			log.Printf("Shutting down: %s", reason)
+			cancel()
+		})
+	}
+
+	stopEventLog := func() {}
+	if logFormat == logFormatJSON || verbose {
+		stopEventLog = startEventLog(events, slog.Default())
+	}
+	if eventsSocket != "" {
+		server, err := serveEventSocket(eventsSocket, events)
+		if err != nil {
+			fatal("events", "Failed to open events socket: %v", err)
+		}
+		defer server.Close()
+	}
+	stopStatsD := func() {}
+	if statsDAddr != "" {
+		if err := validateStatsDAddr(statsDAddr); err != nil {
+			fatal("options", "Invalid options: %v", err)
+		}
+		conn, err := net.Dial("udp", statsDAddr)
+		if err != nil {
+			fatal("statsd", "Failed to open StatsD connection: %v", err)
+		}
+		defer conn.Close()
+		stopStatsD = startStatsD(events, conn, strings.Trim(statsDPrefix, "."))
+	}
+
+	setFlags := collectSetFlags(flag.CommandLine)
+	cfg := cliCfg
+
+	var remoteCfg *ini.File
+	if remoteConfigURL != "" {
+		if err := validateRemoteConfigURL(remoteConfigURL); err != nil {
+			fatal("options", "Invalid options: %v", err)
+		}
+		header, err := parseRemoteConfigHeaders(remoteConfigHeaders)
+		if err != nil {
+			fatal("options", "Invalid options: %v", err)
+		}
+		source := remoteConfigSource{URL: remoteConfigURL, Header: header, CacheTTL: remoteConfigCache}
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			source.CacheDir = filepath.Join(cacheDir, "aws-go-forward")
+		}
+		remoteCfg, err = loadRemoteConfig(ctx, &http.Client{Timeout: remoteConfigTimeoutFlag}, source)
+		if err != nil {
+			fatal("config", "Failed to load remote configuration: %v", err)
+		}
+	}
+
+	if remoteCfg != nil || configFile != "" {
+		fileCfg, err := loadConfigLayers(remoteCfg, configFile)
+		if err != nil {
+			fatal("config", "Failed to load configuration file: %v", err)
+		}
+		cfg = mergeConfigWithCLIOverrides(*fileCfg, cliCfg, setFlags)
+	}
+
+	// Listing documents needs no instance or remote endpoint.
+	if listDocuments {
+		cfg.Profile = strings.TrimSpace(cfg.Profile)
+		if cfg.Profile == "" {
+			fatal("config", "Invalid configuration: %v. Use --help for more information.", ErrMissingProfile)
+		}
+		awsCfg, err := createAWSSession(ctx, cfg.Profile, cfg.Region)
+		if err != nil {
+			fatalStartup(ctx, errorFormat, "credentials", "Failed to create AWS session", err)
+		}
+		if _, err := resolveRegion(awsCfg, cfg.Profile); err != nil {
+			fatal("config", "Invalid configuration: %v", err)
+		}
+		documents, err := listForwardingDocuments(ctx, ssm.NewFromConfig(awsCfg, cfg.ssmClientOptions()...))
+		if err != nil {
+			fatalStartup(ctx, errorFormat, "document", "Failed to list documents", err)
+		}
+		fmt.Print(formatForwardingDocuments(documents))
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fatal("config", "Invalid configuration: %v. Use --help for more information.", err)
+	}
+	cfg, err = applyRemoteService(cfg)
+	if err != nil {
+		fatal("config", "Invalid configuration: %v", err)
+	}
+	cfg = applyDirect(cfg)
+	if cfg.InstanceID == stdinInstanceID {
+		var err error
+		cfg.InstanceID, err = readInstanceID(os.Stdin)
+		if err != nil {
+			fatal("config", "Invalid configuration: %v", err)
+		}
+	}
+	if err := validateSelectionOptions(cfg, allowAny); err != nil {
+		fatal("options", "Invalid selection options: %v. Use --help for more information.", err)
+	}
+	if err := validateOpenOptions(cfg, openInBrowser); err != nil {
+		fatal("options", "Invalid options: %v. Use --help for more information.", err)
+	}
+
+	if regions := cfg.regions(); len(regions) > 1 {
+		if eventsSocket != "" {
+			fatal("options", "Invalid options: %v", ErrMultiRegionWithEventsSocket)
+		}
+		if summaryFile != "" {
+			fatal("options", "Invalid options: %v", ErrMultiRegionWithSummaryFile)
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			fatal("regions", "Failed to start regions: %v", err)
+		}
+		regionArgsFor := func(region string, i int) []string {
+			return regionArgs(flag.CommandLine, args, cfg, region, i)
+		}
+		if err := runRegions(ctx, executable, regionArgsFor, regions, os.Stdout, os.Stderr); err != nil {
+			fatal("session", "Session failed: %v", err)
+		}
+		return
+	}
+
+	if strings.TrimSpace(cfg.Profile) == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			fatal("profile", "Failed to resolve profile: %v", err)
+		}
+		profiles, err := listProfiles(sharedConfigFiles(os.Getenv, home))
+		if err != nil {
+			fatal("profile", "Failed to resolve profile: %v", err)
+		}
+		cfg.Profile, err = resolveProfilePrefix(strings.TrimSpace(cfg.ProfilePrefix), profiles)
+		if err != nil {
+			fatal("profile", "Failed to resolve profile: %v", err)
+		}
+		log.Printf("Using profile %s", cfg.Profile)
+	} else {
+		cfg.Profile = strings.TrimSpace(cfg.Profile)
+		// A file the tool cannot read is left for the SDK to report.
+		if home, err := os.UserHomeDir(); err == nil {
+			if profiles, err := listProfiles(sharedConfigFiles(os.Getenv, home)); err == nil {
+				if err := checkProfile(cfg.Profile, profiles); err != nil {
+					fatal("config", "Invalid configuration: %v", err)
+				}
+			}
+		}
+	}
+
+	deadline := startupDeadline(time.Now(), cfg.MaxStartupTime)
+	startupCtx, cancelStartup := withStartupDeadline(ctx, deadline)
+	defer cancelStartup()
+
+	var timer *startupTimer
+	if timing {
+		timer = newStartupTimer(time.Now())
+	}
+	awsCfg, err := createAWSSession(startupCtx, cfg.Profile, cfg.Region)
+	if err != nil {
+		fatalStartup(startupCtx, errorFormat, "credentials", "Failed to create AWS session", err)
+	}
+	cfg.Region, err = resolveRegion(awsCfg, cfg.Profile)
+	if err != nil {
+		fatal("config", "Invalid configuration: %v", err)
+	}
+	timer.mark(timingCredentials, time.Now())
+	if timing {
+		// Only timed: a failure here, say without a route to STS, does not
+		// stop the tunnel.
+		if _, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(startupCtx, &sts.GetCallerIdentityInput{}); err != nil {
+			log.Printf("Identity check failed: %v", startupFailure(startupCtx, err))
+		}
+		timer.mark(timingIdentity, time.Now())
+	}
+
+	// Resolving the instance and the remote endpoint has its own limit.
+	resolveCtx, cancelResolve := withResolveTimeout(startupCtx, cfg.ResolveTimeout)
+	defer cancelResolve()
+
+	if cfg.ResolverURL != "" {
+		header, err := parseResolverHeaders(resolverHeaders)
+		if err != nil {
+			fatal("options", "Invalid options: %v", err)
+		}
+		resolved, err := queryResolver(resolveCtx, &http.Client{Timeout: resolverTimeout}, cfg.ResolverURL, header, newResolverRequest(cfg))
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to resolve instance", err)
+		}
+		cfg, err = applyResolverResponse(cfg, resolved)
+		if err != nil {
+			fatal("resolve", "Failed to resolve instance: %v", err)
+		}
+	}
+
+	if cfg.cloudMapEnabled() {
+		endpoints, err := discoverServiceEndpoints(resolveCtx, servicediscovery.NewFromConfig(awsCfg), cfg.CloudMapNamespace, cfg.CloudMapService)
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to discover service endpoint", err)
+		}
+		endpoint, err := pickServiceEndpoint(endpoints, cfg.CloudMapSelection, randomIndex)
+		if err != nil {
+			fatal("resolve", "Failed to discover service endpoint: %v", err)
+		}
+		cfg, err = applyServiceEndpoint(cfg, endpoint)
+		if err != nil {
+			fatal("resolve", "Failed to discover service endpoint: %v", err)
+		}
+		log.Printf("Forwarding to %s/%s at %s", cfg.CloudMapNamespace, cfg.CloudMapService, serviceEndpoint{Host: cfg.RemoteHost, Port: cfg.RemotePort})
+	}
+
+	if cfg.eksEnabled() {
+		ref, _ := parseK8sService(cfg.K8sService)
+		kube, err := newEKSKubernetesClient(resolveCtx, eks.NewFromConfig(awsCfg), sts.NewPresignClient(sts.NewFromConfig(awsCfg)), cfg.EKSCluster)
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to resolve Kubernetes service", err)
+		}
+		endpoint, source, err := resolveK8sService(resolveCtx, kube, ref)
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to resolve Kubernetes service", err)
+		}
+		cfg, err = applyServiceEndpoint(cfg, endpoint)
+		if err != nil {
+			fatal("resolve", "Failed to resolve Kubernetes service: %v", err)
+		}
+		log.Printf("Forwarding to %s in %s at %s (%s)", ref, cfg.EKSCluster, serviceEndpoint{Host: cfg.RemoteHost, Port: cfg.RemotePort}, source)
+	}
+
+	ec2Client := ec2.NewFromConfig(awsCfg)
+	ssmClient := ssm.NewFromConfig(awsCfg, cfg.ssmClientOptions()...)
+	var instanceID string
+	if isManagedInstanceID(cfg.InstanceID) {
+		instanceID, err = getManagedInstanceID(resolveCtx, ssmClient, cfg.InstanceID)
+	} else {
+		instanceID, err = resolveInstanceID(resolveCtx, ec2Client, cfg, allowAny)
+	}
+	if err != nil {
+		fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to get instance ID", err)
+	}
+	if describeInstance {
+		details, err := describeInstanceDetails(resolveCtx, ec2Client, ssmClient, instanceID, cfg.interfaceChoice())
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "describe", "Failed to describe instance", err)
+		}
+		fmt.Print(formatInstanceDetails(details))
+		return
+	}
+	if err := checkRequiredTags(resolveCtx, ec2Client, instanceID, cfg.RequireTags); err != nil {
+		fatalStartup(resolveCtx, errorFormat, "resolve", "Instance rejected", err)
+	}
+	var remotePorts []int
+	if cfg.ForwardTaggedPorts {
+		remotePorts, err = taggedRemotePorts(resolveCtx, ec2Client, instanceID)
+		if err != nil {
+			fatalStartup(resolveCtx, errorFormat, "resolve", "Failed to read forwarded ports", err)
+		}
+		cfg.Count = len(remotePorts)
+		if strings.TrimSpace(cfg.RemoteHost) == "" {
+			cfg.RemoteHost = defaultTaggedPortsHost
+		}
+	}
+	cancelResolve()
+	timer.mark(timingResolve, time.Now())
+	events.Emit(lifecycleEvent{Type: eventInstanceResolved, InstanceID: instanceID})
+
+	documentName := cfg.resolvedDocumentName()
+	if checkAgent {
+		if err := checkAgentVersion(startupCtx, ssmClient, instanceID); err != nil && !interrupted(startupCtx) {
+			log.Printf("Warning: %v", startupFailure(startupCtx, err))
+		}
+	}
+	if validateDocumentFirst {
+		if err := validateDocument(startupCtx, ssmClient, documentName); err != nil {
+			fatalStartup(startupCtx, errorFormat, "document", "Failed to validate document", err)
+		}
+	}
+
+	if probe {
+		probeCfg := cfg
+		if len(remotePorts) > 0 {
+			probeCfg.RemotePort = remotePorts[0]
+		}
+		if len(cfg.Forwards) > 0 {
+			probeCfg = sectionForwards(cfg, make([]int, forwardSectionAutoPorts(cfg.Forwards)))[0]
+		}
+		result, err := probeSession(startupCtx, ssmClient, instanceID, documentName, probeCfg.sessionParameters(), sessionReason(probeCfg, user.Current, os.Hostname), time.Now)
+		if err != nil {
+			fatalStartup(startupCtx, errorFormat, "probe", "Failed to probe session", err)
+		}
+		fmt.Println(result)
+		return
+	}
+
+	var forwards []Config
+	var labels []string
+	if len(cfg.Forwards) > 0 {
+		var autoPorts []int
+		if n := forwardSectionAutoPorts(cfg.Forwards); n > 0 {
+			autoCfg := cfg
+			autoCfg.Count = n
+			autoPorts, err = forwardLocalPorts(autoCfg, listenLocalPort)
+			if err != nil {
+				fatal("local_port", "Failed to allocate local port: %v", err)
+			}
+		}
+		forwards = sectionForwards(cfg, autoPorts)
+		labels = forwardSectionLabels(cfg.Forwards)
+		for i, forward := range forwards {
+			fmt.Printf("Forwarding %s: localhost:%d -> %s\n", labels[i], forward.LocalPort, serviceEndpoint{Host: forward.RemoteHost, Port: forward.RemotePort})
+		}
+	} else {
+		ports, err := forwardLocalPorts(cfg, listenLocalPort)
+		if err != nil {
+			fatal("local_port", "Failed to allocate local port: %v", err)
+		}
+		forwards = forwardConfigs(cfg, ports, remotePorts)
+	}
+	if cfg.ForwardTaggedPorts {
+		for _, forward := range forwards {
+			fmt.Printf("Forwarding localhost:%d -> %s\n", forward.LocalPort, serviceEndpoint{Host: forward.RemoteHost, Port: forward.RemotePort})
+		}
+	} else if !cfg.SSH && len(cfg.Forwards) == 0 && cfg.LocalPort == 0 && strings.TrimSpace(cfg.LocalPortRange) != "" {
+		if len(forwards) == 1 {
+			fmt.Printf("Using local port %d from pool %s\n", forwards[0].LocalPort, cfg.LocalPortRange)
+		} else {
+			ports := make([]int, len(forwards))
+			for i, forward := range forwards {
+				ports[i] = forward.LocalPort
+			}
+			fmt.Printf("Using local ports %v from pool %s\n", ports, cfg.LocalPortRange)
+		}
+	}
+
+	if dumpParameters {
+		dumpCfg := forwards[0]
+		input := newStartSessionInput(instanceID, documentName, dumpCfg.sessionParameters(), sessionReason(dumpCfg, user.Current, os.Hostname))
+		out, err := formatStartSessionInput(input)
+		if err != nil {
+			fatal("dump_parameters", "Failed to dump parameters: %v", err)
+		}
+		fmt.Print(out)
+		return
+	}
+
+	releaseLocks := func() {}
+	if !cfg.SSH && !cfg.Pipe {
+		if dir, err := defaultTunnelLockDir(); err != nil {
+			log.Printf("Failed to find the tunnel lock directory, not checking for other tunnels: %v", err)
+		} else {
+			release, err := newTunnelLocks(dir).lockForwards(forwards, instanceID, cfg.Replace)
+			if err != nil {
+				fatal("local_port", "Failed to lock local port: %v", err)
+			}
+			releaseLocks = release
+			defer releaseLocks()
+			// A fatal exit skips the deferred release.
+			exitHook := fatalExitHook
+			fatalExitHook = func(report fatalError) {
+				releaseLocks()
+				if exitHook != nil {
+					exitHook(report)
+				}
+			}
+		}
+	}
+
+	// Ports the tool picked itself were free a moment ago.
+	if !cfg.SSH && (cfg.LocalPort != 0 || len(cfg.Forwards) > 0) {
+		if port, err := checkLocalPortsFree(forwards, listenLocalPort); errors.Is(err, ErrLocalPortInUse) {
+			exitFatal(errorFormat, newFatalError("local_port", fmt.Sprintf("Local port %d is already in use; stop the program holding it or choose another --local-port", port), err))
+		} else if err != nil {
+			fatal("local_port", "Failed to bind local port: %v", err)
+		}
+	}
+
+	if cfg.KillExisting {
+		terminated, err := killExistingSessions(startupCtx, ssmClient, sts.NewFromConfig(awsCfg), instanceID, documentName)
+		if err != nil {
+			fatalStartup(startupCtx, errorFormat, "kill_existing", "Failed to terminate existing sessions", err)
+		}
+		log.Printf("Terminated %d existing session(s) to %s", terminated, instanceID)
+	}
+
+	wake := newWakeNotifier()
+	go watchSuspend(ctx, wake.Notify)
+	go watchClockGaps(ctx, clockGapCheckInterval, clockGapThreshold, wake.Notify)
+
+	stopNotifications := func() {}
+	if notify {
+		stopNotifications = startNotifications(events, cfg.Reconnect != 0 || cfg.PreferFresh, sendNotification)
+	}
+
+	limiter := newSessionLimiter(cfg.MaxSessions)
+	opts := forwardOptions{
+		InstanceID:      instanceID,
+		DocumentName:    documentName,
+		OpenInBrowser:   openInBrowser,
+		OutputAWSEnv:    outputAWSEnv,
+		WatchReady:      eventsSocket != "" || notify || timing,
+		AutoLocalPort:   !cfg.SSH && !cfg.Pipe && !cfg.ForwardTaggedPorts && len(cfg.Forwards) == 0 && cfg.LocalPort == 0 && strings.TrimSpace(cfg.LocalPortRange) == "",
+		Wake:            wake,
+		StartupDeadline: deadline,
+		// The embedded plugin may exit the process when its session
+		// closes, which would skip the post-disconnect command or a
+		// migration to a fresher instance or a reconnect. It also writes
+		// to stdout, which carries the stream with --pipe.
+		Isolated: cfg.PostDisconnect != "" || cfg.PreferFresh || cfg.Reconnect != 0 || cfg.Pipe,
+	}
+	if cfg.Reconnect != 0 {
+		opts.Reconnect = &reconnectPolicy{
+			attempts:       cfg.Reconnect,
+			initialBackoff: reconnectInitialBackoff,
+			maxBackoff:     reconnectMaxBackoff,
+			stableAfter:    reconnectStableAfter,
+			resolve: func(ctx context.Context) (string, error) {
+				ctx, cancel := withResolveTimeout(ctx, cfg.ResolveTimeout)
+				defer cancel()
+				var id string
+				var err error
+				if isManagedInstanceID(cfg.InstanceID) {
+					id, err = getManagedInstanceID(ctx, ssmClient, cfg.InstanceID)
+				} else {
+					id, err = resolveInstanceID(ctx, ec2Client, cfg, allowAny)
+				}
+				if err != nil {
+					return "", err
+				}
+				return id, checkRequiredTags(ctx, ec2Client, id, cfg.RequireTags)
+			},
+			now: time.Now,
+		}
+	}
+	if summaryFile != "" && cfg.nativeForwarder() {
+		opts.BytesSent, opts.BytesReceived = new(atomic.Int64), new(atomic.Int64)
+	}
+	runAll := func(ctx context.Context, opts forwardOptions) error {
+		if len(forwards) == 1 && labels == nil {
+			return runForwardReconnecting(ctx, forwards[0], ssmClient, limiter, events, opts)
+		}
+		return runForwards(ctx, forwards, labels, ssmClient, limiter, events, opts)
+	}
+	stopTiming := func() {}
+	if timing {
+		timer.mark(timingChecks, time.Now())
+		stopTiming = startTiming(events, timer, !cfg.SSH && !cfg.Pipe, logStartupTiming)
+	}
+	if cfg.PreferFresh {
+		fresh := preferFresh{
+			interval: cmp.Or(cfg.PreferFreshInterval, defaultPreferFreshInterval),
+			find:     freshInstanceFinder{ec2Client: ec2Client, ssmClient: ssmClient, filter: cfg.instanceFilter(), requireTags: cfg.RequireTags}.find,
+			resolved: func(id string) {
+				events.Emit(lifecycleEvent{Type: eventInstanceResolved, InstanceID: id})
+			},
+		}
+		if cfg.preferFreshPolicy() == freshPolicyIdle {
+			opts.Connections = new(atomic.Int64)
+			fresh.idle = func() bool { return opts.Connections.Load() == 0 }
+			fresh.idlePoll = freshIdlePollInterval
+		}
+		err = fresh.run(ctx, instanceID, func(ctx context.Context, id string) error {
+			forwardOpts := opts
+			forwardOpts.InstanceID = id
+			// The startup budget only covers the first session.
+			if id != instanceID {
+				forwardOpts.StartupDeadline = time.Time{}
+			}
+			return runAll(ctx, forwardOpts)
+		})
+	} else {
+		err = runAll(ctx, opts)
+	}
+	events.Emit(lifecycleEvent{Type: eventShutdown})
+	stopTiming()
+	stopNotifications()
+	stopEventLog()
+	stopStatsD()
+	// The summary and the locks are handled here from now on.
+	fatalExitHook = nil
+	if stopSummary != nil {
+		summary := stopSummary(exitReason(ctx, err), err, opts.BytesSent, opts.BytesReceived)
+		summary.StartupTiming = timer.Phases()
+		if writeErr := writeSummaryFile(summaryFile, summary); writeErr != nil {
+			log.Printf("Failed to write summary file: %v", writeErr)
+		}
+	}
+	if cfg.PostDisconnect != "" {
+		hookOut := io.Writer(os.Stdout)
+		if cfg.SSH || cfg.Pipe {
+			hookOut = os.Stderr
+		}
+		env := postDisconnectEnv(exitReason(ctx, err), err, instanceID, forwards[0].LocalPort)
+		if hookErr := runPostDisconnect(cfg.PostDisconnect, env, hookOut, postDisconnectTimeout); hookErr != nil {
+			log.Printf("Post-disconnect command failed: %v", hookErr)
+		}
+	}
+	if err != nil {
+		releaseLocks()
+		fatal("session", "Session failed: %v", explainVersionMismatch(context.Background(), ssmClient, instanceID, err))
+	}
+}
@@ -0,0 +1,1936 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type fakeEC2Client struct {
+	output   *ec2.DescribeInstancesOutput
+	err      error
+	gotInput *ec2.DescribeInstancesInput
+}
+
+func (f *fakeEC2Client) DescribeInstances(_ context.Context, input *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	f.gotInput = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.output, nil
+}
+
+// fakePagedEC2Client serves pages[i] for the i-th call and links pages
+// through NextToken.
+type fakePagedEC2Client struct {
+	pages []*ec2.DescribeInstancesOutput
+	calls int
+}
+
+func (f *fakePagedEC2Client) DescribeInstances(_ context.Context, input *ec2.DescribeInstancesInput, _ ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	page := *f.pages[f.calls]
+	f.calls++
+	if f.calls < len(f.pages) {
+		page.NextToken = aws.String(fmt.Sprintf("page-%d", f.calls))
+	}
+	return &page, nil
+}
+
+type fakeSSMClient struct {
+	output   *ssm.StartSessionOutput
+	err      error
+	gotInput *ssm.StartSessionInput
+}
+
+func (f *fakeSSMClient) StartSession(_ context.Context, input *ssm.StartSessionInput, _ ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	f.gotInput = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.output, nil
+}
+
+type fakeSSMDocumentClient struct {
+	output   *ssm.DescribeDocumentOutput
+	err      error
+	gotInput *ssm.DescribeDocumentInput
+}
+
+func (f *fakeSSMDocumentClient) DescribeDocument(_ context.Context, input *ssm.DescribeDocumentInput, _ ...func(*ssm.Options)) (*ssm.DescribeDocumentOutput, error) {
+	f.gotInput = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.output, nil
+}
+
+func TestLoadConfigFromFile(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := strings.Join([]string{
+		"[settings]",
+		"profile = default",
+		"region = us-east-1",
+		"instance_name = my-ec2-instance",
+		"local_port = 3306",
+		"remote_host = db.internal",
+		"remote_port = 3306",
+		"use_builtin = true",
+	}, "\n")
+
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := loadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+
+	if cfg.Profile != "default" {
+		t.Fatalf("Profile = %q, want %q", cfg.Profile, "default")
+	}
+	if cfg.Region != "us-east-1" {
+		t.Fatalf("Region = %q, want %q", cfg.Region, "us-east-1")
+	}
+	if cfg.InstanceName != "my-ec2-instance" {
+		t.Fatalf("InstanceName = %q, want %q", cfg.InstanceName, "my-ec2-instance")
+	}
+	if cfg.LocalPort != 3306 {
+		t.Fatalf("LocalPort = %d, want %d", cfg.LocalPort, 3306)
+	}
+	if cfg.RemoteHost != "db.internal" {
+		t.Fatalf("RemoteHost = %q, want %q", cfg.RemoteHost, "db.internal")
+	}
+	if cfg.RemotePort != 3306 {
+		t.Fatalf("RemotePort = %d, want %d", cfg.RemotePort, 3306)
+	}
+}
+
+func TestLoadConfigFromFileForwarderSettings(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := strings.Join([]string{
+		"[settings]",
+		"profile = default",
+		"instance_name = bastion",
+		"local_port = 3306",
+		"remote_host = db.internal",
+		"remote_port = 3306",
+		"forwarder = native",
+		"read_timeout = 5m",
+		"write_timeout = 30s",
+	}, "\n")
+
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := loadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	if !cfg.nativeForwarder() {
+		t.Fatalf("Forwarder = %q, want native", cfg.Forwarder)
+	}
+	if cfg.ReadTimeout != 5*time.Minute || cfg.WriteTimeout != 30*time.Second {
+		t.Fatalf("timeouts = %s/%s, want 5m0s/30s", cfg.ReadTimeout, cfg.WriteTimeout)
+	}
+}
+
+func TestLoadConfigFromFileMissingFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := loadConfigFromFile(filepath.Join(t.TempDir(), "does-not-exist.ini"))
+	if err == nil {
+		t.Fatal("expected error for missing config file, got nil")
+	}
+}
+
+func TestLoadConfigFromFileMissingSettingsSection(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := strings.Join([]string{
+		"[other]",
+		"profile = default",
+	}, "\n")
+
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	_, err := loadConfigFromFile(configPath)
+	if !errors.Is(err, ErrMissingSettingsSection) {
+		t.Fatalf("expected %v, got %v", ErrMissingSettingsSection, err)
+	}
+}
+
+func TestLoadConfigFromFileMalformedINI(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := "[settings\nprofile = default"
+
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	_, err := loadConfigFromFile(configPath)
+	if err == nil {
+		t.Fatal("expected parse error for malformed INI, got nil")
+	}
+}
+
+func TestLoadConfigFromFileInvalidValueType(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := strings.Join([]string{
+		"[settings]",
+		"profile = default",
+		"region = us-east-1",
+		"instance_name = my-ec2-instance",
+		"local_port = not-a-number",
+		"remote_host = db.internal",
+		"remote_port = 3306",
+	}, "\n")
+
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	_, err := loadConfigFromFile(configPath)
+	if err == nil {
+		t.Fatal("expected parse error for invalid local_port type, got nil")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := Config{
+		Profile:      "default",
+		Region:       "us-east-1",
+		InstanceName: "bastion",
+		LocalPort:    3306,
+		RemoteHost:   "db.internal",
+		RemotePort:   3306,
+	}
+	validByID := Config{
+		Profile:    "default",
+		Region:     "us-east-1",
+		InstanceID: "i-1234567890",
+		LocalPort:  3306,
+		RemoteHost: "db.internal",
+		RemotePort: 3306,
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "valid", cfg: valid},
+		{name: "valid with instance id", cfg: validByID},
+		{name: "missing profile", cfg: Config{Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrMissingProfile},
+		{name: "whitespace profile", cfg: Config{Profile: "   ", Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrMissingProfile},
+		{name: "missing region is resolved later", cfg: Config{Profile: valid.Profile, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}},
+		{name: "missing instance selector", cfg: Config{Profile: valid.Profile, Region: valid.Region, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrMissingInstanceSelector},
+		{name: "both instance selectors set", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, InstanceID: "i-1234567890", LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}},
+		{name: "local port chosen by the os", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}},
+		{name: "invalid local port low", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: -1, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrInvalidLocalPort},
+		{name: "local port pool instead of local port", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPortRange: "6000-6100", RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}},
+		{name: "invalid local port pool", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPortRange: "6100-6000", RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrInvalidLocalPortRange},
+		{name: "invalid local port high", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: 70000, RemoteHost: valid.RemoteHost, RemotePort: valid.RemotePort}, wantErr: ErrInvalidLocalPort},
+		{name: "missing remote host", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemotePort: valid.RemotePort}, wantErr: ErrMissingRemoteHost},
+		{name: "whitespace remote host", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: " \t ", RemotePort: valid.RemotePort}, wantErr: ErrMissingRemoteHost},
+		{name: "missing remote port", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost}, wantErr: ErrMissingRemotePort},
+		{name: "invalid remote port low", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: -1}, wantErr: ErrInvalidRemotePort},
+		{name: "invalid remote port high", cfg: Config{Profile: valid.Profile, Region: valid.Region, InstanceName: valid.InstanceName, LocalPort: valid.LocalPort, RemoteHost: valid.RemoteHost, RemotePort: 70000}, wantErr: ErrInvalidRemotePort},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.cfg.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMergeConfigKeepAliveAliases(t *testing.T) {
+	t.Parallel()
+
+	cli := Config{KeepAlive: true, KeepAliveInterval: time.Minute}
+	for _, setFlags := range []map[string]bool{
+		{"keep-alive": true, "keep-alive-interval": true},
+		{"keepalive": true, "keepalive-interval": true},
+	} {
+		got := mergeConfigWithCLIOverrides(Config{}, cli, setFlags)
+		if !got.KeepAlive || got.KeepAliveInterval != time.Minute {
+			t.Errorf("flags %v: expected keep-alive every 1m, got %v every %s", setFlags, got.KeepAlive, got.KeepAliveInterval)
+		}
+	}
+}
+
+func TestMergeConfigWithCLIOverrides(t *testing.T) {
+	t.Parallel()
+
+	base := Config{
+		Profile:      "profile-from-config",
+		Region:       "us-east-1",
+		InstanceName: "instance-from-config",
+		InstanceID:   "",
+		LocalPort:    3306,
+		RemoteHost:   "db-from-config.internal",
+		RemotePort:   3306,
+	}
+
+	cli := Config{
+		Profile:      "profile-from-cli",
+		Region:       "eu-west-1",
+		InstanceName: "instance-from-cli",
+		InstanceID:   "i-from-cli",
+		LocalPort:    5432,
+		RemoteHost:   "db-from-cli.internal",
+		RemotePort:   5432,
+	}
+
+	tests := []struct {
+		name     string
+		setFlags map[string]bool
+		want     Config
+	}{
+		{
+			name:     "no explicit CLI flags uses config baseline",
+			setFlags: map[string]bool{},
+			want:     base,
+		},
+		{
+			name:     "explicit subset overrides only those fields",
+			setFlags: map[string]bool{"profile": true, "local-port": true},
+			want: Config{
+				Profile:      "profile-from-cli",
+				Region:       "us-east-1",
+				InstanceName: "instance-from-config",
+				InstanceID:   "",
+				LocalPort:    5432,
+				RemoteHost:   "db-from-config.internal",
+				RemotePort:   3306,
+			},
+		},
+		{
+			name:     "all config-related flags override baseline",
+			setFlags: map[string]bool{"profile": true, "region": true, "instance-name": true, "local-port": true, "remote-host": true, "remote-port": true},
+			want: Config{
+				Profile:      "profile-from-cli",
+				Region:       "eu-west-1",
+				InstanceName: "instance-from-cli",
+				InstanceID:   "",
+				LocalPort:    5432,
+				RemoteHost:   "db-from-cli.internal",
+				RemotePort:   5432,
+			},
+		},
+		{
+			name:     "instance-id override clears config instance-name",
+			setFlags: map[string]bool{"instance-id": true},
+			want: Config{
+				Profile:      "profile-from-config",
+				Region:       "us-east-1",
+				InstanceName: "",
+				InstanceID:   "i-from-cli",
+				LocalPort:    3306,
+				RemoteHost:   "db-from-config.internal",
+				RemotePort:   3306,
+			},
+		},
+		{
+			name: "instance-name override clears config instance-id",
+			setFlags: map[string]bool{
+				"instance-name": true,
+			},
+			want: Config{
+				Profile:      "profile-from-config",
+				Region:       "us-east-1",
+				InstanceName: "instance-from-cli",
+				InstanceID:   "",
+				LocalPort:    3306,
+				RemoteHost:   "db-from-config.internal",
+				RemotePort:   3306,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := mergeConfigWithCLIOverrides(base, cli, tt.setFlags)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeConfigWithCLIOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigPrecedenceWithParsedFlags(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("aws-go-forward", flag.ContinueOnError)
+
+	var configFile string
+	var cliCfg Config
+
+	fs.StringVar(&configFile, "config", "", "Path to configuration file in INI format (optional)")
+	fs.StringVar(&cliCfg.Profile, "profile", "", "AWS profile name")
+	fs.StringVar(&cliCfg.Region, "region", "", "AWS region")
+	fs.StringVar(&cliCfg.InstanceName, "instance-name", "", "Name of the instance used for forwarding")
+	fs.StringVar(&cliCfg.InstanceID, "instance-id", "", "Instance ID used for forwarding")
+	fs.IntVar(&cliCfg.LocalPort, "local-port", 0, "Local port")
+	fs.StringVar(&cliCfg.RemoteHost, "remote-host", "", "Remote host")
+	fs.IntVar(&cliCfg.RemotePort, "remote-port", 0, "Remote port")
+
+	err := fs.Parse([]string{"--config", "cfg.ini", "--profile", "cli-profile", "--local-port", "15432", "--instance-id", "i-cli"})
+	if err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	base := Config{
+		Profile:      "cfg-profile",
+		Region:       "us-east-1",
+		InstanceName: "cfg-instance",
+		InstanceID:   "",
+		LocalPort:    3306,
+		RemoteHost:   "cfg-host",
+		RemotePort:   3306,
+	}
+
+	got := mergeConfigWithCLIOverrides(base, cliCfg, collectSetFlags(fs))
+	want := Config{
+		Profile:      "cli-profile",
+		Region:       "us-east-1",
+		InstanceName: "",
+		InstanceID:   "i-cli",
+		LocalPort:    15432,
+		RemoteHost:   "cfg-host",
+		RemotePort:   3306,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged config = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveInstanceIDByName(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns running instance and builds expected filter", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-stopped"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}},
+							{InstanceId: aws.String("i-running"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if got != "i-running" {
+			t.Fatalf("instance id = %q, want %q", got, "i-running")
+		}
+		if client.gotInput == nil {
+			t.Fatal("DescribeInstances input was not captured")
+		}
+		if len(client.gotInput.Filters) != 1 {
+			t.Fatalf("filters length = %d, want 1", len(client.gotInput.Filters))
+		}
+		f := client.gotInput.Filters[0]
+		if aws.ToString(f.Name) != "tag:Name" {
+			t.Fatalf("filter name = %q, want %q", aws.ToString(f.Name), "tag:Name")
+		}
+		if len(f.Values) != 1 || f.Values[0] != "bastion" {
+			t.Fatalf("filter values = %v, want [bastion]", f.Values)
+		}
+	})
+
+	t.Run("returns error when no reservations exist", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{},
+			},
+		}
+
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if !errors.Is(err, ErrNoRunningInstances) {
+			t.Fatalf("expected %v, got %v", ErrNoRunningInstances, err)
+		}
+	})
+
+	t.Run("returns error for nil instance state", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{{
+					Instances: []ec2types.Instance{{
+						InstanceId: aws.String("i-unknown"),
+						State:      nil,
+					}},
+				}},
+			},
+		}
+
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if !errors.Is(err, ErrInvalidInstanceState) {
+			t.Fatalf("expected %v, got %v", ErrInvalidInstanceState, err)
+		}
+	})
+
+	t.Run("returns error for running instance with nil instance id", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{{
+					Instances: []ec2types.Instance{{
+						InstanceId: nil,
+						State:      &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+					}},
+				}},
+			},
+		}
+
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if !errors.Is(err, ErrMissingInstanceID) {
+			t.Fatalf("expected %v, got %v", ErrMissingInstanceID, err)
+		}
+	})
+
+	t.Run("skips malformed entries when valid running instance exists", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-bad-state"), State: nil},
+							{InstanceId: nil, State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+							{InstanceId: aws.String("i-good"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if got != "i-good" {
+			t.Fatalf("instance id = %q, want %q", got, "i-good")
+		}
+	})
+
+	t.Run("handles multiple reservations with one running match", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-stopped-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}},
+						},
+					},
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-running-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if got != "i-running-1" {
+			t.Fatalf("instance id = %q, want %q", got, "i-running-1")
+		}
+	})
+
+	t.Run("errors on multiple running matches without any", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-running-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+							{InstanceId: aws.String("i-running-2"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if !errors.Is(err, ErrMultipleRunningInstances) {
+			t.Fatalf("expected %v, got %v", ErrMultipleRunningInstances, err)
+		}
+	})
+
+	t.Run("allows multiple running matches when any is set", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-running-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+							{InstanceId: aws.String("i-running-2"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+		chooserCalled := false
+
+		got, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, true, defaultAcceptStates, 0, func(n int) (int, error) {
+			chooserCalled = true
+			if n != 2 {
+				t.Fatalf("chooser n = %d, want 2", n)
+			}
+			return 1, nil
+		})
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if !chooserCalled {
+			t.Fatal("chooser was not called")
+		}
+		if got != "i-running-2" {
+			t.Fatalf("instance id = %q, want %q", got, "i-running-2")
+		}
+	})
+
+	t.Run("propagates API error", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("boom")
+		client := &fakeEC2Client{err: wantErr}
+
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, func(_ int) (int, error) {
+			return 0, nil
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("expected wrapped error %v, got %v", wantErr, err)
+		}
+	})
+}
+
+func TestParseAcceptStates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		want    []ec2types.InstanceStateName
+		wantErr error
+	}{
+		{value: "", want: []ec2types.InstanceStateName{ec2types.InstanceStateNameRunning}},
+		{value: "running, Stopping,running", want: []ec2types.InstanceStateName{ec2types.InstanceStateNameRunning, ec2types.InstanceStateNameStopping}},
+		{value: "running,sleeping", wantErr: ErrInvalidAcceptState},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAcceptStates(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAcceptStates() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("states = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveInstanceIDAcceptStates(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeEC2Client{
+		output: &ec2.DescribeInstancesOutput{
+			Reservations: []ec2types.Reservation{
+				{
+					Instances: []ec2types.Instance{
+						{InstanceId: aws.String("i-target"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopping}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, cfg := range []Config{
+		{InstanceName: "bastion", AcceptStates: "running,stopping"},
+		{InstanceID: "i-target", AcceptStates: "running,stopping"},
+	} {
+		got, err := resolveInstanceID(context.Background(), client, cfg, false)
+		if err != nil {
+			t.Fatalf("resolveInstanceID(%+v) unexpected error: %v", cfg, err)
+		}
+		if got != "i-target" {
+			t.Fatalf("instance id = %q, want %q", got, "i-target")
+		}
+	}
+
+	if _, err := resolveInstanceID(context.Background(), client, Config{InstanceID: "i-target", AcceptStates: "running"}, false); !errors.Is(err, ErrInstanceNotRunning) {
+		t.Fatalf("expected %v, got %v", ErrInstanceNotRunning, err)
+	}
+	if _, err := resolveInstanceID(context.Background(), client, Config{InstanceName: "bastion"}, false); !errors.Is(err, ErrNoRunningInstances) {
+		t.Fatalf("expected %v, got %v", ErrNoRunningInstances, err)
+	}
+}
+
+func TestGetInstanceIDByNamePagination(t *testing.T) {
+	t.Parallel()
+
+	page := func(states ...ec2types.InstanceStateName) *ec2.DescribeInstancesOutput {
+		instances := make([]ec2types.Instance, len(states))
+		for i, state := range states {
+			instances[i] = ec2types.Instance{InstanceId: aws.String(fmt.Sprintf("i-%s-%d", state, i)), State: &ec2types.InstanceState{Name: state}}
+		}
+		return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: instances}}}
+	}
+	stopped, running := ec2types.InstanceStateNameStopped, ec2types.InstanceStateNameRunning
+	chooseFirst := func(int) (int, error) { return 0, nil }
+
+	t.Run("finds match on a later page", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakePagedEC2Client{pages: []*ec2.DescribeInstancesOutput{page(stopped), page(stopped), page(running)}}
+		got, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, chooseFirst)
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if got != "i-running-0" {
+			t.Fatalf("instance id = %q, want %q", got, "i-running-0")
+		}
+		if client.calls != 3 {
+			t.Fatalf("DescribeInstances calls = %d, want 3", client.calls)
+		}
+	})
+
+	t.Run("stops once a second match makes the result ambiguous", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakePagedEC2Client{pages: []*ec2.DescribeInstancesOutput{page(running), page(running), page(running)}}
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, chooseFirst)
+		if !errors.Is(err, ErrMultipleRunningInstances) {
+			t.Fatalf("expected %v, got %v", ErrMultipleRunningInstances, err)
+		}
+		if client.calls != 2 {
+			t.Fatalf("DescribeInstances calls = %d, want 2", client.calls)
+		}
+	})
+
+	t.Run("any mode reads every page", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakePagedEC2Client{pages: []*ec2.DescribeInstancesOutput{page(running), page(running), page(running)}}
+		var candidates int
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, true, defaultAcceptStates, 0, func(n int) (int, error) {
+			candidates = n
+			return 0, nil
+		})
+		if err != nil {
+			t.Fatalf("getInstanceIDByName() unexpected error: %v", err)
+		}
+		if candidates != 3 {
+			t.Fatalf("candidates = %d, want 3", candidates)
+		}
+	})
+
+	t.Run("first page strategy", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakePagedEC2Client{pages: []*ec2.DescribeInstancesOutput{page(stopped), page(running)}}
+		_, err := getInstanceIDByName(context.Background(), client, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 1, chooseFirst)
+		if !errors.Is(err, ErrNoRunningInstances) {
+			t.Fatalf("expected %v, got %v", ErrNoRunningInstances, err)
+		}
+		if client.calls != 1 {
+			t.Fatalf("DescribeInstances calls = %d, want 1", client.calls)
+		}
+	})
+}
+
+func TestDescribeMaxPages(t *testing.T) {
+	t.Parallel()
+
+	for value, want := range map[string]int{"": 0, "all": 0, "First": 1} {
+		got, err := describeMaxPages(value)
+		if err != nil {
+			t.Fatalf("describeMaxPages(%q) unexpected error: %v", value, err)
+		}
+		if got != want {
+			t.Fatalf("describeMaxPages(%q) = %d, want %d", value, got, want)
+		}
+	}
+	if _, err := describeMaxPages("some"); !errors.Is(err, ErrInvalidDescribePagination) {
+		t.Fatalf("expected %v, got %v", ErrInvalidDescribePagination, err)
+	}
+}
+
+func TestReadInstanceID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "first line", input: "i-0123456789abcdef0\ni-0fedcba9876543210\n", want: "i-0123456789abcdef0"},
+		{name: "no trailing newline", input: "  i-0123456789abcdef0 ", want: "i-0123456789abcdef0"},
+		{name: "empty", input: "", wantErr: ErrInvalidInstanceID},
+		{name: "not an instance id", input: "bastion\n", wantErr: ErrInvalidInstanceID},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := readInstanceID(strings.NewReader(tt.input))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readInstanceID() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("instance id = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidateStdinInstanceIDWithSSH(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceID: "-", SSH: true}
+	if err := cfg.Validate(); !errors.Is(err, ErrStdinInstanceIDWithSSH) {
+		t.Fatalf("expected %v, got %v", ErrStdinInstanceIDWithSSH, err)
+	}
+}
+
+func TestFormatStartSessionInput(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}
+	input := newStartSessionInput("i-0123456789abcdef0", "Custom-Forwarding", cfg.sessionParameters(), "ticket OPS-1")
+	out, err := formatStartSessionInput(input)
+	if err != nil {
+		t.Fatalf("formatStartSessionInput() unexpected error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if got["Target"] != "i-0123456789abcdef0" || got["DocumentName"] != "Custom-Forwarding" || got["Reason"] != "ticket OPS-1" {
+		t.Fatalf("output = %s, want target, document and reason", out)
+	}
+	parameters, ok := got["Parameters"].(map[string]any)
+	if !ok || len(parameters) != 3 {
+		t.Fatalf("Parameters = %v, want localPortNumber, host and portNumber", got["Parameters"])
+	}
+}
+
+func TestCheckRequiredTags(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeEC2Client{
+		output: &ec2.DescribeInstancesOutput{
+			Reservations: []ec2types.Reservation{
+				{
+					Instances: []ec2types.Instance{
+						{
+							InstanceId: aws.String("i-target"),
+							Tags: []ec2types.Tag{
+								{Key: aws.String("Owner"), Value: aws.String("platform")},
+								{Key: aws.String("CostCenter"), Value: aws.String("")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := checkRequiredTags(context.Background(), client, "i-target", []string{"Owner"}); err != nil {
+		t.Fatalf("checkRequiredTags() unexpected error: %v", err)
+	}
+	err := checkRequiredTags(context.Background(), client, "i-target", []string{"Owner", "CostCenter", "Team"})
+	if !errors.Is(err, ErrMissingRequiredTag) {
+		t.Fatalf("expected %v, got %v", ErrMissingRequiredTag, err)
+	}
+	if !strings.Contains(err.Error(), "CostCenter, Team") {
+		t.Fatalf("error %q does not name the missing tags", err)
+	}
+}
+
+func TestLoadConfigFromFileRequireTags(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := "[settings]\nprofile = default\ninstance_name = bastion\nrequire_tags = Owner, CostCenter\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := loadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	if want := []string{"Owner", "CostCenter"}; !reflect.DeepEqual(cfg.RequireTags, want) {
+		t.Fatalf("RequireTags = %q, want %q", cfg.RequireTags, want)
+	}
+}
+
+func TestGetInstanceIDByID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns running instance and builds expected instance-id query", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-target"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if err != nil {
+			t.Fatalf("getInstanceIDByID() unexpected error: %v", err)
+		}
+		if got != "i-target" {
+			t.Fatalf("instance id = %q, want %q", got, "i-target")
+		}
+		if client.gotInput == nil {
+			t.Fatal("DescribeInstances input was not captured")
+		}
+		if len(client.gotInput.InstanceIds) != 1 || client.gotInput.InstanceIds[0] != "i-target" {
+			t.Fatalf("instance IDs query = %v, want [i-target]", client.gotInput.InstanceIds)
+		}
+	})
+
+	t.Run("returns not found when instance does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{},
+			},
+		}
+
+		_, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if !errors.Is(err, ErrInstanceNotFound) {
+			t.Fatalf("expected %v, got %v", ErrInstanceNotFound, err)
+		}
+	})
+
+	t.Run("returns not running when instance is stopped", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-target"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped}},
+						},
+					},
+				},
+			},
+		}
+
+		_, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if !errors.Is(err, ErrInstanceNotRunning) {
+			t.Fatalf("expected %v, got %v", ErrInstanceNotRunning, err)
+		}
+	})
+
+	t.Run("returns error for nil instance state", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-target"), State: nil},
+						},
+					},
+				},
+			},
+		}
+
+		_, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if !errors.Is(err, ErrInvalidInstanceState) {
+			t.Fatalf("expected %v, got %v", ErrInvalidInstanceState, err)
+		}
+	})
+
+	t.Run("returns error for nil instance id", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: nil, State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		_, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if !errors.Is(err, ErrMissingInstanceID) {
+			t.Fatalf("expected %v, got %v", ErrMissingInstanceID, err)
+		}
+	})
+
+	t.Run("propagates API error", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("boom")
+		client := &fakeEC2Client{err: wantErr}
+
+		_, err := getInstanceIDByID(context.Background(), client, "i-target", defaultAcceptStates)
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("expected wrapped error %v, got %v", wantErr, err)
+		}
+	})
+}
+
+func TestResolveRegion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns region from loaded config", func(t *testing.T) {
+		t.Parallel()
+
+		got, err := resolveRegion(aws.Config{Region: "eu-west-1"}, "default")
+		if err != nil {
+			t.Fatalf("resolveRegion() unexpected error: %v", err)
+		}
+		if got != "eu-west-1" {
+			t.Fatalf("region = %q, want %q", got, "eu-west-1")
+		}
+	})
+
+	t.Run("returns actionable error when region is empty", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := resolveRegion(aws.Config{}, "sandbox")
+		if !errors.Is(err, ErrMissingRegion) {
+			t.Fatalf("expected %v, got %v", ErrMissingRegion, err)
+		}
+		if !strings.Contains(err.Error(), `"sandbox"`) || !strings.Contains(err.Error(), "--region") {
+			t.Fatalf("error %q does not name the profile and the --region flag", err)
+		}
+	})
+}
+
+func TestValidateSelectionOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		allowAny bool
+		wantErr  error
+	}{
+		{
+			name:     "any with instance id is invalid",
+			cfg:      Config{InstanceID: "i-1234567890"},
+			allowAny: true,
+			wantErr:  ErrAnyRequiresInstanceName,
+		},
+		{
+			name:     "any with instance name is valid",
+			cfg:      Config{InstanceName: "bastion"},
+			allowAny: true,
+			wantErr:  nil,
+		},
+		{
+			name:     "instance name without any is valid",
+			cfg:      Config{InstanceName: "bastion"},
+			allowAny: false,
+			wantErr:  nil,
+		},
+		{
+			name:     "instance id without any is valid",
+			cfg:      Config{InstanceID: "i-1234567890"},
+			allowAny: false,
+			wantErr:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateSelectionOptions(tt.cfg, tt.allowAny)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateMaxSessions(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", LocalPort: 3306, RemoteHost: "db.internal", RemotePort: 3306, MaxSessions: 4}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	cfg.MaxSessions = -1
+	if err := cfg.Validate(); !errors.Is(err, ErrInvalidMaxSessions) {
+		t.Fatalf("expected %v, got %v", ErrInvalidMaxSessions, err)
+	}
+}
+
+func TestConfigValidateConnectRetries(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", LocalPort: 3306, RemoteHost: "db.internal", RemotePort: 3306, Policy: Policy{ConnectRetries: 5}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	cfg.ConnectRetries = -1
+	if err := cfg.Validate(); !errors.Is(err, ErrInvalidConnectRetries) {
+		t.Fatalf("expected %v, got %v", ErrInvalidConnectRetries, err)
+	}
+}
+
+func TestConfigValidateCount(t *testing.T) {
+	t.Parallel()
+
+	base := Config{Profile: "default", InstanceName: "bastion", LocalPort: 6000, RemoteHost: "db.internal", RemotePort: 5432}
+
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr error
+	}{
+		{name: "consecutive ports", mutate: func(c *Config) { c.Count = 10 }},
+		{name: "pool ports", mutate: func(c *Config) {
+			c.LocalPort = 0
+			c.LocalPortRange = "6000-6100"
+			c.Count = 10
+		}},
+		{name: "negative", mutate: func(c *Config) { c.Count = -1 }, wantErr: ErrInvalidCount},
+		{name: "past last port", mutate: func(c *Config) {
+			c.LocalPort = 65530
+			c.Count = 10
+		}, wantErr: ErrInvalidCount},
+		{name: "ssh mode", mutate: func(c *Config) {
+			c.SSH = true
+			c.Count = 2
+		}, wantErr: ErrCountWithSSH},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := base
+			tt.mutate(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateForwarder(t *testing.T) {
+	t.Parallel()
+
+	base := Config{Profile: "default", InstanceName: "bastion", LocalPort: 3306, RemoteHost: "db.internal", RemotePort: 3306}
+
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr error
+	}{
+		{name: "default plugin forwarder", mutate: func(*Config) {}},
+		{name: "native with timeouts", mutate: func(c *Config) {
+			c.Forwarder = "native"
+			c.ReadTimeout = time.Minute
+			c.WriteTimeout = 10 * time.Second
+		}},
+		{name: "unknown forwarder", mutate: func(c *Config) { c.Forwarder = "socks" }, wantErr: ErrInvalidForwarder},
+		{name: "timeouts without native", mutate: func(c *Config) { c.ReadTimeout = time.Minute }, wantErr: ErrTimeoutRequiresNative},
+		{name: "native with accept concurrency", mutate: func(c *Config) {
+			c.Forwarder = "native"
+			c.AcceptConcurrency = 8
+		}},
+		{name: "accept concurrency without native", mutate: func(c *Config) { c.AcceptConcurrency = 8 }, wantErr: ErrAcceptConcurrencyRequiresNative},
+		{name: "negative accept concurrency", mutate: func(c *Config) {
+			c.Forwarder = "native"
+			c.AcceptConcurrency = -1
+		}, wantErr: ErrInvalidAcceptConcurrency},
+		{name: "negative timeout", mutate: func(c *Config) {
+			c.Forwarder = "native"
+			c.WriteTimeout = -time.Second
+		}, wantErr: ErrInvalidTimeout},
+		{name: "listen backlog without native", mutate: func(c *Config) { c.ListenBacklog = 64 }, wantErr: ErrListenBacklogRequiresNative},
+		{name: "negative listen backlog", mutate: func(c *Config) {
+			c.Forwarder = "native"
+			c.ListenBacklog = -1
+		}, wantErr: ErrInvalidListenBacklog},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := base
+			tt.mutate(&cfg)
+			err := cfg.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateOpenOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		open    bool
+		wantErr error
+	}{
+		{name: "open disabled", cfg: Config{}, open: false},
+		{name: "open with http", cfg: Config{Protocol: "http"}, open: true},
+		{name: "open with https", cfg: Config{Protocol: "HTTPS"}, open: true},
+		{name: "open without protocol", cfg: Config{}, open: true, wantErr: ErrOpenRequiresHTTP},
+		{name: "open with tcp", cfg: Config{Protocol: "tcp"}, open: true, wantErr: ErrOpenRequiresHTTP},
+		{name: "open in ssh mode", cfg: Config{Protocol: "http", SSH: true}, open: true, wantErr: ErrOpenRequiresHTTP},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateOpenOptions(tt.cfg, tt.open)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateProtocol(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", LocalPort: 8080, RemoteHost: "admin.internal", RemotePort: 443, Protocol: "https"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	cfg.Protocol = "gopher"
+	if err := cfg.Validate(); !errors.Is(err, ErrInvalidProtocol) {
+		t.Fatalf("expected %v, got %v", ErrInvalidProtocol, err)
+	}
+}
+
+func TestWaitForLocalPort(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns once port accepts connections", func(t *testing.T) {
+		t.Parallel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer listener.Close()
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		if err := waitForLocalPort(context.Background(), localHost{}, port, time.Second, 10*time.Millisecond, 0); err != nil {
+			t.Fatalf("waitForLocalPort() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("times out when nothing listens", func(t *testing.T) {
+		t.Parallel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		err = waitForLocalPort(context.Background(), localHost{}, port, 50*time.Millisecond, 10*time.Millisecond, 0)
+		if !errors.Is(err, ErrLocalPortNotReady) {
+			t.Fatalf("expected %v, got %v", ErrLocalPortNotReady, err)
+		}
+	})
+
+	t.Run("gives up after connect retries", func(t *testing.T) {
+		t.Parallel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+
+		err = waitForLocalPort(context.Background(), localHost{}, port, time.Minute, 10*time.Millisecond, 3)
+		if !errors.Is(err, ErrLocalPortNotReady) {
+			t.Fatalf("expected %v, got %v", ErrLocalPortNotReady, err)
+		}
+		if !strings.Contains(err.Error(), "after 3 attempts") {
+			t.Fatalf("error %q does not name the attempts", err)
+		}
+	})
+
+	t.Run("stops when context is cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := waitForLocalPort(ctx, localHost{}, 1, time.Second, 10*time.Millisecond, 0)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestResolveInstanceID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("uses an explicit instance id without describing instances", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{err: errors.New("AccessDenied: ec2:DescribeInstances")}
+		got, err := resolveInstanceID(context.Background(), client, Config{InstanceID: " i-target ", InstanceName: "bastion"}, false)
+		if err != nil {
+			t.Fatalf("resolveInstanceID() unexpected error: %v", err)
+		}
+		if got != "i-target" {
+			t.Fatalf("instance id = %q, want %q", got, "i-target")
+		}
+		if client.gotInput != nil {
+			t.Fatalf("expected no DescribeInstances call, got %+v", client.gotInput)
+		}
+	})
+
+	t.Run("checks the instance id state when accept states is set", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-target"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := resolveInstanceID(context.Background(), client, Config{InstanceID: "i-target", AcceptStates: "running"}, false)
+		if err != nil {
+			t.Fatalf("resolveInstanceID() unexpected error: %v", err)
+		}
+		if got != "i-target" {
+			t.Fatalf("instance id = %q, want %q", got, "i-target")
+		}
+		if client.gotInput == nil {
+			t.Fatal("DescribeInstances input was not captured")
+		}
+		if len(client.gotInput.InstanceIds) != 1 || client.gotInput.InstanceIds[0] != "i-target" {
+			t.Fatalf("instance IDs query = %v, want [i-target]", client.gotInput.InstanceIds)
+		}
+	})
+
+	t.Run("uses instance name path when instance id is empty", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{
+						Instances: []ec2types.Instance{
+							{InstanceId: aws.String("i-running"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+						},
+					},
+				},
+			},
+		}
+
+		got, err := resolveInstanceID(context.Background(), client, Config{InstanceName: "bastion"}, false)
+		if err != nil {
+			t.Fatalf("resolveInstanceID() unexpected error: %v", err)
+		}
+		if got != "i-running" {
+			t.Fatalf("instance id = %q, want %q", got, "i-running")
+		}
+		if client.gotInput == nil {
+			t.Fatal("DescribeInstances input was not captured")
+		}
+		if len(client.gotInput.Filters) != 1 {
+			t.Fatalf("filters length = %d, want 1", len(client.gotInput.Filters))
+		}
+		f := client.gotInput.Filters[0]
+		if aws.ToString(f.Name) != "tag:Name" {
+			t.Fatalf("filter name = %q, want %q", aws.ToString(f.Name), "tag:Name")
+		}
+		if len(f.Values) != 1 || f.Values[0] != "bastion" {
+			t.Fatalf("filter values = %v, want [bastion]", f.Values)
+		}
+	})
+}
+
+func TestFormatAWSEnv(t *testing.T) {
+	t.Parallel()
+
+	t.Run("includes profile region and forward coordinates", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := Config{Profile: "prod", Region: "eu-west-1", LocalPort: 15432, RemoteHost: "db.internal", RemotePort: 5432}
+		got := formatAWSEnv(cfg, "i-123", "session-abc")
+		want := strings.Join([]string{
+			"export AWS_PROFILE='prod'",
+			"export AWS_REGION='eu-west-1'",
+			"export AWS_GO_FORWARD_INSTANCE_ID='i-123'",
+			"export AWS_GO_FORWARD_SESSION_ID='session-abc'",
+			"export AWS_GO_FORWARD_LOCAL_PORT='15432'",
+			"export AWS_GO_FORWARD_REMOTE_HOST='db.internal'",
+			"export AWS_GO_FORWARD_REMOTE_PORT='5432'",
+			"",
+		}, "\n")
+		if got != want {
+			t.Fatalf("formatAWSEnv() =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("omits port coordinates in ssh mode and quotes values", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := Config{Profile: "it's", Region: "us-east-1", SSH: true}
+		got := formatAWSEnv(cfg, "i-123", "session-abc")
+		if strings.Contains(got, "LOCAL_PORT") {
+			t.Fatalf("ssh mode output should not include local port:\n%s", got)
+		}
+		if !strings.Contains(got, `export AWS_PROFILE='it'"'"'s'`) {
+			t.Fatalf("profile was not shell-quoted:\n%s", got)
+		}
+	})
+}
+
+func TestSessionReason(t *testing.T) {
+	t.Parallel()
+
+	currentUser := func() (*user.User, error) { return &user.User{Username: "alice"}, nil }
+	hostname := func() (string, error) { return "jump-1", nil }
+	failingUser := func() (*user.User, error) { return nil, errors.New("no user") }
+	failingHostname := func() (string, error) { return "", errors.New("no hostname") }
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		currentUser func() (*user.User, error)
+		hostname    func() (string, error)
+		want        string
+	}{
+		{name: "auto reason", cfg: Config{}, currentUser: currentUser, hostname: hostname, want: "aws-go-forward by alice@jump-1"},
+		{name: "explicit reason wins", cfg: Config{SessionReason: " TICKET-42 "}, currentUser: currentUser, hostname: hostname, want: "TICKET-42"},
+		{name: "opt out", cfg: Config{NoAutoReason: true}, currentUser: currentUser, hostname: hostname, want: ""},
+		{name: "explicit reason with opt out", cfg: Config{SessionReason: "TICKET-42", NoAutoReason: true}, currentUser: currentUser, hostname: hostname, want: "TICKET-42"},
+		{name: "lookup failures", cfg: Config{}, currentUser: failingUser, hostname: failingHostname, want: "aws-go-forward by unknown@unknown"},
+		{name: "truncated to api limit", cfg: Config{SessionReason: strings.Repeat("x", 300)}, currentUser: currentUser, hostname: hostname, want: strings.Repeat("x", maxSessionReasonLength)},
+		{name: "truncated on a rune boundary", cfg: Config{SessionReason: "x" + strings.Repeat("é", 200)}, currentUser: currentUser, hostname: hostname, want: "x" + strings.Repeat("é", 127)},
+		{name: "invalid utf-8 dropped", cfg: Config{}, currentUser: currentUser, hostname: func() (string, error) { return "jump-\xff1", nil }, want: "aws-go-forward by alice@jump-1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := sessionReason(tt.cfg, tt.currentUser, tt.hostname); got != tt.want {
+				t.Fatalf("sessionReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartPortForwarding(t *testing.T) {
+	t.Parallel()
+
+	t.Run("builds expected StartSession request", func(t *testing.T) {
+		t.Parallel()
+
+		wantOutput := &ssm.StartSessionOutput{SessionId: aws.String("session-123")}
+		client := &fakeSSMClient{output: wantOutput}
+
+		got, err := startPortForwarding(context.Background(), client, "i-123", defaultDocumentName, Config{LocalPort: 3306, RemoteHost: "db.internal", RemotePort: 3306}.sessionParameters(), "")
+		if err != nil {
+			t.Fatalf("startPortForwarding() unexpected error: %v", err)
+		}
+		if got != wantOutput {
+			t.Fatal("startPortForwarding() did not return API output")
+		}
+		if client.gotInput == nil {
+			t.Fatal("StartSession input was not captured")
+		}
+		if aws.ToString(client.gotInput.Target) != "i-123" {
+			t.Fatalf("target = %q, want %q", aws.ToString(client.gotInput.Target), "i-123")
+		}
+		if aws.ToString(client.gotInput.DocumentName) != "AWS-StartPortForwardingSessionToRemoteHost" {
+			t.Fatalf("document name = %q, want %q", aws.ToString(client.gotInput.DocumentName), "AWS-StartPortForwardingSessionToRemoteHost")
+		}
+		if gotHost := client.gotInput.Parameters["host"]; len(gotHost) != 1 || gotHost[0] != "db.internal" {
+			t.Fatalf("host parameter = %v, want [db.internal]", gotHost)
+		}
+		if gotLocalPort := client.gotInput.Parameters["localPortNumber"]; len(gotLocalPort) != 1 || gotLocalPort[0] != "3306" {
+			t.Fatalf("localPortNumber parameter = %v, want [3306]", gotLocalPort)
+		}
+		if gotPort := client.gotInput.Parameters["portNumber"]; len(gotPort) != 1 || gotPort[0] != "3306" {
+			t.Fatalf("portNumber parameter = %v, want [3306]", gotPort)
+		}
+		if client.gotInput.Reason != nil {
+			t.Fatalf("reason = %q, want unset", aws.ToString(client.gotInput.Reason))
+		}
+	})
+
+	t.Run("sets reason when provided", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeSSMClient{output: &ssm.StartSessionOutput{}}
+		_, err := startPortForwarding(context.Background(), client, "i-123", defaultDocumentName, nil, "alice@laptop")
+		if err != nil {
+			t.Fatalf("startPortForwarding() unexpected error: %v", err)
+		}
+		if aws.ToString(client.gotInput.Reason) != "alice@laptop" {
+			t.Fatalf("reason = %q, want %q", aws.ToString(client.gotInput.Reason), "alice@laptop")
+		}
+	})
+
+	t.Run("propagates API error", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("ssm down")
+		client := &fakeSSMClient{err: wantErr}
+
+		_, err := startPortForwarding(context.Background(), client, "i-123", defaultDocumentName, Config{LocalPort: 3306, RemoteHost: "db.internal", RemotePort: 3306}.sessionParameters(), "")
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("expected wrapped error %v, got %v", wantErr, err)
+		}
+	})
+}
+
+func TestConfigResolvedDocumentName(t *testing.T) {
+	t.Parallel()
+
+	if got := (Config{}).resolvedDocumentName(); got != defaultDocumentName {
+		t.Fatalf("default document = %q, want %q", got, defaultDocumentName)
+	}
+	if got := (Config{DocumentName: " Custom-Forward "}).resolvedDocumentName(); got != "Custom-Forward" {
+		t.Fatalf("custom document = %q, want %q", got, "Custom-Forward")
+	}
+}
+
+func TestSSHModeSession(t *testing.T) {
+	t.Parallel()
+
+	t.Run("selects ssh document unless overridden", func(t *testing.T) {
+		t.Parallel()
+
+		if got := (Config{SSH: true}).resolvedDocumentName(); got != sshDocumentName {
+			t.Fatalf("document = %q, want %q", got, sshDocumentName)
+		}
+		if got := (Config{SSH: true, DocumentName: "Custom-SSH"}).resolvedDocumentName(); got != "Custom-SSH" {
+			t.Fatalf("document = %q, want %q", got, "Custom-SSH")
+		}
+	})
+
+	t.Run("defaults port number to 22", func(t *testing.T) {
+		t.Parallel()
+
+		got := (Config{SSH: true}).sessionParameters()
+		want := map[string][]string{"portNumber": {"22"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("parameters = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("uses remote port when set", func(t *testing.T) {
+		t.Parallel()
+
+		got := (Config{SSH: true, RemotePort: 2222}).sessionParameters()
+		want := map[string][]string{"portNumber": {"2222"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("parameters = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("validation does not require local port or remote host", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := Config{Profile: "default", InstanceID: "i-1234567890", SSH: true}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate() unexpected error: %v", err)
+		}
+		cfg.RemotePort = 70000
+		if err := cfg.Validate(); !errors.Is(err, ErrInvalidRemotePort) {
+			t.Fatalf("expected %v, got %v", ErrInvalidRemotePort, err)
+		}
+	})
+}
+
+func TestValidateDocument(t *testing.T) {
+	t.Parallel()
+
+	t.Run("accepts session document", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeSSMDocumentClient{
+			output: &ssm.DescribeDocumentOutput{
+				Document: &ssmtypes.DocumentDescription{DocumentType: ssmtypes.DocumentTypeSession},
+			},
+		}
+		if err := validateDocument(context.Background(), client, "Custom-Forward"); err != nil {
+			t.Fatalf("validateDocument() unexpected error: %v", err)
+		}
+		if aws.ToString(client.gotInput.Name) != "Custom-Forward" {
+			t.Fatalf("document name = %q, want %q", aws.ToString(client.gotInput.Name), "Custom-Forward")
+		}
+	})
+
+	t.Run("maps invalid document to not found", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeSSMDocumentClient{err: &ssmtypes.InvalidDocument{Message: aws.String("missing")}}
+		err := validateDocument(context.Background(), client, "Custom-Forward")
+		if !errors.Is(err, ErrDocumentNotFound) {
+			t.Fatalf("expected %v, got %v", ErrDocumentNotFound, err)
+		}
+	})
+
+	t.Run("rejects non-session document", func(t *testing.T) {
+		t.Parallel()
+
+		client := &fakeSSMDocumentClient{
+			output: &ssm.DescribeDocumentOutput{
+				Document: &ssmtypes.DocumentDescription{DocumentType: ssmtypes.DocumentTypeCommand},
+			},
+		}
+		err := validateDocument(context.Background(), client, "AWS-RunShellScript")
+		if !errors.Is(err, ErrInvalidDocumentType) {
+			t.Fatalf("expected %v, got %v", ErrInvalidDocumentType, err)
+		}
+	})
+
+	t.Run("propagates API error", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("access denied")
+		client := &fakeSSMDocumentClient{err: wantErr}
+		if err := validateDocument(context.Background(), client, "Custom-Forward"); !errors.Is(err, wantErr) {
+			t.Fatalf("expected wrapped error %v, got %v", wantErr, err)
+		}
+	})
+}
+
+func TestRunSessionLifecycle(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cancellation terminates session and stops keepalive", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		allowPluginExit := make(chan struct{})
+		pluginExited := make(chan struct{})
+		keepAliveStopped := make(chan struct{})
+		terminateCalled := make(chan struct{}, 1)
+
+		startPlugin := func() error {
+			defer close(pluginExited)
+			<-allowPluginExit
+			return nil
+		}
+		terminateSession := func(_ context.Context, sessionID string) error {
+			if sessionID != "session-123" {
+				t.Fatalf("sessionID = %q, want %q", sessionID, "session-123")
+			}
+			select {
+			case terminateCalled <- struct{}{}:
+			default:
+			}
+			close(allowPluginExit)
+			return nil
+		}
+		keepAliveFn := func(_ int, stopChan <-chan struct{}) {
+			<-stopChan
+			close(keepAliveStopped)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- runSessionLifecycle(ctx, 3306, "session-123", startPlugin, terminateSession, keepAliveFn)
+		}()
+
+		cancel()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("runSessionLifecycle() unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("runSessionLifecycle() did not return after cancellation")
+		}
+
+		select {
+		case <-terminateCalled:
+		default:
+			t.Fatal("terminateSession was not called")
+		}
+
+		select {
+		case <-keepAliveStopped:
+		default:
+			t.Fatal("keepalive did not stop")
+		}
+
+		select {
+		case <-pluginExited:
+		default:
+			t.Fatal("plugin did not exit")
+		}
+	})
+
+	t.Run("plugin error is returned and triggers termination", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("plugin failed")
+		keepAliveStopped := make(chan struct{})
+		terminateCalled := make(chan struct{}, 1)
+
+		startPlugin := func() error {
+			return wantErr
+		}
+		terminateSession := func(_ context.Context, sessionID string) error {
+			if sessionID != "session-123" {
+				t.Fatalf("sessionID = %q, want %q", sessionID, "session-123")
+			}
+			terminateCalled <- struct{}{}
+			return nil
+		}
+		keepAliveFn := func(_ int, stopChan <-chan struct{}) {
+			<-stopChan
+			close(keepAliveStopped)
+		}
+
+		err := runSessionLifecycle(context.Background(), 3306, "session-123", startPlugin, terminateSession, keepAliveFn)
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("expected %v, got %v", wantErr, err)
+		}
+
+		select {
+		case <-terminateCalled:
+		default:
+			t.Fatal("terminateSession was not called")
+		}
+
+		select {
+		case <-keepAliveStopped:
+		default:
+			t.Fatal("keepalive did not stop")
+		}
+	})
+
+	t.Run("terminate session failure is returned", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		terminateErr := errors.New("terminate failed")
+		allowPluginExit := make(chan struct{})
+
+		startPlugin := func() error {
+			<-allowPluginExit
+			return nil
+		}
+		terminateSession := func(_ context.Context, _ string) error {
+			close(allowPluginExit)
+			return terminateErr
+		}
+		keepAliveFn := func(_ int, stopChan <-chan struct{}) {
+			<-stopChan
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- runSessionLifecycle(ctx, 3306, "session-123", startPlugin, terminateSession, keepAliveFn)
+		}()
+
+		cancel()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, terminateErr) {
+				t.Fatalf("expected %v, got %v", terminateErr, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("runSessionLifecycle() did not return")
+		}
+	})
+}
+
+type fakeTerminateClient struct {
+	err         error
+	hasDeadline bool
+}
+
+func (f *fakeTerminateClient) TerminateSession(ctx context.Context, _ *ssm.TerminateSessionInput, _ ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	_, f.hasDeadline = ctx.Deadline()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ssm.TerminateSessionOutput{}, nil
+}
+
+func TestTerminateSessionOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	failed := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "terminated"},
+		{name: "already closed", err: &ssmtypes.DoesNotExistException{Message: aws.String("session not found")}},
+		{name: "failed", err: failed, wantErr: failed},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeTerminateClient{err: tt.err}
+			err := terminateSessionOnShutdown(context.Background(), client, "session-123", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if !client.hasDeadline {
+				t.Error("expected the terminate call to be bounded by a deadline")
+			}
+		})
+	}
+}
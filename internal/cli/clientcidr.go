@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidAllowCIDR          = errors.New("invalid allow cidr")
+	ErrAllowCIDRRequiresNative   = errors.New("allow cidr requires --forwarder native")
+	ErrAllowCIDRNeedsBindAddress = errors.New("allow cidr only matches non-loopback clients with a non-loopback --bind-address")
+	ErrInvalidBindAddress        = errors.New("invalid bind address")
+	ErrBindAddressRequiresNative = errors.New("bind address requires --forwarder native")
+)
+
+// loopbackClients are the clients the native forwarder always accepts.
+var loopbackClients = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+func parseAllowCIDRs(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidAllowCIDR, value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (c Config) validateAllowCIDRs() error {
+	if len(c.AllowCIDRs) == 0 {
+		return nil
+	}
+	prefixes, err := parseAllowCIDRs(c.AllowCIDRs)
+	if err != nil {
+		return err
+	}
+	if !c.nativeForwarder() {
+		return ErrAllowCIDRRequiresNative
+	}
+	// A loopback listener only ever sees loopback clients.
+	if bind, err := netip.ParseAddr(c.bindAddress()); err == nil && bind.IsLoopback() {
+		for _, prefix := range prefixes {
+			if !slices.ContainsFunc(loopbackClients, prefix.Overlaps) {
+				return fmt.Errorf("%w: %s", ErrAllowCIDRNeedsBindAddress, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// bindAddress is the address the native forwarder's listener binds.
+func (c Config) bindAddress() string {
+	if address := strings.TrimSpace(c.BindAddress); address != "" {
+		return address
+	}
+	return defaultLocalHost
+}
+
+func (c Config) validateBindAddress() error {
+	address := strings.TrimSpace(c.BindAddress)
+	if address == "" {
+		return nil
+	}
+	if _, err := netip.ParseAddr(address); err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidBindAddress, address, err)
+	}
+	if !c.nativeForwarder() {
+		return ErrBindAddressRequiresNative
+	}
+	return nil
+}
+
+// allowedClients returns the source prefixes the native forwarder accepts
+// connections from: loopback and --allow-cidr. The CIDRs have been
+// validated.
+func (c Config) allowedClients() []netip.Prefix {
+	prefixes, _ := parseAllowCIDRs(c.AllowCIDRs)
+	return append(slices.Clone(loopbackClients), prefixes...)
+}
+
+// clientAllowed reports whether addr falls in one of prefixes.
+func clientAllowed(prefixes []netip.Prefix, addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	return slices.ContainsFunc(prefixes, func(prefix netip.Prefix) bool { return prefix.Contains(ip) })
+}
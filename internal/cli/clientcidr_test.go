@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestConfigValidateAllowCIDRs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "none", cfg: Config{}},
+		{name: "native", cfg: Config{Forwarder: forwarderNative, BindAddress: "0.0.0.0", AllowCIDRs: []string{"10.0.0.0/8", " fd00::/8 "}}},
+		{name: "loopback listener", cfg: Config{Forwarder: forwarderNative, AllowCIDRs: []string{"10.0.0.0/8"}}, wantErr: ErrAllowCIDRNeedsBindAddress},
+		{name: "loopback prefix", cfg: Config{Forwarder: forwarderNative, AllowCIDRs: []string{"127.0.0.1/32"}}},
+		{name: "plugin", cfg: Config{AllowCIDRs: []string{"10.0.0.0/8"}}, wantErr: ErrAllowCIDRRequiresNative},
+		{name: "address", cfg: Config{Forwarder: forwarderNative, AllowCIDRs: []string{"10.0.0.1"}}, wantErr: ErrInvalidAllowCIDR},
+		{name: "bits", cfg: Config{Forwarder: forwarderNative, AllowCIDRs: []string{"10.0.0.0/33"}}, wantErr: ErrInvalidAllowCIDR},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateAllowCIDRs(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateBindAddress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "default", cfg: Config{}},
+		{name: "any", cfg: Config{Forwarder: forwarderNative, BindAddress: "0.0.0.0"}},
+		{name: "ipv6", cfg: Config{Forwarder: forwarderNative, BindAddress: "::"}},
+		{name: "plugin", cfg: Config{BindAddress: "0.0.0.0"}, wantErr: ErrBindAddressRequiresNative},
+		{name: "name", cfg: Config{Forwarder: forwarderNative, BindAddress: "localhost"}, wantErr: ErrInvalidBindAddress},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateBindAddress(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigAllowedClients(t *testing.T) {
+	t.Parallel()
+
+	if got := (Config{}).allowedClients(); !reflect.DeepEqual(got, loopbackClients) {
+		t.Errorf("expected %v, got %v", loopbackClients, got)
+	}
+	want := append(slices.Clone(loopbackClients), netip.MustParsePrefix("10.0.0.0/8"))
+	if got := (Config{AllowCIDRs: []string{"10.1.2.3/8"}}).allowedClients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestClientAllowed(t *testing.T) {
+	t.Parallel()
+
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	tests := []struct {
+		name string
+		addr net.Addr
+		want bool
+	}{
+		{name: "inside", addr: &net.TCPAddr{IP: net.ParseIP("10.20.30.40"), Port: 50000}, want: true},
+		{name: "mapped", addr: &net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 50000}, want: true},
+		{name: "ipv6 loopback", addr: &net.TCPAddr{IP: net.IPv6loopback, Port: 50000}, want: true},
+		{name: "outside", addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.5"), Port: 50000}},
+		{name: "not tcp", addr: &net.UnixAddr{Name: "/tmp/socket", Net: "unix"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := clientAllowed(prefixes, tt.addr); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
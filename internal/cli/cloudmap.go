@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	sdtypes "github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+)
+
+const (
+	cloudMapSelectionSingle = "single"
+	cloudMapSelectionFirst  = "first"
+	cloudMapSelectionRandom = "random"
+)
+
+var (
+	ErrIncompleteCloudMapService = errors.New("cloud map namespace and service must be set together")
+	ErrCloudMapWithResolver      = errors.New("cloud map service cannot be combined with resolver url")
+	ErrCloudMapWithSSH           = errors.New("cloud map service cannot be used with ssh mode")
+	ErrInvalidCloudMapSelection  = errors.New("invalid cloud map selection")
+	ErrNoServiceEndpoints        = errors.New("no service endpoints found")
+	ErrMultipleServiceEndpoints  = errors.New("multiple service endpoints found")
+)
+
+type serviceDiscoveryAPI interface {
+	DiscoverInstances(ctx context.Context, params *servicediscovery.DiscoverInstancesInput, optFns ...func(*servicediscovery.Options)) (*servicediscovery.DiscoverInstancesOutput, error)
+}
+
+// serviceEndpoint is one address registered for a Cloud Map service, such
+// as an ECS task behind Service Connect.
+type serviceEndpoint struct {
+	Host string
+	Port int
+}
+
+func (e serviceEndpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func (c Config) cloudMapEnabled() bool {
+	return strings.TrimSpace(c.CloudMapNamespace) != "" || strings.TrimSpace(c.CloudMapService) != ""
+}
+
+func (c Config) validateCloudMap() error {
+	switch strings.ToLower(strings.TrimSpace(c.CloudMapSelection)) {
+	case "", cloudMapSelectionSingle, cloudMapSelectionFirst, cloudMapSelectionRandom:
+	default:
+		return fmt.Errorf("%w: %q (want single, first or random)", ErrInvalidCloudMapSelection, c.CloudMapSelection)
+	}
+	if !c.cloudMapEnabled() {
+		return nil
+	}
+	if strings.TrimSpace(c.CloudMapNamespace) == "" || strings.TrimSpace(c.CloudMapService) == "" {
+		return ErrIncompleteCloudMapService
+	}
+	if strings.TrimSpace(c.ResolverURL) != "" {
+		return ErrCloudMapWithResolver
+	}
+	if c.SSH {
+		return ErrCloudMapWithSSH
+	}
+	return nil
+}
+
+// discoverServiceEndpoints returns the addresses registered for a Cloud Map
+// service, sorted so that "first" selection is stable. Healthy endpoints are
+// preferred; when none is healthy Cloud Map returns all of them.
+func discoverServiceEndpoints(ctx context.Context, client serviceDiscoveryAPI, namespace, service string) ([]serviceEndpoint, error) {
+	output, err := client.DiscoverInstances(ctx, &servicediscovery.DiscoverInstancesInput{
+		NamespaceName: aws.String(namespace),
+		ServiceName:   aws.String(service),
+		HealthStatus:  sdtypes.HealthStatusFilterHealthyOrElseAll,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover instances of %s/%s: %w", namespace, service, err)
+	}
+
+	var endpoints []serviceEndpoint
+	for _, instance := range output.Instances {
+		host := instance.Attributes["AWS_INSTANCE_IPV4"]
+		if host == "" {
+			host = instance.Attributes["AWS_INSTANCE_IPV6"]
+		}
+		port, err := strconv.Atoi(instance.Attributes["AWS_INSTANCE_PORT"])
+		if host == "" || err != nil || port < 1 || port > 65535 {
+			continue
+		}
+		endpoints = append(endpoints, serviceEndpoint{Host: host, Port: port})
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%w for %s/%s", ErrNoServiceEndpoints, namespace, service)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Host != endpoints[j].Host {
+			return endpoints[i].Host < endpoints[j].Host
+		}
+		return endpoints[i].Port < endpoints[j].Port
+	})
+	return endpoints, nil
+}
+
+func pickServiceEndpoint(endpoints []serviceEndpoint, selection string, chooseIndex func(int) (int, error)) (serviceEndpoint, error) {
+	if len(endpoints) == 0 {
+		return serviceEndpoint{}, ErrNoServiceEndpoints
+	}
+	switch strings.ToLower(strings.TrimSpace(selection)) {
+	case cloudMapSelectionFirst:
+		return endpoints[0], nil
+	case cloudMapSelectionRandom:
+		idx, err := chooseIndex(len(endpoints))
+		if err != nil {
+			return serviceEndpoint{}, err
+		}
+		if idx < 0 || idx >= len(endpoints) {
+			return serviceEndpoint{}, fmt.Errorf("random selector returned out-of-range index %d for %d endpoints", idx, len(endpoints))
+		}
+		return endpoints[idx], nil
+	default:
+		if len(endpoints) > 1 {
+			addrs := make([]string, len(endpoints))
+			for i, endpoint := range endpoints {
+				addrs[i] = endpoint.String()
+			}
+			return serviceEndpoint{}, fmt.Errorf("%w: %s (use cloud map selection first or random)", ErrMultipleServiceEndpoints, strings.Join(addrs, ", "))
+		}
+		return endpoints[0], nil
+	}
+}
+
+// applyServiceEndpoint forwards to the discovered endpoint. A remote host or
+// port set on the command line or in the config file takes precedence.
+func applyServiceEndpoint(cfg Config, endpoint serviceEndpoint) (Config, error) {
+	if strings.TrimSpace(cfg.RemoteHost) == "" {
+		cfg.RemoteHost = endpoint.Host
+	}
+	if cfg.RemotePort == 0 {
+		cfg.RemotePort = endpoint.Port
+	}
+	if err := cfg.validateRemote(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	sdtypes "github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+)
+
+type fakeServiceDiscoveryClient struct {
+	output *servicediscovery.DiscoverInstancesOutput
+	err    error
+	input  *servicediscovery.DiscoverInstancesInput
+}
+
+func (f *fakeServiceDiscoveryClient) DiscoverInstances(_ context.Context, params *servicediscovery.DiscoverInstancesInput, _ ...func(*servicediscovery.Options)) (*servicediscovery.DiscoverInstancesOutput, error) {
+	f.input = params
+	return f.output, f.err
+}
+
+func TestDiscoverServiceEndpoints(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeServiceDiscoveryClient{output: &servicediscovery.DiscoverInstancesOutput{
+		Instances: []sdtypes.HttpInstanceSummary{
+			{Attributes: map[string]string{"AWS_INSTANCE_IPV4": "10.0.2.7", "AWS_INSTANCE_PORT": "8080"}},
+			{Attributes: map[string]string{"AWS_INSTANCE_IPV4": "10.0.1.9", "AWS_INSTANCE_PORT": "8080"}},
+			{Attributes: map[string]string{"AWS_INSTANCE_IPV4": "10.0.3.1"}},
+			{Attributes: map[string]string{"AWS_INSTANCE_IPV6": "fd00::1", "AWS_INSTANCE_PORT": "9090"}},
+		},
+	}}
+
+	got, err := discoverServiceEndpoints(context.Background(), client, "prod", "billing")
+	if err != nil {
+		t.Fatalf("discoverServiceEndpoints() unexpected error: %v", err)
+	}
+	want := []serviceEndpoint{{Host: "10.0.1.9", Port: 8080}, {Host: "10.0.2.7", Port: 8080}, {Host: "fd00::1", Port: 9090}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if aws.ToString(client.input.NamespaceName) != "prod" || aws.ToString(client.input.ServiceName) != "billing" {
+		t.Fatalf("unexpected DiscoverInstances input: %+v", client.input)
+	}
+	if client.input.HealthStatus != sdtypes.HealthStatusFilterHealthyOrElseAll {
+		t.Fatalf("expected health status %q, got %q", sdtypes.HealthStatusFilterHealthyOrElseAll, client.input.HealthStatus)
+	}
+
+	empty := &fakeServiceDiscoveryClient{output: &servicediscovery.DiscoverInstancesOutput{}}
+	if _, err := discoverServiceEndpoints(context.Background(), empty, "prod", "billing"); !errors.Is(err, ErrNoServiceEndpoints) {
+		t.Fatalf("expected %v, got %v", ErrNoServiceEndpoints, err)
+	}
+
+	apiErr := errors.New("access denied")
+	failing := &fakeServiceDiscoveryClient{err: apiErr}
+	if _, err := discoverServiceEndpoints(context.Background(), failing, "prod", "billing"); !errors.Is(err, apiErr) {
+		t.Fatalf("expected %v, got %v", apiErr, err)
+	}
+}
+
+func TestPickServiceEndpoint(t *testing.T) {
+	t.Parallel()
+
+	endpoints := []serviceEndpoint{{Host: "10.0.1.9", Port: 8080}, {Host: "10.0.2.7", Port: 8080}}
+	pickLast := func(n int) (int, error) { return n - 1, nil }
+
+	tests := []struct {
+		name      string
+		endpoints []serviceEndpoint
+		selection string
+		want      serviceEndpoint
+		wantErr   error
+	}{
+		{name: "single endpoint", endpoints: endpoints[:1], want: endpoints[0]},
+		{name: "several without selection", endpoints: endpoints, wantErr: ErrMultipleServiceEndpoints},
+		{name: "first", endpoints: endpoints, selection: "first", want: endpoints[0]},
+		{name: "random", endpoints: endpoints, selection: "random", want: endpoints[1]},
+		{name: "none", selection: "first", wantErr: ErrNoServiceEndpoints},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := pickServiceEndpoint(tt.endpoints, tt.selection, pickLast)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pickServiceEndpoint() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyServiceEndpoint(t *testing.T) {
+	t.Parallel()
+
+	endpoint := serviceEndpoint{Host: "10.0.1.9", Port: 8080}
+
+	cfg, err := applyServiceEndpoint(Config{LocalPort: 8080}, endpoint)
+	if err != nil {
+		t.Fatalf("applyServiceEndpoint() unexpected error: %v", err)
+	}
+	if cfg.RemoteHost != "10.0.1.9" || cfg.RemotePort != 8080 {
+		t.Fatalf("config = %+v, want discovered remote", cfg)
+	}
+
+	cfg, err = applyServiceEndpoint(Config{LocalPort: 8080, RemotePort: 9901}, endpoint)
+	if err != nil {
+		t.Fatalf("applyServiceEndpoint() unexpected error: %v", err)
+	}
+	if cfg.RemotePort != 9901 {
+		t.Fatalf("RemotePort = %d, want %d", cfg.RemotePort, 9901)
+	}
+}
+
+func TestConfigValidateCloudMap(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", LocalPort: 8080, CloudMapNamespace: "prod", CloudMapService: "billing"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr error
+	}{
+		{name: "missing service", mutate: func(c *Config) { c.CloudMapService = "" }, wantErr: ErrIncompleteCloudMapService},
+		{name: "bad selection", mutate: func(c *Config) { c.CloudMapSelection = "nearest" }, wantErr: ErrInvalidCloudMapSelection},
+		{name: "ssh", mutate: func(c *Config) { c.SSH = true }, wantErr: ErrCloudMapWithSSH},
+		{name: "resolver", mutate: func(c *Config) {
+			c.InstanceName = ""
+			c.ResolverURL = "https://bastions.example.com/resolve"
+		}, wantErr: ErrCloudMapWithResolver},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := cfg
+			tt.mutate(&c)
+			if err := c.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	controlFileStopValue    = "stop"
+	controlFilePollInterval = 500 * time.Millisecond
+)
+
+// prepareControlFile creates an empty control file when none exists yet, so
+// that removing it later can be observed as a shutdown request.
+func prepareControlFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to prepare control file: %w", err)
+	}
+	return file.Close()
+}
+
+// watchControlFile calls shutdown once the control file contains the stop
+// sentinel or is removed. It returns when either happens or ctx is done.
+func watchControlFile(ctx context.Context, path string, interval time.Duration, shutdown func(reason string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			content, err := os.ReadFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				shutdown("control file removed")
+				return
+			}
+			if err != nil {
+				continue
+			}
+			if strings.EqualFold(strings.TrimSpace(string(content)), controlFileStopValue) {
+				shutdown("stop requested via control file")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchControlFile(t *testing.T) {
+	t.Parallel()
+
+	run := func(t *testing.T, path string, trigger func()) string {
+		t.Helper()
+
+		if err := prepareControlFile(path); err != nil {
+			t.Fatalf("prepareControlFile() unexpected error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		reasons := make(chan string, 1)
+		go watchControlFile(ctx, path, 5*time.Millisecond, func(reason string) {
+			reasons <- reason
+		})
+
+		trigger()
+
+		select {
+		case reason := <-reasons:
+			return reason
+		case <-time.After(time.Second):
+			t.Fatal("watchControlFile() did not request shutdown")
+			return ""
+		}
+	}
+
+	t.Run("stop sentinel triggers shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "control")
+		reason := run(t, path, func() {
+			if err := os.WriteFile(path, []byte("STOP\n"), 0o600); err != nil {
+				t.Fatalf("write control file: %v", err)
+			}
+		})
+		if reason != "stop requested via control file" {
+			t.Fatalf("reason = %q", reason)
+		}
+	})
+
+	t.Run("removal triggers shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "control")
+		reason := run(t, path, func() {
+			if err := os.Remove(path); err != nil {
+				t.Fatalf("remove control file: %v", err)
+			}
+		})
+		if reason != "control file removed" {
+			t.Fatalf("reason = %q", reason)
+		}
+	})
+
+	t.Run("other content is ignored and watcher stops with context", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "control")
+		if err := os.WriteFile(path, []byte("running"), 0o600); err != nil {
+			t.Fatalf("write control file: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			watchControlFile(ctx, path, 5*time.Millisecond, func(reason string) {
+				t.Errorf("unexpected shutdown: %s", reason)
+			})
+		}()
+
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("watchControlFile() did not return after cancellation")
+		}
+	})
+}
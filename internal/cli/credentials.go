@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	ErrSSOLoginRequired = errors.New("SSO session expired or missing")
+	ErrMFACodeRequired  = errors.New("the profile assumes a role that needs an MFA code, which can only be entered on a terminal")
+	ErrInvalidMFACode   = errors.New("invalid MFA code")
+)
+
+// mfaCodePrompt asks on out for the MFA code of a role the profile
+// assumes, and reads it from in. The code goes to STS once; the assumed
+// role's credentials are then cached for the session.
+func mfaCodePrompt(in, out *os.File) func() (string, error) {
+	return func() (string, error) {
+		if !isInteractive(in) {
+			return "", ErrMFACodeRequired
+		}
+		fmt.Fprint(out, "MFA code: ")
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read MFA code: %w", err)
+		}
+		code := strings.TrimSpace(line)
+		if code == "" {
+			return "", ErrInvalidMFACode
+		}
+		return code, nil
+	}
+}
+
+// sharedProfileName returns the profile the SDK loads: profile, else
+// AWS_PROFILE, else default.
+func sharedProfileName(profile string, getenv func(string) string) string {
+	if profile != "" {
+		return profile
+	}
+	if profile = getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// ssoProfile reports whether profile, or a profile it takes its source
+// credentials from, signs in through IAM Identity Center.
+func ssoProfile(ctx context.Context, profile, configFile, credentialsFile string) bool {
+	shared, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+		o.ConfigFiles = []string{configFile}
+		o.CredentialsFiles = []string{credentialsFile}
+	})
+	if err != nil {
+		return false
+	}
+	for c := &shared; c != nil; c = c.Source {
+		if c.SSOSessionName != "" || c.SSOStartURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// explainCredentialsFailure turns the failure to load the profile's
+// credentials into a fix when it is an expired or missing SSO sign-in.
+// The SDK loads credentials on the first API call, where the raw error
+// says little about why.
+func explainCredentialsFailure(profile string, sso bool, err error) error {
+	var invalidToken *ssocreds.InvalidTokenError
+	var apiErr smithy.APIError
+	expired := errors.As(err, &invalidToken) ||
+		sso && (strings.Contains(err.Error(), "SSO token") || errors.As(err, &apiErr) && apiErr.ErrorCode() == "UnauthorizedException")
+	if expired {
+		return fmt.Errorf("%w: run aws sso login --profile %s (%v)", ErrSSOLoginRequired, profile, err)
+	}
+	return fmt.Errorf("failed to load credentials for profile %s: %w", profile, err)
+}
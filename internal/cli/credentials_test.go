@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/smithy-go"
+)
+
+func TestExplainCredentialsFailure(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sso     bool
+		err     error
+		wantErr error
+	}{
+		{name: "expired cached token", sso: true, err: &ssocreds.InvalidTokenError{Err: errors.New("token expired")}, wantErr: ErrSSOLoginRequired},
+		{name: "missing cached token", sso: true, err: errors.New("failed to read cached SSO token file"), wantErr: ErrSSOLoginRequired},
+		{name: "revoked token", sso: true, err: &smithy.GenericAPIError{Code: "UnauthorizedException", Message: "Session token not found or invalid"}, wantErr: ErrSSOLoginRequired},
+		{name: "static keys", err: errors.New("static credentials are empty")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := explainCredentialsFailure("dev", tt.sso, tt.err)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), "aws sso login --profile dev") {
+					t.Errorf("expected %v with the login command, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if errors.Is(err, ErrSSOLoginRequired) || !errors.Is(err, tt.err) {
+				t.Errorf("expected %v wrapped, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSSOProfile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config")
+	config := `[profile sso]
+sso_session = corp
+sso_account_id = 123456789012
+sso_role_name = Admin
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-1
+
+[profile admin]
+role_arn = arn:aws:iam::123456789012:role/Admin
+source_profile = sso
+
+[profile static]
+region = eu-west-1
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	credentials := filepath.Join(t.TempDir(), "credentials")
+
+	for profile, want := range map[string]bool{"sso": true, "admin": true, "static": false, "missing": false} {
+		if got := ssoProfile(context.Background(), profile, path, credentials); got != want {
+			t.Errorf("ssoProfile(%q) = %v, want %v", profile, got, want)
+		}
+	}
+}
+
+func TestSharedProfileName(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"AWS_PROFILE": "ops"}
+	getenv := func(key string) string { return env[key] }
+	if got := sharedProfileName("dev", getenv); got != "dev" {
+		t.Errorf("expected dev, got %q", got)
+	}
+	if got := sharedProfileName("", getenv); got != "ops" {
+		t.Errorf("expected ops, got %q", got)
+	}
+	if got := sharedProfileName("", func(string) string { return "" }); got != "default" {
+		t.Errorf("expected default, got %q", got)
+	}
+}
+
+func TestMFACodePromptWithoutTerminal(t *testing.T) {
+	t.Parallel()
+
+	in, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	defer w.Close()
+
+	if _, err := mfaCodePrompt(in, os.Stderr)(); !errors.Is(err, ErrMFACodeRequired) {
+		t.Errorf("expected %v, got %v", ErrMFACodeRequired, err)
+	}
+}
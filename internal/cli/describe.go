@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+type ssmDescribeInstanceInformationAPI interface {
+	DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error)
+}
+
+// instanceDetails is what --describe-instance prints about the resolved
+// instance. The SSM fields are empty when the instance is not registered
+// with Systems Manager.
+type instanceDetails struct {
+	ID           string
+	Name         string
+	State        string
+	VPC          string
+	Subnet       string
+	PrivateIP    string
+	PublicIP     string
+	Platform     string
+	LaunchTime   time.Time
+	Registered   bool
+	PingStatus   string
+	LastPing     time.Time
+	AgentVersion string
+}
+
+func describeInstanceDetails(ctx context.Context, ec2Client ec2DescribeInstancesAPI, ssmClient ssmDescribeInstanceInformationAPI, instanceID string, choice interfaceChoice) (instanceDetails, error) {
+	details := instanceDetails{ID: instanceID}
+	// EC2 does not know hybrid managed instances; SSM fills in what it can.
+	if !isManagedInstanceID(instanceID) {
+		output, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+		if err != nil {
+			return instanceDetails{}, fmt.Errorf("failed to describe instance: %w", err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				for _, tag := range instance.Tags {
+					if aws.ToString(tag.Key) == "Name" {
+						details.Name = aws.ToString(tag.Value)
+					}
+				}
+				if instance.State != nil {
+					details.State = string(instance.State.Name)
+				}
+				details.VPC = aws.ToString(instance.VpcId)
+				details.Subnet = aws.ToString(instance.SubnetId)
+				privateIP, err := instancePrivateIP(instance, choice)
+				if err != nil {
+					return instanceDetails{}, err
+				}
+				details.PrivateIP = privateIP
+				details.PublicIP = aws.ToString(instance.PublicIpAddress)
+				details.Platform = aws.ToString(instance.PlatformDetails)
+				details.LaunchTime = aws.ToTime(instance.LaunchTime)
+			}
+		}
+	}
+
+	info, err := managedInstanceInformation(ctx, ssmClient, instanceID)
+	if err != nil {
+		return instanceDetails{}, err
+	}
+	if info != nil {
+		details.Registered = true
+		details.PingStatus = string(info.PingStatus)
+		details.LastPing = aws.ToTime(info.LastPingDateTime)
+		details.AgentVersion = aws.ToString(info.AgentVersion)
+		if name := strings.TrimSpace(aws.ToString(info.PlatformName) + " " + aws.ToString(info.PlatformVersion)); name != "" {
+			details.Platform = name
+		}
+		if details.Name == "" {
+			details.Name = aws.ToString(info.Name)
+		}
+		if details.PrivateIP == "" {
+			details.PrivateIP = aws.ToString(info.IPAddress)
+		}
+	}
+	return details, nil
+}
+
+func formatInstanceDetails(details instanceDetails) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	row := func(label, value string) {
+		if value == "" {
+			value = "-"
+		}
+		fmt.Fprintf(w, "%s:\t%s\n", label, value)
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	row("Instance ID", details.ID)
+	row("Name", details.Name)
+	row("State", details.State)
+	row("VPC", details.VPC)
+	row("Subnet", details.Subnet)
+	row("Private IP", details.PrivateIP)
+	row("Public IP", details.PublicIP)
+	row("Platform", details.Platform)
+	row("Launch time", formatTime(details.LaunchTime))
+	if details.Registered {
+		row("SSM ping status", details.PingStatus)
+		row("SSM last ping", formatTime(details.LastPing))
+		row("SSM agent", details.AgentVersion)
+	} else {
+		row("SSM ping status", "not registered (check the SSM agent, its instance profile and its network path to SSM)")
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type fakeInstanceInformationClient struct {
+	output   *ssm.DescribeInstanceInformationOutput
+	err      error
+	gotInput *ssm.DescribeInstanceInformationInput
+}
+
+func (f *fakeInstanceInformationClient) DescribeInstanceInformation(_ context.Context, input *ssm.DescribeInstanceInformationInput, _ ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	f.gotInput = input
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.output, nil
+}
+
+func TestDescribeInstanceDetails(t *testing.T) {
+	t.Parallel()
+
+	launch := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ping := time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)
+	ec2Output := &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: []types.Instance{{
+			InstanceId:       aws.String("i-0123456789abcdef0"),
+			Tags:             []types.Tag{{Key: aws.String("Name"), Value: aws.String("bastion")}},
+			State:            &types.InstanceState{Name: types.InstanceStateNameRunning},
+			VpcId:            aws.String("vpc-1"),
+			SubnetId:         aws.String("subnet-1"),
+			PrivateIpAddress: aws.String("10.0.0.5"),
+			PlatformDetails:  aws.String("Linux/UNIX"),
+			LaunchTime:       aws.Time(launch),
+		}}}},
+	}
+
+	tests := []struct {
+		name    string
+		ssm     *fakeInstanceInformationClient
+		want    instanceDetails
+		id      string
+		wantErr bool
+	}{
+		{
+			name: "registered",
+			ssm: &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{
+				InstanceInformationList: []ssmtypes.InstanceInformation{{
+					InstanceId:       aws.String("i-0123456789abcdef0"),
+					PingStatus:       ssmtypes.PingStatusOnline,
+					LastPingDateTime: aws.Time(ping),
+					AgentVersion:     aws.String("3.3.40.0"),
+					PlatformName:     aws.String("Amazon Linux"),
+					PlatformVersion:  aws.String("2023"),
+				}},
+			}},
+			want: instanceDetails{
+				ID: "i-0123456789abcdef0", Name: "bastion", State: "running", VPC: "vpc-1", Subnet: "subnet-1",
+				PrivateIP: "10.0.0.5", Platform: "Amazon Linux 2023", LaunchTime: launch,
+				Registered: true, PingStatus: "Online", LastPing: ping, AgentVersion: "3.3.40.0",
+			},
+		},
+		{
+			name: "not registered",
+			ssm:  &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{}},
+			want: instanceDetails{
+				ID: "i-0123456789abcdef0", Name: "bastion", State: "running", VPC: "vpc-1", Subnet: "subnet-1",
+				PrivateIP: "10.0.0.5", Platform: "Linux/UNIX", LaunchTime: launch,
+			},
+		},
+		{
+			name: "managed instance",
+			ssm: &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{
+				InstanceInformationList: []ssmtypes.InstanceInformation{{
+					InstanceId:      aws.String(testManagedInstanceID),
+					Name:            aws.String("rack-01"),
+					IPAddress:       aws.String("192.168.1.10"),
+					PingStatus:      ssmtypes.PingStatusOnline,
+					PlatformName:    aws.String("Ubuntu"),
+					PlatformVersion: aws.String("22.04"),
+				}},
+			}},
+			id: testManagedInstanceID,
+			want: instanceDetails{
+				ID: testManagedInstanceID, Name: "rack-01", PrivateIP: "192.168.1.10", Platform: "Ubuntu 22.04",
+				Registered: true, PingStatus: "Online",
+			},
+		},
+		{
+			name:    "ssm error",
+			ssm:     &fakeInstanceInformationClient{err: errors.New("denied")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			id := cmp.Or(tt.id, "i-0123456789abcdef0")
+			got, err := describeInstanceDetails(context.Background(), &fakeEC2Client{output: ec2Output}, tt.ssm, id, interfaceChoice{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+			if tt.ssm.gotInput == nil || len(tt.ssm.gotInput.Filters) != 1 || tt.ssm.gotInput.Filters[0].Values[0] != id {
+				t.Errorf("expected an InstanceIds filter, got %+v", tt.ssm.gotInput)
+			}
+		})
+	}
+}
+
+func TestFormatInstanceDetails(t *testing.T) {
+	t.Parallel()
+
+	out := formatInstanceDetails(instanceDetails{ID: "i-1", State: "running", PrivateIP: "10.0.0.5"})
+	for _, want := range []string{
+		"Instance ID:      i-1\n",
+		"Public IP:        -\n",
+		"SSM ping status:  not registered",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "SSM agent:") {
+		t.Errorf("expected no agent row for an unregistered instance, got:\n%s", out)
+	}
+}
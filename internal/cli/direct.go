@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+)
+
+// directDocumentName forwards to a port on the instance itself; it takes
+// no host parameter.
+const directDocumentName = "AWS-StartPortForwardingSession"
+
+// directHost is the remote host of direct forwards: the instance itself.
+const directHost = "localhost"
+
+var (
+	ErrDirectWithSSH        = errors.New("direct cannot be combined with --ssh")
+	ErrDirectWithRemoteHost = errors.New("direct forwards to the instance itself and cannot be combined with --remote-host")
+	ErrDirectWithDiscovery  = errors.New("direct cannot be combined with --resolver-url, Cloud Map or --k8s-service")
+)
+
+func (c Config) validateDirect() error {
+	if !c.Direct {
+		return nil
+	}
+	if c.SSH {
+		return ErrDirectWithSSH
+	}
+	if strings.TrimSpace(c.ResolverURL) != "" || c.cloudMapEnabled() || c.eksEnabled() {
+		return ErrDirectWithDiscovery
+	}
+	if !isDirectHost(c.RemoteHost) {
+		return ErrDirectWithRemoteHost
+	}
+	for _, target := range c.Forwards {
+		if !isDirectHost(target.RemoteHost) {
+			return ErrDirectWithRemoteHost
+		}
+	}
+	return nil
+}
+
+func isDirectHost(host string) bool {
+	host = strings.TrimSpace(host)
+	return host == "" || host == directHost
+}
+
+// applyDirect fills in the instance itself as the remote host, so checks
+// and messages that name the host keep working.
+func applyDirect(cfg Config) Config {
+	if cfg.Direct {
+		cfg.RemoteHost = directHost
+	}
+	return cfg
+}
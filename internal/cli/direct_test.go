@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestConfigValidateDirect(t *testing.T) {
+	t.Parallel()
+
+	valid := Config{Profile: "dev", Region: "us-east-1", InstanceName: "metrics", LocalPort: 9100, RemotePort: 9100, Direct: true}
+	with := func(change func(*Config)) Config {
+		cfg := valid
+		change(&cfg)
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "no remote host", cfg: valid},
+		{name: "localhost", cfg: with(func(c *Config) { c.RemoteHost = directHost })},
+		{name: "remote host", cfg: with(func(c *Config) { c.RemoteHost = "db.internal" }), wantErr: ErrDirectWithRemoteHost},
+		{name: "section remote host", cfg: with(func(c *Config) {
+			c.Forwards = []forwardTarget{{Name: "db", LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}}
+		}), wantErr: ErrDirectWithRemoteHost},
+		{name: "ssh", cfg: with(func(c *Config) { c.SSH = true }), wantErr: ErrDirectWithSSH},
+		{name: "cloud map", cfg: with(func(c *Config) { c.CloudMapNamespace, c.CloudMapService = "prod", "billing" }), wantErr: ErrDirectWithDiscovery},
+		{name: "missing remote port", cfg: with(func(c *Config) { c.RemotePort = 0 }), wantErr: ErrMissingRemotePort},
+		{name: "not direct", cfg: with(func(c *Config) { c.Direct = false }), wantErr: ErrMissingRemoteHost},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDirectSession(t *testing.T) {
+	t.Parallel()
+
+	cfg := applyDirect(Config{LocalPort: 9100, RemotePort: 9100, Direct: true})
+	if got := cfg.resolvedDocumentName(); got != directDocumentName {
+		t.Errorf("expected %q, got %q", directDocumentName, got)
+	}
+	params := cfg.sessionParameters()
+	if keys := slices.Sorted(maps.Keys(params)); !slices.Equal(keys, []string{"localPortNumber", "portNumber"}) {
+		t.Errorf("expected only the port parameters, got %v", params)
+	}
+	if cfg.RemoteHost != directHost {
+		t.Errorf("expected remote host %q, got %q", directHost, cfg.RemoteHost)
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// amazonDocumentOwner is the owner of the documents AWS manages.
+const amazonDocumentOwner = "Amazon"
+
+// forwardingParameters are the parameters at least one of which a session
+// document needs to take for the tool to forward through it.
+var forwardingParameters = []string{"localPortNumber", "portNumber"}
+
+type ssmListDocumentsAPI interface {
+	ssmDescribeDocumentAPI
+	ListDocuments(ctx context.Context, params *ssm.ListDocumentsInput, optFns ...func(*ssm.Options)) (*ssm.ListDocumentsOutput, error)
+}
+
+// forwardingDocument is a session document --list-documents-for-session
+// prints.
+type forwardingDocument struct {
+	Name       string
+	Managed    bool
+	Parameters []string
+}
+
+// listForwardingDocuments returns the Session documents visible in the
+// region that take a local or remote port, AWS-managed ones first.
+func listForwardingDocuments(ctx context.Context, client ssmListDocumentsAPI) ([]forwardingDocument, error) {
+	var documents []forwardingDocument
+	paginator := ssm.NewListDocumentsPaginator(client, &ssm.ListDocumentsInput{
+		Filters: []ssmtypes.DocumentKeyValuesFilter{
+			{Key: aws.String("DocumentType"), Values: []string{string(ssmtypes.DocumentTypeSession)}},
+		},
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list documents: %w", err)
+		}
+		for _, identifier := range output.DocumentIdentifiers {
+			name := aws.ToString(identifier.Name)
+			// ListDocuments has no parameters; DescribeDocument does.
+			described, err := client.DescribeDocument(ctx, &ssm.DescribeDocumentInput{Name: aws.String(name)})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe document %s: %w", name, err)
+			}
+			if described.Document == nil {
+				continue
+			}
+			var parameters []string
+			for _, parameter := range described.Document.Parameters {
+				parameters = append(parameters, aws.ToString(parameter.Name))
+			}
+			if !slices.ContainsFunc(forwardingParameters, func(name string) bool { return slices.Contains(parameters, name) }) {
+				continue
+			}
+			documents = append(documents, forwardingDocument{
+				Name:       name,
+				Managed:    aws.ToString(identifier.Owner) == amazonDocumentOwner,
+				Parameters: parameters,
+			})
+		}
+	}
+	slices.SortFunc(documents, func(a, b forwardingDocument) int {
+		if a.Managed != b.Managed {
+			if a.Managed {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return documents, nil
+}
+
+func formatForwardingDocuments(documents []forwardingDocument) string {
+	if len(documents) == 0 {
+		return "No Session documents with localPortNumber or portNumber parameters in this region\n"
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tPARAMETERS")
+	for _, document := range documents {
+		owner := "custom"
+		if document.Managed {
+			owner = "aws-managed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", document.Name, owner, strings.Join(document.Parameters, ","))
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSessionDocumentsClient lists one page per entry of pages and
+// describes documents by name from parameters.
+type fakeSessionDocumentsClient struct {
+	pages      [][]ssmtypes.DocumentIdentifier
+	parameters map[string][]string
+	err        error
+	gotFilters []ssmtypes.DocumentKeyValuesFilter
+}
+
+func (f *fakeSessionDocumentsClient) ListDocuments(_ context.Context, input *ssm.ListDocumentsInput, _ ...func(*ssm.Options)) (*ssm.ListDocumentsOutput, error) {
+	f.gotFilters = input.Filters
+	if f.err != nil {
+		return nil, f.err
+	}
+	page := 0
+	if input.NextToken != nil {
+		page = len(aws.ToString(input.NextToken))
+	}
+	output := &ssm.ListDocumentsOutput{DocumentIdentifiers: f.pages[page]}
+	if page+1 < len(f.pages) {
+		output.NextToken = aws.String(strings.Repeat("n", page+1))
+	}
+	return output, nil
+}
+
+func (f *fakeSessionDocumentsClient) DescribeDocument(_ context.Context, input *ssm.DescribeDocumentInput, _ ...func(*ssm.Options)) (*ssm.DescribeDocumentOutput, error) {
+	var parameters []ssmtypes.DocumentParameter
+	for _, name := range f.parameters[aws.ToString(input.Name)] {
+		parameters = append(parameters, ssmtypes.DocumentParameter{Name: aws.String(name)})
+	}
+	return &ssm.DescribeDocumentOutput{Document: &ssmtypes.DocumentDescription{Name: input.Name, Parameters: parameters}}, nil
+}
+
+func TestListForwardingDocuments(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeSessionDocumentsClient{
+		pages: [][]ssmtypes.DocumentIdentifier{
+			{
+				{Name: aws.String("Team-DatabaseTunnel"), Owner: aws.String("123456789012")},
+				{Name: aws.String("AWS-StartPortForwardingSessionToRemoteHost"), Owner: aws.String("Amazon")},
+			},
+			{
+				{Name: aws.String("AWS-StartInteractiveCommand"), Owner: aws.String("Amazon")},
+				{Name: aws.String("AWS-StartSSHSession"), Owner: aws.String("Amazon")},
+			},
+		},
+		parameters: map[string][]string{
+			"Team-DatabaseTunnel":                        {"localPortNumber", "portNumber"},
+			"AWS-StartPortForwardingSessionToRemoteHost": {"host", "portNumber", "localPortNumber"},
+			"AWS-StartInteractiveCommand":                {"command"},
+			"AWS-StartSSHSession":                        {"portNumber"},
+		},
+	}
+
+	documents, err := listForwardingDocuments(context.Background(), client)
+	if err != nil {
+		t.Fatalf("listForwardingDocuments() unexpected error: %v", err)
+	}
+	want := []forwardingDocument{
+		{Name: "AWS-StartPortForwardingSessionToRemoteHost", Managed: true, Parameters: []string{"host", "portNumber", "localPortNumber"}},
+		{Name: "AWS-StartSSHSession", Managed: true, Parameters: []string{"portNumber"}},
+		{Name: "Team-DatabaseTunnel", Parameters: []string{"localPortNumber", "portNumber"}},
+	}
+	if !reflect.DeepEqual(documents, want) {
+		t.Errorf("expected %v, got %v", want, documents)
+	}
+	if len(client.gotFilters) != 1 || aws.ToString(client.gotFilters[0].Key) != "DocumentType" || !reflect.DeepEqual(client.gotFilters[0].Values, []string{"Session"}) {
+		t.Errorf("expected a DocumentType=Session filter, got %v", client.gotFilters)
+	}
+}
+
+func TestListForwardingDocumentsError(t *testing.T) {
+	t.Parallel()
+
+	wantErr := errors.New("access denied")
+	_, err := listForwardingDocuments(context.Background(), &fakeSessionDocumentsClient{err: wantErr})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("expected %v, got %v", wantErr, err)
+	}
+}
+
+func TestFormatForwardingDocuments(t *testing.T) {
+	t.Parallel()
+
+	got := formatForwardingDocuments([]forwardingDocument{
+		{Name: "AWS-StartSSHSession", Managed: true, Parameters: []string{"portNumber"}},
+		{Name: "Team-DatabaseTunnel", Parameters: []string{"localPortNumber", "portNumber"}},
+	})
+	want := "NAME                 OWNER        PARAMETERS\n" +
+		"AWS-StartSSHSession  aws-managed  portNumber\n" +
+		"Team-DatabaseTunnel  custom       localPortNumber,portNumber\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := formatForwardingDocuments(nil); !strings.HasPrefix(got, "No Session documents") {
+		t.Errorf("expected a note that nothing matched, got %q", got)
+	}
+}
@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// eksTokenPrefix marks a bearer token that EKS checks by replaying the
+// presigned sts:GetCallerIdentity request it encodes, as aws-iam-authenticator
+// and "aws eks get-token" do.
+const eksTokenPrefix = "k8s-aws-v1."
+
+const kubernetesAPITimeout = 10 * time.Second
+
+var (
+	ErrIncompleteEKSService   = errors.New("eks cluster and kubernetes service must be set together")
+	ErrInvalidK8sService      = errors.New("invalid kubernetes service")
+	ErrEKSWithCloudMap        = errors.New("kubernetes service cannot be combined with Cloud Map")
+	ErrEKSWithResolver        = errors.New("kubernetes service cannot be combined with resolver url")
+	ErrEKSWithSSH             = errors.New("kubernetes service cannot be used with ssh mode")
+	ErrK8sServicePort         = errors.New("kubernetes service port not found")
+	ErrK8sServiceUnreachable  = errors.New("kubernetes service has no address reachable from the bastion")
+	ErrKubernetesAPIFailed    = errors.New("kubernetes api request failed")
+	ErrKubernetesAPIForbidden = errors.New("kubernetes api request denied")
+)
+
+type eksDescribeClusterAPI interface {
+	DescribeCluster(ctx context.Context, params *eks.DescribeClusterInput, optFns ...func(*eks.Options)) (*eks.DescribeClusterOutput, error)
+}
+
+type stsPresignGetCallerIdentityAPI interface {
+	PresignGetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// k8sServiceRef is a --k8s-service value: namespace/name, optionally
+// followed by :port with the service port's name or number.
+type k8sServiceRef struct {
+	Namespace string
+	Name      string
+	Port      string
+}
+
+func (r k8sServiceRef) String() string {
+	return r.Namespace + "/" + r.Name
+}
+
+func parseK8sService(value string) (k8sServiceRef, error) {
+	ref, port, _ := strings.Cut(strings.TrimSpace(value), ":")
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") || (strings.Contains(value, ":") && port == "") {
+		return k8sServiceRef{}, fmt.Errorf("%w: %q (want namespace/name or namespace/name:port)", ErrInvalidK8sService, value)
+	}
+	return k8sServiceRef{Namespace: namespace, Name: name, Port: port}, nil
+}
+
+func (c Config) eksEnabled() bool {
+	return strings.TrimSpace(c.EKSCluster) != "" || strings.TrimSpace(c.K8sService) != ""
+}
+
+func (c Config) validateEKS() error {
+	if !c.eksEnabled() {
+		return nil
+	}
+	if strings.TrimSpace(c.EKSCluster) == "" || strings.TrimSpace(c.K8sService) == "" {
+		return ErrIncompleteEKSService
+	}
+	if _, err := parseK8sService(c.K8sService); err != nil {
+		return err
+	}
+	if c.cloudMapEnabled() {
+		return ErrEKSWithCloudMap
+	}
+	if strings.TrimSpace(c.ResolverURL) != "" {
+		return ErrEKSWithResolver
+	}
+	if c.SSH {
+		return ErrEKSWithSSH
+	}
+	return nil
+}
+
+// eksToken returns a bearer token for the cluster's API server, signed with
+// the tool's own AWS credentials.
+func eksToken(ctx context.Context, client stsPresignGetCallerIdentityAPI, cluster string) (string, error) {
+	presigned, err := client.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(o *sts.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions,
+				smithyhttp.AddHeaderValue("x-k8s-aws-id", cluster),
+				smithyhttp.AddHeaderValue("X-Amz-Expires", "60"),
+			)
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign eks token: %w", err)
+	}
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned.URL)), nil
+}
+
+// kubernetesClient reads objects from a cluster's API server.
+type kubernetesClient struct {
+	endpoint string
+	token    string
+	client   *http.Client
+	// private is set when the API server has no public endpoint, to explain
+	// why it may be out of reach from this machine.
+	private bool
+}
+
+// newEKSKubernetesClient looks up the cluster's API endpoint and CA and
+// authenticates to it with an EKS token.
+func newEKSKubernetesClient(ctx context.Context, eksClient eksDescribeClusterAPI, presigner stsPresignGetCallerIdentityAPI, cluster string) (*kubernetesClient, error) {
+	output, err := eksClient.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(cluster)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe eks cluster %s: %w", cluster, err)
+	}
+	if output.Cluster == nil || aws.ToString(output.Cluster.Endpoint) == "" {
+		return nil, fmt.Errorf("eks cluster %s has no api endpoint yet (status %s)", cluster, clusterStatus(output))
+	}
+	pool := x509.NewCertPool()
+	if output.Cluster.CertificateAuthority != nil {
+		ca, err := base64.StdEncoding.DecodeString(aws.ToString(output.Cluster.CertificateAuthority.Data))
+		if err != nil || !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("eks cluster %s has an unreadable certificate authority", cluster)
+		}
+	}
+	token, err := eksToken(ctx, presigner, cluster)
+	if err != nil {
+		return nil, err
+	}
+	vpcConfig := output.Cluster.ResourcesVpcConfig
+	return &kubernetesClient{
+		endpoint: strings.TrimSuffix(aws.ToString(output.Cluster.Endpoint), "/"),
+		token:    token,
+		client: &http.Client{
+			Timeout:   kubernetesAPITimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+		private: vpcConfig != nil && !vpcConfig.EndpointPublicAccess,
+	}, nil
+}
+
+func clusterStatus(output *eks.DescribeClusterOutput) string {
+	if output.Cluster == nil {
+		return "unknown"
+	}
+	return string(output.Cluster.Status)
+}
+
+func (k *kubernetesClient) get(ctx context.Context, path string, into any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		if k.private {
+			return fmt.Errorf("%w: %v (the cluster has no public api endpoint; run from a network that reaches it, or set --remote-host to the service address)", ErrKubernetesAPIFailed, err)
+		}
+		return fmt.Errorf("%w: %v", ErrKubernetesAPIFailed, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKubernetesAPIFailed, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: GET %s: %s (map your IAM identity to a Kubernetes user with an access entry or the aws-auth ConfigMap)", ErrKubernetesAPIForbidden, path, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: GET %s: %s", ErrKubernetesAPIFailed, path, resp.Status)
+	}
+	if err := json.Unmarshal(body, into); err != nil {
+		return fmt.Errorf("%w: GET %s: %v", ErrKubernetesAPIFailed, path, err)
+	}
+	return nil
+}
+
+type k8sServicePort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type k8sService struct {
+	Spec struct {
+		Type         string           `json:"type"`
+		ExternalName string           `json:"externalName"`
+		Ports        []k8sServicePort `json:"ports"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP       string `json:"ip"`
+				Hostname string `json:"hostname"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+type k8sEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []k8sServicePort `json:"ports"`
+	} `json:"subsets"`
+}
+
+// servicePort picks the port named or numbered in ref, or the only port
+// when ref has none.
+func (s k8sService) servicePort(ref k8sServiceRef) (k8sServicePort, error) {
+	var names []string
+	for _, port := range s.Spec.Ports {
+		if ref.Port != "" && (port.Name == ref.Port || strconv.Itoa(port.Port) == ref.Port) {
+			return port, nil
+		}
+		names = append(names, servicePortName(port))
+	}
+	if ref.Port == "" && len(s.Spec.Ports) == 1 {
+		return s.Spec.Ports[0], nil
+	}
+	if len(names) == 0 {
+		return k8sServicePort{}, fmt.Errorf("%w: %s exposes no ports", ErrK8sServicePort, ref)
+	}
+	return k8sServicePort{}, fmt.Errorf("%w: %s has ports %s (pick one with %s:<port>)", ErrK8sServicePort, ref, strings.Join(names, ", "), ref)
+}
+
+func servicePortName(port k8sServicePort) string {
+	if port.Name == "" {
+		return strconv.Itoa(port.Port)
+	}
+	return fmt.Sprintf("%s (%d)", port.Name, port.Port)
+}
+
+// resolveK8sService finds an address for the service that a bastion in the
+// cluster's VPC can reach. The service's cluster IP is only routed on the
+// nodes, so the tool uses, in order: the external name, a load balancer
+// ingress, or a ready pod address, which the Amazon VPC CNI assigns from
+// the VPC.
+func resolveK8sService(ctx context.Context, k *kubernetesClient, ref k8sServiceRef) (serviceEndpoint, string, error) {
+	base := "/api/v1/namespaces/" + url.PathEscape(ref.Namespace)
+	var service k8sService
+	if err := k.get(ctx, base+"/services/"+url.PathEscape(ref.Name), &service); err != nil {
+		return serviceEndpoint{}, "", err
+	}
+	port, err := service.servicePort(ref)
+	if err != nil && service.Spec.Type != "ExternalName" {
+		return serviceEndpoint{}, "", err
+	}
+
+	switch service.Spec.Type {
+	case "ExternalName":
+		if port.Port == 0 {
+			port.Port, _ = strconv.Atoi(ref.Port)
+		}
+		if port.Port < 1 || port.Port > 65535 {
+			return serviceEndpoint{}, "", fmt.Errorf("%w: %s is an ExternalName service without ports (give one with %s:<port>)", ErrK8sServicePort, ref, ref)
+		}
+		return serviceEndpoint{Host: service.Spec.ExternalName, Port: port.Port}, "external name", nil
+	case "LoadBalancer":
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if host := cmp.Or(ingress.Hostname, ingress.IP); host != "" {
+				return serviceEndpoint{Host: host, Port: port.Port}, "load balancer", nil
+			}
+		}
+	}
+
+	var endpoints k8sEndpoints
+	if err := k.get(ctx, base+"/endpoints/"+url.PathEscape(ref.Name), &endpoints); err != nil {
+		return serviceEndpoint{}, "", err
+	}
+	var pods []serviceEndpoint
+	for _, subset := range endpoints.Subsets {
+		for _, subsetPort := range subset.Ports {
+			if subsetPort.Name != port.Name {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				pods = append(pods, serviceEndpoint{Host: address.IP, Port: subsetPort.Port})
+			}
+		}
+	}
+	if len(pods) == 0 {
+		return serviceEndpoint{}, "", fmt.Errorf("%w: %s has no ready pods and no load balancer; its cluster IP is only reachable from the nodes (set --remote-host and --remote-port to forward elsewhere)", ErrK8sServiceUnreachable, ref)
+	}
+	slices.SortFunc(pods, func(a, b serviceEndpoint) int { return strings.Compare(a.String(), b.String()) })
+	return pods[0], "pod", nil
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func TestConfigValidateEKS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "unset"},
+		{name: "service", cfg: Config{EKSCluster: "prod", K8sService: "payments/api"}},
+		{name: "named port", cfg: Config{EKSCluster: "prod", K8sService: "payments/api:http"}},
+		{name: "cluster only", cfg: Config{EKSCluster: "prod"}, wantErr: ErrIncompleteEKSService},
+		{name: "service only", cfg: Config{K8sService: "payments/api"}, wantErr: ErrIncompleteEKSService},
+		{name: "no namespace", cfg: Config{EKSCluster: "prod", K8sService: "api"}, wantErr: ErrInvalidK8sService},
+		{name: "empty port", cfg: Config{EKSCluster: "prod", K8sService: "payments/api:"}, wantErr: ErrInvalidK8sService},
+		{name: "cloud map", cfg: Config{EKSCluster: "prod", K8sService: "payments/api", CloudMapNamespace: "prod", CloudMapService: "api"}, wantErr: ErrEKSWithCloudMap},
+		{name: "ssh", cfg: Config{EKSCluster: "prod", K8sService: "payments/api", SSH: true}, wantErr: ErrEKSWithSSH},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateEKS(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEKSToken(t *testing.T) {
+	t.Parallel()
+
+	client := sts.NewPresignClient(sts.New(sts.Options{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+	}))
+	token, err := eksToken(context.Background(), client, "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	encoded, ok := strings.CutPrefix(token, eksTokenPrefix)
+	if !ok {
+		t.Fatalf("expected the %s prefix, got %q", eksTokenPrefix, token)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	presigned, err := url.Parse(string(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	query := presigned.Query()
+	if query.Get("Action") != "GetCallerIdentity" || !strings.Contains(query.Get("X-Amz-SignedHeaders"), "x-k8s-aws-id") {
+		t.Errorf("expected a GetCallerIdentity URL signed for the cluster id header, got %s", presigned)
+	}
+}
+
+func testKubernetesClient(t *testing.T, objects map[string]string) *kubernetesClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &kubernetesClient{endpoint: server.URL, token: "token", client: server.Client()}
+}
+
+func TestResolveK8sService(t *testing.T) {
+	t.Parallel()
+
+	const (
+		servicePath   = "/api/v1/namespaces/payments/services/api"
+		endpointsPath = "/api/v1/namespaces/payments/endpoints/api"
+		twoPorts      = `{"spec":{"type":"ClusterIP","ports":[{"name":"http","port":80},{"name":"metrics","port":9090}]}}`
+		pods          = `{"subsets":[{"addresses":[{"ip":"10.0.2.9"},{"ip":"10.0.1.4"}],"ports":[{"name":"http","port":8080},{"name":"metrics","port":9090}]}]}`
+	)
+	tests := []struct {
+		name       string
+		service    string
+		objects    map[string]string
+		want       serviceEndpoint
+		wantSource string
+		wantErr    error
+	}{
+		{
+			name:       "pod address",
+			service:    "payments/api:http",
+			objects:    map[string]string{servicePath: twoPorts, endpointsPath: pods},
+			want:       serviceEndpoint{Host: "10.0.1.4", Port: 8080},
+			wantSource: "pod",
+		},
+		{
+			name:       "port by number",
+			service:    "payments/api:9090",
+			objects:    map[string]string{servicePath: twoPorts, endpointsPath: pods},
+			want:       serviceEndpoint{Host: "10.0.1.4", Port: 9090},
+			wantSource: "pod",
+		},
+		{
+			name:    "ambiguous port",
+			service: "payments/api",
+			objects: map[string]string{servicePath: twoPorts, endpointsPath: pods},
+			wantErr: ErrK8sServicePort,
+		},
+		{
+			name:    "load balancer",
+			service: "payments/api",
+			objects: map[string]string{
+				servicePath: `{"spec":{"type":"LoadBalancer","ports":[{"port":443}]},"status":{"loadBalancer":{"ingress":[{"hostname":"internal-api.elb.amazonaws.com"}]}}}`,
+			},
+			want:       serviceEndpoint{Host: "internal-api.elb.amazonaws.com", Port: 443},
+			wantSource: "load balancer",
+		},
+		{
+			name:       "external name",
+			service:    "payments/api:5432",
+			objects:    map[string]string{servicePath: `{"spec":{"type":"ExternalName","externalName":"db.internal"}}`},
+			want:       serviceEndpoint{Host: "db.internal", Port: 5432},
+			wantSource: "external name",
+		},
+		{
+			name:    "no ready pods",
+			service: "payments/api",
+			objects: map[string]string{servicePath: `{"spec":{"type":"ClusterIP","ports":[{"port":80}]}}`, endpointsPath: `{"subsets":[]}`},
+			wantErr: ErrK8sServiceUnreachable,
+		},
+		{
+			name:    "missing service",
+			service: "payments/api",
+			wantErr: ErrKubernetesAPIFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ref, err := parseK8sService(tt.service)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, source, err := resolveK8sService(context.Background(), testKubernetesClient(t, tt.objects), ref)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("expected %v from %q, got %v from %q", tt.want, tt.wantSource, got, source)
+			}
+		})
+	}
+}
+
+func TestResolveK8sServiceForbidden(t *testing.T) {
+	t.Parallel()
+
+	kube := testKubernetesClient(t, nil)
+	kube.token = "wrong"
+	if _, _, err := resolveK8sService(context.Background(), kube, k8sServiceRef{Namespace: "payments", Name: "api"}); !errors.Is(err, ErrKubernetesAPIForbidden) {
+		t.Errorf("expected %v, got %v", ErrKubernetesAPIForbidden, err)
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var ErrInvalidSSMEndpoint = errors.New("invalid ssm endpoint")
+
+func (c Config) validateSSMEndpoint() error {
+	endpoint := strings.TrimSpace(c.SSMEndpoint)
+	if endpoint == "" {
+		return nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidSSMEndpoint, c.SSMEndpoint, err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" || parsed.Host == "" {
+		return fmt.Errorf("%w: %q (want a URL such as https://ssm-fips.us-gov-west-1.amazonaws.com)", ErrInvalidSSMEndpoint, c.SSMEndpoint)
+	}
+	if strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return fmt.Errorf("%w: %q has more than a scheme, host and port", ErrInvalidSSMEndpoint, c.SSMEndpoint)
+	}
+	return nil
+}
+
+// ssmEndpoint is the SSM endpoint the session plugin connects through:
+// --ssm-endpoint, or the region's public endpoint.
+func (c Config) ssmEndpoint() string {
+	if endpoint := strings.TrimSpace(c.SSMEndpoint); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return fmt.Sprintf("https://ssm.%s.amazonaws.com", c.Region)
+}
+
+// ssmClientOptions points the SSM client at --ssm-endpoint, when set.
+func (c Config) ssmClientOptions() []func(*ssm.Options) {
+	if strings.TrimSpace(c.SSMEndpoint) == "" {
+		return nil
+	}
+	endpoint := c.ssmEndpoint()
+	return []func(*ssm.Options){func(o *ssm.Options) { o.BaseEndpoint = aws.String(endpoint) }}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestConfigValidateSSMEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  error
+	}{
+		{name: "unset"},
+		{name: "fips", endpoint: "https://ssm-fips.us-gov-west-1.amazonaws.com"},
+		{name: "vpc endpoint with port", endpoint: "https://vpce-0abc-1234.ssm.us-east-1.vpce.amazonaws.com:443/"},
+		{name: "no scheme", endpoint: "ssm-fips.us-east-1.amazonaws.com", wantErr: ErrInvalidSSMEndpoint},
+		{name: "other scheme", endpoint: "ftp://ssm.example.com", wantErr: ErrInvalidSSMEndpoint},
+		{name: "path", endpoint: "https://proxy.example.com/ssm", wantErr: ErrInvalidSSMEndpoint},
+		{name: "unparsable", endpoint: "https://ssm.example.com:port", wantErr: ErrInvalidSSMEndpoint},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := (Config{SSMEndpoint: tt.endpoint}).validateSSMEndpoint(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigSSMEndpoint(t *testing.T) {
+	t.Parallel()
+
+	if got, want := (Config{Region: "eu-west-1"}).ssmEndpoint(), "https://ssm.eu-west-1.amazonaws.com"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if opts := (Config{Region: "eu-west-1"}).ssmClientOptions(); len(opts) != 0 {
+		t.Errorf("expected the SDK's own endpoint resolution, got %d options", len(opts))
+	}
+
+	cfg := Config{Region: "us-gov-west-1", SSMEndpoint: "https://ssm-fips.us-gov-west-1.amazonaws.com/"}
+	want := "https://ssm-fips.us-gov-west-1.amazonaws.com"
+	if got := cfg.ssmEndpoint(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	var options ssm.Options
+	for _, apply := range cfg.ssmClientOptions() {
+		apply(&options)
+	}
+	if got := aws.ToString(options.BaseEndpoint); got != want {
+		t.Errorf("expected the SSM client to use %q, got %q", want, got)
+	}
+
+	several := Config{Region: "us-east-1,us-west-2", LocalPort: 5432, SSMEndpoint: want}
+	if err := several.validateRegions(); !errors.Is(err, ErrMultiRegionWithSSMEndpoint) {
+		t.Errorf("expected %v, got %v", ErrMultiRegionWithSSMEndpoint, err)
+	}
+}
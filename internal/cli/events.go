@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	eventInstanceResolved = "instance_resolved"
+	eventSessionStarted   = "session_started"
+	eventTunnelReady      = "tunnel_ready"
+	eventKeepAliveFailed  = "keepalive_failed"
+	eventProbeUp          = "probe_up"
+	eventProbeDown        = "probe_down"
+	eventSessionEnded     = "session_ended"
+	eventShutdown         = "shutdown"
+)
+
+type lifecycleEvent struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Label      string    `json:"label,omitempty"`
+	InstanceID string    `json:"instance_id,omitempty"`
+	SessionID  string    `json:"session_id,omitempty"`
+	LocalPort  int       `json:"local_port,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// eventBus fans lifecycle events out to subscribers. Emit never blocks: a
+// subscriber that falls behind loses events rather than stalling the tunnel.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[chan lifecycleEvent]struct{}
+	now         func() time.Time
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[chan lifecycleEvent]struct{}),
+		now:         time.Now,
+	}
+}
+
+func (b *eventBus) Emit(event lifecycleEvent) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = b.now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) Subscribe(buffer int) (<-chan lifecycleEvent, func()) {
+	ch := make(chan lifecycleEvent, buffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+var (
+	ErrEventSocketInUse     = errors.New("events socket in use")
+	ErrEventSocketNotSocket = errors.New("events socket path is not a socket")
+)
+
+type eventSocketServer struct {
+	listener net.Listener
+	bus      *eventBus
+	path     string
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	clients map[net.Conn]func()
+	closed  bool
+}
+
+// serveEventSocket streams every event on bus as a JSON line to each client
+// connected to the Unix socket at path.
+func serveEventSocket(path string, bus *eventBus) (*eventSocketServer, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &eventSocketServer{listener: listener, bus: bus, path: path, clients: make(map[net.Conn]func())}
+	server.wg.Add(1)
+	go server.acceptLoop()
+	return server, nil
+}
+
+// removeStaleSocket removes the socket a previous run left at path. A file
+// that is not a socket, or a socket another process still serves, is left
+// alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%w: %s", ErrEventSocketNotSocket, path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrEventSocketInUse, path)
+	}
+	return os.Remove(path)
+}
+
+func (s *eventSocketServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serveClient(conn)
+	}
+}
+
+func (s *eventSocketServer) serveClient(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	events, unsubscribe := s.bus.Subscribe(64)
+	defer unsubscribe()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.clients[conn] = unsubscribe
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		s.mu.Unlock()
+	}()
+
+	// Drop the subscription as soon as the client hangs up.
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				unsubscribe()
+				return
+			}
+		}
+	}()
+
+	encoder := json.NewEncoder(conn)
+	for event := range events {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops accepting clients, flushes events already queued for the
+// connected ones and then disconnects them.
+func (s *eventSocketServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for _, unsubscribe := range s.clients {
+		unsubscribe()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Parallel()
+
+	t.Run("delivers events to every subscriber", func(t *testing.T) {
+		t.Parallel()
+
+		bus := newEventBus()
+		first, unsubscribeFirst := bus.Subscribe(1)
+		defer unsubscribeFirst()
+		second, unsubscribeSecond := bus.Subscribe(1)
+		defer unsubscribeSecond()
+
+		bus.Emit(lifecycleEvent{Type: eventSessionStarted, SessionID: "session-123"})
+
+		for _, ch := range []<-chan lifecycleEvent{first, second} {
+			event := <-ch
+			if event.Type != eventSessionStarted || event.SessionID != "session-123" {
+				t.Fatalf("event = %+v", event)
+			}
+			if event.Time.IsZero() {
+				t.Fatal("event time was not set")
+			}
+		}
+	})
+
+	t.Run("does not block on slow subscribers", func(t *testing.T) {
+		t.Parallel()
+
+		bus := newEventBus()
+		_, unsubscribe := bus.Subscribe(1)
+		defer unsubscribe()
+
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 10; i++ {
+				bus.Emit(lifecycleEvent{Type: eventKeepAliveFailed})
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Emit blocked on a full subscriber")
+		}
+	})
+
+	t.Run("nil bus ignores events", func(t *testing.T) {
+		t.Parallel()
+
+		var bus *eventBus
+		bus.Emit(lifecycleEvent{Type: eventShutdown})
+	})
+}
+
+func TestEventSocketServer(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.sock")
+	bus := newEventBus()
+	server, err := serveEventSocket(path, bus)
+	if err != nil {
+		t.Fatalf("serveEventSocket() unexpected error: %v", err)
+	}
+
+	var readers []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("dial events socket: %v", err)
+		}
+		defer conn.Close()
+		readers = append(readers, bufio.NewReader(conn))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		bus.mu.Lock()
+		subscribed := len(bus.subscribers)
+		bus.mu.Unlock()
+		if subscribed == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers = %d, want 2", subscribed)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	bus.Emit(lifecycleEvent{Type: eventInstanceResolved, InstanceID: "i-123"})
+	bus.Emit(lifecycleEvent{Type: eventShutdown})
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+
+	for _, reader := range readers {
+		var got []string
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			var event lifecycleEvent
+			if err := json.Unmarshal(line, &event); err != nil {
+				t.Fatalf("decode event %q: %v", line, err)
+			}
+			got = append(got, event.Type)
+		}
+		if len(got) != 2 || got[0] != eventInstanceResolved || got[1] != eventShutdown {
+			t.Fatalf("client received %v, want [%s %s]", got, eventInstanceResolved, eventShutdown)
+		}
+	}
+}
+
+func TestServeEventSocketExistingPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		create  func(t *testing.T, path string)
+		wantErr error
+	}{
+		{name: "missing", create: func(*testing.T, string) {}},
+		{name: "regular file", create: func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+		}, wantErr: ErrEventSocketNotSocket},
+		{name: "socket in use", create: func(t *testing.T, path string) {
+			listener, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			t.Cleanup(func() { listener.Close() })
+		}, wantErr: ErrEventSocketInUse},
+		{name: "stale socket", create: func(t *testing.T, path string) {
+			listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			listener.SetUnlinkOnClose(false)
+			listener.Close()
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "events.sock")
+			tt.create(t, path)
+			server, err := serveEventSocket(path, newEventBus())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				if _, statErr := os.Lstat(path); statErr != nil {
+					t.Errorf("expected %s to be left alone, got %v", path, statErr)
+				}
+				return
+			}
+			server.Close()
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type ssmDescribeSessionsAPI interface {
+	DescribeSessions(ctx context.Context, params *ssm.DescribeSessionsInput, optFns ...func(*ssm.Options)) (*ssm.DescribeSessionsOutput, error)
+}
+
+type stsGetCallerIdentityAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+type existingSessionsAPI interface {
+	ssmDescribeSessionsAPI
+	ssmTerminateSessionAPI
+}
+
+// existingSessions lists the caller's active sessions to the instance that
+// use the forwarding document. DescribeSessions does not return session
+// parameters, so sessions to other ports of the instance are included.
+func existingSessions(ctx context.Context, client ssmDescribeSessionsAPI, owner, instanceID, documentName string) ([]string, error) {
+	input := &ssm.DescribeSessionsInput{
+		State: ssmtypes.SessionStateActive,
+		Filters: []ssmtypes.SessionFilter{
+			{Key: ssmtypes.SessionFilterKeyTargetId, Value: aws.String(instanceID)},
+			{Key: ssmtypes.SessionFilterKeyOwner, Value: aws.String(owner)},
+		},
+	}
+	var sessionIDs []string
+	for {
+		output, err := client.DescribeSessions(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe sessions: %w", err)
+		}
+		for _, session := range output.Sessions {
+			if !strings.EqualFold(aws.ToString(session.DocumentName), documentName) {
+				continue
+			}
+			if id := aws.ToString(session.SessionId); id != "" {
+				sessionIDs = append(sessionIDs, id)
+			}
+		}
+		if aws.ToString(output.NextToken) == "" {
+			return sessionIDs, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// killExistingSessions terminates the caller's active forwarding sessions
+// to the instance and returns how many were terminated.
+func killExistingSessions(ctx context.Context, client existingSessionsAPI, identity stsGetCallerIdentityAPI, instanceID, documentName string) (int, error) {
+	caller, err := identity.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	sessionIDs, err := existingSessions(ctx, client, aws.ToString(caller.Arn), instanceID, documentName)
+	if err != nil {
+		return 0, err
+	}
+	terminated := 0
+	var errs []error
+	for _, sessionID := range sessionIDs {
+		if err := terminatePortForwardingSession(ctx, client, sessionID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		terminated++
+	}
+	return terminated, errors.Join(errs...)
+}
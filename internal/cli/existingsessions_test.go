@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type fakeExistingSessionsClient struct {
+	pages         []*ssm.DescribeSessionsOutput
+	inputs        []*ssm.DescribeSessionsInput
+	terminateErr  map[string]error
+	terminatedIDs []string
+}
+
+func (f *fakeExistingSessionsClient) DescribeSessions(_ context.Context, params *ssm.DescribeSessionsInput, _ ...func(*ssm.Options)) (*ssm.DescribeSessionsOutput, error) {
+	f.inputs = append(f.inputs, params)
+	page := f.pages[0]
+	f.pages = f.pages[1:]
+	return page, nil
+}
+
+func (f *fakeExistingSessionsClient) TerminateSession(_ context.Context, params *ssm.TerminateSessionInput, _ ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	id := aws.ToString(params.SessionId)
+	if err := f.terminateErr[id]; err != nil {
+		return nil, err
+	}
+	f.terminatedIDs = append(f.terminatedIDs, id)
+	return &ssm.TerminateSessionOutput{}, nil
+}
+
+type fakeSTSClient struct {
+	arn string
+	err error
+}
+
+func (f fakeSTSClient) GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(f.arn)}, nil
+}
+
+func TestKillExistingSessions(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeExistingSessionsClient{
+		pages: []*ssm.DescribeSessionsOutput{
+			{
+				Sessions: []ssmtypes.Session{
+					{SessionId: aws.String("alice-1"), DocumentName: aws.String(defaultDocumentName)},
+					{SessionId: aws.String("alice-shell"), DocumentName: aws.String("SSM-SessionManagerRunShell")},
+				},
+				NextToken: aws.String("page-2"),
+			},
+			{Sessions: []ssmtypes.Session{
+				{SessionId: aws.String("alice-2"), DocumentName: aws.String(defaultDocumentName)},
+				{SessionId: aws.String("alice-3"), DocumentName: aws.String(defaultDocumentName)},
+			}},
+		},
+		terminateErr: map[string]error{"alice-3": errors.New("access denied")},
+	}
+	arn := "arn:aws:sts::123456789012:assumed-role/dev/alice"
+
+	terminated, err := killExistingSessions(context.Background(), client, fakeSTSClient{arn: arn}, "i-0123456789abcdef0", defaultDocumentName)
+	if err == nil {
+		t.Fatal("expected the failed termination to be reported")
+	}
+	if terminated != 2 {
+		t.Fatalf("expected 2 terminated sessions, got %d", terminated)
+	}
+	if want := []string{"alice-1", "alice-2"}; !reflect.DeepEqual(client.terminatedIDs, want) {
+		t.Fatalf("expected %q, got %q", want, client.terminatedIDs)
+	}
+
+	input := client.inputs[0]
+	if input.State != ssmtypes.SessionStateActive {
+		t.Fatalf("expected active sessions, got %q", input.State)
+	}
+	want := []ssmtypes.SessionFilter{
+		{Key: ssmtypes.SessionFilterKeyTargetId, Value: aws.String("i-0123456789abcdef0")},
+		{Key: ssmtypes.SessionFilterKeyOwner, Value: aws.String(arn)},
+	}
+	if !reflect.DeepEqual(input.Filters, want) {
+		t.Fatalf("expected filters %+v, got %+v", want, input.Filters)
+	}
+	if got := aws.ToString(client.inputs[1].NextToken); got != "page-2" {
+		t.Fatalf("expected the second page to be requested, got token %q", got)
+	}
+}
+
+func TestKillExistingSessionsIdentityError(t *testing.T) {
+	t.Parallel()
+
+	identityErr := errors.New("expired token")
+	_, err := killExistingSessions(context.Background(), &fakeExistingSessionsClient{}, fakeSTSClient{err: identityErr}, "i-0123456789abcdef0", defaultDocumentName)
+	if !errors.Is(err, identityErr) {
+		t.Fatalf("expected %v, got %v", identityErr, err)
+	}
+}
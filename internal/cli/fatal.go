@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// fatalExitCode is the status of every fatal error except an interrupt.
+const fatalExitCode = 1
+
+var ErrInvalidErrorFormat = errors.New("invalid error format")
+
+func validateErrorFormat(format string) error {
+	switch format {
+	case errorFormatText, errorFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidErrorFormat, format, errorFormatText, errorFormatJSON)
+	}
+}
+
+// fatalError is what --error-format json writes to stderr for a fatal
+// error, on one line.
+type fatalError struct {
+	Code     string           `json:"code"`
+	Message  string           `json:"message"`
+	Phase    string           `json:"phase"`
+	ExitCode int              `json:"exit_code"`
+	AWS      *awsErrorDetails `json:"aws,omitempty"`
+}
+
+// awsErrorDetails are read from the AWS SDK error in the chain, if any.
+type awsErrorDetails struct {
+	Service    string `json:"service,omitempty"`
+	Operation  string `json:"operation,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Fault      string `json:"fault,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+// errorCodes name the failures wrapper scripts most often branch on. The
+// first match wins.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrStartupTimeExceeded, "startup_timeout"},
+	{ErrResolveTimeExceeded, "resolve_timeout"},
+	{ErrNoRunningInstances, "instance_not_found"},
+	{ErrInstanceNotFound, "instance_not_found"},
+	{ErrInstanceNotRunning, "instance_not_running"},
+	{ErrMultipleRunningInstances, "instance_ambiguous"},
+	{ErrMissingRequiredTag, "instance_missing_tag"},
+	{ErrDocumentNotFound, "document_not_found"},
+	{ErrSSOLoginRequired, "sso_login_required"},
+	{ErrMFACodeRequired, "mfa_code_required"},
+	{ErrTunnelAlreadyRunning, "tunnel_already_running"},
+	{ErrLocalPortInUse, "local_port_in_use"},
+	{ErrLocalPortPermission, "local_port_permission"},
+	{ErrAgentVersionMismatch, "agent_version_mismatch"},
+	{ErrMonitorFailed, "monitor_failed"},
+	{ErrPipeFailed, "pipe_failed"},
+	{ErrSessionPluginFailed, "session_plugin_failed"},
+}
+
+// errorCode classifies err: a known failure, an AWS API error, invalid
+// options or configuration, or otherwise the phase that failed.
+func errorCode(phase string, err error) string {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	if phase == "options" || phase == "config" {
+		return "invalid_config"
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if strings.Contains(apiErr.ErrorCode(), "AccessDenied") {
+			return "access_denied"
+		}
+		return "aws_error"
+	}
+	return phase + "_failed"
+}
+
+func awsDetails(err error) *awsErrorDetails {
+	var details awsErrorDetails
+	var opErr *smithy.OperationError
+	if errors.As(err, &opErr) {
+		details.Service, details.Operation = opErr.Service(), opErr.Operation()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		details.Code, details.Message, details.Fault = apiErr.ErrorCode(), apiErr.ErrorMessage(), apiErr.ErrorFault().String()
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		details.RequestID, details.StatusCode = respErr.ServiceRequestID(), respErr.HTTPStatusCode()
+	}
+	if details == (awsErrorDetails{}) {
+		return nil
+	}
+	return &details
+}
+
+// newFatalError describes err, which ended phase, as message.
+func newFatalError(phase, message string, err error) fatalError {
+	return fatalError{
+		Code:     errorCode(phase, err),
+		Message:  message,
+		Phase:    phase,
+		ExitCode: fatalExitCode,
+		AWS:      awsDetails(err),
+	}
+}
+
+func interruptedError(phase string) fatalError {
+	return fatalError{Code: "interrupted", Message: "Interrupted", Phase: phase, ExitCode: interruptedExitCode}
+}
+
+func writeFatalJSON(w io.Writer, report fatalError) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// fatalExitHook, when set, runs before exitFatal exits the process.
+var fatalExitHook func(report fatalError)
+
+// exitFatal reports a fatal error the way --error-format asks and exits
+// with its status.
+func exitFatal(format string, report fatalError) {
+	if format == errorFormatJSON {
+		writeFatalJSON(os.Stderr, report)
+	} else if jsonLogs {
+		slog.Error(report.Message, "code", report.Code, "phase", report.Phase)
+	} else {
+		log.Print(report.Message)
+	}
+	if fatalExitHook != nil {
+		fatalExitHook(report)
+	}
+	os.Exit(report.ExitCode)
+}
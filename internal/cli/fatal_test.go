@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func accessDeniedError() error {
+	return &smithy.OperationError{
+		ServiceID:     "SSM",
+		OperationName: "StartSession",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadRequest}},
+				Err:      &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized", Fault: smithy.FaultClient},
+			},
+			RequestID: "req-1",
+		},
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		phase string
+		err   error
+		want  string
+	}{
+		{name: "known failure", phase: "resolve", err: fmt.Errorf("%w for instance name %q", ErrNoRunningInstances, "bastion"), want: "instance_not_found"},
+		{name: "startup budget", phase: "credentials", err: fmt.Errorf("%w: dial tcp", ErrStartupTimeExceeded), want: "startup_timeout"},
+		{name: "invalid configuration", phase: "config", err: ErrMissingProfile, want: "invalid_config"},
+		{name: "access denied", phase: "session", err: accessDeniedError(), want: "access_denied"},
+		{name: "other AWS error", phase: "document", err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: "aws_error"},
+		{name: "unknown", phase: "statsd", err: errors.New("dial udp: no route"), want: "statsd_failed"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := errorCode(tt.phase, tt.err); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteFatalJSON(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("failed to start port forwarding: %w", accessDeniedError())
+	var out bytes.Buffer
+	if err := writeFatalJSON(&out, newFatalError("session", "Session failed: "+err.Error(), err)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Count(out.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("expected one line, got %q", out.String())
+	}
+	var got fatalError
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Code != "access_denied" || got.Phase != "session" || got.ExitCode != fatalExitCode {
+		t.Errorf("expected an access_denied session failure, got %+v", got)
+	}
+	want := awsErrorDetails{Service: "SSM", Operation: "StartSession", Code: "AccessDeniedException", Message: "not authorized", Fault: "client", RequestID: "req-1", StatusCode: http.StatusBadRequest}
+	if got.AWS == nil || *got.AWS != want {
+		t.Errorf("expected %+v, got %+v", want, got.AWS)
+	}
+
+	if details := awsDetails(ErrMissingProfile); details != nil {
+		t.Errorf("expected no AWS details, got %+v", details)
+	}
+}
+
+func TestValidateErrorFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{errorFormatText, errorFormatJSON} {
+		if err := validateErrorFormat(format); err != nil {
+			t.Errorf("expected %q to be valid, got %v", format, err)
+		}
+	}
+	if err := validateErrorFormat("yaml"); !errors.Is(err, ErrInvalidErrorFormat) {
+		t.Errorf("expected %v, got %v", ErrInvalidErrorFormat, err)
+	}
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	forwarderPlugin = "plugin"
+	forwarderNative = "native"
+)
+
+var (
+	ErrInvalidForwarder      = errors.New("invalid forwarder")
+	ErrInvalidTimeout        = errors.New("invalid timeout")
+	ErrTimeoutRequiresNative = errors.New("read/write timeouts require --forwarder native")
+
+	ErrInvalidAcceptConcurrency        = errors.New("invalid accept concurrency")
+	ErrAcceptConcurrencyRequiresNative = errors.New("accept concurrency requires --forwarder native")
+
+	ErrInvalidListenBacklog        = errors.New("invalid listen backlog")
+	ErrListenBacklogRequiresNative = errors.New("listen backlog requires --forwarder native")
+	ErrListenBacklogUnsupported    = errors.New("listen backlog cannot be set on Windows")
+)
+
+// defaultAcceptConcurrency is the number of accept loops run when
+// AcceptConcurrency is not set. Relays always run in their own goroutines.
+const defaultAcceptConcurrency = 1
+
+// A failed Accept, such as EMFILE when the process runs out of file
+// descriptors, is retried after a backoff that doubles between these
+// bounds, as net/http does.
+const (
+	acceptRetryMinDelay = 5 * time.Millisecond
+	acceptRetryMaxDelay = time.Second
+)
+
+type forwarderOptions struct {
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	AcceptConcurrency int
+	// AllowedClients, when set, are the source prefixes connections are
+	// accepted from; others are closed at once.
+	AllowedClients []netip.Prefix
+	// Active, when set, counts the open client connections.
+	Active *atomic.Int64
+	// Sent and Received, when set, count the bytes relayed to and from
+	// the session.
+	Sent     *atomic.Int64
+	Received *atomic.Int64
+	// Logf, when set, replaces log.Printf for the forwarder's messages.
+	Logf func(format string, args ...any)
+}
+
+// nativeForwarder owns the user-facing local listener and relays every
+// accepted connection to the port bound by the session plugin, which lets
+// the tool apply per-connection policy the plugin has no hooks for.
+type nativeForwarder struct {
+	listener net.Listener
+	target   string
+	opts     forwarderOptions
+	logf     func(format string, args ...any)
+
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func startNativeForwarder(listener net.Listener, target string, opts forwarderOptions) *nativeForwarder {
+	f := &nativeForwarder{
+		listener: listener,
+		target:   target,
+		opts:     opts,
+		logf:     log.Printf,
+		conns:    make(map[net.Conn]struct{}),
+		closed:   make(chan struct{}),
+	}
+	if opts.Logf != nil {
+		f.logf = opts.Logf
+	}
+	loops := opts.AcceptConcurrency
+	if loops <= 0 {
+		loops = defaultAcceptConcurrency
+	}
+	for range loops {
+		f.wg.Add(1)
+		go f.acceptLoop()
+	}
+	return f
+}
+
+func (f *nativeForwarder) acceptLoop() {
+	defer f.wg.Done()
+	var delay time.Duration
+	for {
+		client, err := f.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			delay = min(max(2*delay, acceptRetryMinDelay), acceptRetryMaxDelay)
+			f.logf("Forwarder failed to accept a connection, retrying in %s: %v", delay, err)
+			select {
+			case <-f.closed:
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		delay = 0
+		if len(f.opts.AllowedClients) > 0 && !clientAllowed(f.opts.AllowedClients, client.RemoteAddr()) {
+			f.logf("Forwarder rejected connection from %s: not in --allow-cidr", client.RemoteAddr())
+			client.Close()
+			continue
+		}
+		f.wg.Add(1)
+		go f.relay(client)
+	}
+}
+
+func (f *nativeForwarder) track(conn net.Conn) {
+	f.mu.Lock()
+	f.conns[conn] = struct{}{}
+	f.mu.Unlock()
+}
+
+func (f *nativeForwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+	conn.Close()
+}
+
+func (f *nativeForwarder) relay(client net.Conn) {
+	defer f.wg.Done()
+	f.track(client)
+	defer f.untrack(client)
+	if f.opts.Active != nil {
+		f.opts.Active.Add(1)
+		defer f.opts.Active.Add(-1)
+	}
+
+	f.mu.Lock()
+	target := f.target
+	f.mu.Unlock()
+	upstream, err := net.DialTimeout("tcp", target, 10*time.Second)
+	if err != nil {
+		f.logf("Forwarder failed to reach session plugin for %s: %v", client.RemoteAddr(), err)
+		return
+	}
+	f.track(upstream)
+	defer f.untrack(upstream)
+
+	activity := &connActivity{}
+	activity.touch()
+	errCh := make(chan error, 2)
+	go func() { errCh <- copyWithDeadlines(upstream, client, f.opts, activity, f.opts.Sent) }()
+	go func() { errCh <- copyWithDeadlines(client, upstream, f.opts, activity, f.opts.Received) }()
+
+	// A direction that reaches EOF is passed on as a half-close, so a
+	// client that shuts down its write side still gets the response. A
+	// failure ends the connection; closing both sockets unblocks the other
+	// copy.
+	err = <-errCh
+	if err != nil {
+		client.Close()
+		upstream.Close()
+		<-errCh
+	} else if err = <-errCh; err != nil {
+		client.Close()
+		upstream.Close()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		f.logf("Forwarder closed connection from %s: %v", client.RemoteAddr(), err)
+	}
+}
+
+// connActivity is when data last moved in either direction of a relayed
+// connection.
+type connActivity struct {
+	last atomic.Int64
+}
+
+func (a *connActivity) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+func (a *connActivity) idleSince() time.Time {
+	return time.Unix(0, a.last.Load())
+}
+
+// copyWithDeadlines copies src to dst until EOF, which it passes on by
+// closing dst's write side. The read timeout is the connection's idle
+// time: a read that times out while the other direction carried data
+// keeps waiting.
+func copyWithDeadlines(dst, src net.Conn, opts forwarderOptions, activity *connActivity, copied *atomic.Int64) error {
+	buf := make([]byte, 32*1024)
+	for {
+		if opts.ReadTimeout > 0 {
+			src.SetReadDeadline(activity.idleSince().Add(opts.ReadTimeout))
+		}
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			activity.touch()
+			if opts.WriteTimeout > 0 {
+				dst.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+			}
+			written, err := dst.Write(buf[:n])
+			if copied != nil {
+				copied.Add(int64(written))
+			}
+			if err != nil {
+				return fmt.Errorf("write timeout or failure: %w", err)
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				if tcp, ok := dst.(*net.TCPConn); ok {
+					tcp.CloseWrite()
+				}
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(readErr, &netErr) && netErr.Timeout() && time.Since(activity.idleSince()) < opts.ReadTimeout {
+				continue
+			}
+			return fmt.Errorf("read timeout or failure: %w", readErr)
+		}
+	}
+}
+
+// retarget relays connections accepted from now on to target, the port a
+// new session's plugin bound. The listener, and so the local port, stays.
+func (f *nativeForwarder) retarget(target string) {
+	f.mu.Lock()
+	f.target = target
+	f.mu.Unlock()
+}
+
+// Close stops accepting connections and tears down the ones in flight.
+func (f *nativeForwarder) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	err := f.listener.Close()
+	f.mu.Lock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return err
+}
+
+func allocateEphemeralPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
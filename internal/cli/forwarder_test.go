@@ -0,0 +1,404 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newTestForwarder(t *testing.T, target string, opts forwarderOptions) (*nativeForwarder, *[]string, *sync.Mutex) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var mu sync.Mutex
+	var logged []string
+	opts.Logf = func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, format)
+	}
+	forwarder := startNativeForwarder(listener, target, opts)
+	t.Cleanup(func() { forwarder.Close() })
+	return forwarder, &logged, &mu
+}
+
+func TestNativeForwarderRelaysTraffic(t *testing.T) {
+	t.Parallel()
+
+	forwarder, _, _ := newTestForwarder(t, startEchoServer(t), forwarderOptions{})
+
+	conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "SELECT 1"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, len("SELECT 1"))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(reply) != "SELECT 1" {
+		t.Fatalf("reply = %q, want %q", reply, "SELECT 1")
+	}
+}
+
+func TestNativeForwarderRetargetKeepsListener(t *testing.T) {
+	t.Parallel()
+
+	// The first session's plugin port has gone away with the session.
+	dropped, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	droppedAddr := dropped.Addr().String()
+	dropped.Close()
+
+	forwarder, _, _ := newTestForwarder(t, droppedAddr, forwarderOptions{})
+	addr := forwarder.listener.Addr().String()
+	forwarder.retarget(startEchoServer(t))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial forwarder after reconnect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "SELECT 1"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, len("SELECT 1"))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(reply) != "SELECT 1" {
+		t.Fatalf("reply = %q, want %q", reply, "SELECT 1")
+	}
+}
+
+func TestNativeForwarderRejectsClientOutsideAllowCIDR(t *testing.T) {
+	t.Parallel()
+
+	forwarder, logged, mu := newTestForwarder(t, startEchoServer(t), forwarderOptions{
+		AllowedClients: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "SELECT 1")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected forwarder to close a connection from outside --allow-cidr")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*logged) == 0 || !strings.Contains((*logged)[0], "rejected connection") {
+		t.Fatalf("logged = %q, want a rejected connection line", *logged)
+	}
+}
+
+func TestNativeForwarderReadTimeoutClosesConnection(t *testing.T) {
+	t.Parallel()
+
+	forwarder, logged, mu := newTestForwarder(t, startEchoServer(t), forwarderOptions{ReadTimeout: 30 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected forwarder to close idle connection with EOF, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*logged) == 0 || !strings.Contains((*logged)[0], "closed connection") {
+		t.Fatalf("logged = %q, want a closed connection line", *logged)
+	}
+}
+
+// startServer accepts connections on a loopback port and hands each to
+// handle.
+func startServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestNativeForwarderPassesHalfClose(t *testing.T) {
+	t.Parallel()
+
+	// The server answers once the client has sent everything.
+	target := startServer(t, func(conn net.Conn) {
+		request, err := io.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "got "+string(request))
+	})
+	forwarder, _, _ := newTestForwarder(t, target, forwarderOptions{})
+
+	conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "SELECT 1")
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("close write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(reply) != "got SELECT 1" {
+		t.Fatalf("reply = %q, want %q", reply, "got SELECT 1")
+	}
+}
+
+func TestNativeForwarderReadTimeoutIsIdleTime(t *testing.T) {
+	t.Parallel()
+
+	// A download: the server streams for longer than the read timeout and
+	// the client never sends anything.
+	target := startServer(t, func(conn net.Conn) {
+		for range 10 {
+			if _, err := io.WriteString(conn, "row\n"); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	forwarder, logged, mu := newTestForwarder(t, target, forwarderOptions{ReadTimeout: 60 * time.Millisecond})
+
+	conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if want := strings.Repeat("row\n", 10); string(reply) != want {
+		t.Fatalf("reply = %q, want %q", reply, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*logged) != 0 {
+		t.Fatalf("logged = %q, want no timeout", *logged)
+	}
+}
+
+func TestSetListenBacklog(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	err = setListenBacklog(listener, 16)
+	if !listenBacklogSupported {
+		if !errors.Is(err, ErrListenBacklogUnsupported) {
+			t.Fatalf("expected %v, got %v", ErrListenBacklogUnsupported, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("setListenBacklog() unexpected error: %v", err)
+	}
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial after changing the backlog: %v", err)
+	}
+	conn.Close()
+}
+
+func TestNativeForwarderCloseStopsAccepting(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	forwarder := startNativeForwarder(listener, startEchoServer(t), forwarderOptions{})
+	addr := listener.Addr().String()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		forwarder.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not return with a connection in flight")
+	}
+
+	if _, err := net.DialTimeout("tcp", addr, 100*time.Millisecond); err == nil {
+		t.Fatal("forwarder still accepting after Close()")
+	}
+}
+
+func TestNativeForwarderConcurrentAccepts(t *testing.T) {
+	t.Parallel()
+
+	forwarder, _, _ := newTestForwarder(t, startEchoServer(t), forwarderOptions{AcceptConcurrency: 4})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", forwarder.listener.Addr().String())
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			if _, err := io.WriteString(conn, "ping"); err != nil {
+				errs <- err
+				return
+			}
+			reply := make([]byte, len("ping"))
+			if _, err := io.ReadFull(conn, reply); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("relay through concurrent accept loops: %v", err)
+	}
+}
+
+// flakyListener fails the first failures calls to Accept, as a process out
+// of file descriptors does.
+type flakyListener struct {
+	net.Listener
+	mu       sync.Mutex
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.failures > 0 {
+		l.failures--
+		l.mu.Unlock()
+		return nil, syscall.EMFILE
+	}
+	l.mu.Unlock()
+	return l.Listener.Accept()
+}
+
+func TestNativeForwarderSurvivesAcceptErrors(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var mu sync.Mutex
+	var logged []string
+	forwarder := startNativeForwarder(&flakyListener{Listener: inner, failures: 3}, startEchoServer(t), forwarderOptions{
+		Logf: func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			logged = append(logged, format)
+		},
+	})
+	defer forwarder.Close()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("dial forwarder: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, len("ping"))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("expected the forwarder to accept again after failed accepts: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 3 {
+		t.Errorf("expected 3 logged accept failures, got %q", logged)
+	}
+}
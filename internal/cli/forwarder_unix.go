@@ -0,0 +1,30 @@
+//go:build !windows
+
+package cli
+
+import (
+	"net"
+	"syscall"
+)
+
+const listenBacklogSupported = true
+
+// setListenBacklog calls listen(2) again on the bound socket, which
+// replaces the backlog Go chose. The kernel still caps it at somaxconn.
+func setListenBacklog(listener net.Listener, backlog int) error {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	raw, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package cli
+
+import "net"
+
+// Winsock ignores listen on a socket that is already listening, so the
+// backlog cannot be changed once Go has bound the port.
+const listenBacklogSupported = false
+
+func setListenBacklog(net.Listener, int) error {
+	return ErrListenBacklogUnsupported
+}
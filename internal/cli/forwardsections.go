@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// forwardSectionPrefix starts the name of a config file section holding
+// one of several tunnels, e.g. [forward "db"].
+const forwardSectionPrefix = "forward"
+
+var (
+	ErrInvalidForwardSection          = errors.New("invalid forward section")
+	ErrDuplicateForwardLocalPort      = errors.New("duplicate forward local port")
+	ErrForwardSectionsWithSSH         = errors.New("forward sections cannot be used with ssh mode")
+	ErrForwardSectionsWithTaggedPorts = errors.New("forward sections cannot be combined with forward tagged ports")
+	ErrForwardSectionsWithCount       = errors.New("forward sections cannot be combined with count")
+	ErrForwardSectionsWithLocalPort   = errors.New("forward sections cannot be combined with local port; set local_port in each section")
+	ErrForwardSectionsWithRegions     = errors.New("forward sections cannot be combined with several regions")
+)
+
+// forwardTarget is one tunnel of a config file with several. An empty
+// remote host or port falls back to [settings], and a zero local port is
+// chosen like --local-port 0.
+type forwardTarget struct {
+	Name       string `ini:"-"`
+	LocalPort  int    `ini:"local_port"`
+	RemoteHost string `ini:"remote_host"`
+	RemotePort int    `ini:"remote_port"`
+}
+
+// forwardSectionName returns the tunnel name of a [forward "name"] section.
+func forwardSectionName(section string) (string, bool) {
+	rest, ok := strings.CutPrefix(section, forwardSectionPrefix+" ")
+	if !ok {
+		return "", false
+	}
+	return strings.Trim(strings.TrimSpace(rest), `"`), true
+}
+
+// parseForwardSections reads the [forward "name"] sections in file order.
+func parseForwardSections(iniCfg *ini.File) ([]forwardTarget, error) {
+	var targets []forwardTarget
+	for _, section := range iniCfg.Sections() {
+		name, ok := forwardSectionName(section.Name())
+		if !ok {
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: [%s] has no name", ErrInvalidForwardSection, section.Name())
+		}
+		target := forwardTarget{Name: name}
+		if err := section.StrictMapTo(&target); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidForwardSection, name, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (c Config) validateForwardSections() error {
+	if len(c.Forwards) == 0 {
+		return nil
+	}
+	if c.SSH {
+		return ErrForwardSectionsWithSSH
+	}
+	if c.ForwardTaggedPorts {
+		return ErrForwardSectionsWithTaggedPorts
+	}
+	if c.Count > 1 {
+		return ErrForwardSectionsWithCount
+	}
+	if c.LocalPort != 0 {
+		return ErrForwardSectionsWithLocalPort
+	}
+	if len(c.regions()) > 1 {
+		return ErrForwardSectionsWithRegions
+	}
+	// The resolver, Cloud Map and the EKS service may still supply the shared
+	// remote endpoint.
+	discovered := strings.TrimSpace(c.ResolverURL) != "" || c.cloudMapEnabled() || c.eksEnabled()
+	localPorts := make(map[int]string, len(c.Forwards))
+	for _, target := range c.Forwards {
+		if target.LocalPort < 0 || target.LocalPort > 65535 {
+			return fmt.Errorf("%w %q: %w", ErrInvalidForwardSection, target.Name, ErrInvalidLocalPort)
+		}
+		if other, ok := localPorts[target.LocalPort]; ok && target.LocalPort != 0 {
+			return fmt.Errorf("%w: %d in %q and %q", ErrDuplicateForwardLocalPort, target.LocalPort, other, target.Name)
+		}
+		localPorts[target.LocalPort] = target.Name
+		if target.RemotePort < 0 || target.RemotePort > 65535 {
+			return fmt.Errorf("%w %q: %w", ErrInvalidForwardSection, target.Name, ErrInvalidRemotePort)
+		}
+		if discovered {
+			continue
+		}
+		remote := c
+		remote.RemoteHost = cmp.Or(strings.TrimSpace(target.RemoteHost), c.RemoteHost)
+		remote.RemotePort = cmp.Or(target.RemotePort, c.RemotePort)
+		if err := remote.validateRemote(); err != nil {
+			return fmt.Errorf("%w %q: %w", ErrInvalidForwardSection, target.Name, err)
+		}
+	}
+	return nil
+}
+
+// sectionForwards returns one config per forward section. Sections without
+// a local port take theirs from autoPorts, in order.
+func sectionForwards(cfg Config, autoPorts []int) []Config {
+	forwards := make([]Config, len(cfg.Forwards))
+	for i, target := range cfg.Forwards {
+		forwards[i] = cfg
+		forwards[i].RemoteHost = cmp.Or(strings.TrimSpace(target.RemoteHost), cfg.RemoteHost)
+		forwards[i].RemotePort = cmp.Or(target.RemotePort, cfg.RemotePort)
+		forwards[i].LocalPort = target.LocalPort
+		if target.LocalPort == 0 {
+			forwards[i].LocalPort, autoPorts = autoPorts[0], autoPorts[1:]
+		}
+	}
+	return forwards
+}
+
+// forwardSectionAutoPorts is how many forward sections leave the local
+// port to the operating system or the pool.
+func forwardSectionAutoPorts(targets []forwardTarget) int {
+	n := 0
+	for _, target := range targets {
+		if target.LocalPort == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func forwardSectionLabels(targets []forwardTarget) []string {
+	labels := make([]string, len(targets))
+	for i, target := range targets {
+		labels[i] = target.Name
+	}
+	return labels
+}
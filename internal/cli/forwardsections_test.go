@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromFileForwardSections(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := strings.Join([]string{
+		"[settings]",
+		"profile = default",
+		"instance_name = bastion",
+		"remote_host = db.internal",
+		"",
+		`[forward "db"]`,
+		"local_port = 5432",
+		"remote_port = 5432",
+		"",
+		`[forward "cache"]`,
+		"remote_host = cache.internal",
+		"remote_port = 6379",
+	}, "\n")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	cfg, err := loadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	want := []forwardTarget{
+		{Name: "db", LocalPort: 5432, RemotePort: 5432},
+		{Name: "cache", RemoteHost: "cache.internal", RemotePort: 6379},
+	}
+	if !slices.Equal(cfg.Forwards, want) {
+		t.Fatalf("expected %+v, got %+v", want, cfg.Forwards)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	forwards := sectionForwards(*cfg, []int{40000})
+	got := make([]string, len(forwards))
+	for i, forward := range forwards {
+		got[i] = serviceEndpoint{Host: forward.RemoteHost, Port: forward.RemotePort}.String()
+	}
+	if forwards[0].LocalPort != 5432 || forwards[1].LocalPort != 40000 {
+		t.Errorf("expected local ports 5432 and 40000, got %d and %d", forwards[0].LocalPort, forwards[1].LocalPort)
+	}
+	if wantRemote := []string{"db.internal:5432", "cache.internal:6379"}; !slices.Equal(got, wantRemote) {
+		t.Errorf("expected %v, got %v", wantRemote, got)
+	}
+}
+
+func TestLoadConfigFromFileInvalidForwardSection(t *testing.T) {
+	t.Parallel()
+
+	configPath := filepath.Join(t.TempDir(), "settings.ini")
+	content := "[settings]\nprofile = default\n\n[forward \"db\"]\nlocal_port = five\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	if _, err := loadConfigFromFile(configPath); !errors.Is(err, ErrInvalidForwardSection) {
+		t.Fatalf("expected %v, got %v", ErrInvalidForwardSection, err)
+	}
+}
+
+func TestConfigValidateForwardSections(t *testing.T) {
+	t.Parallel()
+
+	base := Config{Profile: "default", InstanceName: "bastion", RemoteHost: "db.internal"}
+	with := func(mutate func(*Config), targets ...forwardTarget) Config {
+		cfg := base
+		cfg.Forwards = targets
+		if mutate != nil {
+			mutate(&cfg)
+		}
+		return cfg
+	}
+	db := forwardTarget{Name: "db", LocalPort: 5432, RemotePort: 5432}
+	cache := forwardTarget{Name: "cache", RemoteHost: "cache.internal", RemotePort: 6379}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "two sections", cfg: with(nil, db, cache)},
+		{name: "duplicate local port", cfg: with(nil, db, forwardTarget{Name: "replica", LocalPort: 5432, RemotePort: 5432}), wantErr: ErrDuplicateForwardLocalPort},
+		{name: "missing remote port", cfg: with(nil, db, forwardTarget{Name: "cache"}), wantErr: ErrMissingRemotePort},
+		{name: "missing remote host", cfg: with(func(c *Config) { c.RemoteHost = "" }, db), wantErr: ErrMissingRemoteHost},
+		{name: "shared local port", cfg: with(func(c *Config) { c.LocalPort = 5432 }, db), wantErr: ErrForwardSectionsWithLocalPort},
+		{name: "ssh", cfg: with(func(c *Config) { c.SSH = true }, db), wantErr: ErrForwardSectionsWithSSH},
+		{name: "tagged ports", cfg: with(func(c *Config) { c.ForwardTaggedPorts = true }, db), wantErr: ErrForwardSectionsWithTaggedPorts},
+		{name: "count", cfg: with(func(c *Config) { c.Count = 2 }, db), wantErr: ErrForwardSectionsWithCount},
+		{name: "several regions", cfg: with(func(c *Config) { c.Region = "us-east-1,eu-west-1" }, db), wantErr: ErrForwardSectionsWithRegions},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
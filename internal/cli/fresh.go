@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	defaultPreferFreshInterval = 10 * time.Minute
+	// freshIdlePollInterval is how often the idle policy looks for a moment
+	// without client connections once a fresher instance was found.
+	freshIdlePollInterval = time.Second
+)
+
+const (
+	freshPolicyIdle      = "idle"
+	freshPolicyImmediate = "immediate"
+)
+
+var (
+	ErrPreferFreshRequiresName       = errors.New("prefer fresh requires --instance-name or --tag")
+	ErrPreferFreshWithSSH            = errors.New("prefer fresh cannot be combined with --ssh")
+	ErrInvalidPreferFreshInterval    = errors.New("invalid prefer fresh interval")
+	ErrInvalidPreferFreshPolicy      = errors.New("invalid prefer fresh policy")
+	ErrPreferFreshIdleRequiresNative = errors.New("prefer fresh policy idle requires --forwarder native")
+)
+
+func (c Config) preferFreshPolicy() string {
+	if policy := strings.ToLower(strings.TrimSpace(c.PreferFreshPolicy)); policy != "" {
+		return policy
+	}
+	return freshPolicyIdle
+}
+
+func (c Config) validatePreferFresh() error {
+	if c.PreferFreshInterval < 0 {
+		return ErrInvalidPreferFreshInterval
+	}
+	policy := c.preferFreshPolicy()
+	if policy != freshPolicyIdle && policy != freshPolicyImmediate {
+		return fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidPreferFreshPolicy, c.PreferFreshPolicy, freshPolicyIdle, freshPolicyImmediate)
+	}
+	if !c.PreferFresh {
+		return nil
+	}
+	if c.instanceFilter().empty() || strings.TrimSpace(c.InstanceID) != "" {
+		return ErrPreferFreshRequiresName
+	}
+	if c.SSH {
+		return ErrPreferFreshWithSSH
+	}
+	// Only the native forwarder sees client connections.
+	if policy == freshPolicyIdle && !c.nativeForwarder() {
+		return fmt.Errorf("%w (or use --prefer-fresh-policy %s)", ErrPreferFreshIdleRequiresNative, freshPolicyImmediate)
+	}
+	return nil
+}
+
+// freshInstanceFinder looks for a running, SSM-online instance with the
+// Name tag and other tags filter that was launched strictly after the
+// current one, in the same availability zone when --az is set.
+type freshInstanceFinder struct {
+	ec2Client   ec2DescribeInstancesAPI
+	ssmClient   ssmDescribeInstanceInformationAPI
+	filter      instanceFilter
+	requireTags []string
+}
+
+func (f freshInstanceFinder) find(ctx context.Context, currentID string) (string, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: append(f.filter.ec2Filters(),
+			types.Filter{Name: aws.String("instance-state-name"), Values: []string{string(types.InstanceStateNameRunning)}},
+		),
+	}
+	var current time.Time
+	var candidates []types.Instance
+	paginator := ec2.NewDescribeInstancesPaginator(f.ec2Client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, reservation := range output.Reservations {
+			for _, instance := range reservation.Instances {
+				if aws.ToString(instance.InstanceId) == currentID {
+					current = aws.ToTime(instance.LaunchTime)
+					continue
+				}
+				candidates = append(candidates, instance)
+			}
+		}
+	}
+
+	var freshest types.Instance
+	var freshestLaunch time.Time
+	for _, instance := range candidates {
+		launched := aws.ToTime(instance.LaunchTime)
+		if aws.ToString(instance.InstanceId) == "" || !launched.After(current) || !launched.After(freshestLaunch) {
+			continue
+		}
+		if !hasRequiredTags(instance.Tags, f.requireTags) {
+			continue
+		}
+		info, err := managedInstanceInformation(ctx, f.ssmClient, aws.ToString(instance.InstanceId))
+		if err != nil {
+			return "", err
+		}
+		if info == nil || info.PingStatus != ssmtypes.PingStatusOnline {
+			continue
+		}
+		freshest, freshestLaunch = instance, launched
+	}
+	return aws.ToString(freshest.InstanceId), nil
+}
+
+func hasRequiredTags(tags []types.Tag, required []string) bool {
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		values[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for _, key := range required {
+		if strings.TrimSpace(values[key]) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// preferFresh keeps a tunnel on the newest healthy instance.
+type preferFresh struct {
+	interval time.Duration
+	// idle reports whether no client connection is open; nil migrates as
+	// soon as a fresher instance is found.
+	idle     func() bool
+	idlePoll time.Duration
+	find     func(ctx context.Context, currentID string) (string, error)
+	resolved func(instanceID string)
+}
+
+// run runs the forwards against instanceID and, whenever a fresher
+// instance shows up, stops them and starts them again against it.
+func (p preferFresh) run(ctx context.Context, instanceID string, forward func(ctx context.Context, instanceID string) error) error {
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		next := make(chan string, 1)
+		watchDone := make(chan struct{})
+		go func() {
+			defer close(watchDone)
+			if id := p.watch(runCtx, instanceID); id != "" {
+				next <- id
+				cancel()
+			}
+		}()
+		err := forward(runCtx, instanceID)
+		cancel()
+		<-watchDone
+		if ctx.Err() != nil {
+			return err
+		}
+		select {
+		case id := <-next:
+			log.Printf("Migrating tunnel from %s to fresher instance %s", instanceID, id)
+			instanceID = id
+			if p.resolved != nil {
+				p.resolved(id)
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// watch checks for a fresher instance every interval and returns it once
+// the migration policy allows. It returns "" when ctx is done.
+func (p preferFresh) watch(ctx context.Context, currentID string) string {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ticker.C:
+		}
+		id, err := p.find(ctx, currentID)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to check for a fresher instance: %v", err)
+			}
+			continue
+		}
+		if id == "" {
+			continue
+		}
+		if p.idle == nil {
+			return id
+		}
+		log.Printf("Found fresher instance %s, migrating once no connections are open", id)
+		idleTicker := time.NewTicker(p.idlePoll)
+		for !p.idle() {
+			select {
+			case <-ctx.Done():
+				idleTicker.Stop()
+				return ""
+			case <-idleTicker.C:
+			}
+		}
+		idleTicker.Stop()
+		return id
+	}
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakePingClient reports the ping status of each instance in status.
+type fakePingClient struct {
+	status map[string]ssmtypes.PingStatus
+}
+
+func (f fakePingClient) DescribeInstanceInformation(_ context.Context, input *ssm.DescribeInstanceInformationInput, _ ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	id := input.Filters[0].Values[0]
+	status, ok := f.status[id]
+	if !ok {
+		return &ssm.DescribeInstanceInformationOutput{}, nil
+	}
+	return &ssm.DescribeInstanceInformationOutput{
+		InstanceInformationList: []ssmtypes.InstanceInformation{{InstanceId: aws.String(id), PingStatus: status}},
+	}, nil
+}
+
+func TestValidatePreferFresh(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "off", cfg: Config{InstanceID: "i-1"}},
+		{name: "idle with native forwarder", cfg: Config{PreferFresh: true, InstanceName: "bastion", Forwarder: forwarderNative}},
+		{name: "immediate with plugin forwarder", cfg: Config{PreferFresh: true, InstanceName: "bastion", PreferFreshPolicy: "Immediate"}},
+		{name: "idle with plugin forwarder", cfg: Config{PreferFresh: true, InstanceName: "bastion"}, wantErr: ErrPreferFreshIdleRequiresNative},
+		{name: "instance id", cfg: Config{PreferFresh: true, InstanceID: "i-1", Forwarder: forwarderNative}, wantErr: ErrPreferFreshRequiresName},
+		{name: "ssh", cfg: Config{PreferFresh: true, InstanceName: "bastion", SSH: true, PreferFreshPolicy: freshPolicyImmediate}, wantErr: ErrPreferFreshWithSSH},
+		{name: "unknown policy", cfg: Config{PreferFreshPolicy: "nightly"}, wantErr: ErrInvalidPreferFreshPolicy},
+		{name: "negative interval", cfg: Config{PreferFreshInterval: -time.Second}, wantErr: ErrInvalidPreferFreshInterval},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validatePreferFresh(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFreshInstanceFinder(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	instance := func(id string, launched time.Time, tags ...string) ec2types.Instance {
+		instance := ec2types.Instance{InstanceId: aws.String(id), LaunchTime: aws.Time(launched)}
+		for _, key := range tags {
+			instance.Tags = append(instance.Tags, ec2types.Tag{Key: aws.String(key), Value: aws.String("x")})
+		}
+		return instance
+	}
+	output := &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+		instance("i-current", base, "Owner"),
+		instance("i-older", base.Add(-time.Hour), "Owner"),
+		instance("i-newer", base.Add(time.Hour), "Owner"),
+		instance("i-newest-offline", base.Add(3*time.Hour), "Owner"),
+		instance("i-newest-untagged", base.Add(2*time.Hour)),
+	}}}}
+	ping := fakePingClient{status: map[string]ssmtypes.PingStatus{
+		"i-older":           ssmtypes.PingStatusOnline,
+		"i-newer":           ssmtypes.PingStatusOnline,
+		"i-newest-offline":  ssmtypes.PingStatusConnectionLost,
+		"i-newest-untagged": ssmtypes.PingStatusOnline,
+	}}
+
+	tests := []struct {
+		name        string
+		currentID   string
+		requireTags []string
+		want        string
+	}{
+		{name: "newer healthy instance", currentID: "i-current", requireTags: []string{"Owner"}, want: "i-newer"},
+		{name: "required tags not needed", currentID: "i-current", want: "i-newest-untagged"},
+		{name: "already on the freshest healthy instance", currentID: "i-newest-untagged", want: ""},
+		{name: "current instance gone", currentID: "i-terminated", requireTags: []string{"Owner"}, want: "i-newer"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeEC2Client{output: output}
+			finder := freshInstanceFinder{ec2Client: client, ssmClient: ping, filter: instanceFilter{Name: "bastion"}, requireTags: tt.requireTags}
+			got, err := finder.find(context.Background(), tt.currentID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if !slices.Contains(client.gotInput.Filters[1].Values, "running") {
+				t.Errorf("expected a running state filter, got %+v", client.gotInput.Filters)
+			}
+		})
+	}
+}
+
+func TestPreferFreshMigrates(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var started []string
+	var resolved []string
+	idle := make(chan bool, 1)
+	idle <- false
+	fresh := preferFresh{
+		interval: time.Millisecond,
+		idlePoll: time.Millisecond,
+		idle: func() bool {
+			select {
+			case v := <-idle:
+				return v
+			default:
+				return true
+			}
+		},
+		find: func(_ context.Context, currentID string) (string, error) {
+			if currentID == "i-old" {
+				return "i-new", nil
+			}
+			return "", nil
+		},
+		resolved: func(id string) { resolved = append(resolved, id) },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := fresh.run(ctx, "i-old", func(ctx context.Context, id string) error {
+		mu.Lock()
+		started = append(started, id)
+		mu.Unlock()
+		if id == "i-new" {
+			return errors.New("session ended")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if err == nil || err.Error() != "session ended" {
+		t.Fatalf("expected the last forward's error, got %v", err)
+	}
+	if !slices.Equal(started, []string{"i-old", "i-new"}) {
+		t.Errorf("expected forwards to i-old then i-new, got %v", started)
+	}
+	if !slices.Equal(resolved, []string{"i-new"}) {
+		t.Errorf("expected i-new to be resolved, got %v", resolved)
+	}
+}
+
+func TestPreferFreshStopsWithContext(t *testing.T) {
+	t.Parallel()
+
+	fresh := preferFresh{
+		interval: time.Hour,
+		find: func(context.Context, string) (string, error) {
+			return "i-new", nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := fresh.run(ctx, "i-old", func(ctx context.Context, id string) error {
+		cancel()
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// postDisconnectTimeout bounds the post-disconnect command so a hung
+// teardown cannot keep the tool from exiting.
+const postDisconnectTimeout = 30 * time.Second
+
+const (
+	exitReasonEnv     = "AWS_GO_FORWARD_EXIT_REASON"
+	exitErrorEnv      = "AWS_GO_FORWARD_ERROR"
+	exitInstanceEnv   = "AWS_GO_FORWARD_INSTANCE_ID"
+	exitLocalPortEnv  = "AWS_GO_FORWARD_LOCAL_PORT"
+	exitReasonError   = "error"
+	exitReasonStopped = "shutdown"
+	exitReasonEnded   = "session_ended"
+)
+
+var ErrPostDisconnectTimeout = errors.New("post-disconnect command timed out")
+
+// exitReason tells the post-disconnect command why the session ended: it
+// failed, the tool was asked to stop, or the session closed on its own.
+func exitReason(ctx context.Context, err error) string {
+	switch {
+	case err != nil:
+		return exitReasonError
+	case ctx.Err() != nil:
+		return exitReasonStopped
+	default:
+		return exitReasonEnded
+	}
+}
+
+func postDisconnectEnv(reason string, err error, instanceID string, localPort int) []string {
+	env := []string{exitReasonEnv + "=" + reason, exitInstanceEnv + "=" + instanceID}
+	if localPort != 0 {
+		env = append(env, exitLocalPortEnv+"="+strconv.Itoa(localPort))
+	}
+	if err != nil {
+		env = append(env, exitErrorEnv+"="+err.Error())
+	}
+	return env
+}
+
+func shellCommand(ctx context.Context, goos, command string) *exec.Cmd {
+	if goos == "windows" {
+		return exec.CommandContext(ctx, "cmd.exe", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runPostDisconnect runs the --post-disconnect command through the shell
+// with the exit reason in its environment.
+func runPostDisconnect(command string, env []string, out io.Writer, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, runtime.GOOS, command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	// Do not wait on children of the shell that keep its output open.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w after %s", ErrPostDisconnectTimeout, timeout)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitReason(t *testing.T) {
+	t.Parallel()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{name: "session closed", ctx: context.Background(), want: exitReasonEnded},
+		{name: "interrupted", ctx: cancelled, want: exitReasonStopped},
+		{name: "failed", ctx: cancelled, err: errors.New("session plugin failed"), want: exitReasonError},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := exitReason(tt.ctx, tt.err); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPostDisconnectEnv(t *testing.T) {
+	t.Parallel()
+
+	got := postDisconnectEnv(exitReasonError, errors.New("keep-alive failed"), "i-0123456789abcdef0", 5432)
+	want := []string{
+		exitReasonEnv + "=error",
+		exitInstanceEnv + "=i-0123456789abcdef0",
+		exitLocalPortEnv + "=5432",
+		exitErrorEnv + "=keep-alive failed",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	t.Parallel()
+
+	if got := shellCommand(context.Background(), "windows", "vpn down").Args; !slices.Equal(got, []string{"cmd.exe", "/C", "vpn down"}) {
+		t.Fatalf("unexpected windows command %q", got)
+	}
+	if got := shellCommand(context.Background(), "linux", "vpn down").Args; !slices.Equal(got, []string{"sh", "-c", "vpn down"}) {
+		t.Fatalf("unexpected unix command %q", got)
+	}
+}
+
+func TestRunPostDisconnect(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	var out bytes.Buffer
+	env := postDisconnectEnv(exitReasonStopped, nil, "i-0123456789abcdef0", 0)
+	if err := runPostDisconnect(`echo "$`+exitReasonEnv+`"`, env, &out, time.Second); err != nil {
+		t.Fatalf("runPostDisconnect() unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != exitReasonStopped {
+		t.Fatalf("expected %q, got %q", exitReasonStopped, got)
+	}
+
+	if err := runPostDisconnect("exit 3", nil, &out, time.Second); err == nil {
+		t.Fatal("expected a failing command to be reported")
+	}
+	if err := runPostDisconnect("exec sleep 5", nil, &out, 50*time.Millisecond); !errors.Is(err, ErrPostDisconnectTimeout) {
+		t.Fatalf("expected %v, got %v", ErrPostDisconnectTimeout, err)
+	}
+}
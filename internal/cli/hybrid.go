@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// managedInstanceIDPattern matches the IDs SSM gives servers and VMs
+// registered through a hybrid activation. They are valid session targets
+// but are unknown to EC2.
+var managedInstanceIDPattern = regexp.MustCompile(`^mi-[0-9a-f]{17}$`)
+
+var (
+	ErrManagedInstanceNotRegistered = errors.New("managed instance is not registered with ssm")
+	ErrManagedInstanceOffline       = errors.New("managed instance is not online")
+	ErrManagedInstanceEC2Only       = errors.New("option needs an ec2 instance")
+)
+
+func isManagedInstanceID(instanceID string) bool {
+	return managedInstanceIDPattern.MatchString(strings.TrimSpace(instanceID))
+}
+
+// isTargetID reports whether id is an EC2 instance ID or a hybrid managed
+// instance ID.
+func isTargetID(id string) bool {
+	return instanceIDPattern.MatchString(id) || managedInstanceIDPattern.MatchString(id)
+}
+
+func (c Config) validateManagedInstance() error {
+	if !isManagedInstanceID(c.InstanceID) {
+		return nil
+	}
+	if len(c.RequireTags) > 0 {
+		return fmt.Errorf("%w: --require-tag reads EC2 tags", ErrManagedInstanceEC2Only)
+	}
+	if c.ForwardTaggedPorts {
+		return fmt.Errorf("%w: --forward-tagged-ports reads EC2 tags", ErrManagedInstanceEC2Only)
+	}
+	return nil
+}
+
+func managedInstanceInformation(ctx context.Context, client ssmDescribeInstanceInformationAPI, instanceID string) (*ssmtypes.InstanceInformation, error) {
+	output, err := client.DescribeInstanceInformation(ctx, &ssm.DescribeInstanceInformationInput{
+		Filters: []ssmtypes.InstanceInformationStringFilter{{Key: aws.String("InstanceIds"), Values: []string{instanceID}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance information: %w", err)
+	}
+	for i := range output.InstanceInformationList {
+		if aws.ToString(output.InstanceInformationList[i].InstanceId) == instanceID {
+			return &output.InstanceInformationList[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getManagedInstanceID checks that a hybrid managed instance is registered
+// and its agent is online. Session Manager only reaches managed instances
+// in the advanced-instances tier; SSM rejects the session otherwise.
+func getManagedInstanceID(ctx context.Context, client ssmDescribeInstanceInformationAPI, instanceID string) (string, error) {
+	instanceID = strings.TrimSpace(instanceID)
+	info, err := managedInstanceInformation(ctx, client, instanceID)
+	if err != nil {
+		return "", err
+	}
+	if info == nil {
+		return "", fmt.Errorf("%w: %q", ErrManagedInstanceNotRegistered, instanceID)
+	}
+	if info.PingStatus != ssmtypes.PingStatusOnline {
+		return "", fmt.Errorf("%w: %q is %s", ErrManagedInstanceOffline, instanceID, info.PingStatus)
+	}
+	return instanceID, nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const testManagedInstanceID = "mi-0123456789abcdef0"
+
+func TestIsTargetID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "i-0123456789abcdef0", want: true},
+		{id: testManagedInstanceID, want: true},
+		{id: "mi-0123", want: false},
+		{id: "bastion", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.id, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isTargetID(tt.id); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetManagedInstanceID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		client  *fakeInstanceInformationClient
+		wantErr error
+	}{
+		{
+			name: "online",
+			client: &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{
+				InstanceInformationList: []ssmtypes.InstanceInformation{{InstanceId: aws.String(testManagedInstanceID), PingStatus: ssmtypes.PingStatusOnline}},
+			}},
+		},
+		{
+			name: "connection lost",
+			client: &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{
+				InstanceInformationList: []ssmtypes.InstanceInformation{{InstanceId: aws.String(testManagedInstanceID), PingStatus: ssmtypes.PingStatusConnectionLost}},
+			}},
+			wantErr: ErrManagedInstanceOffline,
+		},
+		{
+			name:    "not registered",
+			client:  &fakeInstanceInformationClient{output: &ssm.DescribeInstanceInformationOutput{}},
+			wantErr: ErrManagedInstanceNotRegistered,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := getManagedInstanceID(context.Background(), tt.client, " "+testManagedInstanceID+" ")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && got != testManagedInstanceID {
+				t.Errorf("expected %q, got %q", testManagedInstanceID, got)
+			}
+		})
+	}
+}
+
+func TestValidateManagedInstance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "ec2 instance with tags", cfg: Config{InstanceID: "i-0123456789abcdef0", RequireTags: []string{"Owner"}}},
+		{name: "managed instance", cfg: Config{InstanceID: testManagedInstanceID}},
+		{name: "managed instance with required tags", cfg: Config{InstanceID: testManagedInstanceID, RequireTags: []string{"Owner"}}, wantErr: ErrManagedInstanceEC2Only},
+		{name: "managed instance with tagged ports", cfg: Config{InstanceID: testManagedInstanceID, ForwardTaggedPorts: true}, wantErr: ErrManagedInstanceEC2Only},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateManagedInstance(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"gopkg.in/ini.v1"
+)
+
+// instanceTagsSection holds tag filters in the config file, one tag per
+// key.
+const instanceTagsSection = "tags"
+
+var ErrInvalidInstanceTag = errors.New("invalid instance tag")
+
+// parseInstanceTag parses a Key=Value tag filter. The value may use the
+// EC2 filter wildcards * and ?.
+func parseInstanceTag(value string) (string, string, error) {
+	key, val, ok := strings.Cut(value, "=")
+	key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+	if !ok || key == "" || val == "" {
+		return "", "", fmt.Errorf("%w: %q (want Key=Value)", ErrInvalidInstanceTag, value)
+	}
+	return key, val, nil
+}
+
+func parseInstanceTagsSection(section *ini.Section) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, key := range section.Keys() {
+		name, value := strings.TrimSpace(key.Name()), strings.TrimSpace(key.Value())
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s has no value", ErrInvalidInstanceTag, name)
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+// instanceTagsFlag collects repeated --tag Key=Value flags.
+type instanceTagsFlag struct {
+	tags *map[string]string
+}
+
+func (f instanceTagsFlag) String() string {
+	if f.tags == nil {
+		return ""
+	}
+	return formatInstanceTags(*f.tags)
+}
+
+func (f instanceTagsFlag) Set(value string) error {
+	key, val, err := parseInstanceTag(value)
+	if err != nil {
+		return err
+	}
+	if *f.tags == nil {
+		*f.tags = make(map[string]string)
+	}
+	(*f.tags)[key] = val
+	return nil
+}
+
+func formatInstanceTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// instanceFilter says which instances a lookup considers: those with the
+// Name tag and all other tags, in the availability zone if one is set.
+// Region only names where the lookup ran, in messages.
+type instanceFilter struct {
+	Name             string
+	Tags             map[string]string
+	AvailabilityZone string
+	Region           string
+}
+
+func (c Config) instanceFilter() instanceFilter {
+	return instanceFilter{Name: strings.TrimSpace(c.InstanceName), Tags: c.InstanceTags, AvailabilityZone: c.availabilityZone(), Region: c.Region}
+}
+
+func (f instanceFilter) empty() bool {
+	return f.Name == "" && len(f.Tags) == 0
+}
+
+// ec2Filters ANDs the Name tag, the other tags and the availability zone.
+func (f instanceFilter) ec2Filters() []types.Filter {
+	var filters []types.Filter
+	if f.Name != "" {
+		filters = append(filters, types.Filter{Name: aws.String("tag:Name"), Values: []string{f.Name}})
+	}
+	for _, key := range slices.Sorted(maps.Keys(f.Tags)) {
+		filters = append(filters, types.Filter{Name: aws.String("tag:" + key), Values: []string{f.Tags[key]}})
+	}
+	if f.AvailabilityZone != "" {
+		filters = append(filters, availabilityZoneFilter(f.AvailabilityZone))
+	}
+	return filters
+}
+
+// String names the selection in messages, for example
+// instance name "bastion" and tags Environment=prod.
+func (f instanceFilter) String() string {
+	var parts []string
+	if f.Name != "" {
+		parts = append(parts, fmt.Sprintf("instance name %q", f.Name))
+	}
+	if len(f.Tags) > 0 {
+		parts = append(parts, "tags "+formatInstanceTags(f.Tags))
+	}
+	described := strings.Join(parts, " and ")
+	if f.AvailabilityZone != "" {
+		described += " in " + f.AvailabilityZone
+	}
+	return described
+}
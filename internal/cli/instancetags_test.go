@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"gopkg.in/ini.v1"
+)
+
+func TestParseInstanceTag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		wantKey string
+		wantVal string
+		wantErr error
+	}{
+		{value: "Environment=prod", wantKey: "Environment", wantVal: "prod"},
+		{value: " Role = bastion-* ", wantKey: "Role", wantVal: "bastion-*"},
+		{value: "Expr=a=b", wantKey: "Expr", wantVal: "a=b"},
+		{value: "Environment", wantErr: ErrInvalidInstanceTag},
+		{value: "=prod", wantErr: ErrInvalidInstanceTag},
+		{value: "Environment=", wantErr: ErrInvalidInstanceTag},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			key, val, err := parseInstanceTag(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if key != tt.wantKey || val != tt.wantVal {
+				t.Errorf("expected %s=%s, got %s=%s", tt.wantKey, tt.wantVal, key, val)
+			}
+		})
+	}
+}
+
+func TestInstanceTagsFromINI(t *testing.T) {
+	t.Parallel()
+
+	iniCfg, err := ini.Load([]byte("[settings]\ninstance_name = bastion\n[tags]\nEnvironment = prod\nTeam = payments\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg, err := configFromINI(iniCfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := formatInstanceTags(cfg.InstanceTags), "Environment=prod, Team=payments"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	var cli Config
+	if err := (instanceTagsFlag{&cli.InstanceTags}).Set("Environment=staging"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	merged := mergeConfigWithCLIOverrides(*cfg, cli, map[string]bool{"tag": true})
+	if got, want := formatInstanceTags(merged.InstanceTags), "Environment=staging"; got != want {
+		t.Errorf("expected the command line to replace the [tags] section, got %q", got)
+	}
+}
+
+func TestResolveInstanceIDByTags(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeEC2Client{output: &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{
+		Instances: []ec2types.Instance{{InstanceId: aws.String("i-1"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}}},
+	}}}}
+	cfg := Config{InstanceTags: map[string]string{"Team": "payments", "Environment": "prod"}, Select: selectLatest}
+	got, err := resolveInstanceID(context.Background(), client, cfg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "i-1" {
+		t.Errorf("expected %q, got %q", "i-1", got)
+	}
+
+	var names []string
+	for _, filter := range client.gotInput.Filters {
+		names = append(names, aws.ToString(filter.Name))
+	}
+	if slices.Contains(names, "tag:Name") {
+		t.Errorf("expected no Name tag filter, got %v", names)
+	}
+	if !slices.Contains(names, "tag:Environment") || !slices.Contains(names, "tag:Team") {
+		t.Errorf("expected a filter for each tag, got %v", names)
+	}
+}
+
+func TestInstanceFilterEC2Filters(t *testing.T) {
+	t.Parallel()
+
+	filter := instanceFilter{Name: "bastion", Tags: map[string]string{"Team": "payments", "Environment": "prod"}, AvailabilityZone: "us-east-1a"}
+	var got []string
+	for _, f := range filter.ec2Filters() {
+		got = append(got, aws.ToString(f.Name)+"="+f.Values[0])
+	}
+	want := []string{"tag:Name=bastion", "tag:Environment=prod", "tag:Team=payments", "availability-zone=us-east-1a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got, want := filter.String(), `instance name "bastion" and tags Environment=prod, Team=payments in us-east-1a`; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestConfigValidateInstanceTagsOnly(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", Region: "us-east-1", InstanceTags: map[string]string{"Environment": "prod"}, RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 5432}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected tags alone to select an instance, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var (
+	ErrInvalidInterfaceIndex = errors.New("invalid interface index")
+	ErrInterfaceNotFound     = errors.New("network interface not found")
+)
+
+// interfaceChoice says which network interface's private IP stands for an
+// instance that has several.
+type interfaceChoice struct {
+	// Index is the device index; 0 is the primary interface.
+	Index int
+	// Subnet, when an interface is attached in it, wins over Index.
+	Subnet string
+}
+
+func (c Config) interfaceChoice() interfaceChoice {
+	return interfaceChoice{Index: c.InterfaceIndex, Subnet: strings.TrimSpace(c.PreferSubnet)}
+}
+
+func (c Config) validateInterfaceChoice() error {
+	if c.InterfaceIndex < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidInterfaceIndex, c.InterfaceIndex)
+	}
+	return nil
+}
+
+// selectedInterface is the network interface whose private IP was picked.
+type selectedInterface struct {
+	ID          string
+	DeviceIndex int
+	Subnet      string
+	PrivateIP   string
+}
+
+// selectInterface picks the interface in choice.Subnet when there is one,
+// otherwise the one at choice.Index. The lowest device index wins when
+// several interfaces share the subnet.
+func selectInterface(instance types.Instance, choice interfaceChoice) (selectedInterface, error) {
+	var byIndex, bySubnet *selectedInterface
+	for _, eni := range instance.NetworkInterfaces {
+		if eni.Attachment == nil {
+			continue
+		}
+		candidate := selectedInterface{
+			ID:          aws.ToString(eni.NetworkInterfaceId),
+			DeviceIndex: int(aws.ToInt32(eni.Attachment.DeviceIndex)),
+			Subnet:      aws.ToString(eni.SubnetId),
+			PrivateIP:   aws.ToString(eni.PrivateIpAddress),
+		}
+		if candidate.DeviceIndex == choice.Index {
+			byIndex = &candidate
+		}
+		if choice.Subnet != "" && candidate.Subnet == choice.Subnet && (bySubnet == nil || candidate.DeviceIndex < bySubnet.DeviceIndex) {
+			bySubnet = &candidate
+		}
+	}
+	switch {
+	case bySubnet != nil:
+		return *bySubnet, nil
+	case byIndex != nil:
+		return *byIndex, nil
+	case len(instance.NetworkInterfaces) == 0 && choice.Index == 0:
+		// Without interface details the top-level address is the primary's.
+		return selectedInterface{Subnet: aws.ToString(instance.SubnetId), PrivateIP: aws.ToString(instance.PrivateIpAddress)}, nil
+	}
+	return selectedInterface{}, fmt.Errorf("%w: no interface at device index %d on %s", ErrInterfaceNotFound, choice.Index, aws.ToString(instance.InstanceId))
+}
+
+// instancePrivateIP returns the private IP of the chosen interface and logs
+// the pick when the instance has more than one interface to choose from.
+func instancePrivateIP(instance types.Instance, choice interfaceChoice) (string, error) {
+	selected, err := selectInterface(instance, choice)
+	if err != nil {
+		return "", err
+	}
+	if len(instance.NetworkInterfaces) > 1 {
+		log.Printf("Using private IP %s of %s (device index %d, subnet %s)", selected.PrivateIP, selected.ID, selected.DeviceIndex, selected.Subnet)
+	}
+	return selected.PrivateIP, nil
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestSelectInterface(t *testing.T) {
+	t.Parallel()
+
+	eni := func(id string, index int32, subnet, ip string) types.InstanceNetworkInterface {
+		return types.InstanceNetworkInterface{
+			NetworkInterfaceId: aws.String(id),
+			Attachment:         &types.InstanceNetworkInterfaceAttachment{DeviceIndex: aws.Int32(index)},
+			SubnetId:           aws.String(subnet),
+			PrivateIpAddress:   aws.String(ip),
+		}
+	}
+	multi := types.Instance{
+		InstanceId:       aws.String("i-1"),
+		PrivateIpAddress: aws.String("10.0.0.5"),
+		NetworkInterfaces: []types.InstanceNetworkInterface{
+			eni("eni-data", 2, "subnet-data", "10.2.0.9"),
+			eni("eni-primary", 0, "subnet-app", "10.0.0.5"),
+			eni("eni-mgmt", 1, "subnet-mgmt", "10.1.0.7"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		instance types.Instance
+		choice   interfaceChoice
+		want     string
+		wantErr  error
+	}{
+		{name: "primary by default", instance: multi, want: "10.0.0.5"},
+		{name: "device index", instance: multi, choice: interfaceChoice{Index: 1}, want: "10.1.0.7"},
+		{name: "preferred subnet", instance: multi, choice: interfaceChoice{Index: 1, Subnet: "subnet-data"}, want: "10.2.0.9"},
+		{name: "preferred subnet missing falls back to index", instance: multi, choice: interfaceChoice{Subnet: "subnet-other"}, want: "10.0.0.5"},
+		{name: "index not attached", instance: multi, choice: interfaceChoice{Index: 3}, wantErr: ErrInterfaceNotFound},
+		{name: "no interface details", instance: types.Instance{PrivateIpAddress: aws.String("10.0.0.5")}, want: "10.0.0.5"},
+		{name: "no interface details with index", instance: types.Instance{PrivateIpAddress: aws.String("10.0.0.5")}, choice: interfaceChoice{Index: 1}, wantErr: ErrInterfaceNotFound},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := instancePrivateIP(tt.instance, tt.choice)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigValidateInterfaceChoice(t *testing.T) {
+	t.Parallel()
+
+	if err := (Config{InterfaceIndex: -1}).validateInterfaceChoice(); !errors.Is(err, ErrInvalidInterfaceIndex) {
+		t.Errorf("expected %v, got %v", ErrInvalidInterfaceIndex, err)
+	}
+	if err := (Config{InterfaceIndex: 1, PreferSubnet: "subnet-1"}).validateInterfaceChoice(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	keepAliveInterval     = 30 * time.Second
+	keepAliveProbeTimeout = 5 * time.Second
+)
+
+var (
+	ErrUnknownKeepAliveStrategy     = errors.New("unknown keep-alive strategy")
+	ErrUnsupportedKeepAliveStrategy = errors.New("unsupported keep-alive strategy")
+	ErrUnexpectedProbeResponse      = errors.New("unexpected keep-alive probe response")
+	ErrRoundTripUnsupported         = errors.New("keep-alive round trip requires the tcp-probe or a protocol strategy")
+	ErrTunnelClosedProbe            = errors.New("tunnel closed the keep-alive probe connection")
+	ErrInvalidKeepAliveInterval     = errors.New("invalid keep-alive interval")
+)
+
+// keepAliveStrategy probes the local end of the tunnel. Implementations
+// must return once ctx is done.
+type keepAliveStrategy interface {
+	Name() string
+	Probe(ctx context.Context, addr string) error
+}
+
+func parseKeepAliveStrategy(value string) (keepAliveStrategy, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	switch name {
+	case "", "tcp-connect":
+		// The default writes nothing, so no server sees a stray byte.
+		return tcpConnectKeepAlive{}, nil
+	case "tcp-probe":
+		return tcpProbeKeepAlive{}, nil
+	case "none":
+		return noneKeepAlive{}, nil
+	case "ws-ping":
+		// The builtin plugin owns the data channel websocket and does not
+		// expose a way to send pings on it.
+		return nil, fmt.Errorf("%w: %q is not available with the builtin session plugin", ErrUnsupportedKeepAliveStrategy, name)
+	}
+	if protocol, ok := strings.CutPrefix(name, "protocol:"); ok {
+		probe, found := protocolProbes[protocol]
+		if !found {
+			return nil, fmt.Errorf("%w: no protocol probe named %q", ErrUnknownKeepAliveStrategy, protocol)
+		}
+		return protocolKeepAlive{protocol: protocol, probe: probe}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKeepAliveStrategy, value)
+}
+
+// keepAliveEnabled reports whether the local port is probed at all. Probes
+// are opt-in: each one opens a real connection to the remote service, and
+// the session plugin already pings its SSM channel on its own. Choosing a
+// strategy or a round trip opts in as well.
+func (c Config) keepAliveEnabled() bool {
+	return c.KeepAlive || strings.TrimSpace(c.KeepAliveStrategy) != "" || c.KeepAliveRoundTrip
+}
+
+func (c Config) keepAliveInterval() time.Duration {
+	if c.KeepAliveInterval > 0 {
+		return c.KeepAliveInterval
+	}
+	return keepAliveInterval
+}
+
+func (c Config) validateKeepAliveInterval() error {
+	if c.KeepAliveInterval < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidKeepAliveInterval, c.KeepAliveInterval)
+	}
+	return nil
+}
+
+// roundTripStrategyName is the configured strategy, where a round trip
+// without one means the newline probe: the far end needs something to
+// answer.
+func (c Config) roundTripStrategyName() string {
+	if c.KeepAliveRoundTrip && strings.TrimSpace(c.KeepAliveStrategy) == "" {
+		return "tcp-probe"
+	}
+	return c.KeepAliveStrategy
+}
+
+// keepAliveStrategy returns the configured strategy. With KeepAliveRoundTrip
+// the tcp-probe waits for the far end to answer; protocol probes already do.
+func (c Config) keepAliveStrategy() (keepAliveStrategy, error) {
+	strategy, err := parseKeepAliveStrategy(c.roundTripStrategyName())
+	if err != nil || !c.KeepAliveRoundTrip {
+		return strategy, err
+	}
+	switch strategy.(type) {
+	case tcpProbeKeepAlive:
+		return tcpProbeKeepAlive{roundTrip: true}, nil
+	case protocolKeepAlive:
+		return strategy, nil
+	default:
+		return nil, fmt.Errorf("%w, not %q", ErrRoundTripUnsupported, strategy.Name())
+	}
+}
+
+// tcpProbeKeepAlive sends a newline. The local listener accepts even when
+// the plugin's upstream is gone, so with roundTrip the probe also waits to
+// see whether the plugin then closes or resets the connection. A reply, or
+// silence until the wait is over, counts as healthy: many servers say
+// nothing to a lone newline.
+type tcpProbeKeepAlive struct {
+	roundTrip bool
+	// wait is how long a round trip waits; zero means
+	// keepAliveProbeTimeout.
+	wait time.Duration
+}
+
+func (p tcpProbeKeepAlive) Name() string {
+	if p.roundTrip {
+		return "tcp-probe (round trip)"
+	}
+	return "tcp-probe"
+}
+
+func (p tcpProbeKeepAlive) Probe(ctx context.Context, addr string) error {
+	conn, err := dialKeepAlive(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("\n")) // Minimal keep-alive packet
+	if err != nil || !p.roundTrip {
+		return err
+	}
+
+	wait := p.wait
+	if wait == 0 {
+		wait = keepAliveProbeTimeout
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+		return err
+	}
+	n, err := conn.Read(make([]byte, 1))
+	if n > 0 {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrTunnelClosedProbe, err)
+}
+
+type tcpConnectKeepAlive struct{}
+
+func (tcpConnectKeepAlive) Name() string { return "tcp-connect" }
+
+func (tcpConnectKeepAlive) Probe(ctx context.Context, addr string) error {
+	conn, err := dialKeepAlive(ctx, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+type noneKeepAlive struct{}
+
+func (noneKeepAlive) Name() string { return "none" }
+
+func (noneKeepAlive) Probe(context.Context, string) error { return nil }
+
+type protocolKeepAlive struct {
+	protocol string
+	probe    func(conn net.Conn) error
+}
+
+func (p protocolKeepAlive) Name() string { return "protocol:" + p.protocol }
+
+func (p protocolKeepAlive) Probe(ctx context.Context, addr string) error {
+	conn, err := dialKeepAlive(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(keepAliveProbeTimeout)); err != nil {
+		return err
+	}
+	return p.probe(conn)
+}
+
+// protocolProbes speak just enough of each protocol to get a well-formed
+// reply from the server without leaving an error in its logs. MySQL has
+// none: any connection that ends before authentication counts toward the
+// server's max_connect_errors and eventually blocks the host.
+var protocolProbes = map[string]func(conn net.Conn) error{
+	"http": func(conn net.Conn) error {
+		if _, err := io.WriteString(conn, "HEAD / HTTP/1.0\r\n\r\n"); err != nil {
+			return err
+		}
+		return expectPrefix(conn, "HTTP/")
+	},
+	"redis": func(conn net.Conn) error {
+		if _, err := io.WriteString(conn, "PING\r\n"); err != nil {
+			return err
+		}
+		return expectPrefix(conn, "+PONG")
+	},
+	"postgres": func(conn net.Conn) error {
+		// SSLRequest: length 8, request code 80877103; the server answers S or N.
+		if _, err := conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+			return err
+		}
+		reply := make([]byte, 1)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[0] != 'S' && reply[0] != 'N' {
+			return fmt.Errorf("%w: postgres replied %q", ErrUnexpectedProbeResponse, reply)
+		}
+		return nil
+	},
+}
+
+func expectPrefix(conn net.Conn, prefix string) error {
+	reply := make([]byte, len(prefix))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if string(reply) != prefix {
+		return fmt.Errorf("%w: got %q, want %q", ErrUnexpectedProbeResponse, reply, prefix)
+	}
+	return nil
+}
+
+func dialKeepAlive(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: keepAliveProbeTimeout}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// newKeepAliveFunc adapts a strategy to the keep-alive hook taken by
+// runSessionLifecycle. report, when non-nil, receives every probe result,
+// and a receive on wake triggers an immediate probe.
+func newKeepAliveFunc(strategy keepAliveStrategy, interval time.Duration, local localHost, wake <-chan struct{}, report func(error)) func(int, <-chan struct{}) {
+	return func(localPort int, stopChan <-chan struct{}) {
+		runKeepAlive(strategy, interval, local, localPort, stopChan, wake, report)
+	}
+}
+
+func KeepAlive(localPort int, stopChan <-chan struct{}) {
+	runKeepAlive(tcpConnectKeepAlive{}, keepAliveInterval, localHost{}, localPort, stopChan, nil, nil)
+}
+
+func runKeepAlive(strategy keepAliveStrategy, interval time.Duration, local localHost, localPort int, stopChan <-chan struct{}, wake <-chan struct{}, report func(error)) {
+	if _, ok := strategy.(noneKeepAlive); ok {
+		<-stopChan
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	probe := func() {
+		addr, err := local.addr(ctx, localPort)
+		if err == nil {
+			err = strategy.Probe(ctx, addr)
+		}
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		if report != nil {
+			report(err)
+		}
+		switch {
+		case err != nil && jsonLogs:
+			slog.Warn("Keep-alive probe failed", "strategy", strategy.Name(), "local_port", localPort, "error", err.Error())
+		case err != nil:
+			fmt.Printf("Keep-alive %s probe failed: %v\n", strategy.Name(), err)
+		default:
+			slog.Debug("Keep-alive probe succeeded", "strategy", strategy.Name(), "local_port", localPort)
+			if !jsonLogs {
+				fmt.Printf(".")
+			}
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			probe()
+		case <-wake:
+			probe()
+			ticker.Reset(interval)
+		case <-stopChan:
+			// Stop the keep-alive goroutine
+			if jsonLogs {
+				slog.Debug("Stopping keep-alive routine")
+			} else {
+				fmt.Println("Stopping keep-alive routine")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveStopsWhenSignaled(t *testing.T) {
+	t.Parallel()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		KeepAlive(65535, stop)
+		close(done)
+	}()
+
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("KeepAlive did not stop after stop channel closed")
+	}
+}
+
+func TestParseKeepAliveStrategy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value    string
+		wantName string
+		wantErr  error
+	}{
+		{value: "", wantName: "tcp-connect"},
+		{value: "tcp-probe", wantName: "tcp-probe"},
+		{value: " TCP-Connect ", wantName: "tcp-connect"},
+		{value: "none", wantName: "none"},
+		{value: "protocol:redis", wantName: "protocol:redis"},
+		{value: "protocol:postgres", wantName: "protocol:postgres"},
+		{value: "protocol:gopher", wantErr: ErrUnknownKeepAliveStrategy},
+		{value: "ws-ping", wantErr: ErrUnsupportedKeepAliveStrategy},
+		{value: "icmp", wantErr: ErrUnknownKeepAliveStrategy},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseKeepAliveStrategy(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseKeepAliveStrategy() unexpected error: %v", err)
+			}
+			if got.Name() != tt.wantName {
+				t.Fatalf("strategy = %q, want %q", got.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func serveOnce(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return listener.Addr().String()
+}
+
+func TestKeepAliveStrategyProbes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("tcp-probe writes a single newline", func(t *testing.T) {
+		t.Parallel()
+
+		got := make(chan []byte, 1)
+		addr := serveOnce(t, func(conn net.Conn) {
+			data, _ := io.ReadAll(conn)
+			got <- data
+		})
+
+		if err := (tcpProbeKeepAlive{}).Probe(context.Background(), addr); err != nil {
+			t.Fatalf("Probe() unexpected error: %v", err)
+		}
+		if data := <-got; string(data) != "\n" {
+			t.Fatalf("probe payload = %q, want %q", data, "\n")
+		}
+	})
+
+	t.Run("tcp-probe round trip accepts a reply", func(t *testing.T) {
+		t.Parallel()
+
+		addr := serveOnce(t, func(conn net.Conn) {
+			io.ReadFull(conn, make([]byte, 1))
+			io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+		})
+
+		if err := (tcpProbeKeepAlive{roundTrip: true}).Probe(context.Background(), addr); err != nil {
+			t.Fatalf("Probe() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("tcp-probe round trip accepts silence", func(t *testing.T) {
+		t.Parallel()
+
+		done := make(chan struct{})
+		addr := serveOnce(t, func(conn net.Conn) {
+			<-done
+		})
+		defer close(done)
+
+		if err := (tcpProbeKeepAlive{roundTrip: true, wait: 50 * time.Millisecond}).Probe(context.Background(), addr); err != nil {
+			t.Fatalf("Probe() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("tcp-probe round trip detects closed tunnel", func(t *testing.T) {
+		t.Parallel()
+
+		addr := serveOnce(t, func(conn net.Conn) {
+			io.ReadFull(conn, make([]byte, 1))
+		})
+
+		if err := (tcpProbeKeepAlive{roundTrip: true}).Probe(context.Background(), addr); !errors.Is(err, ErrTunnelClosedProbe) {
+			t.Fatalf("expected %v, got %v", ErrTunnelClosedProbe, err)
+		}
+	})
+
+	t.Run("tcp-connect sends nothing", func(t *testing.T) {
+		t.Parallel()
+
+		got := make(chan []byte, 1)
+		addr := serveOnce(t, func(conn net.Conn) {
+			data, _ := io.ReadAll(conn)
+			got <- data
+		})
+
+		if err := (tcpConnectKeepAlive{}).Probe(context.Background(), addr); err != nil {
+			t.Fatalf("Probe() unexpected error: %v", err)
+		}
+		if data := <-got; len(data) != 0 {
+			t.Fatalf("probe payload = %q, want empty", data)
+		}
+	})
+
+	t.Run("redis protocol probe expects PONG", func(t *testing.T) {
+		t.Parallel()
+
+		addr := serveOnce(t, func(conn net.Conn) {
+			buf := make([]byte, len("PING\r\n"))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			io.WriteString(conn, "+PONG\r\n")
+		})
+
+		strategy, err := parseKeepAliveStrategy("protocol:redis")
+		if err != nil {
+			t.Fatalf("parseKeepAliveStrategy() unexpected error: %v", err)
+		}
+		if err := strategy.Probe(context.Background(), addr); err != nil {
+			t.Fatalf("Probe() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("postgres protocol probe rejects unexpected reply", func(t *testing.T) {
+		t.Parallel()
+
+		addr := serveOnce(t, func(conn net.Conn) {
+			buf := make([]byte, 8)
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			conn.Write([]byte("E"))
+		})
+
+		strategy, err := parseKeepAliveStrategy("protocol:postgres")
+		if err != nil {
+			t.Fatalf("parseKeepAliveStrategy() unexpected error: %v", err)
+		}
+		if err := strategy.Probe(context.Background(), addr); !errors.Is(err, ErrUnexpectedProbeResponse) {
+			t.Fatalf("expected %v, got %v", ErrUnexpectedProbeResponse, err)
+		}
+	})
+}
+
+func TestNoneKeepAliveWaitsForStop(t *testing.T) {
+	t.Parallel()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		newKeepAliveFunc(noneKeepAlive{}, time.Millisecond, localHost{}, nil, nil)(65535, stop)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("none keep-alive returned before stop")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("none keep-alive did not stop after stop channel closed")
+	}
+}
+
+type failingKeepAlive struct{ err error }
+
+func (failingKeepAlive) Name() string { return "failing" }
+
+func (f failingKeepAlive) Probe(context.Context, string) error { return f.err }
+
+func TestKeepAliveReportsProbeResults(t *testing.T) {
+	t.Parallel()
+
+	wantErr := errors.New("probe failed")
+	results := make(chan error, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		newKeepAliveFunc(failingKeepAlive{err: wantErr}, time.Millisecond, localHost{}, nil, func(err error) {
+			select {
+			case results <- err:
+			default:
+			}
+		})(65535, stop)
+	}()
+
+	select {
+	case err := <-results:
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("reported %v, want %v", err, wantErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("keep-alive did not report probe result")
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestKeepAliveProbesOnWake(t *testing.T) {
+	t.Parallel()
+
+	results := make(chan error, 1)
+	stop := make(chan struct{})
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		newKeepAliveFunc(failingKeepAlive{}, time.Hour, localHost{}, wake, func(err error) {
+			results <- err
+		})(65535, stop)
+	}()
+
+	wake <- struct{}{}
+	select {
+	case <-results:
+	case <-time.After(time.Second):
+		t.Fatal("keep-alive did not probe on wake")
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestConfigKeepAliveRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		strategy string
+		wantName string
+		wantErr  error
+	}{
+		{strategy: "", wantName: "tcp-probe (round trip)"},
+		{strategy: "protocol:redis", wantName: "protocol:redis"},
+		{strategy: "tcp-connect", wantErr: ErrRoundTripUnsupported},
+		{strategy: "none", wantErr: ErrRoundTripUnsupported},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Parallel()
+			got, err := Config{KeepAliveStrategy: tt.strategy, KeepAliveRoundTrip: true}.keepAliveStrategy()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("keepAliveStrategy() unexpected error: %v", err)
+			}
+			if got.Name() != tt.wantName {
+				t.Fatalf("strategy = %q, want %q", got.Name(), tt.wantName)
+			}
+		})
+	}
+}
+
+func TestConfigKeepAliveEnabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{name: "off by default", cfg: Config{}},
+		{name: "flag", cfg: Config{KeepAlive: true}, want: true},
+		{name: "strategy opts in", cfg: Config{KeepAliveStrategy: "protocol:postgres"}, want: true},
+		{name: "round trip opts in", cfg: Config{KeepAliveRoundTrip: true}, want: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.cfg.keepAliveEnabled(); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigKeepAliveInterval(t *testing.T) {
+	t.Parallel()
+
+	if got := (Config{}).keepAliveInterval(); got != keepAliveInterval {
+		t.Errorf("expected %s, got %s", keepAliveInterval, got)
+	}
+	if got := (Config{KeepAliveInterval: 5 * time.Minute}).keepAliveInterval(); got != 5*time.Minute {
+		t.Errorf("expected 5m0s, got %s", got)
+	}
+	if err := (Config{KeepAliveInterval: -time.Second}).validateKeepAliveInterval(); !errors.Is(err, ErrInvalidKeepAliveInterval) {
+		t.Errorf("expected %v, got %v", ErrInvalidKeepAliveInterval, err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package cli implements the aws-go-forward command. Start runs a single
+// forward of it for package forward, which embeds it in other programs.
+//
+// The session plugin runs in a child copy of the program, so a program that
+// calls Start must call RunPlugin before anything else.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// startReadyTimeout bounds the wait for the local port once the session
+// has started.
+const startReadyTimeout = 30 * time.Second
+
+var (
+	ErrStartUnsupported = errors.New("not supported when embedded")
+	ErrTunnelNotReady   = errors.New("tunnel did not become ready")
+)
+
+// Tunnel is a forward started by Start.
+type Tunnel struct {
+	// LocalPort is the port the tunnel listens on, which the operating
+	// system picks when Config.LocalPort is zero.
+	LocalPort int
+	// InstanceID is the SSM target the tunnel goes through.
+	InstanceID string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// RunPlugin runs the session plugin and exits when the program was started
+// as the child plugin process of a Tunnel. Otherwise it returns at once.
+func RunPlugin() {
+	if handled, err := runPluginSubcommand(os.Args, os.Stderr); handled {
+		if err != nil {
+			os.Exit(fatalExitCode)
+		}
+		os.Exit(0)
+	}
+}
+
+// startSSMAPI is what Start needs from SSM.
+type startSSMAPI interface {
+	ssmSessionAPI
+	ssmDescribeInstanceInformationAPI
+}
+
+// validateStart rejects the options that only the command implements.
+func (c Config) validateStart() error {
+	var unsupported []string
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{
+		{c.SSH, "SSH"},
+		{c.Pipe, "Pipe"},
+		{c.Count > 1, "Count"},
+		{len(c.Forwards) > 0, "Forwards"},
+		{c.ForwardTaggedPorts, "ForwardTaggedPorts"},
+		{len(c.regions()) > 1, "several regions"},
+		{strings.TrimSpace(c.ResolverURL) != "", "ResolverURL"},
+		{c.cloudMapEnabled(), "Cloud Map"},
+		{c.eksEnabled(), "EKS services"},
+		{c.PreferFresh, "PreferFresh"},
+		{c.Reconnect != 0, "Reconnect"},
+		{strings.TrimSpace(c.InstanceID) == stdinInstanceID, "InstanceID from stdin"},
+	} {
+		if option.set {
+			unsupported = append(unsupported, option.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: %s", ErrStartUnsupported, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// Start resolves the instance cfg selects, starts a port forwarding
+// session and runs the session plugin, as the command does for a single
+// forward. It returns once the local port accepts connections. Cancelling
+// ctx aborts the start, and afterwards closes the tunnel like Close.
+func Start(ctx context.Context, cfg Config) (*Tunnel, error) {
+	if err := cfg.validateStart(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := applyRemoteService(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg = applyDirect(cfg)
+
+	deadline := startupDeadline(time.Now(), cfg.MaxStartupTime)
+	startupCtx, cancelStartup := withStartupDeadline(ctx, deadline)
+	defer cancelStartup()
+	awsCfg, err := createAWSSession(startupCtx, cfg.Profile, cfg.Region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", startupFailure(startupCtx, err))
+	}
+	if cfg.Region, err = resolveRegion(awsCfg, cfg.Profile); err != nil {
+		return nil, err
+	}
+	// The embedded plugin exits the process when its session closes.
+	return start(ctx, cfg, deadline, ec2.NewFromConfig(awsCfg), ssm.NewFromConfig(awsCfg, cfg.ssmClientOptions()...), forwardOptions{Isolated: true})
+}
+
+// start runs Start's forward once the AWS clients exist. opts carries how
+// the session plugin runs.
+func start(ctx context.Context, cfg Config, deadline time.Time, ec2Client ec2DescribeInstancesAPI, ssmClient startSSMAPI, opts forwardOptions) (*Tunnel, error) {
+	startupCtx, cancelStartup := withStartupDeadline(ctx, deadline)
+	defer cancelStartup()
+	resolveCtx, cancelResolve := withResolveTimeout(startupCtx, cfg.ResolveTimeout)
+	defer cancelResolve()
+	var instanceID string
+	var err error
+	if isManagedInstanceID(cfg.InstanceID) {
+		instanceID, err = getManagedInstanceID(resolveCtx, ssmClient, cfg.InstanceID)
+	} else {
+		instanceID, err = resolveInstanceID(resolveCtx, ec2Client, cfg, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance ID: %w", startupFailure(resolveCtx, err))
+	}
+	if err := checkRequiredTags(resolveCtx, ec2Client, instanceID, cfg.RequireTags); err != nil {
+		return nil, fmt.Errorf("instance rejected: %w", startupFailure(resolveCtx, err))
+	}
+	cancelResolve()
+
+	if cfg.LocalPort == 0 {
+		ports, err := forwardLocalPorts(cfg, listenLocalPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate local port: %w", err)
+		}
+		cfg.LocalPort = ports[0]
+	} else if _, err := checkLocalPortsFree([]Config{cfg}, listenLocalPort); err != nil {
+		return nil, err
+	}
+
+	events := newEventBus()
+	started, unsubscribe := events.Subscribe(8)
+	defer unsubscribe()
+	runCtx, cancel := context.WithCancel(ctx)
+	h := &Tunnel{LocalPort: cfg.LocalPort, InstanceID: instanceID, cancel: cancel, done: make(chan struct{})}
+	opts.InstanceID = instanceID
+	opts.DocumentName = cfg.resolvedDocumentName()
+	opts.StartupDeadline = deadline
+	go func() {
+		defer close(h.done)
+		h.err = runForward(runCtx, cfg, ssmClient, newSessionLimiter(cfg.MaxSessions), events, opts)
+	}()
+
+	for {
+		select {
+		case event := <-started:
+			if event.Type != eventSessionStarted {
+				continue
+			}
+			readyCtx, stopReady := context.WithCancel(runCtx)
+			go func() {
+				select {
+				case <-h.done:
+				case <-readyCtx.Done():
+				}
+				stopReady()
+			}()
+			err := waitForLocalPort(readyCtx, newLocalHost(cfg), cfg.LocalPort, clampToDeadline(startReadyTimeout, deadline, time.Now()), 250*time.Millisecond, 0)
+			stopReady()
+			if err == nil {
+				return h, nil
+			}
+			if closeErr := h.Close(); closeErr != nil {
+				return nil, closeErr
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%w: %v", ErrTunnelNotReady, err)
+		case <-h.done:
+			cancel()
+			if h.err != nil {
+				return nil, h.err
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%w: the session ended", ErrTunnelNotReady)
+		}
+	}
+}
+
+// Close terminates the session and waits for the session plugin to exit.
+// It returns the error the tunnel failed with, if any, so closing a
+// healthy tunnel returns nil.
+func (h *Tunnel) Close() error {
+	h.cancel()
+	<-h.done
+	return h.err
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestConfigValidateStart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantErr  error
+		wantText string
+	}{
+		{name: "single forward", cfg: Config{InstanceName: "bastion", RemoteHost: "db", RemotePort: 5432}},
+		{name: "ssh", cfg: Config{SSH: true}, wantErr: ErrStartUnsupported, wantText: "SSH"},
+		{name: "several", cfg: Config{Count: 2, Reconnect: -1}, wantErr: ErrStartUnsupported, wantText: "Count, Reconnect"},
+		{name: "stdin", cfg: Config{InstanceID: stdinInstanceID}, wantErr: ErrStartUnsupported, wantText: "InstanceID from stdin"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.cfg.validateStart()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.HasSuffix(err.Error(), tt.wantText) {
+				t.Errorf("expected the error to name %q, got %v", tt.wantText, err)
+			}
+		})
+	}
+}
+
+func TestStartValidates(t *testing.T) {
+	t.Parallel()
+
+	_, err := Start(context.Background(), Config{Profile: "default", InstanceName: "bastion", LocalPort: 5432, RemotePort: 5432})
+	if !errors.Is(err, ErrMissingRemoteHost) {
+		t.Errorf("expected %v, got %v", ErrMissingRemoteHost, err)
+	}
+}
+
+func TestTunnelClose(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Tunnel{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		<-ctx.Done()
+		close(h.done)
+	}()
+	if err := h.Close(); err != nil {
+		t.Errorf("expected closing a healthy tunnel to return nil, got %v", err)
+	}
+}
+
+func TestStartReadyClose(t *testing.T) {
+	t.Parallel()
+
+	pluginExited := errors.New("plugin exited")
+	tests := []struct {
+		name string
+		// exit makes the plugin fail before it binds its port.
+		exit    bool
+		wantErr error
+	}{
+		{name: "ready"},
+		{name: "plugin exits", exit: true, wantErr: pluginExited},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ec2Client := &fakeEC2Client{output: &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+				{InstanceId: aws.String("i-0123"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+			}}}}}
+			sessions := &fakeSessionClient{}
+			ssmClient := struct {
+				*fakeSessionClient
+				ssmDescribeInstanceInformationAPI
+			}{fakeSessionClient: sessions}
+			startPlugin := func(ctx context.Context, localPort int) error {
+				if tt.exit {
+					return pluginExited
+				}
+				listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+				if err != nil {
+					return err
+				}
+				go func() {
+					<-ctx.Done()
+					listener.Close()
+				}()
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return nil
+					}
+					conn.Close()
+				}
+			}
+
+			cfg := Config{Profile: "default", InstanceName: "bastion", RemoteHost: "db.internal", RemotePort: 5432}
+			tunnel, err := start(context.Background(), cfg, time.Now().Add(10*time.Second), ec2Client, ssmClient, forwardOptions{StartPlugin: startPlugin})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if tunnel.InstanceID != "i-0123" || tunnel.LocalPort == 0 {
+				t.Errorf("expected a tunnel to i-0123 on a chosen port, got %+v", tunnel)
+			}
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", tunnel.LocalPort))
+			if err != nil {
+				t.Fatalf("expected the local port to accept connections once started: %v", err)
+			}
+			conn.Close()
+
+			if err := tunnel.Close(); err != nil {
+				t.Errorf("expected closing a healthy tunnel to return nil, got %v", err)
+			}
+			if _, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", tunnel.LocalPort)); err == nil {
+				t.Errorf("expected local port %d to be closed after Close", tunnel.LocalPort)
+			}
+			sessions.mu.Lock()
+			defer sessions.mu.Unlock()
+			if !slices.Equal(sessions.terminated, []string{"session-1"}) {
+				t.Errorf("expected Close to terminate session-1, got %v", sessions.terminated)
+			}
+		})
+	}
+}
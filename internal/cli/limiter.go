@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"log"
+)
+
+// sessionLimiter bounds how many SSM sessions are open at once. A nil
+// limiter places no bound.
+type sessionLimiter struct {
+	slots chan struct{}
+	logf  func(format string, args ...any)
+}
+
+func newSessionLimiter(maxSessions int) *sessionLimiter {
+	if maxSessions <= 0 {
+		return nil
+	}
+	return &sessionLimiter{
+		slots: make(chan struct{}, maxSessions),
+		logf:  log.Printf,
+	}
+}
+
+// Acquire blocks until a session slot is free. The returned release
+// function must be called once the session has ended.
+func (l *sessionLimiter) Acquire(ctx context.Context, label string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	l.logf("Forward %s queued: %d of %d sessions in use", label, len(l.slots), cap(l.slots))
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *sessionLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil limiter never blocks", func(t *testing.T) {
+		t.Parallel()
+
+		limiter := newSessionLimiter(0)
+		if limiter != nil {
+			t.Fatal("newSessionLimiter(0) should return nil")
+		}
+		for i := 0; i < 10; i++ {
+			release, err := limiter.Acquire(context.Background(), "forward")
+			if err != nil {
+				t.Fatalf("Acquire() unexpected error: %v", err)
+			}
+			release()
+		}
+	})
+
+	t.Run("queues beyond the limit until a slot is released", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var logged []string
+		limiter := newSessionLimiter(1)
+		limiter.logf = func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+
+		release, err := limiter.Acquire(context.Background(), "first")
+		if err != nil {
+			t.Fatalf("Acquire() unexpected error: %v", err)
+		}
+
+		acquired := make(chan struct{})
+		go func() {
+			releaseSecond, err := limiter.Acquire(context.Background(), "second")
+			if err != nil {
+				t.Errorf("Acquire() unexpected error: %v", err)
+				return
+			}
+			releaseSecond()
+			close(acquired)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("second forward acquired a slot while limit was reached")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		release()
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("second forward was not admitted after release")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(logged) != 1 || logged[0] != "Forward second queued: 1 of 1 sessions in use" {
+			t.Fatalf("logged = %q", logged)
+		}
+	})
+
+	t.Run("queued acquire returns when context is cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		limiter := newSessionLimiter(1)
+		limiter.logf = func(string, ...any) {}
+		if _, err := limiter.Acquire(context.Background(), "first"); err != nil {
+			t.Fatalf("Acquire() unexpected error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := limiter.Acquire(ctx, "second"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLocalHost        = "127.0.0.1"
+	localHostResolveTimeout = 2 * time.Second
+)
+
+var (
+	ErrInvalidLocalPortRange   = errors.New("invalid local port range")
+	ErrLocalPortPoolExhausted  = errors.New("no free local port left in pool")
+	ErrLocalPortInUse          = errors.New("local port is already in use")
+	ErrLocalPortPermission     = errors.New("permission denied binding local port")
+	ErrLocalAddressUnavailable = errors.New("local address unavailable (ephemeral ports may be exhausted)")
+	ErrInvalidLocalHost        = errors.New("invalid local host")
+	ErrInvalidLocalResolver    = errors.New("invalid local resolver")
+	ErrLocalHostUnresolved     = errors.New("local host did not resolve")
+)
+
+// localHost is where the keep-alive and readiness checks reach the local
+// port. Name may be a DNS name, such as a loopback alias; it is resolved on
+// every dial with a timeout so a slow resolver cannot stall the caller.
+type localHost struct {
+	Name     string
+	Resolver *net.Resolver
+}
+
+func newLocalHost(cfg Config) localHost {
+	local := localHost{Name: strings.TrimSpace(cfg.LocalHost)}
+	if server := strings.TrimSpace(cfg.LocalResolver); server != "" {
+		local.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return local
+}
+
+func validateLocalHost(cfg Config) error {
+	if host := strings.TrimSpace(cfg.LocalHost); strings.ContainsAny(host, " /:") && net.ParseIP(host) == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidLocalHost, cfg.LocalHost)
+	}
+	if server := strings.TrimSpace(cfg.LocalResolver); server != "" {
+		if _, port, err := net.SplitHostPort(server); err != nil || port == "" {
+			return fmt.Errorf("%w: %q (want host:port)", ErrInvalidLocalResolver, cfg.LocalResolver)
+		}
+	}
+	return nil
+}
+
+// addr returns the address to dial for port.
+func (h localHost) addr(ctx context.Context, port int) (string, error) {
+	name := h.Name
+	if name == "" {
+		name = defaultLocalHost
+	}
+	if net.ParseIP(name) != nil {
+		return net.JoinHostPort(name, strconv.Itoa(port)), nil
+	}
+	resolver := h.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, localHostResolveTimeout)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrLocalHostUnresolved, name, err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrLocalHostUnresolved, name)
+	}
+	return net.JoinHostPort(addrs[0], strconv.Itoa(port)), nil
+}
+
+func parsePortRange(value string) (int, int, error) {
+	lowText, highText, found := strings.Cut(strings.TrimSpace(value), "-")
+	if !found {
+		return 0, 0, fmt.Errorf("%w: %q (want <low>-<high>)", ErrInvalidLocalPortRange, value)
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(lowText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q: %v", ErrInvalidLocalPortRange, value, err)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(highText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q: %v", ErrInvalidLocalPortRange, value, err)
+	}
+	if low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidLocalPortRange, value)
+	}
+	return low, high, nil
+}
+
+// classifyBindError maps a failed local bind onto an error that tells
+// port exhaustion apart from permission and in-use failures.
+func classifyBindError(port int, err error) error {
+	switch {
+	case isAnyError(err, addrInUseErrors):
+		return fmt.Errorf("%w: %d", ErrLocalPortInUse, port)
+	case isAnyError(err, permissionErrors):
+		hint := ""
+		if port < 1024 {
+			hint = " (ports below 1024 usually require elevated privileges)"
+		}
+		return fmt.Errorf("%w: %d%s", ErrLocalPortPermission, port, hint)
+	case isAnyError(err, addrNotAvailErrors):
+		return fmt.Errorf("%w: %d", ErrLocalAddressUnavailable, port)
+	default:
+		return fmt.Errorf("failed to bind local port %d: %w", port, err)
+	}
+}
+
+func isAnyError(err error, targets []error) bool {
+	return slices.ContainsFunc(targets, func(target error) bool { return errors.Is(err, target) })
+}
+
+func listenLocalPort(port int) (net.Listener, error) {
+	return listenHostPort(defaultLocalHost, port)
+}
+
+func listenHostPort(host string, port int) (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// pickPortsFromPool returns the first n ports in [low, high] that can be
+// bound. Each port stays bound until the search ends so none is returned
+// twice.
+func pickPortsFromPool(low, high, n int, listen func(int) (net.Listener, error)) ([]int, error) {
+	var ports []int
+	var listeners []net.Listener
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	for port := low; port <= high && len(ports) < n; port++ {
+		listener, err := listen(port)
+		if err == nil {
+			listeners = append(listeners, listener)
+			ports = append(ports, port)
+			continue
+		}
+		classified := classifyBindError(port, err)
+		if errors.Is(classified, ErrLocalPortInUse) {
+			continue
+		}
+		return nil, classified
+	}
+	if len(ports) < n {
+		return nil, fmt.Errorf("%w: %d-%d", ErrLocalPortPoolExhausted, low, high)
+	}
+	return ports, nil
+}
+
+// recheckLocalPort makes sure a port the operating system chose is still
+// free right before the session binds it, and picks another one if a
+// different process took it in the meantime.
+func recheckLocalPort(port int, listen func(int) (net.Listener, error)) (int, error) {
+	listener, err := listen(port)
+	if err == nil {
+		listener.Close()
+		return port, nil
+	}
+	if err := classifyBindError(port, err); !errors.Is(err, ErrLocalPortInUse) {
+		return 0, err
+	}
+	ports, err := pickEphemeralPorts(1, listen)
+	if err != nil {
+		return 0, err
+	}
+	return ports[0], nil
+}
+
+// checkLocalPortsFree binds the local port of each forward and lets it go
+// at once, so a port another program holds is reported before a session
+// is started for it rather than by the session plugin. It returns the
+// first port that cannot be bound.
+func checkLocalPortsFree(forwards []Config, listen func(int) (net.Listener, error)) (int, error) {
+	for _, forward := range forwards {
+		listener, err := listen(forward.LocalPort)
+		if err != nil {
+			return forward.LocalPort, classifyBindError(forward.LocalPort, err)
+		}
+		listener.Close()
+	}
+	return 0, nil
+}
+
+// pickEphemeralPorts lets the operating system choose n free local ports.
+// The listeners stay open until all are picked so no port is handed out
+// twice.
+func pickEphemeralPorts(n int, listen func(int) (net.Listener, error)) ([]int, error) {
+	ports := make([]int, 0, n)
+	for range n {
+		listener, err := listen(0)
+		if err != nil {
+			return nil, classifyBindError(0, err)
+		}
+		defer listener.Close()
+		ports = append(ports, listener.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParsePortRange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value    string
+		wantLow  int
+		wantHigh int
+		wantErr  error
+	}{
+		{value: "6000-6100", wantLow: 6000, wantHigh: 6100},
+		{value: " 7000 - 7000 ", wantLow: 7000, wantHigh: 7000},
+		{value: "6000", wantErr: ErrInvalidLocalPortRange},
+		{value: "6100-6000", wantErr: ErrInvalidLocalPortRange},
+		{value: "0-10", wantErr: ErrInvalidLocalPortRange},
+		{value: "60000-70000", wantErr: ErrInvalidLocalPortRange},
+		{value: "a-b", wantErr: ErrInvalidLocalPortRange},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+			low, high, err := parsePortRange(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePortRange() unexpected error: %v", err)
+			}
+			if low != tt.wantLow || high != tt.wantHigh {
+				t.Fatalf("range = %d-%d, want %d-%d", low, high, tt.wantLow, tt.wantHigh)
+			}
+		})
+	}
+}
+
+func bindError(errno syscall.Errno) error {
+	return &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", errno)}
+}
+
+func TestClassifyBindError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		port    int
+		err     error
+		wantErr error
+	}{
+		{name: "in use", port: 5432, err: bindError(syscall.EADDRINUSE), wantErr: ErrLocalPortInUse},
+		{name: "permission", port: 80, err: bindError(syscall.EACCES), wantErr: ErrLocalPortPermission},
+		{name: "address unavailable", port: 5432, err: bindError(syscall.EADDRNOTAVAIL), wantErr: ErrLocalAddressUnavailable},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := classifyBindError(tt.port, tt.err); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPickPortsFromPoolOnePort(t *testing.T) {
+	t.Parallel()
+
+	t.Run("skips ports in use", func(t *testing.T) {
+		t.Parallel()
+
+		listen := func(port int) (net.Listener, error) {
+			if port < 6002 {
+				return nil, bindError(syscall.EADDRINUSE)
+			}
+			return net.Listen("tcp", "127.0.0.1:0")
+		}
+		got, err := pickPortsFromPool(6000, 6005, 1, listen)
+		if err != nil {
+			t.Fatalf("pickPortsFromPool() unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, []int{6002}) {
+			t.Fatalf("ports = %v, want [6002]", got)
+		}
+	})
+
+	t.Run("reports exhausted pool", func(t *testing.T) {
+		t.Parallel()
+
+		listen := func(int) (net.Listener, error) {
+			return nil, bindError(syscall.EADDRINUSE)
+		}
+		if _, err := pickPortsFromPool(6000, 6002, 1, listen); !errors.Is(err, ErrLocalPortPoolExhausted) {
+			t.Fatalf("expected %v, got %v", ErrLocalPortPoolExhausted, err)
+		}
+	})
+
+	t.Run("stops on permission error", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		listen := func(int) (net.Listener, error) {
+			calls++
+			return nil, bindError(syscall.EACCES)
+		}
+		if _, err := pickPortsFromPool(80, 90, 1, listen); !errors.Is(err, ErrLocalPortPermission) {
+			t.Fatalf("expected %v, got %v", ErrLocalPortPermission, err)
+		}
+		if calls != 1 {
+			t.Fatalf("listen calls = %d, want 1", calls)
+		}
+	})
+}
+
+func TestPickPortsFromPool(t *testing.T) {
+	t.Parallel()
+
+	listen := func(port int) (net.Listener, error) {
+		if port == 6001 {
+			return nil, bindError(syscall.EADDRINUSE)
+		}
+		return net.Listen("tcp", "127.0.0.1:0")
+	}
+	got, err := pickPortsFromPool(6000, 6005, 3, listen)
+	if err != nil {
+		t.Fatalf("pickPortsFromPool() unexpected error: %v", err)
+	}
+	want := []int{6000, 6002, 6003}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ports = %v, want %v", got, want)
+	}
+
+	if _, err := pickPortsFromPool(6000, 6002, 3, listen); !errors.Is(err, ErrLocalPortPoolExhausted) {
+		t.Fatalf("expected %v, got %v", ErrLocalPortPoolExhausted, err)
+	}
+}
+
+func TestLocalHostAddr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "default", want: "127.0.0.1:6000"},
+		{name: "address", host: "127.0.0.2", want: "127.0.0.2:6000"},
+		{name: "ipv6 address", host: "::1", want: "[::1]:6000"},
+		{name: "name", host: "localhost"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := localHost{Name: tt.host}.addr(context.Background(), 6000)
+			if err != nil {
+				t.Fatalf("addr() unexpected error: %v", err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+			if host, _, err := net.SplitHostPort(got); err != nil || net.ParseIP(host) == nil {
+				t.Fatalf("expected a resolved address, got %q", got)
+			}
+		})
+	}
+}
+
+func TestLocalHostAddrResolverTimeout(t *testing.T) {
+	t.Parallel()
+
+	// A resolver that never answers must not hold up the caller for longer
+	// than the resolve timeout.
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	start := time.Now()
+	_, err := localHost{Name: "tunnel.invalid", Resolver: resolver}.addr(context.Background(), 6000)
+	if !errors.Is(err, ErrLocalHostUnresolved) {
+		t.Fatalf("expected %v, got %v", ErrLocalHostUnresolved, err)
+	}
+	if elapsed := time.Since(start); elapsed > localHostResolveTimeout+time.Second {
+		t.Fatalf("lookup took %s, want at most about %s", elapsed, localHostResolveTimeout)
+	}
+}
+
+func TestValidateLocalHost(t *testing.T) {
+	t.Parallel()
+
+	valid := []Config{{}, {LocalHost: "tunnel.local"}, {LocalHost: "::1"}, {LocalHost: "tunnel.local", LocalResolver: "127.0.0.53:53"}}
+	for _, cfg := range valid {
+		if err := validateLocalHost(cfg); err != nil {
+			t.Fatalf("validateLocalHost(%+v) unexpected error: %v", cfg, err)
+		}
+	}
+	if err := validateLocalHost(Config{LocalHost: "tunnel.local:6000"}); !errors.Is(err, ErrInvalidLocalHost) {
+		t.Fatalf("expected %v, got %v", ErrInvalidLocalHost, err)
+	}
+	if err := validateLocalHost(Config{LocalResolver: "127.0.0.53"}); !errors.Is(err, ErrInvalidLocalResolver) {
+		t.Fatalf("expected %v, got %v", ErrInvalidLocalResolver, err)
+	}
+}
+
+func TestRecheckLocalPort(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		listen  func(int) (net.Listener, error)
+		want    int
+		wantNew bool
+		wantErr error
+	}{
+		{
+			name:   "still free",
+			listen: func(int) (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") },
+			want:   54321,
+		},
+		{
+			name: "taken in the meantime",
+			listen: func(port int) (net.Listener, error) {
+				if port == 54321 {
+					return nil, bindError(syscall.EADDRINUSE)
+				}
+				return net.Listen("tcp", "127.0.0.1:0")
+			},
+			wantNew: true,
+		},
+		{
+			name:    "other bind failure",
+			listen:  func(int) (net.Listener, error) { return nil, bindError(syscall.EACCES) },
+			wantErr: ErrLocalPortPermission,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := recheckLocalPort(54321, tt.listen)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantNew {
+				if got == 0 || got == 54321 {
+					t.Errorf("expected a new port, got %d", got)
+				}
+			} else if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckLocalPortsFree(t *testing.T) {
+	t.Parallel()
+
+	var open []net.Listener
+	listen := func(port int) (net.Listener, error) {
+		if port == 5432 {
+			return nil, bindError(syscall.EADDRINUSE)
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		open = append(open, listener)
+		return listener, err
+	}
+
+	if _, err := checkLocalPortsFree([]Config{{LocalPort: 8080}, {LocalPort: 8081}}, listen); err != nil {
+		t.Fatalf("expected the ports to be free, got %v", err)
+	}
+	for _, listener := range open {
+		// The check must not keep the port bound.
+		if err := listener.Close(); err == nil {
+			t.Errorf("expected %s to be closed by the check", listener.Addr())
+		}
+	}
+
+	port, err := checkLocalPortsFree([]Config{{LocalPort: 8080}, {LocalPort: 5432}}, listen)
+	if !errors.Is(err, ErrLocalPortInUse) {
+		t.Fatalf("expected %v, got %v", ErrLocalPortInUse, err)
+	}
+	if port != 5432 {
+		t.Errorf("expected 5432, got %d", port)
+	}
+}
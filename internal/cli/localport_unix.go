@@ -0,0 +1,12 @@
+//go:build !windows
+
+package cli
+
+import "syscall"
+
+// The errors a failed local bind is classified by.
+var (
+	addrInUseErrors    = []error{syscall.EADDRINUSE}
+	permissionErrors   = []error{syscall.EACCES, syscall.EPERM}
+	addrNotAvailErrors = []error{syscall.EADDRNOTAVAIL}
+)
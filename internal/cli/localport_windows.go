@@ -0,0 +1,13 @@
+//go:build windows
+
+package cli
+
+import "syscall"
+
+// The errors a failed local bind is classified by. Winsock reports its own
+// WSA error codes, which the syscall package's POSIX values do not match.
+var (
+	addrInUseErrors    = []error{syscall.EADDRINUSE, syscall.Errno(10048)}            // WSAEADDRINUSE
+	permissionErrors   = []error{syscall.EACCES, syscall.EPERM, syscall.Errno(10013)} // WSAEACCES
+	addrNotAvailErrors = []error{syscall.EADDRNOTAVAIL, syscall.Errno(10049)}         // WSAEADDRNOTAVAIL
+)
@@ -0,0 +1,24 @@
+//go:build windows
+
+package cli
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyBindErrorWinsock(t *testing.T) {
+	t.Parallel()
+
+	inUse := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.Errno(10048))}
+	if err := classifyBindError(5432, inUse); !errors.Is(err, ErrLocalPortInUse) {
+		t.Errorf("expected %v, got %v", ErrLocalPortInUse, err)
+	}
+	denied := &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.Errno(10013))}
+	if err := classifyBindError(80, denied); !errors.Is(err, ErrLocalPortPermission) {
+		t.Errorf("expected %v, got %v", ErrLocalPortPermission, err)
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+var ErrInvalidLogFormat = errors.New("invalid log format")
+
+// jsonLogs is set once at startup by --log-format json. Output that text
+// mode writes to stdout for a person, such as the keep-alive dots, is then
+// left out or logged instead.
+var jsonLogs bool
+
+func validateLogFormat(format string) error {
+	switch format {
+	case logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidLogFormat, format, logFormatText, logFormatJSON)
+	}
+}
+
+// setupLogging routes the log package, and slog, to w in format. verbose
+// adds the debug messages, such as every keep-alive tick. Text mode
+// without verbose leaves logging as it is.
+func setupLogging(format string, verbose bool, w io.Writer) {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	if format != logFormatJSON {
+		slog.SetLogLoggerLevel(level)
+		return
+	}
+	jsonLogs = true
+	slog.SetDefault(slog.New(newJSONLogHandler(w, level)))
+}
+
+// newJSONLogHandler writes one object per line with time, level and
+// message, followed by the record's own fields.
+func newJSONLogHandler(w io.Writer, level slog.Level) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return attr
+			}
+			switch attr.Key {
+			case slog.TimeKey:
+				attr.Value = slog.StringValue(attr.Value.Time().UTC().Format(time.RFC3339Nano))
+			case slog.LevelKey:
+				attr.Value = slog.StringValue(strings.ToLower(attr.Value.String()))
+			case slog.MessageKey:
+				attr.Key = "message"
+			}
+			return attr
+		},
+	})
+}
+
+// eventLogMessages word the lifecycle events for the log. Keep-alive
+// failures are left out, the keep-alive logs them itself.
+var eventLogMessages = map[string]string{
+	eventInstanceResolved: "Instance resolved",
+	eventSessionStarted:   "Session started",
+	eventTunnelReady:      "Tunnel ready",
+	eventProbeUp:          "Monitored service is up",
+	eventProbeDown:        "Monitored service is down",
+	eventSessionEnded:     "Session ended",
+	eventShutdown:         "Shutting down",
+}
+
+// logEvent logs event through logger, at warn level when it carries an
+// error.
+func logEvent(logger *slog.Logger, event lifecycleEvent) {
+	message, ok := eventLogMessages[event.Type]
+	if !ok {
+		return
+	}
+	level := slog.LevelInfo
+	if event.Error != "" || event.Type == eventProbeDown {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{slog.String("event", event.Type)}
+	for _, field := range []struct{ key, value string }{
+		{"label", event.Label},
+		{"instance_id", event.InstanceID},
+		{"session_id", event.SessionID},
+		{"error", event.Error},
+	} {
+		if field.value != "" {
+			attrs = append(attrs, slog.String(field.key, field.value))
+		}
+	}
+	if event.LocalPort != 0 {
+		attrs = append(attrs, slog.Int("local_port", event.LocalPort))
+	}
+	logger.LogAttrs(context.Background(), level, message, attrs...)
+}
+
+// startEventLog logs every lifecycle event on bus. The returned function
+// stops it once the pending events are written.
+func startEventLog(bus *eventBus, logger *slog.Logger) func() {
+	events, unsubscribe := bus.Subscribe(16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range events {
+			logEvent(logger, event)
+		}
+	}()
+	return func() {
+		unsubscribe()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestValidateLogFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format  string
+		wantErr error
+	}{
+		{format: logFormatText},
+		{format: logFormatJSON},
+		{format: "JSON", wantErr: ErrInvalidLogFormat},
+		{format: "", wantErr: ErrInvalidLogFormat},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.format, func(t *testing.T) {
+			t.Parallel()
+
+			if err := validateLogFormat(tt.format); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestJSONLogHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(newJSONLogHandler(&buf, slog.LevelInfo))
+	logger.Debug("Keep-alive probe succeeded")
+	logger.Warn("Reconnect attempt 1 failed", "error", "timeout")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON object, got %q: %v", buf.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, line["time"].(string)); err != nil {
+		t.Errorf("expected an RFC 3339 time, got %v", line["time"])
+	}
+	for key, want := range map[string]any{"level": "warn", "message": "Reconnect attempt 1 failed", "error": "timeout"} {
+		if line[key] != want {
+			t.Errorf("expected %s %v, got %v", key, want, line[key])
+		}
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		event lifecycleEvent
+		want  map[string]any
+	}{
+		{
+			name:  "session started",
+			event: lifecycleEvent{Type: eventSessionStarted, InstanceID: "i-0123", SessionID: "user-0abc", LocalPort: 5432},
+			want:  map[string]any{"level": "info", "message": "Session started", "event": eventSessionStarted, "instance_id": "i-0123", "session_id": "user-0abc", "local_port": float64(5432)},
+		},
+		{
+			name:  "session failed",
+			event: lifecycleEvent{Type: eventSessionEnded, Label: "db", Error: "plugin exited"},
+			want:  map[string]any{"level": "warn", "message": "Session ended", "label": "db", "error": "plugin exited"},
+		},
+		{
+			name:  "keep-alive failure",
+			event: lifecycleEvent{Type: eventKeepAliveFailed, Error: "timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			logEvent(slog.New(newJSONLogHandler(&buf, slog.LevelInfo)), tt.event)
+			if tt.want == nil {
+				if buf.Len() != 0 {
+					t.Errorf("expected no log line, got %q", buf.String())
+				}
+				return
+			}
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("expected one JSON object, got %q: %v", buf.String(), err)
+			}
+			for key, want := range tt.want {
+				if line[key] != want {
+					t.Errorf("expected %s %v, got %v", key, want, line[key])
+				}
+			}
+		})
+	}
+}
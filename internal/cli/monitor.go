@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMonitorInterval = 15 * time.Second
+	defaultMonitorFailures = 3
+)
+
+var (
+	ErrMonitorFailed          = errors.New("monitor probes failed")
+	ErrMonitorWithSSH         = errors.New("monitor cannot be used with ssh mode")
+	ErrMonitorProbe           = errors.New("monitor requires the tcp-probe or a protocol keep-alive strategy")
+	ErrInvalidMonitorInterval = errors.New("invalid monitor interval")
+	ErrInvalidMonitorFailures = errors.New("invalid monitor failures")
+)
+
+func (c Config) validateMonitor() error {
+	if c.MonitorInterval < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidMonitorInterval, c.MonitorInterval)
+	}
+	if c.MonitorFailures < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidMonitorFailures, c.MonitorFailures)
+	}
+	if !c.Monitor {
+		return nil
+	}
+	if c.SSH {
+		return ErrMonitorWithSSH
+	}
+	_, err := c.monitorStrategy()
+	return err
+}
+
+func (c Config) monitorInterval() time.Duration {
+	if c.MonitorInterval > 0 {
+		return c.MonitorInterval
+	}
+	return defaultMonitorInterval
+}
+
+func (c Config) monitorFailures() int {
+	if c.MonitorFailures > 0 {
+		return c.MonitorFailures
+	}
+	return defaultMonitorFailures
+}
+
+// monitorStrategy is the keep-alive strategy --monitor probes with. Only
+// probes that need an answer from the remote service say anything about
+// reachability, so the tcp-probe always waits for a round trip.
+func (c Config) monitorStrategy() (keepAliveStrategy, error) {
+	name := c.KeepAliveStrategy
+	if strings.TrimSpace(name) == "" {
+		name = "tcp-probe"
+	}
+	strategy, err := parseKeepAliveStrategy(name)
+	if err != nil {
+		return nil, err
+	}
+	switch strategy.(type) {
+	case tcpProbeKeepAlive:
+		return tcpProbeKeepAlive{roundTrip: true}, nil
+	case protocolKeepAlive:
+		return strategy, nil
+	default:
+		return nil, fmt.Errorf("%w, not %q", ErrMonitorProbe, strategy.Name())
+	}
+}
+
+// probeMonitor tracks the results of --monitor probes.
+type probeMonitor struct {
+	limit    int
+	failures int
+	known    bool
+	up       bool
+}
+
+// record reports whether the probe result changed the up or down state,
+// and returns ErrMonitorFailed once limit probes in a row have failed.
+func (m *probeMonitor) record(err error) (bool, error) {
+	up := err == nil
+	changed := !m.known || m.up != up
+	m.known, m.up = true, up
+	if up {
+		m.failures = 0
+		return changed, nil
+	}
+	m.failures++
+	if m.failures >= m.limit {
+		return changed, fmt.Errorf("%w: %d in a row, last: %w", ErrMonitorFailed, m.failures, err)
+	}
+	return changed, nil
+}
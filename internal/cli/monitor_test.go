@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConfigValidateMonitor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "off"},
+		{name: "default probe", cfg: Config{Monitor: true}},
+		{name: "protocol probe", cfg: Config{Monitor: true, KeepAliveStrategy: "protocol:http"}},
+		{name: "tcp-connect", cfg: Config{Monitor: true, KeepAliveStrategy: "tcp-connect"}, wantErr: ErrMonitorProbe},
+		{name: "none", cfg: Config{Monitor: true, KeepAliveStrategy: "none"}, wantErr: ErrMonitorProbe},
+		{name: "ssh", cfg: Config{Monitor: true, SSH: true}, wantErr: ErrMonitorWithSSH},
+		{name: "negative interval", cfg: Config{Monitor: true, MonitorInterval: -time.Second}, wantErr: ErrInvalidMonitorInterval},
+		{name: "negative failures", cfg: Config{Monitor: true, MonitorFailures: -1}, wantErr: ErrInvalidMonitorFailures},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateMonitor(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigMonitorStrategy(t *testing.T) {
+	t.Parallel()
+
+	strategy, err := (Config{Monitor: true}).monitorStrategy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strategy != (tcpProbeKeepAlive{roundTrip: true}) {
+		t.Errorf("expected a round-trip tcp-probe, got %s", strategy.Name())
+	}
+	if got := (Config{}).monitorInterval(); got != defaultMonitorInterval {
+		t.Errorf("expected %s, got %s", defaultMonitorInterval, got)
+	}
+	if got := (Config{}).monitorFailures(); got != defaultMonitorFailures {
+		t.Errorf("expected %d, got %d", defaultMonitorFailures, got)
+	}
+}
+
+func TestProbeMonitorRecord(t *testing.T) {
+	t.Parallel()
+
+	probeErr := errors.New("connection refused")
+	monitor := &probeMonitor{limit: 2}
+	steps := []struct {
+		err         error
+		wantChanged bool
+		wantFailed  bool
+	}{
+		{err: nil, wantChanged: true},
+		{err: nil},
+		{err: probeErr, wantChanged: true},
+		{err: nil, wantChanged: true},
+		{err: probeErr, wantChanged: true},
+		{err: probeErr, wantFailed: true},
+	}
+	for i, step := range steps {
+		changed, failed := monitor.record(step.err)
+		if changed != step.wantChanged {
+			t.Errorf("probe %d: expected changed %v, got %v", i+1, step.wantChanged, changed)
+		}
+		if (failed != nil) != step.wantFailed {
+			t.Fatalf("probe %d: expected failed %v, got %v", i+1, step.wantFailed, failed)
+		}
+		if failed != nil && (!errors.Is(failed, ErrMonitorFailed) || !errors.Is(failed, probeErr)) {
+			t.Errorf("probe %d: expected %v wrapping the last probe error, got %v", i+1, ErrMonitorFailed, failed)
+		}
+	}
+}
+
+func TestStatsDMetricsProbeUp(t *testing.T) {
+	t.Parallel()
+
+	metrics := &statsDMetrics{prefix: "fwd"}
+	var got []string
+	for _, event := range []string{eventProbeUp, eventProbeDown} {
+		got = append(got, metrics.lines(lifecycleEvent{Type: event})...)
+	}
+	want := []string{"fwd.probe_up:1|g", "fwd.probe_up:0|g"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
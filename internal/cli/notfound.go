@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// instanceMisses records what a name lookup saw besides the instances it
+// could use, to explain an empty result.
+type instanceMisses struct {
+	// states counts the instances that match the filter in a state that is
+	// not accepted.
+	states map[types.InstanceStateName]int
+	// truncated is set when pages were left unread.
+	truncated bool
+}
+
+func (m *instanceMisses) add(state types.InstanceStateName) {
+	if m.states == nil {
+		m.states = make(map[types.InstanceStateName]int)
+	}
+	m.states[state]++
+}
+
+// noInstancesError explains why no instance in acceptStates matches filter,
+// with the likely fixes.
+func noInstancesError(filter instanceFilter, acceptStates []types.InstanceStateName, misses instanceMisses) error {
+	target := filter.String()
+	if !slices.Equal(acceptStates, defaultAcceptStates) {
+		target += " in states " + formatStates(acceptStates)
+	}
+
+	var hints []string
+	if total := sumStates(misses.states); total > 0 {
+		counts := make([]string, 0, len(misses.states))
+		for _, state := range slices.Sorted(maps.Keys(misses.states)) {
+			counts = append(counts, fmt.Sprintf("%d %s", misses.states[state], state))
+		}
+		hints = append(hints, fmt.Sprintf("%d matching %s in other states (%s); start one or widen --accept-states", total, plural(total, "instance is", "instances are"), strings.Join(counts, ", ")))
+	} else {
+		where := "in this region"
+		if filter.Region != "" {
+			where = "in " + filter.Region
+		}
+		check := "the Name tag spelling, which is case-sensitive"
+		if filter.Name == "" {
+			check = "the tag keys and values, which are case-sensitive"
+		}
+		hints = append(hints, fmt.Sprintf("no instance %s matches in any state; check %s, and --region", where, check))
+	}
+	if misses.truncated {
+		hints = append(hints, "only the first page of results was read, see --describe-pagination")
+	}
+	return fmt.Errorf("%w for %s: %s", ErrNoRunningInstances, target, strings.Join(hints, "; "))
+}
+
+func sumStates(states map[types.InstanceStateName]int) int {
+	total := 0
+	for _, n := range states {
+		total += n
+	}
+	return total
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// describeInstancesFailure points at the missing permission when the
+// profile may not call ec2:DescribeInstances.
+func describeInstancesFailure(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "UnauthorizedOperation" || strings.Contains(apiErr.ErrorCode(), "AccessDenied")) {
+		return fmt.Errorf("%w (the profile needs ec2:DescribeInstances; an explicit --instance-id skips the lookup)", err)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestNoInstancesError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		filter       instanceFilter
+		acceptStates []types.InstanceStateName
+		misses       instanceMisses
+		want         []string
+	}{
+		{
+			name:         "other states",
+			filter:       instanceFilter{Name: "bastion", Region: "eu-west-1"},
+			acceptStates: defaultAcceptStates,
+			misses: instanceMisses{states: map[types.InstanceStateName]int{
+				types.InstanceStateNameStopped: 2,
+				types.InstanceStateNamePending: 1,
+			}},
+			want: []string{"3 matching instances are in other states (1 pending, 2 stopped)", "--accept-states"},
+		},
+		{
+			name:         "no match",
+			filter:       instanceFilter{Name: "bastion", Region: "eu-west-1"},
+			acceptStates: defaultAcceptStates,
+			want:         []string{"no instance in eu-west-1 matches in any state", "Name tag spelling", "--region"},
+		},
+		{
+			name:         "tags only",
+			filter:       instanceFilter{Tags: map[string]string{"role": "bastion"}},
+			acceptStates: defaultAcceptStates,
+			want:         []string{"no instance in this region", "tag keys and values"},
+		},
+		{
+			name:         "accepted states",
+			filter:       instanceFilter{Name: "bastion"},
+			acceptStates: []types.InstanceStateName{types.InstanceStateNameStopped},
+			want:         []string{"in states stopped"},
+		},
+		{
+			name:         "truncated",
+			filter:       instanceFilter{Name: "bastion"},
+			acceptStates: defaultAcceptStates,
+			misses:       instanceMisses{truncated: true},
+			want:         []string{"--describe-pagination"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := noInstancesError(tt.filter, tt.acceptStates, tt.misses)
+			if !errors.Is(err, ErrNoRunningInstances) {
+				t.Fatalf("expected %v, got %v", ErrNoRunningInstances, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected the error to contain %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeInstancesFailure(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantHint bool
+	}{
+		{name: "unauthorized", err: &smithy.GenericAPIError{Code: "UnauthorizedOperation"}, wantHint: true},
+		{name: "access denied", err: fmt.Errorf("operation error: %w", &smithy.GenericAPIError{Code: "AccessDeniedException"}), wantHint: true},
+		{name: "throttled", err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}},
+		{name: "other", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := describeInstancesFailure(tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if got := strings.Contains(err.Error(), "ec2:DescribeInstances"); got != tt.wantHint {
+				t.Errorf("expected hint %v, got %v", tt.wantHint, err)
+			}
+		})
+	}
+}
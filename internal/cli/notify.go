@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const notificationTitle = "aws-go-forward"
+
+var ErrNoNotifier = errors.New("no desktop notification backend available")
+
+func notificationCommand(goos, title, message string) (string, []string) {
+	switch goos {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return "osascript", []string{"-e", script}
+	case "windows":
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(5000, %s, %s, 'Info')
+Start-Sleep -Seconds 6
+$n.Dispose()`, powerShellQuote(title), powerShellQuote(message))
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", script}
+	default:
+		return "notify-send", []string{"--app-name", notificationTitle, title, message}
+	}
+}
+
+func appleScriptQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func powerShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func sendNotification(title, message string) error {
+	name, args := notificationCommand(runtime.GOOS, title, message)
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoNotifier, err)
+	}
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+func notificationLabel(event lifecycleEvent) string {
+	if event.Label != "" {
+		return event.Label
+	}
+	return event.InstanceID
+}
+
+func endedNotification(event lifecycleEvent) string {
+	if event.Error != "" {
+		return fmt.Sprintf("Tunnel to %s failed: %s", notificationLabel(event), event.Error)
+	}
+	return fmt.Sprintf("Tunnel to %s closed", notificationLabel(event))
+}
+
+// tunnelNotifier picks the notifications for lifecycle events, per forward.
+// With reconnects, a session that ends is held back: the forward's next
+// session is announced as a reconnect instead, and the end is only
+// reported on shutdown, when no reconnect follows.
+type tunnelNotifier struct {
+	reconnects bool
+	ready      map[string]bool
+	dropped    map[string]lifecycleEvent
+}
+
+func newTunnelNotifier(reconnects bool) *tunnelNotifier {
+	return &tunnelNotifier{reconnects: reconnects, ready: make(map[string]bool), dropped: make(map[string]lifecycleEvent)}
+}
+
+// notifications returns the notifications event deserves, if any.
+func (n *tunnelNotifier) notifications(event lifecycleEvent) []string {
+	switch event.Type {
+	case eventTunnelReady:
+		if n.ready[event.Label] {
+			return nil
+		}
+		n.ready[event.Label] = true
+		return []string{fmt.Sprintf("Tunnel to %s ready on localhost:%d", notificationLabel(event), event.LocalPort)}
+	case eventSessionStarted:
+		if _, ok := n.dropped[event.Label]; !ok {
+			return nil
+		}
+		delete(n.dropped, event.Label)
+		return []string{fmt.Sprintf("Tunnel to %s reconnected on localhost:%d", notificationLabel(event), event.LocalPort)}
+	case eventSessionEnded:
+		if n.reconnects {
+			n.dropped[event.Label] = event
+			return nil
+		}
+		return []string{endedNotification(event)}
+	case eventShutdown:
+		return n.flush()
+	default:
+		return nil
+	}
+}
+
+// flush returns the ends held back for a reconnect that did not come.
+func (n *tunnelNotifier) flush() []string {
+	labels := make([]string, 0, len(n.dropped))
+	for label := range n.dropped {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	messages := make([]string, len(labels))
+	for i, label := range labels {
+		messages[i] = endedNotification(n.dropped[label])
+		delete(n.dropped, label)
+	}
+	return messages
+}
+
+// startNotifications turns lifecycle events into desktop notifications.
+// reconnects says whether a forward may start a new session after one
+// ends. When no backend is available notifications are skipped silently.
+// The returned stop function waits briefly for pending notifications to go
+// out.
+func startNotifications(bus *eventBus, reconnects bool, send func(title, message string) error) func() {
+	events, unsubscribe := bus.Subscribe(16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		notifier := newTunnelNotifier(reconnects)
+		for event := range events {
+			for _, message := range notifier.notifications(event) {
+				if err := send(notificationTitle, message); errors.Is(err, ErrNoNotifier) {
+					// Drain without notifying.
+					for range events {
+					}
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
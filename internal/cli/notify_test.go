@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNotificationCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		goos     string
+		wantName string
+		wantArg  string
+	}{
+		{goos: "linux", wantName: "notify-send", wantArg: `Tunnel "db" ready`},
+		{goos: "darwin", wantName: "osascript", wantArg: `display notification "Tunnel \"db\" ready" with title "aws-go-forward"`},
+		{goos: "windows", wantName: "powershell", wantArg: `'Tunnel "db" ready'`},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.goos, func(t *testing.T) {
+			t.Parallel()
+			name, args := notificationCommand(tt.goos, notificationTitle, `Tunnel "db" ready`)
+			if name != tt.wantName {
+				t.Fatalf("command = %q, want %q", name, tt.wantName)
+			}
+			if !strings.Contains(strings.Join(args, " "), tt.wantArg) {
+				t.Fatalf("args = %q, want to contain %q", args, tt.wantArg)
+			}
+		})
+	}
+}
+
+func TestStartNotifications(t *testing.T) {
+	t.Parallel()
+
+	bus := newEventBus()
+	var mu sync.Mutex
+	var sent []string
+	stop := startNotifications(bus, false, func(_, message string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, message)
+		return nil
+	})
+
+	bus.Emit(lifecycleEvent{Type: eventSessionStarted, InstanceID: "i-123"})
+	bus.Emit(lifecycleEvent{Type: eventTunnelReady, InstanceID: "i-123", LocalPort: 5432})
+	bus.Emit(lifecycleEvent{Type: eventSessionEnded, InstanceID: "i-123", Error: "plugin exited"})
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"Tunnel to i-123 ready on localhost:5432", "Tunnel to i-123 failed: plugin exited"}
+	if strings.Join(sent, "|") != strings.Join(want, "|") {
+		t.Fatalf("notifications = %q, want %q", sent, want)
+	}
+}
+
+func TestStartNotificationsWithoutBackend(t *testing.T) {
+	t.Parallel()
+
+	bus := newEventBus()
+	calls := 0
+	stop := startNotifications(bus, false, func(string, string) error {
+		calls++
+		return ErrNoNotifier
+	})
+
+	bus.Emit(lifecycleEvent{Type: eventTunnelReady, InstanceID: "i-123"})
+	bus.Emit(lifecycleEvent{Type: eventSessionEnded, InstanceID: "i-123"})
+	stop()
+
+	if calls != 1 {
+		t.Fatalf("send calls = %d, want 1", calls)
+	}
+}
+
+func TestTunnelNotifierReconnects(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		reconnects bool
+		events     []lifecycleEvent
+		want       []string
+	}{
+		{
+			name: "without reconnects",
+			events: []lifecycleEvent{
+				{Type: eventSessionStarted, InstanceID: "i-123", LocalPort: 5432},
+				{Type: eventTunnelReady, InstanceID: "i-123", LocalPort: 5432},
+				{Type: eventSessionEnded, InstanceID: "i-123"},
+				{Type: eventShutdown},
+			},
+			want: []string{"Tunnel to i-123 ready on localhost:5432", "Tunnel to i-123 closed"},
+		},
+		{
+			name:       "reconnected then gave up",
+			reconnects: true,
+			events: []lifecycleEvent{
+				{Type: eventSessionStarted, InstanceID: "i-123", LocalPort: 5432},
+				{Type: eventTunnelReady, InstanceID: "i-123", LocalPort: 5432},
+				{Type: eventSessionEnded, InstanceID: "i-123", Error: "plugin exited"},
+				{Type: eventSessionStarted, InstanceID: "i-456", LocalPort: 5432},
+				{Type: eventTunnelReady, InstanceID: "i-456", LocalPort: 5432},
+				{Type: eventSessionEnded, InstanceID: "i-456", Error: "plugin exited"},
+				{Type: eventShutdown},
+			},
+			want: []string{"Tunnel to i-123 ready on localhost:5432", "Tunnel to i-456 reconnected on localhost:5432", "Tunnel to i-456 failed: plugin exited"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier := newTunnelNotifier(tt.reconnects)
+			var got []string
+			for _, event := range tt.events {
+				got = append(got, notifier.notifications(event)...)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("notifications = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// pipeDialInterval is how often the relay tries the plugin's port while
+// the plugin is still starting.
+const pipeDialInterval = 250 * time.Millisecond
+
+var (
+	ErrPipeWithSSH             = errors.New("pipe cannot be combined with --ssh")
+	ErrStdinInstanceIDWithPipe = errors.New("instance id from stdin cannot be used with pipe mode")
+	ErrPipeUnsupported         = errors.New("not supported with --pipe")
+	ErrPipeFailed              = errors.New("pipe relay failed")
+)
+
+// validatePipe rejects the options that need a local port or a stdin and
+// stdout of their own.
+func (c Config) validatePipe() error {
+	if !c.Pipe {
+		return nil
+	}
+	if c.SSH {
+		return ErrPipeWithSSH
+	}
+	if strings.TrimSpace(c.InstanceID) == stdinInstanceID {
+		return ErrStdinInstanceIDWithPipe
+	}
+	var unsupported []string
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{
+		{c.LocalPort != 0, "--local-port"},
+		{strings.TrimSpace(c.LocalPortRange) != "", "--local-port-range"},
+		{c.Count > 1, "--count"},
+		{len(c.Forwards) > 0, "forward sections"},
+		{c.ForwardTaggedPorts, "--forward-tagged-ports"},
+		{len(c.regions()) > 1, "several regions"},
+		{c.nativeForwarder(), "--forwarder native"},
+		{c.PreferFresh, "--prefer-fresh"},
+		{c.Reconnect != 0, "--reconnect"},
+		{c.Monitor, "--monitor"},
+		{strings.EqualFold(strings.TrimSpace(c.Select), selectPrompt), "--select prompt"},
+	} {
+		if option.set {
+			unsupported = append(unsupported, option.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%w: %s", ErrPipeUnsupported, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// runPipe connects to the port the session plugin listens on and relays it
+// to in and out until either side closes.
+func runPipe(ctx context.Context, port int, timeout time.Duration, in io.Reader, out io.Writer) error {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	deadline := time.Now().Add(timeout)
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			if err := relayPipe(conn, in, out); err != nil {
+				return fmt.Errorf("%w: %v", ErrPipeFailed, err)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w: session plugin not listening on %s after %s: %v", ErrPipeFailed, addr, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pipeDialInterval):
+		}
+	}
+}
+
+// relayPipe copies in to conn and conn to out. The end of in half-closes
+// conn, so the remote side can still answer; the relay is done when the
+// remote side closes or either copy fails.
+func relayPipe(conn net.Conn, in io.Reader, out io.Writer) error {
+	defer conn.Close()
+	sent := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, in)
+		if half, ok := conn.(interface{ CloseWrite() error }); ok && err == nil {
+			if err = half.CloseWrite(); err == nil {
+				return
+			}
+		}
+		sent <- err
+	}()
+	received := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(out, conn)
+		received <- err
+	}()
+
+	select {
+	case err := <-sent:
+		return err
+	case err := <-received:
+		return err
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidatePipe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		wantErr  error
+		wantText string
+	}{
+		{name: "off", cfg: Config{SSH: true, LocalPort: 5432}},
+		{name: "pipe", cfg: Config{Pipe: true, RemoteHost: "db", RemotePort: 5432}},
+		{name: "ssh", cfg: Config{Pipe: true, SSH: true}, wantErr: ErrPipeWithSSH},
+		{name: "stdin", cfg: Config{Pipe: true, InstanceID: stdinInstanceID}, wantErr: ErrStdinInstanceIDWithPipe},
+		{name: "local port", cfg: Config{Pipe: true, LocalPort: 5432, Reconnect: -1}, wantErr: ErrPipeUnsupported, wantText: "--local-port, --reconnect"},
+		{name: "native", cfg: Config{Pipe: true, Forwarder: forwarderNative}, wantErr: ErrPipeUnsupported, wantText: "--forwarder native"},
+		{name: "prompt", cfg: Config{Pipe: true, Select: selectPrompt}, wantErr: ErrPipeUnsupported, wantText: "--select prompt"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.cfg.validatePipe()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !strings.HasSuffix(err.Error(), tt.wantText) {
+				t.Errorf("expected the error to name %q, got %v", tt.wantText, err)
+			}
+		})
+	}
+}
+
+// pipeServer accepts one connection on a loopback port and hands it to
+// serve.
+func pipeServer(t *testing.T, serve func(net.Conn)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestRunPipeHalfClose(t *testing.T) {
+	t.Parallel()
+
+	// The server only answers once it has read all of stdin.
+	port := pipeServer(t, func(conn net.Conn) {
+		request, _ := io.ReadAll(conn)
+		conn.Write(append([]byte("got "), request...))
+	})
+
+	var out bytes.Buffer
+	err := runPipe(context.Background(), port, time.Second, strings.NewReader("ping"), &out)
+	if err != nil {
+		t.Fatalf("expected the relay to end cleanly, got %v", err)
+	}
+	if out.String() != "got ping" {
+		t.Errorf("expected %q, got %q", "got ping", out.String())
+	}
+}
+
+func TestRunPipeRemoteClose(t *testing.T) {
+	t.Parallel()
+
+	port := pipeServer(t, func(conn net.Conn) {
+		conn.Write([]byte("bye"))
+	})
+
+	// Stdin never ends, so only the remote side closing ends the relay.
+	in, stdin := io.Pipe()
+	defer stdin.Close()
+	var out bytes.Buffer
+	err := runPipe(context.Background(), port, time.Second, in, &out)
+	if err != nil {
+		t.Fatalf("expected the relay to end cleanly, got %v", err)
+	}
+	if out.String() != "bye" {
+		t.Errorf("expected %q, got %q", "bye", out.String())
+	}
+}
+
+func TestRunPipeNotListening(t *testing.T) {
+	t.Parallel()
+
+	port, err := allocateEphemeralPort()
+	if err != nil {
+		t.Fatalf("failed to allocate port: %v", err)
+	}
+	err = runPipe(context.Background(), port, 10*time.Millisecond, strings.NewReader(""), io.Discard)
+	if !errors.Is(err, ErrPipeFailed) {
+		t.Errorf("expected %v, got %v", ErrPipeFailed, err)
+	}
+}
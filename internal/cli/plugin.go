@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/session-manager-plugin/src/sessionmanagerplugin/session"
+)
+
+// pluginSubcommand makes the binary act as session-manager-plugin. The
+// embedded plugin keeps per-process state and exits the process when a
+// session stops, so concurrent forwards each run it in a child process.
+const pluginSubcommand = "session-manager-plugin"
+
+// pluginResponseEnv carries the StartSession response to a child plugin
+// process so the session token does not show up in the process list.
+const pluginResponseEnv = "AWS_SSM_START_SESSION_RESPONSE"
+
+// externalPluginName is the installed AWS session plugin that
+// --plugin-fallback runs when the embedded one fails.
+const externalPluginName = "session-manager-plugin"
+
+var (
+	ErrSessionPluginFailed    = errors.New("session plugin failed")
+	ErrExternalPluginNotFound = errors.New("session-manager-plugin not found in PATH")
+)
+
+func pluginArgs(responseArg, region, profile, instanceID, ssmEndpoint string) []string {
+	return []string{
+		"aws-go-forward", // Executable name (ignored)
+		responseArg,
+		region,
+		"StartSession",
+		profile,
+		fmt.Sprintf(`{"Target":"%s"}`, instanceID),
+		ssmEndpoint,
+	}
+}
+
+func startSessionManagerPluginBuiltin(response *ssm.StartSessionOutput, region, profile, instanceID string, ssmEndpoint string) error {
+	pluginData, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session response: %w", err)
+	}
+	args := pluginArgs(string(pluginData), region, profile, instanceID, ssmEndpoint)
+
+	return runEmbeddedPlugin(session.ValidateInputAndStartSession, args)
+}
+
+// runEmbeddedPlugin runs the embedded plugin, turning its error output and
+// any panic into an error.
+func runEmbeddedPlugin(start func(args []string, out io.Writer), args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Session plugin error: panic: %v", r)
+			err = fmt.Errorf("%w: panic: %v", ErrSessionPluginFailed, r)
+		}
+	}()
+	// The plugin prints routine status to stdout itself; what it writes to
+	// the given writer are the reasons it could not start the session.
+	var output bytes.Buffer
+	start(args, &output)
+	return pluginFailure(output.String(), log.Printf)
+}
+
+// pluginFailure logs the error output of the plugin and turns it into an
+// error.
+func pluginFailure(output string, logf func(format string, args ...any)) error {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return nil
+	}
+	writer := &pluginErrorWriter{logf: logf}
+	writer.Write([]byte(output + "\n"))
+	if writer.mismatch != "" {
+		return fmt.Errorf("%w: %w: %s", ErrSessionPluginFailed, ErrAgentVersionMismatch, strings.Join(strings.Fields(output), " "))
+	}
+	return fmt.Errorf("%w: %s", ErrSessionPluginFailed, strings.Join(strings.Fields(output), " "))
+}
+
+// pluginErrorWriter logs every non-empty line written to it as a session
+// plugin error, and keeps the first one that points at a protocol version
+// mismatch with the agent.
+type pluginErrorWriter struct {
+	logf   func(format string, args ...any)
+	prefix string
+
+	mu       sync.Mutex
+	partial  []byte
+	mismatch string
+}
+
+func (w *pluginErrorWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.logLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// Flush logs a final line that did not end in a newline.
+func (w *pluginErrorWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logLine(string(w.partial))
+	w.partial = nil
+}
+
+func (w *pluginErrorWriter) logLine(line string) {
+	if line = strings.TrimSpace(line); line != "" {
+		w.logf("%sSession plugin error: %s", w.prefix, line)
+		if w.mismatch == "" && isVersionMismatch(line) {
+			w.mismatch = line
+		}
+	}
+}
+
+// startSessionManagerPluginProcess runs the plugin in a child copy of this
+// binary. The child is killed when ctx is cancelled.
+func startSessionManagerPluginProcess(ctx context.Context, response *ssm.StartSessionOutput, region, profile, instanceID string, ssmEndpoint string, stdin io.Reader, stdout io.Writer, logPrefix string) error {
+	pluginData, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session response: %w", err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	cmd := pluginCommand(ctx, executable, []string{pluginSubcommand}, pluginData, region, profile, instanceID, ssmEndpoint)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	return runPluginCommand(ctx, cmd, logPrefix)
+}
+
+// startSessionManagerPluginExternal runs the installed session-manager-plugin
+// on the same StartSession response. In SSH mode it gets the tool's stdin
+// and stdout, which carry the tunneled stream.
+func startSessionManagerPluginExternal(ctx context.Context, response *ssm.StartSessionOutput, region, profile, instanceID string, ssmEndpoint string, stdin io.Reader, stdout io.Writer, logPrefix string) error {
+	pluginData, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session response: %w", err)
+	}
+	executable, err := exec.LookPath(externalPluginName)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExternalPluginNotFound, err)
+	}
+
+	cmd := pluginCommand(ctx, executable, nil, pluginData, region, profile, instanceID, ssmEndpoint)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	return runPluginCommand(ctx, cmd, logPrefix)
+}
+
+// pluginCommand builds a plugin invocation that reads the StartSession
+// response from pluginResponseEnv.
+func pluginCommand(ctx context.Context, executable string, leadingArgs []string, pluginData []byte, region, profile, instanceID, ssmEndpoint string) *exec.Cmd {
+	args := pluginArgs(pluginResponseEnv, region, profile, instanceID, ssmEndpoint)
+	cmd := exec.CommandContext(ctx, executable, append(leadingArgs, args[1:]...)...)
+	cmd.Env = append(os.Environ(), pluginResponseEnv+"="+string(pluginData))
+	return cmd
+}
+
+func runPluginCommand(ctx context.Context, cmd *exec.Cmd, logPrefix string) error {
+	stderr := &pluginErrorWriter{logf: log.Printf, prefix: logPrefix}
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	stderr.Flush()
+	if err != nil && ctx.Err() == nil {
+		if stderr.mismatch != "" {
+			return fmt.Errorf("session plugin process failed: %w: %s", ErrAgentVersionMismatch, stderr.mismatch)
+		}
+		return fmt.Errorf("session plugin process failed: %w", err)
+	}
+	return nil
+}
+
+// runPluginSubcommand handles an invocation of the binary as the session
+// plugin. It reports whether args selected the plugin subcommand. The
+// plugin's error output is written to errOut, for the parent to log, and
+// makes it return ErrSessionPluginFailed.
+func runPluginSubcommand(args []string, errOut io.Writer) (bool, error) {
+	if len(args) < 2 || args[1] != pluginSubcommand {
+		return false, nil
+	}
+	var output bytes.Buffer
+	session.ValidateInputAndStartSession(args[1:], &output)
+	if output.Len() == 0 {
+		return true, nil
+	}
+	errOut.Write(output.Bytes())
+	return true, ErrSessionPluginFailed
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestRunPluginSubcommandIgnoresOtherArgs(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{"aws-go-forward"},
+		{"aws-go-forward", "--profile", "dev"},
+	} {
+		var out bytes.Buffer
+		if handled, err := runPluginSubcommand(args, &out); handled || err != nil {
+			t.Fatalf("runPluginSubcommand(%q) = %v, %v, want false, nil", args, handled, err)
+		}
+	}
+}
+
+func TestPluginArgs(t *testing.T) {
+	t.Parallel()
+
+	got := pluginArgs(pluginResponseEnv, "eu-west-1", "dev", "i-123", "https://ssm.eu-west-1.amazonaws.com")
+	want := []string{"aws-go-forward", pluginResponseEnv, "eu-west-1", "StartSession", "dev", `{"Target":"i-123"}`, "https://ssm.eu-west-1.amazonaws.com"}
+	if len(got) != len(want) {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("args[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPluginErrorWriter(t *testing.T) {
+	t.Parallel()
+
+	var logged []string
+	writer := &pluginErrorWriter{prefix: "[forward-1] ", logf: func(format string, args ...any) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+	writer.Write([]byte("Cannot perform start session: "))
+	writer.Write([]byte("EOF\n\nretrying"))
+	writer.Flush()
+
+	want := []string{"[forward-1] Session plugin error: Cannot perform start session: EOF", "[forward-1] Session plugin error: retrying"}
+	if len(logged) != len(want) {
+		t.Fatalf("expected %q, got %q", want, logged)
+	}
+	for i := range want {
+		if logged[i] != want[i] {
+			t.Fatalf("expected %q, got %q", want[i], logged[i])
+		}
+	}
+}
+
+func TestPluginFailure(t *testing.T) {
+	t.Parallel()
+
+	var logged int
+	logf := func(string, ...any) { logged++ }
+	if err := pluginFailure(" \n", logf); err != nil || logged != 0 {
+		t.Fatalf("expected no error or log, got %v and %d lines", err, logged)
+	}
+	err := pluginFailure("Invalid Operation\n", logf)
+	if !errors.Is(err, ErrSessionPluginFailed) {
+		t.Fatalf("expected %v, got %v", ErrSessionPluginFailed, err)
+	}
+	if logged != 1 {
+		t.Fatalf("expected 1 logged line, got %d", logged)
+	}
+}
+
+func TestRunEmbeddedPlugin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		start   func(args []string, out io.Writer)
+		wantErr bool
+	}{
+		{name: "session ends", start: func([]string, io.Writer) {}},
+		{name: "error output", start: func(_ []string, out io.Writer) { fmt.Fprintln(out, "Invalid Operation") }, wantErr: true},
+		{name: "panic", start: func([]string, io.Writer) { panic("unsupported session type") }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := runEmbeddedPlugin(tt.start, nil)
+			if tt.wantErr && !errors.Is(err, ErrSessionPluginFailed) {
+				t.Fatalf("expected %v, got %v", ErrSessionPluginFailed, err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("runEmbeddedPlugin() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPluginCommand(t *testing.T) {
+	t.Parallel()
+
+	cmd := pluginCommand(context.Background(), "/usr/local/bin/session-manager-plugin", nil, []byte(`{"SessionId":"s-1"}`), "eu-west-1", "dev", "i-123", "https://ssm.eu-west-1.amazonaws.com")
+	want := []string{"/usr/local/bin/session-manager-plugin", pluginResponseEnv, "eu-west-1", "StartSession", "dev", `{"Target":"i-123"}`, "https://ssm.eu-west-1.amazonaws.com"}
+	if !slices.Equal(cmd.Args, want) {
+		t.Fatalf("expected %q, got %q", want, cmd.Args)
+	}
+	if !slices.Contains(cmd.Env, pluginResponseEnv+`={"SessionId":"s-1"}`) {
+		t.Fatalf("expected the session response in the environment, got %q", cmd.Env)
+	}
+}
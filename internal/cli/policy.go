@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// policySection holds the timeout and retry settings.
+const policySection = "policy"
+
+// maxConnectRetries is how many readiness attempts, 250ms apart, fit in the
+// 30 second readiness timeout.
+const maxConnectRetries = 120
+
+var (
+	ErrResolveTimeoutOverBudget = errors.New("resolve timeout exceeds max startup time")
+	ErrTooManyConnectRetries    = errors.New("too many connect retries")
+)
+
+// Policy groups the timeouts and retries of a forward. Flags override
+// single fields.
+type Policy struct {
+	MaxStartupTime time.Duration `ini:"max_startup_time"`
+	ResolveTimeout time.Duration `ini:"resolve_timeout"`
+	ConnectRetries int           `ini:"connect_retries"`
+	ReadTimeout    time.Duration `ini:"read_timeout"`
+	WriteTimeout   time.Duration `ini:"write_timeout"`
+}
+
+// loadPolicy reads the policy keys from [settings], where they used to
+// live, and then from [policy], which wins.
+func loadPolicy(iniCfg *ini.File) (Policy, error) {
+	var policy Policy
+	if err := iniCfg.Section("settings").StrictMapTo(&policy); err != nil {
+		return Policy{}, err
+	}
+	if iniCfg.HasSection(policySection) {
+		if err := iniCfg.Section(policySection).StrictMapTo(&policy); err != nil {
+			return Policy{}, fmt.Errorf("[%s]: %w", policySection, err)
+		}
+	}
+	return policy, nil
+}
+
+// validate checks the values that do not depend on other settings. The
+// read and write timeouts are checked with the forwarder they belong to.
+func (p Policy) validate() error {
+	if p.ConnectRetries < 0 {
+		return ErrInvalidConnectRetries
+	}
+	if p.ConnectRetries > maxConnectRetries {
+		return fmt.Errorf("%w: %d (at most %d fit in the readiness timeout)", ErrTooManyConnectRetries, p.ConnectRetries, maxConnectRetries)
+	}
+	if p.MaxStartupTime < 0 {
+		return ErrInvalidMaxStartupTime
+	}
+	if p.ResolveTimeout < 0 {
+		return ErrInvalidResolveTimeout
+	}
+	if p.MaxStartupTime > 0 && p.ResolveTimeout > p.MaxStartupTime {
+		return fmt.Errorf("%w: %s > %s", ErrResolveTimeoutOverBudget, p.ResolveTimeout, p.MaxStartupTime)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPolicy(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "forward.ini")
+	content := "[settings]\nprofile = default\nmax_startup_time = 1m\nconnect_retries = 4\n\n[policy]\nmax_startup_time = 45s\nresolve_timeout = 10s\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg, err := loadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	want := Policy{MaxStartupTime: 45 * time.Second, ResolveTimeout: 10 * time.Second, ConnectRetries: 4}
+	if cfg.Policy != want {
+		t.Fatalf("expected %+v, got %+v", want, cfg.Policy)
+	}
+
+	merged := mergeConfigWithCLIOverrides(*cfg, Config{Policy: Policy{ResolveTimeout: 5 * time.Second}}, map[string]bool{"resolve-timeout": true})
+	if merged.ResolveTimeout != 5*time.Second || merged.MaxStartupTime != 45*time.Second {
+		t.Fatalf("expected only the resolve timeout overridden, got %+v", merged.Policy)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr error
+	}{
+		{name: "zero", policy: Policy{}},
+		{name: "resolve within budget", policy: Policy{MaxStartupTime: time.Minute, ResolveTimeout: 10 * time.Second, ConnectRetries: 20}},
+		{name: "resolve without budget", policy: Policy{ResolveTimeout: time.Hour}},
+		{name: "negative connect retries", policy: Policy{ConnectRetries: -1}, wantErr: ErrInvalidConnectRetries},
+		{name: "too many connect retries", policy: Policy{ConnectRetries: maxConnectRetries + 1}, wantErr: ErrTooManyConnectRetries},
+		{name: "negative max startup time", policy: Policy{MaxStartupTime: -time.Second}, wantErr: ErrInvalidMaxStartupTime},
+		{name: "negative resolve timeout", policy: Policy{ResolveTimeout: -time.Second}, wantErr: ErrInvalidResolveTimeout},
+		{name: "resolve over budget", policy: Policy{MaxStartupTime: 10 * time.Second, ResolveTimeout: time.Minute}, wantErr: ErrResolveTimeoutOverBudget},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.policy.validate()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("validate() unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var ErrProbeSessionFailed = errors.New("probe session failed")
+
+// probeResult is what --probe-session reports.
+type probeResult struct {
+	SessionID string
+	Start     time.Duration
+	Terminate time.Duration
+}
+
+func (r probeResult) String() string {
+	return fmt.Sprintf("Probe session %s started in %s and terminated in %s", r.SessionID, r.Start.Round(time.Millisecond), r.Terminate.Round(time.Millisecond))
+}
+
+// probeSession starts a session with the real request and terminates it
+// right away. Nothing connects to the session's stream, so no local port
+// is bound and the plugin is not started.
+func probeSession(ctx context.Context, client ssmSessionAPI, instanceID, documentName string, parameters map[string][]string, reason string, now func() time.Time) (probeResult, error) {
+	started := now()
+	output, err := startPortForwarding(ctx, client, instanceID, documentName, parameters, reason)
+	if err != nil {
+		return probeResult{}, fmt.Errorf("%w: start session: %w", ErrProbeSessionFailed, err)
+	}
+	result := probeResult{SessionID: aws.ToString(output.SessionId), Start: now().Sub(started)}
+	if result.SessionID == "" {
+		return result, fmt.Errorf("%w: start session returned no session id", ErrProbeSessionFailed)
+	}
+	terminating := now()
+	if err := terminatePortForwardingSession(ctx, client, result.SessionID); err != nil {
+		return result, fmt.Errorf("%w: terminate session %s: %w", ErrProbeSessionFailed, result.SessionID, err)
+	}
+	result.Terminate = now().Sub(terminating)
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+type fakeProbeClient struct {
+	startOutput  *ssm.StartSessionOutput
+	startErr     error
+	terminateErr error
+	started      *ssm.StartSessionInput
+	terminated   []string
+}
+
+func (f *fakeProbeClient) StartSession(_ context.Context, input *ssm.StartSessionInput, _ ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	f.started = input
+	if f.startErr != nil {
+		return nil, f.startErr
+	}
+	return f.startOutput, nil
+}
+
+func (f *fakeProbeClient) TerminateSession(_ context.Context, input *ssm.TerminateSessionInput, _ ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	f.terminated = append(f.terminated, aws.ToString(input.SessionId))
+	if f.terminateErr != nil {
+		return nil, f.terminateErr
+	}
+	return &ssm.TerminateSessionOutput{}, nil
+}
+
+// steppingClock advances by step on every call.
+func steppingClock(step time.Duration) func() time.Time {
+	now := time.Unix(0, 0)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestProbeSession(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		client         *fakeProbeClient
+		wantErr        bool
+		wantTerminated []string
+	}{
+		{
+			name:           "started and terminated",
+			client:         &fakeProbeClient{startOutput: &ssm.StartSessionOutput{SessionId: aws.String("s-1")}},
+			wantTerminated: []string{"s-1"},
+		},
+		{
+			name:    "start denied",
+			client:  &fakeProbeClient{startErr: errors.New("AccessDeniedException")},
+			wantErr: true,
+		},
+		{
+			name:    "no session id",
+			client:  &fakeProbeClient{startOutput: &ssm.StartSessionOutput{}},
+			wantErr: true,
+		},
+		{
+			name:           "terminate denied",
+			client:         &fakeProbeClient{startOutput: &ssm.StartSessionOutput{SessionId: aws.String("s-1")}, terminateErr: errors.New("AccessDeniedException")},
+			wantErr:        true,
+			wantTerminated: []string{"s-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			params := map[string][]string{"portNumber": {"5432"}}
+			result, err := probeSession(context.Background(), tt.client, "i-target", "AWS-StartPortForwardingSessionToRemoteHost", params, "probe", steppingClock(time.Second))
+			if tt.wantErr {
+				if !errors.Is(err, ErrProbeSessionFailed) {
+					t.Fatalf("expected %v, got %v", ErrProbeSessionFailed, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.client.terminated) != len(tt.wantTerminated) || (len(tt.wantTerminated) > 0 && tt.client.terminated[0] != tt.wantTerminated[0]) {
+				t.Errorf("expected terminated %v, got %v", tt.wantTerminated, tt.client.terminated)
+			}
+			if aws.ToString(tt.client.started.Target) != "i-target" || aws.ToString(tt.client.started.Reason) != "probe" {
+				t.Errorf("expected the real start request, got %+v", tt.client.started)
+			}
+			if !tt.wantErr && (result.Start != time.Second || result.Terminate != time.Second) {
+				t.Errorf("expected 1s timings, got %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+var (
+	ErrNoMatchingProfile = errors.New("no profile matches prefix")
+	ErrAmbiguousProfile  = errors.New("profile prefix is ambiguous")
+	ErrUnknownProfile    = errors.New("profile not found in the shared config or credentials file")
+)
+
+// defaultProfile may be missing from the shared files: the SDK then falls
+// back to environment, container or instance credentials.
+const defaultProfile = "default"
+
+// maxProfileSuggestions bounds the "did you mean" list.
+const maxProfileSuggestions = 3
+
+// sharedConfigFiles returns the AWS shared config and credentials paths,
+// honouring AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE.
+func sharedConfigFiles(getenv func(string) string, home string) (string, string) {
+	configFile := getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+	credentialsFile := getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		credentialsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	return configFile, credentialsFile
+}
+
+// listProfiles returns the sorted profile names defined in the given
+// shared config and credentials files. Missing files are skipped.
+func listProfiles(configFile, credentialsFile string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, file := range []struct {
+		path   string
+		prefix string
+	}{
+		{configFile, "profile "},
+		{credentialsFile, ""},
+	} {
+		if _, err := os.Stat(file.path); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		iniCfg, err := ini.Load(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.path, err)
+		}
+		for _, name := range iniCfg.SectionStrings() {
+			if name == ini.DefaultSection {
+				continue
+			}
+			if file.prefix != "" && name != "default" {
+				var found bool
+				name, found = strings.CutPrefix(name, file.prefix)
+				if !found {
+					continue
+				}
+			}
+			seen[strings.TrimSpace(name)] = true
+		}
+	}
+
+	profiles := make([]string, 0, len(seen))
+	for name := range seen {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// resolveProfilePrefix picks the profile named by prefix. An exact match
+// wins; otherwise exactly one profile may start with prefix.
+func resolveProfilePrefix(prefix string, profiles []string) (string, error) {
+	var candidates []string
+	for _, name := range profiles {
+		if name == prefix {
+			return name, nil
+		}
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w: %q", ErrNoMatchingProfile, prefix)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%w: %q matches %s; pass --profile to choose one", ErrAmbiguousProfile, prefix, strings.Join(candidates, ", "))
+	}
+}
+
+// checkProfile verifies that profile is defined in the shared files. The
+// error suggests the closest names and lists every profile.
+func checkProfile(profile string, profiles []string) error {
+	if profile == defaultProfile || slices.Contains(profiles, profile) {
+		return nil
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("%w: %q (no profiles are defined)", ErrUnknownProfile, profile)
+	}
+	msg := fmt.Sprintf("%q", profile)
+	if suggestions := closestProfiles(profile, profiles); len(suggestions) > 0 {
+		msg += " (did you mean " + strings.Join(suggestions, ", ") + "?)"
+	}
+	return fmt.Errorf("%w: %s; available profiles: %s", ErrUnknownProfile, msg, strings.Join(profiles, ", "))
+}
+
+// closestProfiles returns up to maxProfileSuggestions profiles within a
+// small edit distance of name, closest first.
+func closestProfiles(name string, profiles []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	limit := max(2, len(name)/3)
+	var candidates []candidate
+	for _, profile := range profiles {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(profile)); d <= limit {
+			candidates = append(candidates, candidate{profile, d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	var names []string
+	for _, c := range candidates[:min(len(candidates), maxProfileSuggestions)] {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListProfiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	credentialsFile := filepath.Join(dir, "credentials")
+	config := "[default]\nregion = us-east-1\n\n[profile company-prod]\nregion = eu-west-1\n\n[profile company-prod-ro]\n\n[sso-session corp]\n"
+	credentials := "[default]\n\n[company-dev]\naws_access_key_id = x\n"
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	if err := os.WriteFile(credentialsFile, []byte(credentials), 0o600); err != nil {
+		t.Fatalf("write credentials file: %v", err)
+	}
+
+	got, err := listProfiles(configFile, credentialsFile)
+	if err != nil {
+		t.Fatalf("listProfiles() unexpected error: %v", err)
+	}
+	want := []string{"company-dev", "company-prod", "company-prod-ro", "default"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("profiles = %q, want %q", got, want)
+	}
+
+	got, err = listProfiles(configFile, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatalf("listProfiles() unexpected error with missing credentials: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("profiles = %q, want 3 from config only", got)
+	}
+}
+
+func TestSharedConfigFiles(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"AWS_CONFIG_FILE": "/etc/aws/config"}
+	configFile, credentialsFile := sharedConfigFiles(func(key string) string { return env[key] }, "/home/dev")
+	if configFile != "/etc/aws/config" {
+		t.Fatalf("config file = %q, want %q", configFile, "/etc/aws/config")
+	}
+	if want := filepath.Join("/home/dev", ".aws", "credentials"); credentialsFile != want {
+		t.Fatalf("credentials file = %q, want %q", credentialsFile, want)
+	}
+}
+
+func TestResolveProfilePrefix(t *testing.T) {
+	t.Parallel()
+
+	profiles := []string{"company-dev", "company-prod", "company-prod-ro", "default"}
+
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr error
+	}{
+		{prefix: "company-prod", want: "company-prod"},
+		{prefix: "company-d", want: "company-dev"},
+		{prefix: "company-prod-", want: "company-prod-ro"},
+		{prefix: "company", wantErr: ErrAmbiguousProfile},
+		{prefix: "other", wantErr: ErrNoMatchingProfile},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.prefix, func(t *testing.T) {
+			t.Parallel()
+			got, err := resolveProfilePrefix(tt.prefix, profiles)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveProfilePrefix() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("profile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	t.Parallel()
+
+	profiles := []string{"company-dev", "company-prod", "company-prod-ro", "sandbox"}
+
+	tests := []struct {
+		name     string
+		profile  string
+		profiles []string
+		wantErr  error
+		wantMsg  string
+	}{
+		{name: "defined", profile: "company-prod", profiles: profiles},
+		{name: "default uses the ambient chain", profile: "default", profiles: profiles},
+		{name: "typo", profile: "compnay-prod", profiles: profiles, wantErr: ErrUnknownProfile, wantMsg: `"compnay-prod" (did you mean company-prod?); available profiles: company-dev, company-prod, company-prod-ro, sandbox`},
+		{name: "case", profile: "Sandbox", profiles: profiles, wantErr: ErrUnknownProfile, wantMsg: "(did you mean sandbox?)"},
+		{name: "nothing close", profile: "billing", profiles: profiles, wantErr: ErrUnknownProfile, wantMsg: `"billing"; available profiles: company-dev`},
+		{name: "no profiles", profile: "billing", wantErr: ErrUnknownProfile, wantMsg: "no profiles are defined"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkProfile(tt.profile, tt.profiles)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("expected %q in %q", tt.wantMsg, err.Error())
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"prod", "", 4},
+		{"prod", "prod", 0},
+		{"prod", "prd", 1},
+		{"compnay", "company", 2},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q): expected %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = 30 * time.Second
+	// reconnectStableAfter is how long a session has to stay up for the
+	// next drop to count attempts from the start again.
+	reconnectStableAfter = time.Minute
+	// reconnectUnlimited as --reconnect keeps trying until Ctrl-C.
+	reconnectUnlimited = -1
+)
+
+var (
+	ErrInvalidReconnect = errors.New("invalid reconnect")
+	ErrReconnectWithSSH = errors.New("reconnect cannot be combined with --ssh")
+)
+
+func (c Config) validateReconnect() error {
+	if c.Reconnect < reconnectUnlimited {
+		return fmt.Errorf("%w: %d (want a number of attempts, 0 = off, or %d = no limit)", ErrInvalidReconnect, c.Reconnect, reconnectUnlimited)
+	}
+	if c.Reconnect != 0 && c.SSH {
+		return ErrReconnectWithSSH
+	}
+	return nil
+}
+
+// reconnectPolicy starts a forward again after its session dropped, with
+// exponential backoff between attempts.
+type reconnectPolicy struct {
+	// attempts is how many reconnects in a row are tried, or
+	// reconnectUnlimited.
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	stableAfter    time.Duration
+	// resolve looks the instance up again, so a replaced instance is
+	// followed.
+	resolve func(ctx context.Context) (string, error)
+	now     func() time.Time
+}
+
+func (p *reconnectPolicy) backoff(attempt int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 1; i < attempt && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, p.maxBackoff)
+}
+
+// run runs forward against instanceID until ctx is done or the attempts
+// run out, and returns the last forward's error.
+func (p *reconnectPolicy) run(ctx context.Context, instanceID, prefix string, forward func(ctx context.Context, instanceID string) error, resolved func(instanceID string)) error {
+	attempt := 0
+	for {
+		started := p.now()
+		err := forward(ctx, instanceID)
+		// A newer session would hit the same agent, and a failed monitor
+		// has already retried for long enough.
+		if ctx.Err() != nil || errors.Is(err, ErrAgentVersionMismatch) || errors.Is(err, ErrMonitorFailed) {
+			return err
+		}
+		if p.now().Sub(started) >= p.stableAfter {
+			attempt = 0
+		}
+		reason := "session ended"
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Printf("%sSession dropped: %s", prefix, reason)
+
+		for {
+			if p.attempts != reconnectUnlimited && attempt >= p.attempts {
+				log.Printf("%sGiving up after %d reconnect attempt(s)", prefix, attempt)
+				return err
+			}
+			attempt++
+			backoff := p.backoff(attempt)
+			log.Printf("%sReconnect attempt %d in %s", prefix, attempt, backoff)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			id, resolveErr := p.resolve(ctx)
+			if resolveErr != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				log.Printf("%sReconnect attempt %d failed to find the instance: %v", prefix, attempt, resolveErr)
+				err = resolveErr
+				continue
+			}
+			if id != instanceID {
+				log.Printf("%sInstance %s was replaced by %s", prefix, instanceID, id)
+				instanceID = id
+				if resolved != nil {
+					resolved(id)
+				}
+			}
+			break
+		}
+	}
+}
+
+// localPortHold keeps a reconnecting forward on one local port, so its
+// clients can connect again to the same address after a drop.
+type localPortHold struct {
+	// port is the local port the first session bound, once it has.
+	port int
+	// forwarder, with the native forwarder, keeps port's listener open
+	// between sessions.
+	forwarder *nativeForwarder
+}
+
+// sessionOptions returns the config and options of the forward's next
+// session: once a session has bound a local port, later ones reuse it
+// instead of letting the operating system choose again.
+func (h *localPortHold) sessionOptions(cfg Config, opts forwardOptions) (Config, forwardOptions) {
+	opts.LocalPortHold = h
+	if h.port != 0 {
+		cfg.LocalPort = h.port
+		opts.AutoLocalPort = false
+	}
+	return cfg, opts
+}
+
+func (h *localPortHold) Close() {
+	if h.forwarder != nil {
+		h.forwarder.Close()
+	}
+}
+
+// runForwardReconnecting runs one forward and, with opts.Reconnect set,
+// opens a new session whenever the current one drops.
+func runForwardReconnecting(ctx context.Context, cfg Config, client ssmSessionAPI, limiter *sessionLimiter, events *eventBus, opts forwardOptions) error {
+	if opts.Reconnect == nil {
+		return runForward(ctx, cfg, client, limiter, events, opts)
+	}
+	prefix := ""
+	if opts.Label != "" {
+		prefix = "[" + opts.Label + "] "
+	}
+	reconnecting := false
+	hold := &localPortHold{}
+	defer hold.Close()
+	return opts.Reconnect.run(ctx, opts.InstanceID, prefix, func(ctx context.Context, instanceID string) error {
+		forwardCfg, forwardOpts := hold.sessionOptions(cfg, opts)
+		forwardOpts.InstanceID = instanceID
+		// The startup budget only covers the first session.
+		if reconnecting {
+			forwardOpts.StartupDeadline = time.Time{}
+		}
+		reconnecting = true
+		return runForward(ctx, forwardCfg, client, limiter, events, forwardOpts)
+	}, func(instanceID string) {
+		events.Emit(lifecycleEvent{Type: eventInstanceResolved, Label: opts.Label, InstanceID: instanceID})
+	})
+}
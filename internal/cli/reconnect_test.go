@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func testReconnectPolicy(attempts int, resolve func(ctx context.Context) (string, error)) *reconnectPolicy {
+	return &reconnectPolicy{
+		attempts:       attempts,
+		initialBackoff: time.Millisecond,
+		maxBackoff:     4 * time.Millisecond,
+		stableAfter:    time.Hour,
+		resolve:        resolve,
+		now:            time.Now,
+	}
+}
+
+func TestReconnectPolicyFollowsReplacedInstance(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var forwarded, resolvedIDs []string
+	policy := testReconnectPolicy(reconnectUnlimited, func(context.Context) (string, error) { return "i-new", nil })
+	err := policy.run(ctx, "i-old", "", func(ctx context.Context, instanceID string) error {
+		forwarded = append(forwarded, instanceID)
+		if len(forwarded) == 3 {
+			cancel()
+			return nil
+		}
+		return errors.New("plugin exited")
+	}, func(instanceID string) { resolvedIDs = append(resolvedIDs, instanceID) })
+
+	if err != nil {
+		t.Fatalf("expected no error after Ctrl-C, got %v", err)
+	}
+	if want := []string{"i-old", "i-new", "i-new"}; !slices.Equal(forwarded, want) {
+		t.Errorf("expected %v, got %v", want, forwarded)
+	}
+	if !slices.Equal(resolvedIDs, []string{"i-new"}) {
+		t.Errorf("expected the replacement to be reported once, got %v", resolvedIDs)
+	}
+}
+
+func TestReconnectPolicyGivesUp(t *testing.T) {
+	t.Parallel()
+
+	dropped := errors.New("session dropped")
+	denied := errors.New("denied")
+	tests := []struct {
+		name      string
+		resolve   func(context.Context) (string, error)
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "forward keeps failing", resolve: func(context.Context) (string, error) { return "i-1", nil }, wantCalls: 3, wantErr: dropped},
+		{name: "instance lookup fails", resolve: func(context.Context) (string, error) { return "", denied }, wantCalls: 1, wantErr: denied},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			err := testReconnectPolicy(2, tt.resolve).run(context.Background(), "i-1", "", func(context.Context, string) error {
+				calls++
+				return dropped
+			}, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d forwards, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := &reconnectPolicy{initialBackoff: time.Second, maxBackoff: 30 * time.Second}
+	var got []time.Duration
+	for attempt := 1; attempt <= 7; attempt++ {
+		got = append(got, policy.backoff(attempt))
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestLocalPortHoldKeepsAutoAllocatedPort(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hold := &localPortHold{}
+	var ports []int
+	var auto []bool
+	policy := testReconnectPolicy(reconnectUnlimited, func(context.Context) (string, error) { return "i-0123", nil })
+	policy.run(ctx, "i-0123", "", func(ctx context.Context, instanceID string) error {
+		cfg, opts := hold.sessionOptions(Config{LocalPort: 54013}, forwardOptions{AutoLocalPort: true})
+		ports = append(ports, cfg.LocalPort)
+		auto = append(auto, opts.AutoLocalPort)
+		// Like runForward: the first session finds 54013 taken and binds
+		// another port, which it records in the hold.
+		if opts.AutoLocalPort {
+			cfg.LocalPort = 54020
+		}
+		opts.LocalPortHold.port = cfg.LocalPort
+		if len(ports) == 3 {
+			cancel()
+			return nil
+		}
+		return errors.New("plugin exited")
+	}, nil)
+
+	if want := []int{54013, 54020, 54020}; !slices.Equal(ports, want) {
+		t.Errorf("expected local ports %v, got %v", want, ports)
+	}
+	if want := []bool{true, false, false}; !slices.Equal(auto, want) {
+		t.Errorf("expected only the first session to choose its port, got %v", auto)
+	}
+}
+
+func TestConfigValidateReconnect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "off", cfg: Config{SSH: true}},
+		{name: "attempts", cfg: Config{Reconnect: 5}},
+		{name: "unlimited", cfg: Config{Reconnect: reconnectUnlimited}},
+		{name: "negative", cfg: Config{Reconnect: -2}, wantErr: ErrInvalidReconnect},
+		{name: "ssh", cfg: Config{Reconnect: 3, SSH: true}, wantErr: ErrReconnectWithSSH},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateReconnect(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// fakeSessionClient hands out numbered sessions.
+type fakeSessionClient struct {
+	mu         sync.Mutex
+	started    int
+	terminated []string
+}
+
+func (f *fakeSessionClient) StartSession(context.Context, *ssm.StartSessionInput, ...func(*ssm.Options)) (*ssm.StartSessionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started++
+	return &ssm.StartSessionOutput{SessionId: aws.String(fmt.Sprintf("session-%d", f.started))}, nil
+}
+
+func (f *fakeSessionClient) TerminateSession(_ context.Context, input *ssm.TerminateSessionInput, _ ...func(*ssm.Options)) (*ssm.TerminateSessionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.terminated = append(f.terminated, aws.ToString(input.SessionId))
+	return &ssm.TerminateSessionOutput{}, nil
+}
+
+// readGreeting connects to port until something answers and returns the
+// first line it sends. Right after a session starts, its plugin may not
+// listen yet, and the forwarder closes the client.
+func readGreeting(t *testing.T, port int) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		line, err := func() (string, error) {
+			conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			return bufio.NewReader(conn).ReadString('\n')
+		}()
+		if err == nil {
+			return strings.TrimSpace(line)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("local port %d did not answer: %v", port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunForwardReconnectingKeepsLocalPort(t *testing.T) {
+	t.Parallel()
+
+	port, err := allocateEphemeralPort()
+	if err != nil {
+		t.Fatalf("allocate port: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := newEventBus()
+	started, unsubscribe := events.Subscribe(16)
+	defer unsubscribe()
+
+	// Each session's plugin greets clients with its session number; the
+	// first one exits once it has served a client, as a dropped session.
+	var sessions atomic.Int32
+	startPlugin := func(ctx context.Context, localPort int) error {
+		session := sessions.Add(1)
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(conn, "session %d\n", session)
+			conn.Close()
+			if session == 1 {
+				return errors.New("plugin exited")
+			}
+		}
+	}
+
+	client := &fakeSessionClient{}
+	cfg := Config{LocalPort: port, RemoteHost: "db.internal", RemotePort: 5432, Forwarder: forwarderNative}
+	opts := forwardOptions{
+		InstanceID:    "i-0123",
+		AutoLocalPort: true,
+		Reconnect:     testReconnectPolicy(reconnectUnlimited, func(context.Context) (string, error) { return "i-0123", nil }),
+		StartPlugin:   startPlugin,
+	}
+	done := make(chan error, 1)
+	go func() { done <- runForwardReconnecting(ctx, cfg, client, nil, events, opts) }()
+
+	waitStarted := func() lifecycleEvent {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-started:
+				if event.Type == eventSessionStarted {
+					return event
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for a session to start")
+			}
+		}
+	}
+	if event := waitStarted(); event.LocalPort != port {
+		t.Fatalf("expected the first session on local port %d, got %d", port, event.LocalPort)
+	}
+	if got := readGreeting(t, port); got != "session 1" {
+		t.Fatalf("expected the first session to answer, got %q", got)
+	}
+	if event := waitStarted(); event.LocalPort != port {
+		t.Fatalf("expected the reconnected session on local port %d, got %d", port, event.LocalPort)
+	}
+	if got := readGreeting(t, port); got != "session 2" {
+		t.Errorf("expected the reconnected session to answer on the same port, got %q", got)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward did not stop")
+	}
+	if _, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+		t.Errorf("expected local port %d to be closed once the forward stopped", port)
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if want := []string{"session-1", "session-2"}; !slices.Equal(client.terminated, want) {
+		t.Errorf("expected sessions %v to be terminated, got %v", want, client.terminated)
+	}
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// regionStopTimeout is how long a region's process gets to close its
+// session after being asked to stop.
+const regionStopTimeout = 10 * time.Second
+
+var (
+	ErrMultiRegionRequiresLocalPort = errors.New("several regions require --local-port")
+	ErrMultiRegionWithSSH           = errors.New("several regions cannot be combined with --ssh")
+	ErrMultiRegionWithTaggedPorts   = errors.New("several regions cannot be combined with --forward-tagged-ports")
+	ErrMultiRegionWithEventsSocket  = errors.New("several regions cannot share --events-socket")
+	ErrMultiRegionWithSummaryFile   = errors.New("several regions cannot share --summary-file")
+	ErrMultiRegionWithSSMEndpoint   = errors.New("several regions cannot share --ssm-endpoint")
+	ErrDuplicateRegion              = errors.New("duplicate region")
+	ErrRegionFailed                 = errors.New("region failed")
+)
+
+// regionListFlag collects repeated --region flags into Config.Region as a
+// comma-separated list.
+type regionListFlag struct {
+	value *string
+	set   bool
+}
+
+func (f *regionListFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f *regionListFlag) Set(value string) error {
+	if f.set {
+		*f.value += "," + value
+	} else {
+		*f.value = value
+	}
+	f.set = true
+	return nil
+}
+
+// regions returns the regions to forward to; more than one runs a full
+// resolve and forward pipeline per region.
+func (c Config) regions() []string {
+	var regions []string
+	for _, region := range strings.Split(c.Region, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+func (c Config) validateRegions() error {
+	regions := c.regions()
+	if len(regions) < 2 {
+		return nil
+	}
+	seen := make(map[string]bool, len(regions))
+	for _, region := range regions {
+		if seen[region] {
+			return fmt.Errorf("%w: %q", ErrDuplicateRegion, region)
+		}
+		seen[region] = true
+	}
+	if c.SSH {
+		return ErrMultiRegionWithSSH
+	}
+	if c.ForwardTaggedPorts {
+		return ErrMultiRegionWithTaggedPorts
+	}
+	if strings.TrimSpace(c.SSMEndpoint) != "" {
+		return ErrMultiRegionWithSSMEndpoint
+	}
+	if c.LocalPort == 0 {
+		return ErrMultiRegionRequiresLocalPort
+	}
+	return nil
+}
+
+// regionLocalPort gives each region its own block of local ports, one per
+// forward, starting at --local-port.
+func regionLocalPort(cfg Config, index int) int {
+	return cfg.LocalPort + index*max(cfg.Count, 1)
+}
+
+// stripFlags removes the named flags and their values from args, using fs
+// to tell which flags take a value.
+func stripFlags(fs *flag.FlagSet, args []string, names ...string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(kept, args[i:]...)
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		takesValue := false
+		if f := fs.Lookup(name); f != nil && !hasValue {
+			boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+			takesValue = !ok || !boolFlag.IsBoolFlag()
+		}
+		end := i
+		if takesValue && i+1 < len(args) {
+			end = i + 1
+		}
+		strip := false
+		for _, n := range names {
+			strip = strip || n == name
+		}
+		if !strip {
+			kept = append(kept, args[i:end+1]...)
+		}
+		i = end
+	}
+	return kept
+}
+
+// regionArgs are the arguments of one region's process: the tool's own
+// arguments with the region, local port and a stdin instance ID replaced.
+func regionArgs(fs *flag.FlagSet, args []string, cfg Config, region string, index int) []string {
+	child := stripFlags(fs, args, "region", "local-port", "instance-id")
+	child = append(child, "--region", region, "--local-port", strconv.Itoa(regionLocalPort(cfg, index)))
+	if id := strings.TrimSpace(cfg.InstanceID); id != "" {
+		child = append(child, "--instance-id", id)
+	}
+	return child
+}
+
+// prefixWriter writes every line to out with prefix in front.
+type prefixWriter struct {
+	mu      *sync.Mutex
+	out     io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		line, rest, ok := bytes.Cut(w.partial, []byte("\n"))
+		if !ok {
+			break
+		}
+		if _, err := fmt.Fprintf(w.out, "%s%s\n", w.prefix, line); err != nil {
+			return 0, err
+		}
+		w.partial = rest
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		fmt.Fprintf(w.out, "%s%s\n", w.prefix, w.partial)
+		w.partial = nil
+	}
+}
+
+// runRegions runs the tool once per region, concurrently, with each line
+// of output labeled by region, and reports how each region ended.
+func runRegions(ctx context.Context, executable string, args func(region string, index int) []string, regions []string, stdout, stderr io.Writer) error {
+	var mu sync.Mutex
+	errs := make([]error, len(regions))
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prefix := "[" + region + "] "
+			out := &prefixWriter{mu: &mu, out: stdout, prefix: prefix}
+			errOut := &prefixWriter{mu: &mu, out: stderr, prefix: prefix}
+			cmd := exec.CommandContext(ctx, executable, args(region, i)...)
+			cmd.Stdout, cmd.Stderr = out, errOut
+			cmd.Cancel = func() error { return interruptProcess(cmd.Process) }
+			cmd.WaitDelay = regionStopTimeout
+			errs[i] = cmd.Run()
+			out.Flush()
+			errOut.Flush()
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, region := range regions {
+		if errs[i] != nil && ctx.Err() == nil {
+			fmt.Fprintf(stderr, "Region %s failed: %v\n", region, errs[i])
+			failed = append(failed, fmt.Errorf("%w: %s: %v", ErrRegionFailed, region, errs[i]))
+			continue
+		}
+		fmt.Fprintf(stderr, "Region %s finished\n", region)
+	}
+	return errors.Join(failed...)
+}
+
+// interruptProcess asks a region's process to shut down cleanly so it
+// terminates its session. Windows has no interrupt to send to another
+// process, so it is killed there.
+func interruptProcess(process *os.Process) error {
+	if runtime.GOOS == "windows" {
+		return process.Kill()
+	}
+	return process.Signal(os.Interrupt)
+}
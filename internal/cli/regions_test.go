@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegionListFlag(t *testing.T) {
+	t.Parallel()
+
+	var region string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&regionListFlag{value: &region}, "region", "")
+	if err := fs.Parse([]string{"--region", "us-east-1", "--region=eu-west-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := Config{Region: region}.regions()
+	if want := []string{"us-east-1", "eu-west-1"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := (Config{Region: " us-east-1 , ap-south-1,"}).regions(); !slices.Equal(got, []string{"us-east-1", "ap-south-1"}) {
+		t.Errorf("expected comma-separated regions to be split, got %v", got)
+	}
+}
+
+func TestValidateRegions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "single region", cfg: Config{Region: "us-east-1", SSH: true}},
+		{name: "several regions", cfg: Config{Region: "us-east-1,eu-west-1", LocalPort: 5432}},
+		{name: "duplicate", cfg: Config{Region: "us-east-1,us-east-1", LocalPort: 5432}, wantErr: ErrDuplicateRegion},
+		{name: "no local port", cfg: Config{Region: "us-east-1,eu-west-1", LocalPortRange: "6000-6100"}, wantErr: ErrMultiRegionRequiresLocalPort},
+		{name: "ssh", cfg: Config{Region: "us-east-1,eu-west-1", SSH: true}, wantErr: ErrMultiRegionWithSSH},
+		{name: "tagged ports", cfg: Config{Region: "us-east-1,eu-west-1", ForwardTaggedPorts: true}, wantErr: ErrMultiRegionWithTaggedPorts},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateRegions(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRegionArgs(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("region", "", "")
+	fs.Int("local-port", 0, "")
+	fs.String("instance-id", "", "")
+	fs.String("session-reason", "", "")
+	fs.Bool("open", false, "")
+
+	args := []string{"-region", "us-east-1", "--open", "--session-reason", "--region", "--local-port=5432", "--instance-id", "-", "--region=eu-west-1"}
+	cfg := Config{LocalPort: 5432, Count: 2, InstanceID: "i-0123456789abcdef0"}
+	got := regionArgs(fs, args, cfg, "eu-west-1", 1)
+	want := []string{"--open", "--session-reason", "--region", "--region", "eu-west-1", "--local-port", "5434", "--instance-id", "i-0123456789abcdef0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	t.Parallel()
+
+	var out strings.Builder
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "[us-east-1] "}
+	w.Write([]byte("Port forwarding "))
+	w.Write([]byte("session started.\nPress Ctrl-C"))
+	w.Flush()
+	want := "[us-east-1] Port forwarding session started.\n[us-east-1] Press Ctrl-C\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
+
+func TestRunRegions(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	args := func(region string, _ int) []string {
+		if region == "eu-west-1" {
+			return []string{"-c", "echo denied >&2; exit 3"}
+		}
+		return []string{"-c", "echo started"}
+	}
+	var stdout, stderr strings.Builder
+	err := runRegions(context.Background(), "sh", args, []string{"us-east-1", "eu-west-1"}, &stdout, &stderr)
+	if !errors.Is(err, ErrRegionFailed) || !strings.Contains(err.Error(), "eu-west-1") || strings.Contains(err.Error(), "us-east-1") {
+		t.Fatalf("expected only eu-west-1 to fail, got %v", err)
+	}
+	if stdout.String() != "[us-east-1] started\n" {
+		t.Errorf("expected labeled output, got %q", stdout.String())
+	}
+	for _, want := range []string{"[eu-west-1] denied\n", "Region us-east-1 finished\n", "Region eu-west-1 failed: exit status 3\n"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("expected %q in %q", want, stderr.String())
+		}
+	}
+}
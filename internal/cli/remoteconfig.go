@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+const (
+	remoteConfigTimeout         = 10 * time.Second
+	maxRemoteConfigResponseSize = 1 << 20
+)
+
+var (
+	ErrInvalidRemoteConfigURL    = errors.New("invalid remote config url")
+	ErrInvalidRemoteConfigHeader = errors.New("invalid remote config header")
+	ErrRemoteConfigFailed        = errors.New("remote config request failed")
+	ErrInvalidRemoteConfig       = errors.New("invalid remote config")
+)
+
+// remoteConfigSource describes where the base configuration is fetched
+// from. With a CacheTTL the last response is reused for that long.
+type remoteConfigSource struct {
+	URL      string
+	Header   http.Header
+	CacheTTL time.Duration
+	CacheDir string
+}
+
+func validateRemoteConfigURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRemoteConfigURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: %q (want http:// or https:// URL)", ErrInvalidRemoteConfigURL, value)
+	}
+	return nil
+}
+
+// parseRemoteConfigHeaders parses --remote-config-header values. Environment
+// variables in the values are expanded, so tokens stay out of shell history.
+func parseRemoteConfigHeaders(values []string) (http.Header, error) {
+	expanded := make([]string, len(values))
+	for i, value := range values {
+		expanded[i] = os.ExpandEnv(value)
+	}
+	return parseHTTPHeaders(expanded, ErrInvalidRemoteConfigHeader)
+}
+
+// remoteConfigCachePath names the cache file of a remote config URL.
+func remoteConfigCachePath(dir, configURL string) string {
+	sum := sha256.Sum256([]byte(configURL))
+	return filepath.Join(dir, "remote-config-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// parseRemoteConfig turns a JSON config document into INI sections. Top-level
+// keys are [settings] keys; a key holding an object is a section of its own,
+// such as service_ports. Lists are joined with commas.
+func parseRemoteConfig(data []byte) (*ini.File, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRemoteConfig, err)
+	}
+
+	file := ini.Empty()
+	settings := file.Section("settings")
+	for key, value := range document {
+		if object, ok := value.(map[string]any); ok {
+			section := file.Section(key)
+			for name, value := range object {
+				if err := setRemoteConfigKey(section, name, value); err != nil {
+					return nil, fmt.Errorf("%w: %s.%s: %v", ErrInvalidRemoteConfig, key, name, err)
+				}
+			}
+			continue
+		}
+		if err := setRemoteConfigKey(settings, key, value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidRemoteConfig, key, err)
+		}
+	}
+	return file, nil
+}
+
+func setRemoteConfigKey(section *ini.Section, name string, value any) error {
+	text, err := remoteConfigValue(value)
+	if err != nil {
+		return err
+	}
+	_, err = section.NewKey(name, text)
+	return err
+}
+
+func remoteConfigValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprintf("%t", v), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, err := remoteConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := item.([]any); nested {
+				return "", errors.New("nested lists are not supported")
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// loadRemoteConfig fetches the base configuration document, from the cache
+// when it is fresh enough.
+func loadRemoteConfig(ctx context.Context, client *http.Client, source remoteConfigSource) (*ini.File, error) {
+	cachePath := ""
+	if source.CacheTTL > 0 && source.CacheDir != "" {
+		cachePath = remoteConfigCachePath(source.CacheDir, source.URL)
+		if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < source.CacheTTL {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				if file, err := parseRemoteConfig(data); err == nil {
+					return file, nil
+				}
+			}
+		}
+	}
+
+	data, err := fetchRemoteConfig(ctx, client, source)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseRemoteConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if cachePath != "" {
+		if err := writeRemoteConfigCache(cachePath, data); err != nil {
+			log.Printf("Failed to cache remote configuration: %v", err)
+		}
+	}
+	return file, nil
+}
+
+func fetchRemoteConfig(ctx context.Context, client *http.Client, source remoteConfigSource) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRemoteConfigURL, err)
+	}
+	for name, values := range source.Header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRemoteConfigFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: GET %s: %s", ErrRemoteConfigFailed, source.URL, response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxRemoteConfigResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRemoteConfigFailed, err)
+	}
+	return data, nil
+}
+
+func writeRemoteConfigCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRemoteConfig(t *testing.T) {
+	t.Parallel()
+
+	file, err := parseRemoteConfig([]byte(`{
+		"profile": "prod",
+		"region": "eu-west-1",
+		"local_port": 5432,
+		"keepalive_roundtrip": true,
+		"require_tags": ["Owner", "Team"],
+		"service_ports": {"warehouse": 5439}
+	}`))
+	if err != nil {
+		t.Fatalf("parseRemoteConfig() unexpected error: %v", err)
+	}
+	cfg, err := configFromINI(file)
+	if err != nil {
+		t.Fatalf("configFromINI() unexpected error: %v", err)
+	}
+	if cfg.Profile != "prod" || cfg.Region != "eu-west-1" || cfg.LocalPort != 5432 || !cfg.KeepAliveRoundTrip {
+		t.Fatalf("unexpected config: %+v", *cfg)
+	}
+	if len(cfg.RequireTags) != 2 || cfg.RequireTags[0] != "Owner" || cfg.RequireTags[1] != "Team" {
+		t.Fatalf("expected [Owner Team], got %v", cfg.RequireTags)
+	}
+	if cfg.ServicePorts["warehouse"] != 5439 {
+		t.Fatalf("expected warehouse port 5439, got %v", cfg.ServicePorts)
+	}
+
+	for _, document := range []string{`[]`, `{"profile": null}`, `{"require_tags": [["a"]]}`, `{"profile"`} {
+		if _, err := parseRemoteConfig([]byte(document)); !errors.Is(err, ErrInvalidRemoteConfig) {
+			t.Fatalf("%s: expected %v, got %v", document, ErrInvalidRemoteConfig, err)
+		}
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	t.Parallel()
+
+	base, err := parseRemoteConfig([]byte(`{"profile": "org-default", "region": "eu-west-1", "remote_port": 5432}`))
+	if err != nil {
+		t.Fatalf("parseRemoteConfig() unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "forward.ini")
+	if err := os.WriteFile(path, []byte("[settings]\nprofile = mine\nlocal_port = 15432\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg, err := loadConfigLayers(base, path)
+	if err != nil {
+		t.Fatalf("loadConfigLayers() unexpected error: %v", err)
+	}
+	if cfg.Profile != "mine" || cfg.Region != "eu-west-1" || cfg.RemotePort != 5432 || cfg.LocalPort != 15432 {
+		t.Fatalf("expected file over remote layer, got %+v", *cfg)
+	}
+}
+
+func TestLoadRemoteConfig(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"profile": "prod"}`))
+	}))
+	defer server.Close()
+
+	header, err := parseRemoteConfigHeaders([]string{"Authorization: Bearer secret"})
+	if err != nil {
+		t.Fatalf("parseRemoteConfigHeaders() unexpected error: %v", err)
+	}
+	source := remoteConfigSource{URL: server.URL, Header: header, CacheTTL: time.Hour, CacheDir: t.TempDir()}
+	for i := 0; i < 2; i++ {
+		file, err := loadRemoteConfig(context.Background(), server.Client(), source)
+		if err != nil {
+			t.Fatalf("loadRemoteConfig() unexpected error: %v", err)
+		}
+		if got := file.Section("settings").Key("profile").String(); got != "prod" {
+			t.Fatalf("expected prod, got %q", got)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("expected the cached document to be reused, got %d requests", got)
+	}
+
+	source = remoteConfigSource{URL: server.URL}
+	if _, err := loadRemoteConfig(context.Background(), server.Client(), source); !errors.Is(err, ErrRemoteConfigFailed) {
+		t.Fatalf("expected %v, got %v", ErrRemoteConfigFailed, err)
+	}
+}
+
+func TestRemoteConfigOptions(t *testing.T) {
+	t.Parallel()
+
+	if err := validateRemoteConfigURL("ftp://config.internal/awsfwd.json"); !errors.Is(err, ErrInvalidRemoteConfigURL) {
+		t.Fatalf("expected %v, got %v", ErrInvalidRemoteConfigURL, err)
+	}
+	if err := validateRemoteConfigURL("https://config.internal/awsfwd.json"); err != nil {
+		t.Fatalf("validateRemoteConfigURL() unexpected error: %v", err)
+	}
+	if _, err := parseRemoteConfigHeaders([]string{"no colon"}); !errors.Is(err, ErrInvalidRemoteConfigHeader) {
+		t.Fatalf("expected %v, got %v", ErrInvalidRemoteConfigHeader, err)
+	}
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	resolverTimeout         = 10 * time.Second
+	maxResolverResponseSize = 1 << 20
+)
+
+var (
+	ErrResolverWithInstanceSelector = errors.New("resolver url cannot be combined with instance name, tags or instance id")
+	ErrInvalidResolverURL           = errors.New("invalid resolver url")
+	ErrInvalidResolverHeader        = errors.New("invalid resolver header")
+	ErrResolverFailed               = errors.New("resolver request failed")
+	ErrInvalidResolverResponse      = errors.New("invalid resolver response")
+)
+
+var instanceIDPattern = regexp.MustCompile(`^i-[0-9a-f]{8,17}$`)
+
+type resolverRequest struct {
+	Env     string `json:"env,omitempty"`
+	Region  string `json:"region"`
+	Service string `json:"service,omitempty"`
+	Profile string `json:"profile"`
+}
+
+type resolverResponse struct {
+	InstanceID string `json:"instance_id"`
+	RemoteHost string `json:"remote_host,omitempty"`
+	RemotePort int    `json:"remote_port,omitempty"`
+}
+
+func newResolverRequest(cfg Config) resolverRequest {
+	return resolverRequest{
+		Env:     cfg.ResolverEnv,
+		Region:  cfg.Region,
+		Service: cfg.ResolverService,
+		Profile: cfg.Profile,
+	}
+}
+
+func validateResolverURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResolverURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: %q (want http:// or https:// URL)", ErrInvalidResolverURL, value)
+	}
+	return nil
+}
+
+func parseResolverHeaders(values []string) (http.Header, error) {
+	return parseHTTPHeaders(values, ErrInvalidResolverHeader)
+}
+
+// parseHTTPHeaders parses "Name: value" flag values, reporting a malformed
+// one as errInvalid.
+func parseHTTPHeaders(values []string, errInvalid error) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		name, headerValue, found := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%w: %q (want \"Name: value\")", errInvalid, value)
+		}
+		header.Add(name, strings.TrimSpace(headerValue))
+	}
+	return header, nil
+}
+
+// queryResolver POSTs the selection criteria to a resolver endpoint and
+// returns the instance it chose.
+func queryResolver(ctx context.Context, client *http.Client, resolverURL string, header http.Header, request resolverRequest) (resolverResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return resolverResponse{}, fmt.Errorf("failed to marshal resolver request: %w", err)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, resolverURL, bytes.NewReader(body))
+	if err != nil {
+		return resolverResponse{}, fmt.Errorf("%w: %v", ErrInvalidResolverURL, err)
+	}
+	for name, values := range header {
+		httpRequest.Header[name] = values
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept", "application/json")
+
+	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		return resolverResponse{}, fmt.Errorf("%w: %v", ErrResolverFailed, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return resolverResponse{}, fmt.Errorf("%w: %s", ErrResolverFailed, httpResponse.Status)
+	}
+
+	var response resolverResponse
+	if err := json.NewDecoder(io.LimitReader(httpResponse.Body, maxResolverResponseSize)).Decode(&response); err != nil {
+		return resolverResponse{}, fmt.Errorf("%w: %v", ErrInvalidResolverResponse, err)
+	}
+	if !isTargetID(response.InstanceID) {
+		return resolverResponse{}, fmt.Errorf("%w: instance id %q", ErrInvalidResolverResponse, response.InstanceID)
+	}
+	if response.RemotePort < 0 || response.RemotePort > 65535 {
+		return resolverResponse{}, fmt.Errorf("%w: remote port %d", ErrInvalidResolverResponse, response.RemotePort)
+	}
+	return response, nil
+}
+
+// applyResolverResponse selects the resolved instance. A remote host or
+// port set on the command line or in the config file takes precedence.
+func applyResolverResponse(cfg Config, response resolverResponse) (Config, error) {
+	cfg.InstanceID = response.InstanceID
+	if strings.TrimSpace(cfg.RemoteHost) == "" {
+		cfg.RemoteHost = response.RemoteHost
+	}
+	if cfg.RemotePort == 0 {
+		cfg.RemotePort = response.RemotePort
+	}
+	if cfg.SSH {
+		return cfg, nil
+	}
+	if err := cfg.validateRemote(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseResolverHeaders(t *testing.T) {
+	t.Parallel()
+
+	header, err := parseResolverHeaders([]string{"Authorization: Bearer abc", "X-Team:platform"})
+	if err != nil {
+		t.Fatalf("parseResolverHeaders() unexpected error: %v", err)
+	}
+	if got := header.Get("Authorization"); got != "Bearer abc" {
+		t.Fatalf("Authorization = %q, want %q", got, "Bearer abc")
+	}
+	if got := header.Get("X-Team"); got != "platform" {
+		t.Fatalf("X-Team = %q, want %q", got, "platform")
+	}
+
+	for _, value := range []string{"Authorization", ": value", "Bad Name: value"} {
+		if _, err := parseResolverHeaders([]string{value}); !errors.Is(err, ErrInvalidResolverHeader) {
+			t.Fatalf("parseResolverHeaders(%q): expected %v, got %v", value, ErrInvalidResolverHeader, err)
+		}
+	}
+}
+
+func TestQueryResolver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    resolverResponse
+		wantErr error
+	}{
+		{
+			name:   "instance with remote",
+			status: http.StatusOK,
+			body:   `{"instance_id":"i-0123456789abcdef0","remote_host":"db.internal","remote_port":5432}`,
+			want:   resolverResponse{InstanceID: "i-0123456789abcdef0", RemoteHost: "db.internal", RemotePort: 5432},
+		},
+		{name: "server error", status: http.StatusInternalServerError, body: `{}`, wantErr: ErrResolverFailed},
+		{name: "malformed json", status: http.StatusOK, body: `{`, wantErr: ErrInvalidResolverResponse},
+		{name: "bad instance id", status: http.StatusOK, body: `{"instance_id":"bastion"}`, wantErr: ErrInvalidResolverResponse},
+		{name: "bad remote port", status: http.StatusOK, body: `{"instance_id":"i-0123456789abcdef0","remote_port":70000}`, wantErr: ErrInvalidResolverResponse},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotRequest resolverRequest
+			var gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&gotRequest)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			header := http.Header{"Authorization": {"Bearer abc"}}
+			request := resolverRequest{Env: "prod", Region: "eu-west-1", Service: "billing", Profile: "dev"}
+			got, err := queryResolver(context.Background(), server.Client(), server.URL, header, request)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queryResolver() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("response = %+v, want %+v", got, tt.want)
+			}
+			if gotRequest != request {
+				t.Fatalf("request = %+v, want %+v", gotRequest, request)
+			}
+			if gotAuth != "Bearer abc" {
+				t.Fatalf("Authorization = %q, want %q", gotAuth, "Bearer abc")
+			}
+		})
+	}
+}
+
+func TestApplyResolverResponse(t *testing.T) {
+	t.Parallel()
+
+	response := resolverResponse{InstanceID: "i-0123456789abcdef0", RemoteHost: "db.internal", RemotePort: 5432}
+
+	cfg, err := applyResolverResponse(Config{LocalPort: 5432}, response)
+	if err != nil {
+		t.Fatalf("applyResolverResponse() unexpected error: %v", err)
+	}
+	if cfg.InstanceID != response.InstanceID || cfg.RemoteHost != "db.internal" || cfg.RemotePort != 5432 {
+		t.Fatalf("config = %+v, want resolved instance and remote", cfg)
+	}
+
+	cfg, err = applyResolverResponse(Config{LocalPort: 5432, RemoteHost: "replica.internal"}, response)
+	if err != nil {
+		t.Fatalf("applyResolverResponse() unexpected error: %v", err)
+	}
+	if cfg.RemoteHost != "replica.internal" {
+		t.Fatalf("RemoteHost = %q, want %q", cfg.RemoteHost, "replica.internal")
+	}
+
+	if _, err := applyResolverResponse(Config{LocalPort: 5432}, resolverResponse{InstanceID: response.InstanceID}); !errors.Is(err, ErrMissingRemoteHost) {
+		t.Fatalf("expected %v, got %v", ErrMissingRemoteHost, err)
+	}
+}
+
+func TestConfigValidateResolver(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", ResolverURL: "https://bastions.example.com/resolve", LocalPort: 5432}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	withName := cfg
+	withName.InstanceName = "bastion"
+	if err := withName.Validate(); !errors.Is(err, ErrResolverWithInstanceSelector) {
+		t.Fatalf("expected %v, got %v", ErrResolverWithInstanceSelector, err)
+	}
+
+	badURL := cfg
+	badURL.ResolverURL = "bastions.example.com"
+	if err := badURL.Validate(); !errors.Is(err, ErrInvalidResolverURL) {
+		t.Fatalf("expected %v, got %v", ErrInvalidResolverURL, err)
+	}
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	selectLatest = "latest"
+	selectPrompt = "prompt"
+)
+
+var (
+	ErrInvalidSelect          = errors.New("invalid select")
+	ErrSelectWithAny          = errors.New("select cannot be combined with --any")
+	ErrSelectPromptWithSSH    = errors.New("select prompt cannot be combined with --ssh")
+	ErrSelectPromptNoTerminal = errors.New("select prompt needs a terminal")
+	ErrInvalidInstanceChoice  = errors.New("invalid instance choice")
+)
+
+// instanceMatch is a running instance whose Name tag matched, with what is
+// shown to tell several matches apart.
+type instanceMatch struct {
+	ID               string
+	PrivateIP        string
+	AvailabilityZone string
+	LaunchTime       time.Time
+}
+
+func newInstanceMatch(instance types.Instance) instanceMatch {
+	match := instanceMatch{
+		ID:         aws.ToString(instance.InstanceId),
+		PrivateIP:  aws.ToString(instance.PrivateIpAddress),
+		LaunchTime: aws.ToTime(instance.LaunchTime),
+	}
+	if instance.Placement != nil {
+		match.AvailabilityZone = aws.ToString(instance.Placement.AvailabilityZone)
+	}
+	return match
+}
+
+func (m instanceMatch) String() string {
+	launched := "unknown launch time"
+	if !m.LaunchTime.IsZero() {
+		launched = "launched " + m.LaunchTime.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s (%s, %s, %s)", m.ID, cmp.Or(m.PrivateIP, "no private IP"), cmp.Or(m.AvailabilityZone, "unknown AZ"), launched)
+}
+
+// sortMatches orders matches newest first, then by ID.
+func sortMatches(matches []instanceMatch) {
+	slices.SortStableFunc(matches, func(a, b instanceMatch) int {
+		if c := b.LaunchTime.Compare(a.LaunchTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+func ambiguousInstanceName(filter instanceFilter, matches []instanceMatch) error {
+	sortMatches(matches)
+	listed := make([]string, len(matches))
+	for i, match := range matches {
+		listed[i] = match.String()
+	}
+	return fmt.Errorf("%w for %s: %s; pick one with --select latest, --select prompt, --any or --instance-id", ErrMultipleRunningInstances, filter, strings.Join(listed, ", "))
+}
+
+func (c Config) validateSelect(allowAny bool) error {
+	switch strings.ToLower(strings.TrimSpace(c.Select)) {
+	case "":
+		return nil
+	case selectLatest:
+	case selectPrompt:
+		if c.SSH {
+			return ErrSelectPromptWithSSH
+		}
+	default:
+		return fmt.Errorf("%w: %q (want %s or %s)", ErrInvalidSelect, c.Select, selectLatest, selectPrompt)
+	}
+	if allowAny {
+		return ErrSelectWithAny
+	}
+	return nil
+}
+
+// instanceChooser returns how to pick among several matches, or nil to
+// refuse an ambiguous name. Without --select the tool asks when it runs
+// on a terminal.
+func instanceChooser(cfg Config, in, out *os.File) func([]instanceMatch) (int, error) {
+	prompt := func(matches []instanceMatch) (int, error) {
+		if !isInteractive(in) {
+			return 0, ErrSelectPromptNoTerminal
+		}
+		return promptInstanceChoice(in, out, cfg.instanceFilter(), matches)
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Select)) {
+	case selectLatest:
+		return func([]instanceMatch) (int, error) { return 0, nil }
+	case selectPrompt:
+		return prompt
+	}
+	if cfg.SSH || cfg.Pipe || !isInteractive(in) || !isInteractive(out) {
+		return nil
+	}
+	return prompt
+}
+
+// selectInstanceByName resolves the name like getInstanceIDByName but lets
+// choose pick among several matches, which it gets newest first.
+func selectInstanceByName(ctx context.Context, client ec2DescribeInstancesAPI, filter instanceFilter, acceptStates []types.InstanceStateName, maxPages int, choose func([]instanceMatch) (int, error)) (string, error) {
+	matches, err := findInstancesByName(ctx, client, filter, acceptStates, maxPages, true)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 1 {
+		return matches[0].ID, nil
+	}
+	sortMatches(matches)
+	idx, err := choose(matches)
+	if err != nil {
+		return "", fmt.Errorf("failed to choose instance among %d matches: %w", len(matches), err)
+	}
+	if idx < 0 || idx >= len(matches) {
+		return "", fmt.Errorf("%w: %d for %d matches", ErrInvalidInstanceChoice, idx+1, len(matches))
+	}
+	return matches[idx].ID, nil
+}
+
+// promptInstanceChoice lists the matches and reads a number from in until
+// it names one of them.
+func promptInstanceChoice(in io.Reader, out io.Writer, filter instanceFilter, matches []instanceMatch) (int, error) {
+	fmt.Fprintf(out, "%d running instances match %s:\n", len(matches), filter)
+	for i, match := range matches {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, match)
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Choose an instance [1-%d]: ", len(matches))
+		line, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(matches) {
+			return n - 1, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, fmt.Errorf("%w: no choice made", ErrInvalidInstanceChoice)
+			}
+			return 0, err
+		}
+		fmt.Fprintf(out, "Enter a number between 1 and %d.\n", len(matches))
+	}
+}
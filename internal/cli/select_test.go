@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func matchingInstances() *ec2.DescribeInstancesOutput {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	instance := func(id, ip, az string, launched time.Time) ec2types.Instance {
+		return ec2types.Instance{
+			InstanceId:       aws.String(id),
+			PrivateIpAddress: aws.String(ip),
+			Placement:        &ec2types.Placement{AvailabilityZone: aws.String(az)},
+			LaunchTime:       aws.Time(launched),
+			State:            &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning},
+		}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+		instance("i-old", "10.0.0.1", "us-east-1a", base),
+		instance("i-new", "10.0.0.2", "us-east-1b", base.Add(time.Hour)),
+		instance("i-mid", "10.0.0.3", "us-east-1c", base.Add(time.Minute)),
+	}}}}
+}
+
+func TestSelectInstanceByName(t *testing.T) {
+	t.Parallel()
+
+	latest := func([]instanceMatch) (int, error) { return 0, nil }
+	tests := []struct {
+		name    string
+		output  *ec2.DescribeInstancesOutput
+		choose  func([]instanceMatch) (int, error)
+		want    string
+		wantErr error
+	}{
+		{name: "latest", output: matchingInstances(), choose: latest, want: "i-new"},
+		{name: "second newest", output: matchingInstances(), choose: func([]instanceMatch) (int, error) { return 1, nil }, want: "i-mid"},
+		{name: "out of range", output: matchingInstances(), choose: func([]instanceMatch) (int, error) { return 3, nil }, wantErr: ErrInvalidInstanceChoice},
+		{
+			name: "single match skips the choice",
+			output: &ec2.DescribeInstancesOutput{Reservations: []ec2types.Reservation{{Instances: []ec2types.Instance{
+				{InstanceId: aws.String("i-only"), State: &ec2types.InstanceState{Name: ec2types.InstanceStateNameRunning}},
+			}}}},
+			choose: func([]instanceMatch) (int, error) { return 0, errors.New("unexpected choice") },
+			want:   "i-only",
+		},
+		{name: "no match", output: &ec2.DescribeInstancesOutput{}, choose: latest, wantErr: ErrNoRunningInstances},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := selectInstanceByName(context.Background(), &fakeEC2Client{output: tt.output}, instanceFilter{Name: "bastion"}, defaultAcceptStates, 0, tt.choose)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAmbiguousInstanceNameListsMatches(t *testing.T) {
+	t.Parallel()
+
+	_, err := getInstanceIDByName(context.Background(), &fakeEC2Client{output: matchingInstances()}, instanceFilter{Name: "bastion"}, false, defaultAcceptStates, 0, randomIndex)
+	if !errors.Is(err, ErrMultipleRunningInstances) {
+		t.Fatalf("expected %v, got %v", ErrMultipleRunningInstances, err)
+	}
+	for _, want := range []string{`"bastion"`, "i-new (10.0.0.2, us-east-1b, launched 2024-05-01T01:00:00Z)", "i-old (10.0.0.1, us-east-1a", "--select latest"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err.Error())
+		}
+	}
+}
+
+func TestPromptInstanceChoice(t *testing.T) {
+	t.Parallel()
+
+	matches := []instanceMatch{{ID: "i-new"}, {ID: "i-old"}}
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr error
+	}{
+		{name: "valid", input: "2\n", want: 1},
+		{name: "retries after invalid input", input: "9\nabc\n1\n", want: 0},
+		{name: "last line without newline", input: "2", want: 1},
+		{name: "no input", input: "", wantErr: ErrInvalidInstanceChoice},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out strings.Builder
+			got, err := promptInstanceChoice(strings.NewReader(tt.input), &out, instanceFilter{Name: "bastion"}, matches)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+			if !strings.Contains(out.String(), "  2) i-old (") {
+				t.Errorf("expected the matches to be listed, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestValidateSelect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		allowAny bool
+		wantErr  error
+	}{
+		{name: "unset", cfg: Config{}, allowAny: true},
+		{name: "latest", cfg: Config{Select: "Latest"}},
+		{name: "prompt", cfg: Config{Select: selectPrompt}},
+		{name: "unknown", cfg: Config{Select: "newest"}, wantErr: ErrInvalidSelect},
+		{name: "with any", cfg: Config{Select: selectLatest}, allowAny: true, wantErr: ErrSelectWithAny},
+		{name: "prompt with ssh", cfg: Config{Select: selectPrompt, SSH: true}, wantErr: ErrSelectPromptWithSSH},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.cfg.validateSelect(tt.allowAny); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+const (
+	installServiceCommand   = "install-service"
+	uninstallServiceCommand = "uninstall-service"
+	defaultServiceName      = "default"
+	launchdLabelPrefix      = "com.github.esoel.aws-go-forward."
+)
+
+var (
+	ErrMissingServiceConfig   = errors.New("install-service requires --config")
+	ErrInvalidServiceName     = errors.New("invalid service name")
+	ErrUnsupportedServiceHost = errors.New("services are not supported on this operating system")
+)
+
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// serviceSpec describes one persistent tunnel: the tool started on login
+// with a config file.
+type serviceSpec struct {
+	Name       string
+	Executable string
+	ConfigFile string
+	LogFile    string
+}
+
+func (s serviceSpec) id() string {
+	return "aws-go-forward-" + s.Name
+}
+
+// serviceHost installs service definitions for one operating system. run
+// executes the platform service manager.
+type serviceHost struct {
+	goos string
+	home string
+	uid  int
+	run  func(name string, args ...string) error
+}
+
+func (h serviceHost) definitionPath(spec serviceSpec) (string, error) {
+	switch h.goos {
+	case "linux":
+		return filepath.Join(h.home, ".config", "systemd", "user", spec.id()+".service"), nil
+	case "darwin":
+		return filepath.Join(h.home, "Library", "LaunchAgents", launchdLabelPrefix+spec.Name+".plist"), nil
+	case "windows":
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedServiceHost, h.goos)
+	}
+}
+
+func (h serviceHost) defaultLogFile(spec serviceSpec) string {
+	switch h.goos {
+	case "darwin":
+		return filepath.Join(h.home, "Library", "Logs", spec.id()+".log")
+	case "windows":
+		return filepath.Join(h.home, "AppData", "Local", "aws-go-forward", spec.id()+".log")
+	default:
+		// systemd sends output to the journal.
+		return ""
+	}
+}
+
+func systemdUnit(spec serviceSpec) string {
+	return fmt.Sprintf(`[Unit]
+Description=aws-go-forward tunnel %s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s --config %s
+Restart=on-failure
+RestartSec=10
+
+[Install]
+WantedBy=default.target
+`, spec.Name, systemdQuote(spec.Executable), systemdQuote(spec.ConfigFile))
+}
+
+func systemdQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(value) + `"`
+}
+
+func launchdPlist(spec serviceSpec) string {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>--config</string>
+		<string>%s</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, escape(launchdLabelPrefix+spec.Name), escape(spec.Executable), escape(spec.ConfigFile), escape(spec.LogFile), escape(spec.LogFile))
+}
+
+// windowsTaskCommand is the command line of the logon task. cmd.exe does
+// the log redirection, which Task Scheduler cannot do itself.
+func windowsTaskCommand(spec serviceSpec) string {
+	return fmt.Sprintf(`cmd.exe /c ""%s" --config "%s" >> "%s" 2>&1"`, spec.Executable, spec.ConfigFile, spec.LogFile)
+}
+
+func (h serviceHost) install(spec serviceSpec, out io.Writer) error {
+	if spec.LogFile == "" {
+		spec.LogFile = h.defaultLogFile(spec)
+	}
+	path, err := h.definitionPath(spec)
+	if err != nil {
+		return err
+	}
+	if spec.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(spec.LogFile), 0o755); err != nil {
+			return err
+		}
+	}
+
+	switch h.goos {
+	case "linux":
+		if err := writeServiceFile(path, systemdUnit(spec)); err != nil {
+			return err
+		}
+		if err := h.run("systemctl", "--user", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := h.run("systemctl", "--user", "enable", "--now", spec.id()+".service"); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Installed systemd user unit %s; logs: journalctl --user -u %s\n", path, spec.id())
+	case "darwin":
+		if err := writeServiceFile(path, launchdPlist(spec)); err != nil {
+			return err
+		}
+		if err := h.run("launchctl", "bootstrap", fmt.Sprintf("gui/%d", h.uid), path); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Installed launchd agent %s; logs: %s\n", path, spec.LogFile)
+	case "windows":
+		if err := h.run("schtasks", "/Create", "/F", "/SC", "ONLOGON", "/RL", "LIMITED", "/TN", spec.id(), "/TR", windowsTaskCommand(spec)); err != nil {
+			return err
+		}
+		if err := h.run("schtasks", "/Run", "/TN", spec.id()); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Installed logon task %s; logs: %s\n", spec.id(), spec.LogFile)
+	}
+	return nil
+}
+
+func (h serviceHost) uninstall(spec serviceSpec, out io.Writer) error {
+	path, err := h.definitionPath(spec)
+	if err != nil {
+		return err
+	}
+
+	switch h.goos {
+	case "linux":
+		if err := h.run("systemctl", "--user", "disable", "--now", spec.id()+".service"); err != nil {
+			return err
+		}
+		if err := removeServiceFile(path); err != nil {
+			return err
+		}
+		if err := h.run("systemctl", "--user", "daemon-reload"); err != nil {
+			return err
+		}
+	case "darwin":
+		if err := h.run("launchctl", "bootout", fmt.Sprintf("gui/%d/%s", h.uid, launchdLabelPrefix+spec.Name)); err != nil {
+			return err
+		}
+		if err := removeServiceFile(path); err != nil {
+			return err
+		}
+	case "windows":
+		if err := h.run("schtasks", "/End", "/TN", spec.id()); err != nil {
+			fmt.Fprintf(out, "Task %s was not running: %v\n", spec.id(), err)
+		}
+		if err := h.run("schtasks", "/Delete", "/F", "/TN", spec.id()); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Uninstalled %s\n", spec.id())
+	return nil
+}
+
+func writeServiceFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+func removeServiceFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func runServiceCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// runServiceSubcommand handles install-service and uninstall-service. It
+// reports whether args selected one of them.
+func runServiceSubcommand(args []string, out io.Writer) (bool, error) {
+	if len(args) < 2 || (args[1] != installServiceCommand && args[1] != uninstallServiceCommand) {
+		return false, nil
+	}
+
+	fs := flag.NewFlagSet(args[1], flag.ContinueOnError)
+	var spec serviceSpec
+	fs.StringVar(&spec.Name, "name", defaultServiceName, "Service name, to install several tunnels side by side")
+	if args[1] == installServiceCommand {
+		fs.StringVar(&spec.ConfigFile, "config", "", "Path to the configuration file the service runs with")
+		fs.StringVar(&spec.LogFile, "log-file", "", "Log file (default: the journal on Linux, ~/Library/Logs on macOS, %LOCALAPPDATA%\\aws-go-forward on Windows)")
+	}
+	if err := fs.Parse(args[2:]); err != nil {
+		return true, err
+	}
+	if !serviceNamePattern.MatchString(spec.Name) {
+		return true, fmt.Errorf("%w: %q", ErrInvalidServiceName, spec.Name)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return true, err
+	}
+	host := serviceHost{goos: runtime.GOOS, home: home, uid: os.Getuid(), run: runServiceCommand}
+
+	if args[1] == uninstallServiceCommand {
+		return true, host.uninstall(spec, out)
+	}
+
+	if spec.ConfigFile == "" {
+		return true, ErrMissingServiceConfig
+	}
+	if spec.ConfigFile, err = filepath.Abs(spec.ConfigFile); err != nil {
+		return true, err
+	}
+	if _, err := loadConfigFromFile(spec.ConfigFile); err != nil {
+		return true, fmt.Errorf("failed to load configuration file: %w", err)
+	}
+	if spec.Executable, err = os.Executable(); err != nil {
+		return true, err
+	}
+	return true, host.install(spec, out)
+}
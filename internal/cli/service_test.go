@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type recordedCommands [][]string
+
+func (r *recordedCommands) run(name string, args ...string) error {
+	*r = append(*r, append([]string{name}, args...))
+	return nil
+}
+
+func TestServiceHostInstallSystemd(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	var commands recordedCommands
+	host := serviceHost{goos: "linux", home: home, run: commands.run}
+	spec := serviceSpec{Name: "prod-db", Executable: "/usr/local/bin/aws-go-forward", ConfigFile: "/etc/tunnels/prod db.ini"}
+
+	if err := host.install(spec, io.Discard); err != nil {
+		t.Fatalf("install() unexpected error: %v", err)
+	}
+
+	unit, err := os.ReadFile(filepath.Join(home, ".config", "systemd", "user", "aws-go-forward-prod-db.service"))
+	if err != nil {
+		t.Fatalf("read unit: %v", err)
+	}
+	if want := `ExecStart="/usr/local/bin/aws-go-forward" --config "/etc/tunnels/prod db.ini"`; !strings.Contains(string(unit), want) {
+		t.Fatalf("unit = %q, want line %q", unit, want)
+	}
+	if len(commands) != 2 || strings.Join(commands[1], " ") != "systemctl --user enable --now aws-go-forward-prod-db.service" {
+		t.Fatalf("commands = %q, want daemon-reload then enable --now", commands)
+	}
+
+	commands = nil
+	if err := host.uninstall(spec, io.Discard); err != nil {
+		t.Fatalf("uninstall() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config", "systemd", "user", "aws-go-forward-prod-db.service")); !os.IsNotExist(err) {
+		t.Fatalf("unit still present after uninstall: %v", err)
+	}
+}
+
+func TestServiceHostInstallLaunchd(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	var commands recordedCommands
+	host := serviceHost{goos: "darwin", home: home, uid: 501, run: commands.run}
+	spec := serviceSpec{Name: "default", Executable: "/opt/homebrew/bin/aws-go-forward", ConfigFile: "/Users/dev/tunnel.ini"}
+
+	if err := host.install(spec, io.Discard); err != nil {
+		t.Fatalf("install() unexpected error: %v", err)
+	}
+
+	path := filepath.Join(home, "Library", "LaunchAgents", "com.github.esoel.aws-go-forward.default.plist")
+	plist, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read plist: %v", err)
+	}
+	logFile := filepath.Join(home, "Library", "Logs", "aws-go-forward-default.log")
+	for _, want := range []string{"<string>/Users/dev/tunnel.ini</string>", "<string>" + logFile + "</string>"} {
+		if !strings.Contains(string(plist), want) {
+			t.Fatalf("plist missing %q:\n%s", want, plist)
+		}
+	}
+	if got := strings.Join(commands[0], " "); got != "launchctl bootstrap gui/501 "+path {
+		t.Fatalf("command = %q, want launchctl bootstrap", got)
+	}
+}
+
+func TestServiceHostInstallWindows(t *testing.T) {
+	t.Parallel()
+
+	var commands recordedCommands
+	host := serviceHost{goos: "windows", home: t.TempDir(), run: commands.run}
+	spec := serviceSpec{Name: "default", Executable: `C:\Tools\aws-go-forward.exe`, ConfigFile: `C:\Users\dev\tunnel.ini`, LogFile: filepath.Join(t.TempDir(), "tunnel.log")}
+
+	if err := host.install(spec, io.Discard); err != nil {
+		t.Fatalf("install() unexpected error: %v", err)
+	}
+	create := strings.Join(commands[0], " ")
+	if !strings.Contains(create, "/SC ONLOGON") || !strings.Contains(create, `--config "C:\Users\dev\tunnel.ini"`) {
+		t.Fatalf("create command = %q, want a logon task running the config", create)
+	}
+}
+
+func TestRunServiceSubcommandIgnoresOtherArgs(t *testing.T) {
+	t.Parallel()
+
+	handled, err := runServiceSubcommand([]string{"aws-go-forward", "--profile", "dev"}, io.Discard)
+	if handled || err != nil {
+		t.Fatalf("runServiceSubcommand() = %v, %v, want false, nil", handled, err)
+	}
+}
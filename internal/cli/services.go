@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// servicePortsSection maps service names to ports, adding to or replacing
+// entries of defaultServicePorts.
+const servicePortsSection = "service_ports"
+
+var (
+	ErrUnknownRemoteService  = errors.New("unknown remote service")
+	ErrRemoteServiceConflict = errors.New("remote service and remote port disagree")
+	ErrInvalidServicePort    = errors.New("invalid service port")
+)
+
+// defaultServicePorts holds the well-known ports of services commonly
+// reached through a bastion.
+var defaultServicePorts = map[string]int{
+	"cassandra":     9042,
+	"elasticsearch": 9200,
+	"grafana":       3000,
+	"http":          80,
+	"https":         443,
+	"kafka":         9092,
+	"ldap":          389,
+	"ldaps":         636,
+	"mariadb":       3306,
+	"memcached":     11211,
+	"mongodb":       27017,
+	"mssql":         1433,
+	"mysql":         3306,
+	"opensearch":    9200,
+	"oracle":        1521,
+	"postgres":      5432,
+	"postgresql":    5432,
+	"prometheus":    9090,
+	"rabbitmq":      5672,
+	"rdp":           3389,
+	"redis":         6379,
+	"smtp":          25,
+	"ssh":           22,
+	"vnc":           5900,
+}
+
+func parseServicePorts(section *ini.Section) (map[string]int, error) {
+	ports := make(map[string]int)
+	for _, key := range section.Keys() {
+		port, err := strconv.Atoi(strings.TrimSpace(key.Value()))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%w: %s = %q", ErrInvalidServicePort, key.Name(), key.Value())
+		}
+		ports[strings.ToLower(strings.TrimSpace(key.Name()))] = port
+	}
+	return ports, nil
+}
+
+// remoteServicePort returns the port of the named remote service, looking
+// at the config file's [service_ports] before the built-in table.
+func (c Config) remoteServicePort() (int, error) {
+	name := strings.ToLower(strings.TrimSpace(c.RemoteService))
+	if port, ok := c.ServicePorts[name]; ok {
+		return port, nil
+	}
+	if port, ok := defaultServicePorts[name]; ok {
+		return port, nil
+	}
+	return 0, fmt.Errorf("%w: %q (add it to [%s] in the config file)", ErrUnknownRemoteService, c.RemoteService, servicePortsSection)
+}
+
+// applyRemoteService sets the remote port from RemoteService. An explicit
+// remote port must match the service's port.
+func applyRemoteService(cfg Config) (Config, error) {
+	if strings.TrimSpace(cfg.RemoteService) == "" {
+		return cfg, nil
+	}
+	port, err := cfg.remoteServicePort()
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.RemotePort != 0 && cfg.RemotePort != port {
+		return Config{}, fmt.Errorf("%w: %s is port %d, not %d", ErrRemoteServiceConflict, cfg.RemoteService, port, cfg.RemotePort)
+	}
+	cfg.RemotePort = port
+	return cfg, nil
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyRemoteService(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    int
+		wantErr error
+	}{
+		{name: "no service", cfg: Config{RemotePort: 8080}, want: 8080},
+		{name: "built-in service", cfg: Config{RemoteService: "postgres"}, want: 5432},
+		{name: "case insensitive", cfg: Config{RemoteService: "Redis"}, want: 6379},
+		{name: "matching remote port", cfg: Config{RemoteService: "mysql", RemotePort: 3306}, want: 3306},
+		{name: "conflicting remote port", cfg: Config{RemoteService: "mysql", RemotePort: 3307}, wantErr: ErrRemoteServiceConflict},
+		{name: "unknown service", cfg: Config{RemoteService: "gopher"}, wantErr: ErrUnknownRemoteService},
+		{name: "config override", cfg: Config{RemoteService: "postgres", ServicePorts: map[string]int{"postgres": 6432}}, want: 6432},
+		{name: "config addition", cfg: Config{RemoteService: "billing", ServicePorts: map[string]int{"billing": 8443}}, want: 8443},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := applyRemoteService(tt.cfg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyRemoteService() unexpected error: %v", err)
+			}
+			if got.RemotePort != tt.want {
+				t.Fatalf("expected remote port %d, got %d", tt.want, got.RemotePort)
+			}
+		})
+	}
+}
+
+func TestConfigValidateRemoteService(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", LocalPort: 5432, RemoteHost: "db.internal", RemoteService: "postgres"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	cfg.RemotePort = 5433
+	if err := cfg.Validate(); !errors.Is(err, ErrRemoteServiceConflict) {
+		t.Fatalf("expected %v, got %v", ErrRemoteServiceConflict, err)
+	}
+}
+
+func TestLoadConfigFromFileServicePorts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.ini")
+	content := "[settings]\nprofile = default\ninstance_name = bastion\nremote_service = Billing\n\n[service_ports]\nBilling = 8443\n"
+	if err := os.WriteFile(valid, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	cfg, err := loadConfigFromFile(valid)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	if port, err := cfg.remoteServicePort(); err != nil || port != 8443 {
+		t.Fatalf("expected port 8443, got %d (%v)", port, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.ini")
+	content = "[settings]\nprofile = default\n\n[service_ports]\nbilling = https\n"
+	if err := os.WriteFile(invalid, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	if _, err := loadConfigFromFile(invalid); !errors.Is(err, ErrInvalidServicePort) {
+		t.Fatalf("expected %v, got %v", ErrInvalidServicePort, err)
+	}
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	setupCommand       = "setup"
+	defaultSetupConfig = "aws-go-forward.ini"
+)
+
+var (
+	ErrSetupNotInteractive = errors.New("setup needs an interactive terminal")
+	ErrSetupAborted        = errors.New("setup aborted")
+	ErrConfigFileExists    = errors.New("config file already exists")
+)
+
+// setupWizard asks for the settings of a single forward. Every prompt
+// offers a default where one makes sense, so Enter accepts it.
+type setupWizard struct {
+	in       *bufio.Reader
+	out      io.Writer
+	profiles []string
+}
+
+func (w setupWizard) ask(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", label)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		fmt.Fprintln(w.out)
+		return "", ErrSetupAborted
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+func (w setupWizard) askRequired(label, def string) (string, error) {
+	for {
+		answer, err := w.ask(label, def)
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintln(w.out, "A value is required.")
+	}
+}
+
+func (w setupWizard) askPort(label string, def int) (int, error) {
+	defText := ""
+	if def != 0 {
+		defText = strconv.Itoa(def)
+	}
+	for {
+		answer, err := w.askRequired(label, defText)
+		if err != nil {
+			return 0, err
+		}
+		port, err := strconv.Atoi(answer)
+		if err == nil && port >= 1 && port <= 65535 {
+			return port, nil
+		}
+		fmt.Fprintln(w.out, "Enter a port between 1 and 65535.")
+	}
+}
+
+func (w setupWizard) confirm(label string) (bool, error) {
+	answer, err := w.ask(label+" (y/N)", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (w setupWizard) askProfile() (string, error) {
+	def := "default"
+	if len(w.profiles) > 0 {
+		fmt.Fprintln(w.out, "AWS profiles found:")
+		for i, name := range w.profiles {
+			fmt.Fprintf(w.out, "  %d) %s\n", i+1, name)
+		}
+		if !slices.Contains(w.profiles, def) {
+			def = w.profiles[0]
+		}
+	}
+	answer, err := w.askRequired("Profile (name or number)", def)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(w.profiles) {
+		return w.profiles[n-1], nil
+	}
+	return answer, nil
+}
+
+// run asks for every setting and returns the resulting configuration.
+func (w setupWizard) run() (Config, error) {
+	var cfg Config
+	var err error
+	if cfg.Profile, err = w.askProfile(); err != nil {
+		return Config{}, err
+	}
+	if cfg.Region, err = w.ask("Region (blank uses the profile's region)", ""); err != nil {
+		return Config{}, err
+	}
+	instance, err := w.askRequired("Instance name (Name tag) or instance ID", "")
+	if err != nil {
+		return Config{}, err
+	}
+	if isTargetID(instance) {
+		cfg.InstanceID = instance
+	} else {
+		cfg.InstanceName = instance
+	}
+	if cfg.RemoteHost, err = w.askRequired("Remote host to forward to", "localhost"); err != nil {
+		return Config{}, err
+	}
+	if cfg.RemotePort, err = w.askPort("Remote port", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.LocalPort, err = w.askPort("Local port", cfg.RemotePort); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// formatSetupConfig renders cfg in the format read by loadConfigFromFile.
+func formatSetupConfig(cfg Config) string {
+	var b strings.Builder
+	b.WriteString("[settings]\n")
+	fmt.Fprintf(&b, "profile = %s\n", cfg.Profile)
+	if cfg.Region != "" {
+		fmt.Fprintf(&b, "region = %s\n", cfg.Region)
+	}
+	if cfg.InstanceID != "" {
+		fmt.Fprintf(&b, "instance_id = %s\n", cfg.InstanceID)
+	} else {
+		fmt.Fprintf(&b, "instance_name = %s\n", cfg.InstanceName)
+	}
+	fmt.Fprintf(&b, "local_port = %d\n", cfg.LocalPort)
+	fmt.Fprintf(&b, "remote_host = %s\n", cfg.RemoteHost)
+	fmt.Fprintf(&b, "remote_port = %d\n", cfg.RemotePort)
+	return b.String()
+}
+
+// writeSetupConfig writes the configuration and reads it back so a file
+// the tool cannot load is never left behind.
+func writeSetupConfig(path string, cfg Config, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%w: %s (pass --force to overwrite)", ErrConfigFileExists, path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(formatSetupConfig(cfg)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if _, err := loadConfigFromFile(path); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to read back configuration: %w", err)
+	}
+	return nil
+}
+
+func isInteractive(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runSetupSubcommand handles the setup wizard. It reports whether args
+// selected it. Without a terminal, or in CI, it fails instead of waiting
+// for input.
+func runSetupSubcommand(args []string, in *os.File, out io.Writer) (bool, error) {
+	if len(args) < 2 || args[1] != setupCommand {
+		return false, nil
+	}
+
+	fs := flag.NewFlagSet(setupCommand, flag.ContinueOnError)
+	output := fs.String("output", defaultSetupConfig, "Path of the configuration file to write")
+	force := fs.Bool("force", false, "Overwrite an existing configuration file")
+	if err := fs.Parse(args[2:]); err != nil {
+		return true, err
+	}
+	if os.Getenv("CI") != "" || !isInteractive(in) {
+		return true, ErrSetupNotInteractive
+	}
+
+	wizard := setupWizard{in: bufio.NewReader(in), out: out}
+	if home, err := os.UserHomeDir(); err == nil {
+		// Setup still works without the list; any profile name can be typed.
+		wizard.profiles, _ = listProfiles(sharedConfigFiles(os.Getenv, home))
+	}
+
+	cfg, err := wizard.run()
+	if err != nil {
+		return true, err
+	}
+	if err := writeSetupConfig(*output, cfg, *force); err != nil {
+		return true, err
+	}
+	fmt.Fprintf(out, "Wrote %s. Start the tunnel with: aws-go-forward --config %s\n", *output, *output)
+
+	test, err := wizard.confirm("Start the tunnel now to test it?")
+	if err != nil || !test {
+		return true, nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return true, err
+	}
+	fmt.Fprintln(out, "Press Ctrl-C to stop the test.")
+	// The tunnel handles Ctrl-C itself; keep it from ending the wizard first.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	cmd := exec.Command(executable, "--config", *output)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return true, fmt.Errorf("test connection failed: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupWizardRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Config
+		wantErr error
+	}{
+		{
+			name:  "profile by number and instance name",
+			input: "2\neu-west-1\nbastion\ndb.internal\n5432\n\n",
+			want:  Config{Profile: "prod", Region: "eu-west-1", InstanceName: "bastion", RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 5432},
+		},
+		{
+			name:  "defaults and instance id",
+			input: "\n\ni-0123456789abcdef0\n\n6379\n16379\n",
+			want:  Config{Profile: "default", InstanceID: "i-0123456789abcdef0", RemoteHost: "localhost", RemotePort: 6379, LocalPort: 16379},
+		},
+		{
+			name:  "invalid port is asked again",
+			input: "default\n\nbastion\ndb.internal\n70000\nabc\n3306\n\n",
+			want:  Config{Profile: "default", InstanceName: "bastion", RemoteHost: "db.internal", RemotePort: 3306, LocalPort: 3306},
+		},
+		{
+			name:    "end of input aborts",
+			input:   "default\n\n",
+			wantErr: ErrSetupAborted,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			wizard := setupWizard{in: bufio.NewReader(strings.NewReader(tt.input)), out: io.Discard, profiles: []string{"default", "prod"}}
+			got, err := wizard.run()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run() unexpected error: %v", err)
+			}
+			if got.Profile != tt.want.Profile || got.Region != tt.want.Region || got.InstanceName != tt.want.InstanceName ||
+				got.InstanceID != tt.want.InstanceID || got.RemoteHost != tt.want.RemoteHost ||
+				got.RemotePort != tt.want.RemotePort || got.LocalPort != tt.want.LocalPort {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteSetupConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "forward.ini")
+	cfg := Config{Profile: "prod", Region: "eu-west-1", InstanceName: "bastion", RemoteHost: "db.internal", RemotePort: 5432, LocalPort: 15432}
+	if err := writeSetupConfig(path, cfg, false); err != nil {
+		t.Fatalf("writeSetupConfig() unexpected error: %v", err)
+	}
+
+	loaded, err := loadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFromFile() unexpected error: %v", err)
+	}
+	if loaded.Profile != cfg.Profile || loaded.Region != cfg.Region || loaded.InstanceName != cfg.InstanceName ||
+		loaded.RemoteHost != cfg.RemoteHost || loaded.RemotePort != cfg.RemotePort || loaded.LocalPort != cfg.LocalPort {
+		t.Fatalf("expected %+v, got %+v", cfg, *loaded)
+	}
+	if err := loaded.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	if err := writeSetupConfig(path, cfg, false); !errors.Is(err, ErrConfigFileExists) {
+		t.Fatalf("expected %v, got %v", ErrConfigFileExists, err)
+	}
+	if err := writeSetupConfig(path, cfg, true); err != nil {
+		t.Fatalf("writeSetupConfig() with force unexpected error: %v", err)
+	}
+}
+
+func TestRunSetupSubcommandRequiresTerminal(t *testing.T) {
+	t.Parallel()
+
+	if handled, _ := runSetupSubcommand([]string{"aws-go-forward", "--profile", "default"}, os.Stdin, io.Discard); handled {
+		t.Fatal("expected other arguments not to be handled")
+	}
+
+	// A regular file stands in for redirected or piped stdin.
+	in, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer in.Close()
+	handled, err := runSetupSubcommand([]string{"aws-go-forward", setupCommand, "--output", filepath.Join(t.TempDir(), "forward.ini")}, in, io.Discard)
+	if !handled {
+		t.Fatal("expected setup to be handled")
+	}
+	if !errors.Is(err, ErrSetupNotInteractive) {
+		t.Fatalf("expected %v, got %v", ErrSetupNotInteractive, err)
+	}
+}
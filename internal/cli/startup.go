@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// interruptedExitCode is the shell's status for a process ended by Ctrl-C.
+const interruptedExitCode = 130
+
+var (
+	ErrInvalidMaxStartupTime = errors.New("invalid max startup time")
+	ErrStartupTimeExceeded   = errors.New("startup time budget exceeded")
+	ErrInvalidResolveTimeout = errors.New("invalid resolve timeout")
+	ErrResolveTimeExceeded   = errors.New("instance resolution timed out")
+)
+
+// startupDeadline returns when a startup budget that began at start runs
+// out. Without a budget it returns the zero time.
+func startupDeadline(start time.Time, budget time.Duration) time.Time {
+	if budget <= 0 {
+		return time.Time{}
+	}
+	return start.Add(budget)
+}
+
+// withStartupDeadline bounds ctx by the startup deadline, if there is one.
+func withStartupDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadlineCause(ctx, deadline, ErrStartupTimeExceeded)
+}
+
+// withResolveTimeout bounds the instance and endpoint lookups, if a
+// timeout is set. The startup budget of ctx still applies.
+func withResolveTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrResolveTimeExceeded, timeout))
+}
+
+// clampToDeadline shortens a phase timeout to what is left of the startup
+// budget.
+func clampToDeadline(timeout time.Duration, deadline, now time.Time) time.Duration {
+	if deadline.IsZero() {
+		return timeout
+	}
+	return max(min(timeout, deadline.Sub(now)), 0)
+}
+
+// startupFailure names the limit that ran out, the startup budget or the
+// resolve timeout, so the cause is clear from the AWS SDK error.
+func startupFailure(ctx context.Context, err error) error {
+	cause := context.Cause(ctx)
+	if err == nil || cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	if errors.Is(cause, ErrStartupTimeExceeded) || errors.Is(cause, ErrResolveTimeExceeded) {
+		return fmt.Errorf("%w: %v", cause, err)
+	}
+	return err
+}
+
+// interrupted reports whether ctx was cancelled by Ctrl-C or SIGTERM
+// rather than by running out of time.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), context.Canceled)
+}
+
+// fatalStartup reports a failed startup step and exits. A step aborted by
+// Ctrl-C exits quietly: the cancelled AWS call is not what went wrong.
+func fatalStartup(ctx context.Context, errorFormat, phase, step string, err error) {
+	if interrupted(ctx) {
+		exitFatal(errorFormat, interruptedError(phase))
+	}
+	err = startupFailure(ctx, err)
+	exitFatal(errorFormat, newFatalError(phase, fmt.Sprintf("%s: %v", step, err), err))
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupDeadline(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := startupDeadline(start, 0); !got.IsZero() {
+		t.Fatalf("expected no deadline, got %v", got)
+	}
+	if got, want := startupDeadline(start, 45*time.Second), start.Add(45*time.Second); !got.Equal(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestClampToDeadline(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		deadline time.Time
+		want     time.Duration
+	}{
+		{name: "no budget", want: 30 * time.Second},
+		{name: "budget longer than timeout", deadline: now.Add(time.Minute), want: 30 * time.Second},
+		{name: "budget shorter than timeout", deadline: now.Add(10 * time.Second), want: 10 * time.Second},
+		{name: "budget spent", deadline: now.Add(-time.Second), want: 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := clampToDeadline(30*time.Second, tt.deadline, now); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStartupFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := withStartupDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	<-ctx.Done()
+	if err := startupFailure(ctx, ctx.Err()); !errors.Is(err, ErrStartupTimeExceeded) {
+		t.Fatalf("expected %v, got %v", ErrStartupTimeExceeded, err)
+	}
+
+	unbounded, cancelUnbounded := withStartupDeadline(context.Background(), time.Time{})
+	cancelUnbounded()
+	if err := startupFailure(unbounded, unbounded.Err()); !errors.Is(err, context.Canceled) || errors.Is(err, ErrStartupTimeExceeded) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if err := startupFailure(ctx, nil); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
+
+func TestSessionLimiterAcquireStartupBudget(t *testing.T) {
+	t.Parallel()
+
+	limiter := newSessionLimiter(1)
+	limiter.logf = func(string, ...any) {}
+	release, err := limiter.Acquire(context.Background(), "forward-1")
+	if err != nil {
+		t.Fatalf("Acquire() unexpected error: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := withStartupDeadline(context.Background(), time.Now().Add(20*time.Millisecond))
+	defer cancel()
+	_, err = limiter.Acquire(ctx, "forward-2")
+	if err := startupFailure(ctx, err); !errors.Is(err, ErrStartupTimeExceeded) {
+		t.Fatalf("expected %v, got %v", ErrStartupTimeExceeded, err)
+	}
+}
+
+func TestWithResolveTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := withResolveTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err := startupFailure(ctx, ctx.Err())
+	if !errors.Is(err, ErrResolveTimeExceeded) {
+		t.Fatalf("expected %v, got %v", ErrResolveTimeExceeded, err)
+	}
+	if !strings.Contains(err.Error(), "after 10ms") {
+		t.Fatalf("error %q does not name the timeout", err)
+	}
+
+	// The startup budget running out first is reported as such.
+	startupCtx, cancelStartup := withStartupDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelStartup()
+	resolveCtx, cancelResolve := withResolveTimeout(startupCtx, time.Minute)
+	defer cancelResolve()
+	<-resolveCtx.Done()
+	err = startupFailure(resolveCtx, resolveCtx.Err())
+	if !errors.Is(err, ErrStartupTimeExceeded) || errors.Is(err, ErrResolveTimeExceeded) {
+		t.Fatalf("expected %v, got %v", ErrStartupTimeExceeded, err)
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	t.Parallel()
+
+	signalled, stop := context.WithCancel(context.Background())
+	stop()
+	resolveCtx, cancelResolve := withResolveTimeout(signalled, time.Minute)
+	defer cancelResolve()
+	if !interrupted(signalled) || !interrupted(resolveCtx) {
+		t.Fatalf("expected a cancelled parent to count as interrupted")
+	}
+
+	expired, cancel := withStartupDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	<-expired.Done()
+	if interrupted(expired) || interrupted(context.Background()) {
+		t.Fatalf("expected a spent startup budget or a live context not to count as interrupted")
+	}
+}
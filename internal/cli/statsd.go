@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultStatsDPrefix = "aws_go_forward"
+
+var ErrInvalidStatsDAddr = errors.New("invalid statsd address")
+
+func validateStatsDAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidStatsDAddr, addr, err)
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%w: %q (want host:port)", ErrInvalidStatsDAddr, addr)
+	}
+	return nil
+}
+
+// statsDMetrics turns lifecycle events into StatsD lines:
+//
+//	<prefix>.sessions_started       counter
+//	<prefix>.sessions_ended         counter
+//	<prefix>.session_failures       counter, sessions that ended with an error
+//	<prefix>.keepalive_failures     counter
+//	<prefix>.session_start_duration timer, from resolving the instance to the session starting
+//	<prefix>.up                     gauge, forwards with an open session
+//	<prefix>.probe_up               gauge, 1 or 0 as --monitor probes succeed or fail
+type statsDMetrics struct {
+	prefix   string
+	resolved time.Time
+	up       int
+}
+
+func (m *statsDMetrics) lines(event lifecycleEvent) []string {
+	var lines []string
+	add := func(name, value, kind string) {
+		lines = append(lines, m.prefix+"."+name+":"+value+"|"+kind)
+	}
+	switch event.Type {
+	case eventInstanceResolved:
+		m.resolved = event.Time
+	case eventSessionStarted:
+		add("sessions_started", "1", "c")
+		if !m.resolved.IsZero() && !event.Time.Before(m.resolved) {
+			add("session_start_duration", strconv.FormatInt(event.Time.Sub(m.resolved).Milliseconds(), 10), "ms")
+		}
+		m.up++
+		add("up", strconv.Itoa(m.up), "g")
+	case eventKeepAliveFailed:
+		add("keepalive_failures", "1", "c")
+	case eventProbeUp:
+		add("probe_up", "1", "g")
+	case eventProbeDown:
+		add("probe_up", "0", "g")
+	case eventSessionEnded:
+		add("sessions_ended", "1", "c")
+		if event.Error != "" {
+			add("session_failures", "1", "c")
+		}
+		m.up = max(m.up-1, 0)
+		add("up", strconv.Itoa(m.up), "g")
+	}
+	return lines
+}
+
+// startStatsD sends metrics for lifecycle events to out, one UDP datagram
+// per event. Send errors are ignored: metrics must never affect the tunnel.
+func startStatsD(bus *eventBus, out io.Writer, prefix string) func() {
+	events, unsubscribe := bus.Subscribe(64)
+	metrics := &statsDMetrics{prefix: prefix}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range events {
+			if lines := metrics.lines(event); len(lines) > 0 {
+				out.Write([]byte(strings.Join(lines, "\n")))
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsDMetricsLines(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	metrics := &statsDMetrics{prefix: "fwd"}
+	tests := []struct {
+		event lifecycleEvent
+		want  []string
+	}{
+		{event: lifecycleEvent{Type: eventInstanceResolved, Time: start}},
+		{event: lifecycleEvent{Type: eventSessionStarted, Time: start.Add(1500 * time.Millisecond)}, want: []string{"fwd.sessions_started:1|c", "fwd.session_start_duration:1500|ms", "fwd.up:1|g"}},
+		{event: lifecycleEvent{Type: eventTunnelReady, Time: start.Add(2 * time.Second)}},
+		{event: lifecycleEvent{Type: eventKeepAliveFailed, Time: start.Add(time.Minute)}, want: []string{"fwd.keepalive_failures:1|c"}},
+		{event: lifecycleEvent{Type: eventSessionEnded, Time: start.Add(2 * time.Minute), Error: "session plugin failed"}, want: []string{"fwd.sessions_ended:1|c", "fwd.session_failures:1|c", "fwd.up:0|g"}},
+		{event: lifecycleEvent{Type: eventSessionEnded, Time: start.Add(3 * time.Minute)}, want: []string{"fwd.sessions_ended:1|c", "fwd.up:0|g"}},
+	}
+
+	for _, tt := range tests {
+		if got := metrics.lines(tt.event); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: expected %q, got %q", tt.event.Type, tt.want, got)
+		}
+	}
+}
+
+func TestStartStatsD(t *testing.T) {
+	t.Parallel()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer server.Close()
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	bus := newEventBus()
+	stop := startStatsD(bus, conn, defaultStatsDPrefix)
+	bus.Emit(lifecycleEvent{Type: eventKeepAliveFailed})
+	defer stop()
+
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 512)
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got := string(buf[:n]); got != "aws_go_forward.keepalive_failures:1|c" {
+		t.Fatalf("expected keepalive failure counter, got %q", got)
+	}
+}
+
+func TestValidateStatsDAddr(t *testing.T) {
+	t.Parallel()
+
+	if err := validateStatsDAddr("localhost:8125"); err != nil {
+		t.Fatalf("validateStatsDAddr() unexpected error: %v", err)
+	}
+	for _, addr := range []string{"localhost", ":8125", "localhost:0", "localhost:statsd"} {
+		if err := validateStatsDAddr(addr); !errors.Is(err, ErrInvalidStatsDAddr) {
+			t.Fatalf("%s: expected %v, got %v", addr, ErrInvalidStatsDAddr, err)
+		}
+	}
+}
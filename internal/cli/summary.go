@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// runSummary is what --summary-file records about a run once it ends.
+// The byte counts are only known with the native forwarder, and the startup
+// timing is only recorded with --timing.
+type runSummary struct {
+	Start             time.Time     `json:"start"`
+	End               time.Time     `json:"end"`
+	DurationSeconds   float64       `json:"duration_seconds"`
+	ExitReason        string        `json:"exit_reason"`
+	Error             string        `json:"error,omitempty"`
+	InstanceIDs       []string      `json:"instance_ids"`
+	SessionIDs        []string      `json:"session_ids"`
+	SessionsStarted   int           `json:"sessions_started"`
+	SessionFailures   int           `json:"session_failures"`
+	Reconnects        int           `json:"reconnects"`
+	KeepAliveFailures int           `json:"keepalive_failures"`
+	BytesSent         *int64        `json:"bytes_sent,omitempty"`
+	BytesReceived     *int64        `json:"bytes_received,omitempty"`
+	StartupTiming     []phaseTiming `json:"startup_timing,omitempty"`
+}
+
+// summaryRecorder builds a runSummary from lifecycle events. A session
+// started for a forward that already had one, for example after a move to
+// a fresher instance, counts as a reconnect.
+type summaryRecorder struct {
+	summary runSummary
+	started map[string]bool
+}
+
+func (r *summaryRecorder) record(event lifecycleEvent) {
+	switch event.Type {
+	case eventInstanceResolved:
+		if event.InstanceID != "" && !slices.Contains(r.summary.InstanceIDs, event.InstanceID) {
+			r.summary.InstanceIDs = append(r.summary.InstanceIDs, event.InstanceID)
+		}
+	case eventSessionStarted:
+		r.summary.SessionsStarted++
+		if event.SessionID != "" {
+			r.summary.SessionIDs = append(r.summary.SessionIDs, event.SessionID)
+		}
+		if r.started[event.Label] {
+			r.summary.Reconnects++
+		}
+		r.started[event.Label] = true
+	case eventKeepAliveFailed:
+		r.summary.KeepAliveFailures++
+	case eventSessionEnded:
+		if event.Error != "" {
+			r.summary.SessionFailures++
+		}
+	}
+}
+
+// startSummary records lifecycle events from now on. The returned function
+// stops recording and completes the summary with how the run ended.
+func startSummary(bus *eventBus, now func() time.Time) func(reason string, err error, sent, received *atomic.Int64) runSummary {
+	events, unsubscribe := bus.Subscribe(64)
+	recorder := &summaryRecorder{
+		summary: runSummary{Start: now().UTC(), InstanceIDs: []string{}, SessionIDs: []string{}},
+		started: make(map[string]bool),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range events {
+			recorder.record(event)
+		}
+	}()
+	return func(reason string, err error, sent, received *atomic.Int64) runSummary {
+		unsubscribe()
+		<-done
+		summary := recorder.summary
+		summary.End = now().UTC()
+		summary.DurationSeconds = summary.End.Sub(summary.Start).Seconds()
+		summary.ExitReason = reason
+		if err != nil {
+			summary.Error = err.Error()
+		}
+		if sent != nil && received != nil {
+			sentBytes, receivedBytes := sent.Load(), received.Load()
+			summary.BytesSent, summary.BytesReceived = &sentBytes, &receivedBytes
+		}
+		return summary
+	}
+}
+
+// fatalSummaryWriter returns the fatal exit hook that completes the
+// summary with the fatal error and writes it to path.
+func fatalSummaryWriter(path string, stop func(reason string, err error, sent, received *atomic.Int64) runSummary) func(report fatalError) {
+	return func(report fatalError) {
+		reason := exitReasonError
+		if report.ExitCode == interruptedExitCode {
+			reason = exitReasonStopped
+		}
+		summary := stop(reason, errors.New(report.Message), nil, nil)
+		if err := writeSummaryFile(path, summary); err != nil {
+			log.Printf("Failed to write summary file: %v", err)
+		}
+	}
+}
+
+// writeSummaryFile writes the summary through a temporary file so readers
+// never see a partial document.
+func writeSummaryFile(path string, summary runSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
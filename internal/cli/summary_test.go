@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartSummary(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	bus := newEventBus()
+	stop := startSummary(bus, func() time.Time { return now })
+	for _, event := range []lifecycleEvent{
+		{Type: eventInstanceResolved, InstanceID: "i-old"},
+		{Type: eventSessionStarted, Label: "db", SessionID: "s-1"},
+		{Type: eventSessionStarted, Label: "cache", SessionID: "s-2"},
+		{Type: eventKeepAliveFailed, Label: "db", Error: "timeout"},
+		{Type: eventSessionEnded, Label: "db", SessionID: "s-1", Error: "plugin exited"},
+		{Type: eventInstanceResolved, InstanceID: "i-new"},
+		{Type: eventSessionStarted, Label: "db", SessionID: "s-3"},
+		{Type: eventSessionEnded, Label: "db", SessionID: "s-3"},
+		{Type: eventShutdown},
+	} {
+		bus.Emit(event)
+	}
+	now = start.Add(90 * time.Second)
+
+	var sent, received atomic.Int64
+	sent.Store(1024)
+	received.Store(4096)
+	got := stop(exitReasonError, errors.New("db: session failed"), &sent, &received)
+
+	if !slices.Equal(got.InstanceIDs, []string{"i-old", "i-new"}) || !slices.Equal(got.SessionIDs, []string{"s-1", "s-2", "s-3"}) {
+		t.Errorf("expected both instances and three sessions, got %v and %v", got.InstanceIDs, got.SessionIDs)
+	}
+	if got.SessionsStarted != 3 || got.Reconnects != 1 || got.SessionFailures != 1 || got.KeepAliveFailures != 1 {
+		t.Errorf("expected 3 sessions, 1 reconnect, 1 failure and 1 keep-alive failure, got %+v", got)
+	}
+	if got.DurationSeconds != 90 || got.ExitReason != exitReasonError || got.Error != "db: session failed" {
+		t.Errorf("expected a 90s run ending in an error, got %+v", got)
+	}
+	if got.BytesSent == nil || *got.BytesSent != 1024 || got.BytesReceived == nil || *got.BytesReceived != 4096 {
+		t.Errorf("expected the byte counts, got %v and %v", got.BytesSent, got.BytesReceived)
+	}
+}
+
+func TestWriteSummaryFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	summary := runSummary{ExitReason: exitReasonStopped, InstanceIDs: []string{"i-1"}, SessionIDs: []string{}}
+	if err := writeSummaryFile(path, summary); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary file: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded["exit_reason"] != exitReasonStopped {
+		t.Errorf("expected exit_reason %q, got %v", exitReasonStopped, decoded["exit_reason"])
+	}
+	if _, ok := decoded["bytes_sent"]; ok {
+		t.Errorf("expected no byte counts without the native forwarder, got %s", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the temporary file to be gone, got %v", err)
+	}
+}
+
+func TestFatalSummaryWriter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	bus := newEventBus()
+	write := fatalSummaryWriter(path, startSummary(bus, time.Now))
+	bus.Emit(lifecycleEvent{Type: eventInstanceResolved, InstanceID: "i-1"})
+	write(newFatalError("resolve", "Failed to resolve instance: no running instances", ErrNoRunningInstances))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary file: %v", err)
+	}
+	var decoded runSummary
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.ExitReason != exitReasonError || decoded.Error != "Failed to resolve instance: no running instances" {
+		t.Errorf("expected the fatal error in the summary, got %s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	clockGapCheckInterval = 5 * time.Second
+	clockGapThreshold     = 30 * time.Second
+)
+
+// wakeNotifier tells running forwards that the process may have been
+// stopped for a while, so they should check their tunnel right away.
+type wakeNotifier struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func newWakeNotifier() *wakeNotifier {
+	return &wakeNotifier{subscribers: make(map[chan struct{}]struct{})}
+}
+
+// Subscribe returns a channel that receives after every Notify. A nil
+// notifier returns a nil channel, which never receives.
+func (w *wakeNotifier) Subscribe() (<-chan struct{}, func()) {
+	if w == nil {
+		return nil, func() {}
+	}
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	w.subscribers[ch] = struct{}{}
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subscribers, ch)
+		w.mu.Unlock()
+	}
+}
+
+func (w *wakeNotifier) Notify() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// clockGap returns how much longer than interval passed between two ticks,
+// by wall clock. The monotonic clock stops while the machine sleeps, so
+// only the wall clock shows the gap.
+func clockGap(last, now time.Time, interval time.Duration) time.Duration {
+	return now.Round(0).Sub(last.Round(0)) - interval
+}
+
+// watchClockGaps calls onWake when ticks arrive much later than scheduled,
+// which happens after the machine was asleep.
+func watchClockGaps(ctx context.Context, interval, threshold time.Duration, onWake func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if gap := clockGap(last, now, interval); gap > threshold {
+				log.Printf("Woke up after about %s asleep; checking the tunnel", gap.Round(time.Second))
+				onWake()
+			}
+			last = now
+		}
+	}
+}
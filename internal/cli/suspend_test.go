@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWakeNotifier(t *testing.T) {
+	t.Parallel()
+
+	w := newWakeNotifier()
+	first, unsubscribeFirst := w.Subscribe()
+	second, unsubscribeSecond := w.Subscribe()
+	defer unsubscribeSecond()
+
+	w.Notify()
+	w.Notify()
+	for _, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		default:
+			t.Fatal("subscriber was not notified")
+		}
+	}
+
+	unsubscribeFirst()
+	w.Notify()
+	select {
+	case <-first:
+		t.Fatal("unsubscribed channel was notified")
+	default:
+	}
+}
+
+func TestNilWakeNotifier(t *testing.T) {
+	t.Parallel()
+
+	var w *wakeNotifier
+	ch, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+	w.Notify()
+	if ch != nil {
+		t.Fatal("nil notifier returned a non-nil channel")
+	}
+}
+
+func TestClockGap(t *testing.T) {
+	t.Parallel()
+
+	last := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	if gap := clockGap(last, last.Add(5*time.Second), 5*time.Second); gap != 0 {
+		t.Fatalf("gap = %s, want 0s", gap)
+	}
+	if gap := clockGap(last, last.Add(10*time.Minute), 5*time.Second); gap != 10*time.Minute-5*time.Second {
+		t.Fatalf("gap = %s, want %s", gap, 10*time.Minute-5*time.Second)
+	}
+}
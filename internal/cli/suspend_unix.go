@@ -0,0 +1,36 @@
+//go:build !windows
+
+package cli
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSuspend logs terminal suspend (Ctrl-Z) and resume (fg), and calls
+// onResume after SIGCONT so forwards re-check their tunnel.
+func watchSuspend(ctx context.Context, onResume func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTSTP, syscall.SIGCONT)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGTSTP:
+				log.Printf("Suspended; local connections stall until the process is resumed")
+				// Handling SIGTSTP replaces the default stop, so stop explicitly.
+				syscall.Kill(syscall.Getpid(), syscall.SIGSTOP)
+			case syscall.SIGCONT:
+				log.Printf("Resumed; checking the tunnel")
+				onResume()
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package cli
+
+import "context"
+
+// watchSuspend is a no-op: Windows has no job-control signals.
+func watchSuspend(ctx context.Context, onResume func()) {}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// portsTagKey names the instance tag listing the ports a service exposes,
+// e.g. Ports=5432,9090.
+const portsTagKey = "Ports"
+
+// defaultTaggedPortsHost is the remote host of tagged ports when none is
+// set: the instance itself.
+const defaultTaggedPortsHost = "localhost"
+
+var (
+	ErrMissingPortsTag           = errors.New("instance has no ports tag")
+	ErrInvalidPortsTag           = errors.New("invalid ports tag")
+	ErrTaggedPortsWithSSH        = errors.New("forward tagged ports cannot be used with ssh mode")
+	ErrTaggedPortsWithCount      = errors.New("forward tagged ports cannot be combined with count")
+	ErrTaggedPortsWithRemotePort = errors.New("forward tagged ports cannot be combined with remote port")
+	ErrTaggedPortsWithDiscovery  = errors.New("forward tagged ports cannot be combined with resolver url, cloud map service or kubernetes service")
+)
+
+func (c Config) validateTaggedPorts() error {
+	if !c.ForwardTaggedPorts {
+		return nil
+	}
+	if c.SSH {
+		return ErrTaggedPortsWithSSH
+	}
+	if c.Count > 1 {
+		return ErrTaggedPortsWithCount
+	}
+	if c.RemotePort != 0 {
+		return ErrTaggedPortsWithRemotePort
+	}
+	if strings.TrimSpace(c.ResolverURL) != "" || c.cloudMapEnabled() || c.eksEnabled() {
+		return ErrTaggedPortsWithDiscovery
+	}
+	return nil
+}
+
+// parsePortsTag parses a comma-separated port list. Duplicates are dropped
+// and the order of first appearance is kept.
+func parsePortsTag(value string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%w: %q is not a port", ErrInvalidPortsTag, field)
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPortsTag, value)
+	}
+	return ports, nil
+}
+
+// taggedRemotePorts reads the remote ports to forward from the instance's
+// ports tag.
+func taggedRemotePorts(ctx context.Context, client ec2DescribeInstancesAPI, instanceID string) ([]int, error) {
+	tags, err := instanceTags(ctx, client, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := tags[portsTagKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no %s tag", ErrMissingPortsTag, instanceID, portsTagKey)
+	}
+	ports, err := parsePortsTag(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s tag on %s: %w", portsTagKey, instanceID, err)
+	}
+	return ports, nil
+}
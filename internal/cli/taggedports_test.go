@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestParsePortsTag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr error
+	}{
+		{value: "5432,9090", want: []int{5432, 9090}},
+		{value: " 9090 , 5432, 9090,", want: []int{9090, 5432}},
+		{value: "5432,http", wantErr: ErrInvalidPortsTag},
+		{value: "70000", wantErr: ErrInvalidPortsTag},
+		{value: " , ", wantErr: ErrInvalidPortsTag},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+			got, err := parsePortsTag(tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePortsTag() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTaggedRemotePorts(t *testing.T) {
+	t.Parallel()
+
+	clientWithTags := func(tags ...ec2types.Tag) *fakeEC2Client {
+		return &fakeEC2Client{
+			output: &ec2.DescribeInstancesOutput{
+				Reservations: []ec2types.Reservation{
+					{Instances: []ec2types.Instance{{InstanceId: aws.String("i-target"), Tags: tags}}},
+				},
+			},
+		}
+	}
+
+	got, err := taggedRemotePorts(context.Background(), clientWithTags(ec2types.Tag{Key: aws.String("Ports"), Value: aws.String("5432,9090")}), "i-target")
+	if err != nil {
+		t.Fatalf("taggedRemotePorts() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []int{5432, 9090}) {
+		t.Fatalf("expected %v, got %v", []int{5432, 9090}, got)
+	}
+
+	if _, err := taggedRemotePorts(context.Background(), clientWithTags(), "i-target"); !errors.Is(err, ErrMissingPortsTag) {
+		t.Fatalf("expected %v, got %v", ErrMissingPortsTag, err)
+	}
+}
+
+func TestConfigValidateTaggedPorts(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Profile: "default", InstanceName: "bastion", ForwardTaggedPorts: true}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr error
+	}{
+		{name: "ssh", mutate: func(c *Config) { c.SSH = true }, wantErr: ErrTaggedPortsWithSSH},
+		{name: "count", mutate: func(c *Config) { c.Count = 2 }, wantErr: ErrTaggedPortsWithCount},
+		{name: "remote port", mutate: func(c *Config) { c.RemotePort = 5432 }, wantErr: ErrTaggedPortsWithRemotePort},
+		{name: "cloud map", mutate: func(c *Config) {
+			c.CloudMapNamespace = "prod"
+			c.CloudMapService = "billing"
+		}, wantErr: ErrTaggedPortsWithDiscovery},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := cfg
+			tt.mutate(&c)
+			if err := c.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
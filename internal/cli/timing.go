@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Startup phases --timing reports, in the order they run.
+const (
+	timingCredentials  = "credentials"
+	timingIdentity     = "identity"
+	timingResolve      = "resolve"
+	timingChecks       = "checks"
+	timingStartSession = "start_session"
+	timingPlugin       = "plugin"
+)
+
+type phaseTiming struct {
+	Phase           string        `json:"phase"`
+	Duration        time.Duration `json:"-"`
+	DurationSeconds float64       `json:"duration_seconds"`
+}
+
+// startupTimer splits startup into consecutive phases: each mark ends the
+// phase that began at the previous mark.
+type startupTimer struct {
+	mu     sync.Mutex
+	last   time.Time
+	phases []phaseTiming
+}
+
+func newStartupTimer(start time.Time) *startupTimer {
+	return &startupTimer{last: start}
+}
+
+func (t *startupTimer) mark(phase string, at time.Time) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := max(at.Sub(t.last), 0)
+	t.last = at
+	t.phases = append(t.phases, phaseTiming{Phase: phase, Duration: d, DurationSeconds: d.Seconds()})
+}
+
+func (t *startupTimer) Phases() []phaseTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]phaseTiming(nil), t.phases...)
+}
+
+func formatStartupTiming(phases []phaseTiming) string {
+	var total time.Duration
+	parts := make([]string, len(phases))
+	for i, phase := range phases {
+		total += phase.Duration
+		parts[i] = fmt.Sprintf("%s %s", phase.Phase, phase.Duration.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s (total %s)", strings.Join(parts, ", "), total.Round(time.Millisecond))
+}
+
+// logStartupTiming logs the breakdown, with one <phase>_ms attribute per
+// phase in JSON mode.
+func logStartupTiming(phases []phaseTiming) {
+	if !jsonLogs {
+		log.Printf("Startup timing: %s", formatStartupTiming(phases))
+		return
+	}
+	var total time.Duration
+	args := make([]any, 0, 2*len(phases)+2)
+	for _, phase := range phases {
+		total += phase.Duration
+		args = append(args, phase.Phase+"_ms", phase.Duration.Milliseconds())
+	}
+	slog.Info("Startup timing", append(args, "total_ms", total.Milliseconds())...)
+}
+
+// startTiming ends the start_session and plugin phases on the first
+// session's lifecycle events and reports the breakdown once the local port
+// is ready. Without waitReady, as in SSH and pipe mode where the port is
+// not watched, it reports once the session started. The returned function
+// stops listening.
+func startTiming(bus *eventBus, timer *startupTimer, waitReady bool, report func([]phaseTiming)) func() {
+	events, unsubscribe := bus.Subscribe(16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		started := false
+		for event := range events {
+			switch {
+			case event.Type == eventSessionStarted && !started:
+				started = true
+				timer.mark(timingStartSession, event.Time)
+				if waitReady {
+					continue
+				}
+			case event.Type == eventTunnelReady && started && waitReady:
+				timer.mark(timingPlugin, event.Time)
+			default:
+				continue
+			}
+			report(timer.Phases())
+			for range events {
+			}
+			return
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
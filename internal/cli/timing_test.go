@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStartupTimer(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timer := newStartupTimer(start)
+	timer.mark(timingCredentials, start.Add(120*time.Millisecond))
+	timer.mark(timingResolve, start.Add(450*time.Millisecond))
+	timer.mark(timingStartSession, start.Add(1200*time.Millisecond))
+
+	got := formatStartupTiming(timer.Phases())
+	want := "credentials 120ms, resolve 330ms, start_session 750ms (total 1.2s)"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if phases := timer.Phases(); phases[1].DurationSeconds != 0.33 {
+		t.Errorf("expected 0.33 seconds for resolve, got %v", phases[1].DurationSeconds)
+	}
+
+	var disabled *startupTimer
+	disabled.mark(timingCredentials, start)
+	if phases := disabled.Phases(); phases != nil {
+		t.Errorf("expected no phases without --timing, got %v", phases)
+	}
+}
+
+func TestStartTiming(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		waitReady bool
+		want      []string
+	}{
+		{name: "port forwarding", waitReady: true, want: []string{timingResolve, timingStartSession, timingPlugin}},
+		{name: "ssh", want: []string{timingResolve, timingStartSession}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			bus := newEventBus()
+			timer := newStartupTimer(start)
+			timer.mark(timingResolve, start.Add(time.Second))
+			reports := make(chan []phaseTiming, 2)
+			stop := startTiming(bus, timer, tt.waitReady, func(phases []phaseTiming) { reports <- phases })
+			bus.Emit(lifecycleEvent{Type: eventSessionStarted, Time: start.Add(2 * time.Second)})
+			bus.Emit(lifecycleEvent{Type: eventTunnelReady, Time: start.Add(3 * time.Second)})
+			// A second session, after a reconnect, is not startup.
+			bus.Emit(lifecycleEvent{Type: eventSessionStarted, Time: start.Add(time.Minute)})
+
+			var phases []phaseTiming
+			select {
+			case phases = <-reports:
+			case <-time.After(time.Second):
+				t.Fatal("expected the timing to be reported")
+			}
+			stop()
+			var names []string
+			for _, phase := range phases {
+				names = append(names, phase.Phase)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("expected phases %v, got %v", tt.want, names)
+			}
+			if last := phases[len(phases)-1]; last.Duration != time.Second {
+				t.Errorf("expected %s to take 1s, got %s", last.Phase, last.Duration)
+			}
+			if len(reports) != 0 {
+				t.Errorf("expected one report, got more")
+			}
+		})
+	}
+}
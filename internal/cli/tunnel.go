@@ -0,0 +1,386 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+type ssmSessionAPI interface {
+	ssmStartSessionAPI
+	ssmTerminateSessionAPI
+}
+
+// forwardOptions holds the per-forward settings that are not part of Config.
+type forwardOptions struct {
+	Label         string
+	InstanceID    string
+	DocumentName  string
+	OpenInBrowser bool
+	OutputAWSEnv  bool
+	WatchReady    bool
+	// Wake triggers an immediate keep-alive probe, e.g. after a resume.
+	Wake *wakeNotifier
+	// Isolated runs the session plugin in a child process, which concurrent
+	// forwards require.
+	Isolated bool
+	// StartupDeadline bounds starting the session; zero means no limit.
+	StartupDeadline time.Time
+	// AutoLocalPort means the operating system chose LocalPort, so it is
+	// checked again before the session binds it.
+	AutoLocalPort bool
+	// Connections, when set, counts the client connections open through
+	// the native forwarder.
+	Connections *atomic.Int64
+	// BytesSent and BytesReceived, when set, count the bytes relayed
+	// through the native forwarder.
+	BytesSent     *atomic.Int64
+	BytesReceived *atomic.Int64
+	// Reconnect, when set, opens a new session after the current one drops.
+	Reconnect *reconnectPolicy
+	// LocalPortHold, when set, keeps the local port and the native
+	// forwarder's listener across the sessions of a reconnecting forward.
+	LocalPortHold *localPortHold
+	// StartPlugin, when set, runs in place of the session plugin, which
+	// binds localPort; tests use it to stand in for a session.
+	StartPlugin func(ctx context.Context, localPort int) error
+}
+
+// forwardLocalPorts returns the local port of each forward cfg asks for:
+// consecutive ports from LocalPort, free ports from LocalPortRange, or
+// ports chosen by the operating system when neither is set.
+func forwardLocalPorts(cfg Config, listen func(int) (net.Listener, error)) ([]int, error) {
+	count := max(cfg.Count, 1)
+	if cfg.SSH || cfg.Pipe {
+		return []int{0}, nil
+	}
+	if cfg.LocalPort == 0 {
+		if strings.TrimSpace(cfg.LocalPortRange) == "" {
+			return pickEphemeralPorts(count, listen)
+		}
+		low, high, err := parsePortRange(cfg.LocalPortRange)
+		if err != nil {
+			return nil, err
+		}
+		return pickPortsFromPool(low, high, count, listen)
+	}
+	ports := make([]int, count)
+	for i := range ports {
+		ports[i] = cfg.LocalPort + i
+	}
+	return ports, nil
+}
+
+// forwardConfigs returns one config per local port. remotePorts, when set,
+// gives each forward its own remote port.
+func forwardConfigs(cfg Config, localPorts, remotePorts []int) []Config {
+	forwards := make([]Config, len(localPorts))
+	for i, port := range localPorts {
+		forwards[i] = cfg
+		forwards[i].LocalPort = port
+		if remotePorts != nil {
+			forwards[i].RemotePort = remotePorts[i]
+		}
+	}
+	return forwards
+}
+
+// runForwards runs the forwards concurrently. A forward that fails is
+// reported and does not stop the others. labels names the forwards;
+// without them they are numbered.
+func runForwards(ctx context.Context, forwards []Config, labels []string, client ssmSessionAPI, limiter *sessionLimiter, events *eventBus, opts forwardOptions) error {
+	errs := make([]error, len(forwards))
+	var wg sync.WaitGroup
+	for i, forwardCfg := range forwards {
+		forwardOpts := opts
+		forwardOpts.Label = fmt.Sprintf("forward-%d", i+1)
+		if labels != nil {
+			forwardOpts.Label = labels[i]
+		}
+		forwardOpts.Isolated = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runForwardReconnecting(ctx, forwardCfg, client, limiter, events, forwardOpts); err != nil {
+				log.Printf("Forward %s on local port %d failed: %v", forwardOpts.Label, forwardCfg.LocalPort, err)
+				errs[i] = fmt.Errorf("%s: %w", forwardOpts.Label, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runForward opens one SSM session and keeps it alive until the plugin
+// exits or ctx is cancelled.
+func runForward(ctx context.Context, cfg Config, client ssmSessionAPI, limiter *sessionLimiter, events *eventBus, opts forwardOptions) error {
+	label := opts.Label
+	if label == "" {
+		label = opts.InstanceID
+	}
+	prefix := ""
+	if opts.Label != "" {
+		prefix = "[" + opts.Label + "] "
+	}
+	emit := func(event lifecycleEvent) {
+		event.Label = opts.Label
+		event.InstanceID = opts.InstanceID
+		events.Emit(event)
+	}
+
+	if !cfg.SSH {
+		if err := checkRemoteAllowed(cfg.RemoteAllowlist, opts.InstanceID, cfg.InstanceName, cfg.RemoteHost, cfg.RemotePort); err != nil {
+			return err
+		}
+		if err := checkRemoteHostSuffix(cfg.RemoteHostSuffixes, cfg.RemoteHost); err != nil {
+			return err
+		}
+	}
+
+	// The startup budget also covers waiting for a free session slot.
+	startCtx, cancelStart := withStartupDeadline(ctx, opts.StartupDeadline)
+	defer cancelStart()
+	releaseSession, err := limiter.Acquire(startCtx, label)
+	err = startupFailure(startCtx, err)
+	if err != nil {
+		// Ctrl-C while waiting for a slot just stops the forward.
+		if interrupted(ctx) {
+			return nil
+		}
+		return fmt.Errorf("failed to start port forwarding: %w", err)
+	}
+	defer releaseSession()
+
+	if opts.AutoLocalPort {
+		port, err := recheckLocalPort(cfg.LocalPort, listenLocalPort)
+		if err != nil {
+			return fmt.Errorf("failed to allocate local port: %w", err)
+		}
+		if port != cfg.LocalPort {
+			log.Printf("%sLocal port %d was taken before the session started, using %d instead", prefix, cfg.LocalPort, port)
+			cfg.LocalPort = port
+		}
+		fmt.Printf("%sForwarding on 127.0.0.1:%d -> %s\n", prefix, cfg.LocalPort, serviceEndpoint{Host: cfg.RemoteHost, Port: cfg.RemotePort})
+	}
+	if opts.LocalPortHold != nil {
+		opts.LocalPortHold.port = cfg.LocalPort
+	}
+
+	// With the native forwarder the plugin binds an internal loopback port
+	// and the tool owns the user-facing one.
+	pluginCfg := cfg
+	if !cfg.SSH && cfg.nativeForwarder() {
+		var listener net.Listener
+		held := opts.LocalPortHold != nil && opts.LocalPortHold.forwarder != nil
+		if !held {
+			listener, err = listenHostPort(cfg.bindAddress(), cfg.LocalPort)
+			if err != nil {
+				return fmt.Errorf("failed to start native forwarder: %w", classifyBindError(cfg.LocalPort, err))
+			}
+			if cfg.ListenBacklog > 0 {
+				if err := setListenBacklog(listener, cfg.ListenBacklog); err != nil {
+					listener.Close()
+					return fmt.Errorf("failed to set listen backlog: %w", err)
+				}
+			}
+		}
+		pluginCfg.LocalPort, err = allocateEphemeralPort()
+		if err != nil {
+			if listener != nil {
+				listener.Close()
+			}
+			return fmt.Errorf("failed to start native forwarder: %w", err)
+		}
+		target := fmt.Sprintf("127.0.0.1:%d", pluginCfg.LocalPort)
+		if held {
+			opts.LocalPortHold.forwarder.retarget(target)
+		} else {
+			forwarder := startNativeForwarder(listener, target, forwarderOptions{
+				ReadTimeout:       cfg.ReadTimeout,
+				WriteTimeout:      cfg.WriteTimeout,
+				AcceptConcurrency: cfg.AcceptConcurrency,
+				AllowedClients:    cfg.allowedClients(),
+				Active:            opts.Connections,
+				Sent:              opts.BytesSent,
+				Received:          opts.BytesReceived,
+			})
+			// A held forwarder is closed once the forward stops reconnecting.
+			if opts.LocalPortHold != nil {
+				opts.LocalPortHold.forwarder = forwarder
+			} else {
+				defer forwarder.Close()
+			}
+		}
+	}
+	// With --pipe the plugin binds a loopback port only the relay uses.
+	if cfg.Pipe {
+		pluginCfg.LocalPort, err = allocateEphemeralPort()
+		if err != nil {
+			return fmt.Errorf("failed to allocate local port: %w", err)
+		}
+	}
+
+	sessionResponse, err := startPortForwarding(startCtx, client, opts.InstanceID, opts.DocumentName, pluginCfg.sessionParameters(), sessionReason(cfg, user.Current, os.Hostname))
+	err = startupFailure(startCtx, err)
+	if err != nil {
+		if interrupted(ctx) {
+			return nil
+		}
+		return fmt.Errorf("failed to start port forwarding: %w", err)
+	}
+	sessionID := aws.ToString(sessionResponse.SessionId)
+
+	// In SSH and pipe mode stdout carries the tunneled stream, so status
+	// goes to stderr.
+	var statusOut io.Writer = os.Stdout
+	keepAliveStrategy, err := cfg.keepAliveStrategy()
+	if err != nil {
+		return err
+	}
+	if cfg.SSH || cfg.Pipe {
+		statusOut = os.Stderr
+	}
+	if cfg.SSH || cfg.Pipe || !cfg.keepAliveEnabled() {
+		keepAliveStrategy = noneKeepAlive{}
+	}
+	keepAliveInterval := cfg.keepAliveInterval()
+	report := func(err error) {
+		if err != nil {
+			emit(lifecycleEvent{Type: eventKeepAliveFailed, SessionID: sessionID, LocalPort: cfg.LocalPort, Error: err.Error()})
+		}
+	}
+	if cfg.Monitor {
+		keepAliveStrategy, err = cfg.monitorStrategy()
+		if err != nil {
+			return err
+		}
+		keepAliveInterval = cfg.monitorInterval()
+		// Sustained failure ends the session like Ctrl-C would, and the
+		// cause is returned once it is down.
+		var stopMonitor context.CancelCauseFunc
+		ctx, stopMonitor = context.WithCancelCause(ctx)
+		defer stopMonitor(nil)
+		monitor := &probeMonitor{limit: cfg.monitorFailures()}
+		keepAliveReport := report
+		report = func(err error) {
+			keepAliveReport(err)
+			changed, failed := monitor.record(err)
+			if changed && err == nil {
+				log.Printf("%sMonitor: %s is up", prefix, serviceEndpoint{Host: cfg.RemoteHost, Port: cfg.RemotePort})
+				emit(lifecycleEvent{Type: eventProbeUp, SessionID: sessionID, LocalPort: cfg.LocalPort})
+			} else if changed {
+				log.Printf("%sMonitor: %s is down: %v", prefix, serviceEndpoint{Host: cfg.RemoteHost, Port: cfg.RemotePort}, err)
+				emit(lifecycleEvent{Type: eventProbeDown, SessionID: sessionID, LocalPort: cfg.LocalPort, Error: err.Error()})
+			}
+			if failed != nil {
+				stopMonitor(failed)
+			}
+		}
+	}
+	wake, unsubscribeWake := opts.Wake.Subscribe()
+	defer unsubscribeWake()
+	local := newLocalHost(cfg)
+	keepAliveFn := newKeepAliveFunc(keepAliveStrategy, keepAliveInterval, local, wake, report)
+	if opts.Label != "" {
+		fmt.Fprintf(statusOut, "%sPort forwarding session started on local port %d.\n", prefix, cfg.LocalPort)
+	} else {
+		fmt.Fprintln(statusOut, "Port forwarding session started.\nPress Ctrl-C to terminate.")
+	}
+	emit(lifecycleEvent{Type: eventSessionStarted, SessionID: sessionID, LocalPort: cfg.LocalPort})
+	if opts.OutputAWSEnv {
+		fmt.Fprint(statusOut, formatAWSEnv(cfg, opts.InstanceID, sessionID))
+	}
+
+	ssmEndpoint := cfg.ssmEndpoint()
+
+	if cfg.Pipe {
+		// The relay ending, on either side, ends the session.
+		var stopPipe context.CancelCauseFunc
+		ctx, stopPipe = context.WithCancelCause(ctx)
+		defer stopPipe(nil)
+		go func() {
+			stopPipe(runPipe(ctx, pluginCfg.LocalPort, clampToDeadline(30*time.Second, opts.StartupDeadline, time.Now()), os.Stdin, os.Stdout))
+		}()
+	}
+
+	if !cfg.SSH && !cfg.Pipe && (opts.OpenInBrowser || opts.WatchReady || cfg.ConnectRetries > 0) {
+		go func() {
+			readyTimeout := clampToDeadline(30*time.Second, opts.StartupDeadline, time.Now())
+			if err := waitForLocalPort(ctx, local, cfg.LocalPort, readyTimeout, 250*time.Millisecond, cfg.ConnectRetries); err != nil {
+				if opts.OpenInBrowser {
+					log.Printf("%sNot opening browser: %v", prefix, err)
+				} else if cfg.ConnectRetries > 0 && ctx.Err() == nil {
+					log.Printf("%sLocal port not ready: %v", prefix, err)
+				}
+				return
+			}
+			if cfg.ConnectRetries > 0 {
+				fmt.Fprintf(statusOut, "%sLocal port %d is accepting connections.\n", prefix, cfg.LocalPort)
+			}
+			emit(lifecycleEvent{Type: eventTunnelReady, SessionID: sessionID, LocalPort: cfg.LocalPort})
+			if !opts.OpenInBrowser {
+				return
+			}
+			url := fmt.Sprintf("%s://localhost:%d", strings.ToLower(strings.TrimSpace(cfg.Protocol)), cfg.LocalPort)
+			if err := openBrowserURL(url); err != nil {
+				log.Printf("%sNot opening browser: %v", prefix, err)
+			}
+		}()
+	}
+
+	// Keep-alive probes go straight to the plugin's port, so with the native
+	// forwarder they never show up as client connections on the relay.
+	err = runSessionLifecycle(
+		ctx,
+		pluginCfg.LocalPort,
+		sessionID,
+		func() error {
+			if opts.StartPlugin != nil {
+				return opts.StartPlugin(ctx, pluginCfg.LocalPort)
+			}
+			// A plugin process needs the tool's stdin and stdout in SSH
+			// mode, where they carry the tunneled stream.
+			var stdin io.Reader
+			stdout := statusOut
+			if cfg.SSH {
+				stdin, stdout = os.Stdin, os.Stdout
+			}
+			var err error
+			if opts.Isolated {
+				err = startSessionManagerPluginProcess(ctx, sessionResponse, cfg.Region, cfg.Profile, opts.InstanceID, ssmEndpoint, stdin, stdout, prefix)
+			} else {
+				err = startSessionManagerPluginBuiltin(sessionResponse, cfg.Region, cfg.Profile, opts.InstanceID, ssmEndpoint)
+			}
+			if err == nil || !cfg.PluginFallback || ctx.Err() != nil {
+				return err
+			}
+			log.Printf("%sEmbedded session plugin failed, falling back to %s: %v", prefix, externalPluginName, err)
+			return startSessionManagerPluginExternal(ctx, sessionResponse, cfg.Region, cfg.Profile, opts.InstanceID, ssmEndpoint, stdin, stdout, prefix)
+		},
+		func(ctx context.Context, sessionID string) error {
+			return terminateSessionOnShutdown(ctx, client, sessionID, prefix)
+		},
+		keepAliveFn,
+	)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMonitorFailed) || errors.Is(cause, ErrPipeFailed) {
+		err = cause
+	}
+	ended := lifecycleEvent{Type: eventSessionEnded, SessionID: sessionID}
+	if err != nil {
+		ended.Error = err.Error()
+	}
+	emit(ended)
+	return err
+}
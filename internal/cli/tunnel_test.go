@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestForwardLocalPorts(t *testing.T) {
+	t.Parallel()
+
+	listen := func(int) (net.Listener, error) {
+		return net.Listen("tcp", "127.0.0.1:0")
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []int
+	}{
+		{name: "single forward", cfg: Config{LocalPort: 5432}, want: []int{5432}},
+		{name: "count from local port", cfg: Config{LocalPort: 6000, Count: 3}, want: []int{6000, 6001, 6002}},
+		{name: "count from pool", cfg: Config{LocalPortRange: "7000-7100", Count: 2}, want: []int{7000, 7001}},
+		{name: "ssh mode", cfg: Config{SSH: true}, want: []int{0}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := forwardLocalPorts(tt.cfg, listen)
+			if err != nil {
+				t.Fatalf("forwardLocalPorts() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ports = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardLocalPortsEphemeral(t *testing.T) {
+	t.Parallel()
+
+	ports, err := forwardLocalPorts(Config{Count: 3}, listenLocalPort)
+	if err != nil {
+		t.Fatalf("forwardLocalPorts() unexpected error: %v", err)
+	}
+	if len(ports) != 3 || ports[0] == ports[1] || ports[1] == ports[2] || ports[0] == ports[2] {
+		t.Fatalf("expected 3 distinct ports, got %v", ports)
+	}
+}
+
+func TestForwardConfigs(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{RemoteHost: "localhost", RemotePort: 80}
+	forwards := forwardConfigs(cfg, []int{6000, 6001}, []int{5432, 9090})
+	if len(forwards) != 2 || forwards[0].LocalPort != 6000 || forwards[0].RemotePort != 5432 || forwards[1].LocalPort != 6001 || forwards[1].RemotePort != 9090 {
+		t.Fatalf("unexpected forwards: %+v", forwards)
+	}
+
+	forwards = forwardConfigs(cfg, []int{6000, 6001}, nil)
+	if forwards[1].LocalPort != 6001 || forwards[1].RemotePort != 80 {
+		t.Fatalf("unexpected forwards: %+v", forwards)
+	}
+}
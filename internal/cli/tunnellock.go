@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// tunnelLockHost is the address forwards listen on.
+	tunnelLockHost = "127.0.0.1"
+	// replaceStopTimeout is how long --replace waits for the other tunnel
+	// to exit.
+	replaceStopTimeout = 10 * time.Second
+	// tunnelLockGrace is how long a tunnel may take to bind its port after
+	// taking the lock, for example while StartSession runs.
+	tunnelLockGrace = time.Minute
+)
+
+var (
+	ErrTunnelAlreadyRunning = errors.New("local port is already forwarded by another aws-go-forward")
+	ErrReplaceTimedOut      = errors.New("existing tunnel did not exit")
+	ErrReplaceUnverified    = errors.New("cannot verify that the process holding the local port is aws-go-forward")
+)
+
+// tunnelLock is what a running tunnel records about itself for each of its
+// local ports.
+type tunnelLock struct {
+	PID        int       `json:"pid"`
+	LocalPort  int       `json:"local_port"`
+	InstanceID string    `json:"instance_id"`
+	Remote     string    `json:"remote"`
+	Started    time.Time `json:"started"`
+	// Executable tells the tunnel apart from another program that got
+	// its process ID after a crash.
+	Executable string `json:"executable,omitempty"`
+}
+
+func (l tunnelLock) String() string {
+	return fmt.Sprintf("pid %d, to %s via %s, since %s", l.PID, l.Remote, l.InstanceID, l.Started.Local().Format(time.DateTime))
+}
+
+// tunnelLocks keeps one lock file per local port in dir.
+type tunnelLocks struct {
+	dir string
+	// alive and stop act on another tunnel's process.
+	alive func(pid int) bool
+	stop  func(pid int) error
+	// executable reports the program pid runs, where the platform tells;
+	// --replace only signals a process it could check.
+	executable func(pid int) (string, error)
+	// listen tells a lock whose process is gone but whose PID was reused
+	// apart from a live tunnel: past the grace period, the port is free.
+	listen func(port int) (net.Listener, error)
+	now    func() time.Time
+}
+
+func newTunnelLocks(dir string) *tunnelLocks {
+	return &tunnelLocks{dir: dir, alive: processAlive, stop: stopProcess, executable: processExecutable, listen: listenLocalPort, now: time.Now}
+}
+
+func defaultTunnelLockDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "aws-go-forward", "tunnels"), nil
+}
+
+func (t *tunnelLocks) path(port int) string {
+	return filepath.Join(t.dir, tunnelLockHost+"-"+strconv.Itoa(port)+".json")
+}
+
+// acquire locks lock.LocalPort for this process. A live tunnel on the port
+// fails with ErrTunnelAlreadyRunning unless replace is set, in which case
+// it is stopped first if it holds the port; one still starting up is only
+// robbed of its lock and fails to bind. Locks left behind by tunnels that
+// are gone are taken over.
+func (t *tunnelLocks) acquire(lock tunnelLock, replace bool) (release func(), err error) {
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create tunnel lock directory: %w", err)
+	}
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+	path := t.path(lock.LocalPort)
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write tunnel lock: %w", err)
+			}
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) || attempt > 0 {
+			return nil, fmt.Errorf("failed to create tunnel lock: %w", err)
+		}
+
+		existing, live := t.holder(path, lock.LocalPort)
+		if live {
+			if !replace {
+				return nil, fmt.Errorf("%w: %d (%s); stop it or use --replace", ErrTunnelAlreadyRunning, lock.LocalPort, existing)
+			}
+			if !t.portFree(lock.LocalPort) {
+				if err := t.replace(existing); err != nil {
+					return nil, err
+				}
+			}
+		}
+		os.Remove(path)
+	}
+}
+
+// holder reads the lock at path and reports whether its tunnel still runs.
+func (t *tunnelLocks) holder(path string, port int) (tunnelLock, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tunnelLock{}, false
+	}
+	var existing tunnelLock
+	if err := json.Unmarshal(data, &existing); err != nil || existing.PID <= 0 || existing.PID == os.Getpid() || !t.alive(existing.PID) {
+		return existing, false
+	}
+	if existing.Executable != "" {
+		if executable, err := t.executable(existing.PID); err == nil && executable != existing.Executable {
+			return existing, false
+		}
+	}
+	if t.now().Sub(existing.Started) < tunnelLockGrace {
+		return existing, true
+	}
+	return existing, !t.portFree(port)
+}
+
+func (t *tunnelLocks) portFree(port int) bool {
+	listener, err := t.listen(port)
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// replace stops the tunnel of existing. A process that cannot be told
+// apart from another program that got its PID is not signalled.
+func (t *tunnelLocks) replace(existing tunnelLock) error {
+	if executable, err := t.executable(existing.PID); err != nil || executable != existing.Executable {
+		return fmt.Errorf("%w: pid %d on local port %d; stop it by hand", ErrReplaceUnverified, existing.PID, existing.LocalPort)
+	}
+	if err := t.stop(existing.PID); err != nil {
+		return fmt.Errorf("failed to stop the tunnel on local port %d (pid %d): %w", existing.LocalPort, existing.PID, err)
+	}
+	deadline := time.Now().Add(replaceStopTimeout)
+	for t.alive(existing.PID) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: pid %d is still running after %s", ErrReplaceTimedOut, existing.PID, replaceStopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+// lockForwards locks the local port of every forward. When one fails, the
+// locks taken so far are released.
+func (t *tunnelLocks) lockForwards(forwards []Config, instanceID string, replace bool) (release func(), err error) {
+	executable, _ := os.Executable()
+	var releases []func()
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	for _, forward := range forwards {
+		releaseOne, err := t.acquire(tunnelLock{
+			PID:        os.Getpid(),
+			LocalPort:  forward.LocalPort,
+			InstanceID: instanceID,
+			Remote:     serviceEndpoint{Host: forward.RemoteHost, Port: forward.RemotePort}.String(),
+			Started:    t.now().UTC(),
+			Executable: executable,
+		}, replace)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, releaseOne)
+	}
+	return release, nil
+}
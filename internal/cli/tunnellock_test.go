@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testTunnelExecutable = "/usr/local/bin/aws-go-forward"
+
+func testTunnelLocks(t *testing.T, alive map[int]bool, portFree bool) *tunnelLocks {
+	t.Helper()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &tunnelLocks{
+		dir:   t.TempDir(),
+		alive: func(pid int) bool { return alive[pid] },
+		stop: func(pid int) error {
+			alive[pid] = false
+			return nil
+		},
+		executable: func(int) (string, error) { return testTunnelExecutable, nil },
+		listen: func(int) (net.Listener, error) {
+			if !portFree {
+				return nil, syscall.EADDRINUSE
+			}
+			return net.Listen("tcp", "127.0.0.1:0")
+		},
+		now: func() time.Time { return now },
+	}
+}
+
+func writeOtherLock(t *testing.T, locks *tunnelLocks, pid int, started time.Time) {
+	t.Helper()
+	data, err := json.Marshal(tunnelLock{PID: pid, LocalPort: 5432, InstanceID: "i-other", Remote: "db.internal:5432", Started: started, Executable: testTunnelExecutable})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(locks.path(5432), data, 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+}
+
+func TestTunnelLocksAcquire(t *testing.T) {
+	t.Parallel()
+
+	const otherPID = 4242
+	tests := []struct {
+		name     string
+		alive    bool
+		portFree bool
+		age      time.Duration
+		replace  bool
+		// otherProgram is what the lock's PID runs, when not the tunnel.
+		otherProgram string
+		// unverified means the lock's program cannot be looked up.
+		unverified  bool
+		wantStopped bool
+		wantErr     error
+	}{
+		{name: "running tunnel", alive: true, age: time.Hour, wantErr: ErrTunnelAlreadyRunning},
+		{name: "starting tunnel", alive: true, portFree: true, age: time.Second, wantErr: ErrTunnelAlreadyRunning},
+		{name: "replace", alive: true, age: time.Hour, replace: true, wantStopped: true},
+		{name: "replace starting tunnel", alive: true, portFree: true, age: time.Second, replace: true},
+		{name: "process gone", age: time.Hour},
+		{name: "process id reused", alive: true, portFree: true, age: time.Hour},
+		{name: "replace unverified tunnel", alive: true, age: time.Hour, replace: true, unverified: true, wantErr: ErrReplaceUnverified},
+		{name: "unverified tunnel", alive: true, age: time.Hour, unverified: true, wantErr: ErrTunnelAlreadyRunning},
+		{name: "process id reused by another program", alive: true, age: time.Second, otherProgram: "/usr/bin/vim", replace: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			alive := map[int]bool{otherPID: tt.alive}
+			locks := testTunnelLocks(t, alive, tt.portFree)
+			if tt.otherProgram != "" {
+				locks.executable = func(int) (string, error) { return tt.otherProgram, nil }
+			}
+			if tt.unverified {
+				locks.executable = func(int) (string, error) { return "", errors.New("no /proc") }
+			}
+			writeOtherLock(t, locks, otherPID, locks.now().Add(-tt.age))
+
+			release, err := locks.lockForwards([]Config{{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}}, "i-1", tt.replace)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if stopped := tt.alive && !alive[otherPID]; stopped != tt.wantStopped {
+				t.Errorf("expected stopped %v, got %v", tt.wantStopped, stopped)
+			}
+			if existing, _ := locks.holder(locks.path(5432), 5432); existing.PID != os.Getpid() || existing.InstanceID != "i-1" {
+				t.Errorf("expected this process to hold the lock, got %+v", existing)
+			}
+			release()
+			if _, err := os.Stat(locks.path(5432)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected the lock to be released, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTunnelLocksLockForwardsReleasesOnFailure(t *testing.T) {
+	t.Parallel()
+
+	const otherPID = 4242
+	locks := testTunnelLocks(t, map[int]bool{otherPID: true}, false)
+	writeOtherLock(t, locks, otherPID, locks.now().Add(-time.Hour))
+
+	forwards := []Config{{LocalPort: 6379, RemoteHost: "cache", RemotePort: 6379}, {LocalPort: 5432, RemoteHost: "db", RemotePort: 5432}}
+	if _, err := locks.lockForwards(forwards, "i-1", false); !errors.Is(err, ErrTunnelAlreadyRunning) {
+		t.Fatalf("expected %v, got %v", ErrTunnelAlreadyRunning, err)
+	}
+	if _, err := os.Stat(locks.path(6379)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the first lock to be released, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// processAlive probes pid with signal 0; EPERM still means it exists.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// stopProcess asks pid to shut down as on Ctrl-C, so it closes its session.
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
+}
+
+// processExecutable reads the program pid runs from /proc on Linux and
+// from ps on macOS, whose comm column is the full path. Other systems are
+// not checked.
+func processExecutable(pid int) (string, error) {
+	switch runtime.GOOS {
+	case "linux":
+		path, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+		if err != nil {
+			return "", err
+		}
+		// A binary replaced by an upgrade is still the same tunnel.
+		return strings.TrimSuffix(path, " (deleted)"), nil
+	case "darwin":
+		out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	default:
+		return "", fmt.Errorf("cannot look up the executable of a process on %s", runtime.GOOS)
+	}
+}
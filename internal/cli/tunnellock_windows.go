@@ -0,0 +1,46 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procQueryFullProcessImageName = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryFullProcessImageNameW")
+
+// processAlive reports whether pid can be opened.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// stopProcess kills pid: Windows cannot deliver SIGTERM to another process.
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// processExecutable asks Windows for the full path of the program pid runs.
+func processExecutable(pid int) (string, error) {
+	const processQueryLimitedInformation = 0x1000
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer syscall.CloseHandle(handle)
+	buf := make([]uint16, 1<<15)
+	size := uint32(len(buf))
+	if r, _, err := procQueryFullProcessImageName.Call(uintptr(handle), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", err
+	}
+	return syscall.UTF16ToString(buf[:size]), nil
+}